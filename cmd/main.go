@@ -7,11 +7,17 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"time"
 
+	"auth-rest-api/internal/breached"
+	"auth-rest-api/internal/emailaddr"
 	"auth-rest-api/internal/handler"
+	"auth-rest-api/internal/mailer"
+	"auth-rest-api/internal/models"
 	"auth-rest-api/internal/server"
 	"auth-rest-api/internal/service"
 	"auth-rest-api/internal/store"
+	"auth-rest-api/internal/store/sqlstore"
 )
 
 func main() {
@@ -24,7 +30,10 @@ func main() {
 		return
 	}
 
-	newHTTPHandler(app)
+	if err = newHTTPHandler(ctx, app); err != nil {
+		app.Logger.LogAttrs(ctx, slog.LevelError, "failed to create handlers", slog.Any("error", err))
+		return
+	}
 
 	srvErr := make(chan error, 1)
 	go func() {
@@ -53,20 +62,148 @@ func main() {
 	app.Logger.LogAttrs(ctx, slog.LevelInfo, "application is shut down", slog.String("name", app.Name))
 }
 
-func newHTTPHandler(app *server.Server) {
-	st := store.New(app.DB.Client)
-	svc := service.New(st)
+func newHTTPHandler(ctx context.Context, app *server.Server) error {
+	keys, err := service.KeysFromEnv()
+	if err != nil {
+		return err
+	}
+
+	mail, err := mailer.FromEnv(app.Logger)
+	if err != nil {
+		return err
+	}
+
+	opts := []service.Opts{service.WithKeys(keys), service.WithMailer(mail)}
+
+	// the dump stays open for the life of the process
+	if path := os.Getenv("BREACHED_PASSWORDS_FILE"); path != "" {
+		dump, err := breached.Open(path)
+		if err != nil {
+			return err
+		}
+
+		opts = append(opts, service.WithBreachChecker(dump))
+	}
+
+	if path := os.Getenv("EMAIL_BLOCKLIST_FILE"); path != "" {
+		blocklist, err := emailaddr.LoadBlocklist(path)
+		if err != nil {
+			return err
+		}
+
+		app.Logger.LogAttrs(ctx, slog.LevelInfo, "email blocklist loaded", slog.Int("domains", blocklist.Len()))
+
+		opts = append(opts, service.WithEmailBlocklist(blocklist))
+	}
+
+	st, err := newStore(ctx, app)
+	if err != nil {
+		return err
+	}
+
+	// rotated keys are kept in the store, restarts and every replica share them
+	if err := keys.Load(ctx, st, service.GetEnvAsDuration("JWT_KEY_SYNC_INTERVAL", time.Minute)); err != nil {
+		return err
+	}
+
+	err = keys.StartRotation(ctx, service.GetEnvAsDuration("JWT_ROTATION_INTERVAL", 0), func(err error) {
+		app.Logger.LogAttrs(ctx, slog.LevelError, "key ring sync or rotation failed", slog.String("error", err.Error()))
+	})
+	if err != nil {
+		return err
+	}
+
+	svc := service.New(st, opts...)
 	h := handler.New(svc)
 
-	app.Mux.HandleFunc("POST /signup", server.Chain(h.SignUp, server.AddCorrelation()))
-	app.Mux.HandleFunc("POST /signin", server.Chain(h.SignIn, server.AddCorrelation()))
-	app.Mux.HandleFunc("POST /refresh", server.Chain(h.RefreshToken, server.AddCorrelation(), server.AuthMiddleware()))
-	app.Mux.HandleFunc("POST /revoke", server.Chain(h.RevokeToken, server.AddCorrelation(), server.AuthMiddleware()))
+	// users are looked up by the normalized email, addresses stored before normalization or before a
+	// change of the alias settings are moved to it
+	moved, err := svc.NormalizeEmails(context.WithValue(ctx, server.Logger, app.Logger))
+	if err != nil {
+		return err
+	}
+
+	app.Logger.LogAttrs(ctx, slog.LevelInfo, "stored emails normalized", slog.Int("moved", moved))
+
+	// key rotation and role grants stay behind the operator key: the first admin is assigned with it and an
+	// admin token can not grant itself more access, the user admin routes need the admin role
+	adminKey := server.RequireAPIKey(os.Getenv("ADMIN_API_KEY"))
+
+	// limits are counted per route, they come first in Chain to see the client and the claims
+	// without Redis every replica counts on its own
+	var limiter server.RateLimiter = server.NewMemoryRateLimiter()
+	if app.DB.Client != nil {
+		limiter = server.NewRedisRateLimiter(app.DB.Client)
+	}
+
+	signInLimit := server.RateLimit(limiter, server.RateLimitFromEnv("RATE_LIMIT_SIGNIN", "10/1m sliding-window", server.KeyByIP))
+	mailLimit := server.RateLimit(limiter, server.RateLimitFromEnv("RATE_LIMIT_MAIL", "5/15m sliding-window", server.KeyByIP))
+	userLimit := server.RateLimit(limiter, server.RateLimitFromEnv("RATE_LIMIT_USER", "120/1m", server.KeyByUser))
+
+	app.Mux.HandleFunc("POST /signup", server.Chain(h.SignUp, mailLimit, server.AddCorrelation()))
+	app.Mux.HandleFunc("POST /signin", server.Chain(h.SignIn, signInLimit, server.AddCorrelation()))
+	app.Mux.HandleFunc("POST /signin/mfa", server.Chain(h.SignInMFA, signInLimit, server.AddCorrelation()))
+	app.Mux.HandleFunc("POST /signin/magic-link", server.Chain(h.RequestMagicLink, mailLimit, server.AddCorrelation()))
+	app.Mux.HandleFunc("POST /signin/magic-link/verify", server.Chain(h.VerifyMagicLink, signInLimit, server.AddCorrelation()))
+	app.Mux.HandleFunc("POST /signin/passkey/begin", server.Chain(h.BeginPasskeySignIn, signInLimit, server.AddCorrelation()))
+	app.Mux.HandleFunc("POST /signin/passkey/finish", server.Chain(h.FinishPasskeySignIn, signInLimit, server.AddCorrelation()))
+	app.Mux.HandleFunc("POST /verify-email", server.Chain(h.VerifyEmail, signInLimit, server.AddCorrelation()))
+	app.Mux.HandleFunc("POST /verify-email/resend", server.Chain(h.ResendVerification, mailLimit, server.AddCorrelation()))
+	app.Mux.HandleFunc("POST /password/forgot", server.Chain(h.ForgotPassword, mailLimit, server.AddCorrelation()))
+	app.Mux.HandleFunc("POST /password/reset", server.Chain(h.ResetPassword, signInLimit, server.AddCorrelation()))
+	app.Mux.HandleFunc("POST /refresh", server.Chain(h.RefreshToken, signInLimit, server.AddCorrelation(),
+		server.AuthMiddleware(svc.VerifyAccessToken)))
+	app.Mux.HandleFunc("POST /revoke", server.Chain(h.RevokeToken, signInLimit, server.AddCorrelation()))
+	app.Mux.HandleFunc("GET /sessions", server.Chain(h.ListSessions, userLimit, server.AddCorrelation(),
+		server.AuthMiddleware(svc.VerifyAccessToken)))
+	app.Mux.HandleFunc("DELETE /sessions/{id}", server.Chain(h.RevokeSession, userLimit, server.AddCorrelation(),
+		server.AuthMiddleware(svc.VerifyAccessToken)))
+	app.Mux.HandleFunc("DELETE /sessions", server.Chain(h.RevokeAllSessions, userLimit, server.AddCorrelation(),
+		server.AuthMiddleware(svc.VerifyAccessToken)))
+	app.Mux.HandleFunc("GET /me", server.Chain(h.GetProfile, userLimit, server.AddCorrelation(),
+		server.AuthMiddleware(svc.VerifyAccessToken)))
+	app.Mux.HandleFunc("PATCH /me", server.Chain(h.UpdateProfile, userLimit, server.AddCorrelation(),
+		server.AuthMiddleware(svc.VerifyAccessToken)))
+	app.Mux.HandleFunc("POST /me/password", server.Chain(h.ChangePassword, userLimit, server.AddCorrelation(),
+		server.AuthMiddleware(svc.VerifyAccessToken)))
+	app.Mux.HandleFunc("POST /me/email", server.Chain(h.ChangeEmail, userLimit, server.AddCorrelation(),
+		server.AuthMiddleware(svc.VerifyAccessToken)))
+	app.Mux.HandleFunc("POST /mfa/totp/enroll", server.Chain(h.EnrollTOTP, userLimit, server.AddCorrelation(),
+		server.AuthMiddleware(svc.VerifyAccessToken)))
+	app.Mux.HandleFunc("POST /mfa/totp/confirm", server.Chain(h.ConfirmTOTP, userLimit, server.AddCorrelation(),
+		server.AuthMiddleware(svc.VerifyAccessToken)))
+	app.Mux.HandleFunc("POST /passkeys/register/begin", server.Chain(h.BeginPasskeyRegistration, userLimit, server.AddCorrelation(),
+		server.AuthMiddleware(svc.VerifyAccessToken)))
+	app.Mux.HandleFunc("POST /passkeys/register/finish", server.Chain(h.FinishPasskeyRegistration, userLimit, server.AddCorrelation(),
+		server.AuthMiddleware(svc.VerifyAccessToken)))
+	app.Mux.HandleFunc("POST /introspect", server.Chain(h.Introspect, server.AddCorrelation(),
+		server.RequireClientCredentials(server.ParseClients(os.Getenv("INTROSPECTION_CLIENTS")))))
+	app.Mux.HandleFunc("GET /.well-known/jwks.json", server.Chain(h.JWKS, server.AddCorrelation()))
+	app.Mux.HandleFunc("POST /admin/keys/rotate", server.Chain(h.RotateKeys, server.AddCorrelation(), adminKey))
+	app.Mux.HandleFunc("GET /admin/users", server.Chain(h.ListUsers, userLimit, server.AddCorrelation(),
+		server.RequireRole(models.RoleAdmin), server.AuthMiddleware(svc.VerifyAccessToken)))
+	app.Mux.HandleFunc("GET /admin/users/{id}", server.Chain(h.GetUser, userLimit, server.AddCorrelation(),
+		server.RequireRole(models.RoleAdmin), server.AuthMiddleware(svc.VerifyAccessToken)))
+	app.Mux.HandleFunc("PATCH /admin/users/{id}", server.Chain(h.UpdateUser, userLimit, server.AddCorrelation(),
+		server.RequireRole(models.RoleAdmin), server.AuthMiddleware(svc.VerifyAccessToken)))
+	app.Mux.HandleFunc("DELETE /admin/users/{id}", server.Chain(h.DeleteUser, userLimit, server.AddCorrelation(),
+		server.RequireRole(models.RoleAdmin), server.AuthMiddleware(svc.VerifyAccessToken)))
+	app.Mux.HandleFunc("POST /admin/users/{id}/disable", server.Chain(h.DisableUser, userLimit, server.AddCorrelation(),
+		server.RequireRole(models.RoleAdmin), server.AuthMiddleware(svc.VerifyAccessToken)))
+	app.Mux.HandleFunc("POST /admin/users/{id}/logout", server.Chain(h.LogoutUser, userLimit, server.AddCorrelation(),
+		server.RequireRole(models.RoleAdmin), server.AuthMiddleware(svc.VerifyAccessToken)))
+	app.Mux.HandleFunc("GET /admin/users/{id}/access", server.Chain(h.GetUserAccess, server.AddCorrelation(), adminKey))
+	app.Mux.HandleFunc("PUT /admin/users/{id}/roles/{role}", server.Chain(h.AssignRole, server.AddCorrelation(), adminKey))
+	app.Mux.HandleFunc("DELETE /admin/users/{id}/roles/{role}", server.Chain(h.RemoveRole, server.AddCorrelation(), adminKey))
+	app.Mux.HandleFunc("PUT /admin/users/{id}/permissions/{permission}", server.Chain(h.GrantPermission, server.AddCorrelation(),
+		adminKey))
+	app.Mux.HandleFunc("DELETE /admin/users/{id}/permissions/{permission}", server.Chain(h.RevokePermission, server.AddCorrelation(),
+		adminKey))
 
 	app.Mux.HandleFunc("GET /health", func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
 
-		if err := app.DB.Client.Ping(context.Background()); err != nil {
+		if err := app.DB.Ping(context.Background()); err != nil {
 			app.Health = &server.Health{
 				Status:   "Down",
 				DBStatus: "Down",
@@ -101,4 +238,32 @@ func newHTTPHandler(app *server.Server) {
 		w.Header().Set("Content-Type", "application/json")
 		_, _ = w.Write(data)
 	})
+
+	return nil
+}
+
+// newStore returns the store of STORE_DRIVER, the SQL schema is migrated before the first request
+func newStore(ctx context.Context, app *server.Server) (service.Storer, error) {
+	var dialect sqlstore.Dialect
+
+	switch app.DB.Driver {
+	case server.DriverPostgres:
+		dialect = sqlstore.Postgres
+	case server.DriverSQLite:
+		dialect = sqlstore.SQLite
+	default:
+		return store.New(app.DB.Client), nil
+	}
+
+	st := sqlstore.New(app.DB.SQL, dialect)
+	if err := st.Migrate(ctx); err != nil {
+		return nil, err
+	}
+
+	// expired rows are skipped by every read, the cleanup only keeps the tables small
+	st.StartCleanup(ctx, service.GetEnvAsDuration("STORE_CLEANUP_INTERVAL", 10*time.Minute), func(err error) {
+		app.Logger.LogAttrs(ctx, slog.LevelError, "store cleanup failed", slog.String("error", err.Error()))
+	})
+
+	return st, nil
 }
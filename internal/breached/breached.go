@@ -0,0 +1,97 @@
+package breached
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1" //nolint:gosec // the dumps are indexed by SHA-1, it is not used to protect anything
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"strings"
+)
+
+// File looks passwords up in a local copy of a breached password dump like the one of Have I Been
+// Pwned, one "SHA1:COUNT" line per password sorted by hash. The sort order indexes the file by hash
+// prefix, a lookup is a binary search over byte offsets and never loads the file.
+type File struct {
+	file *os.File
+	size int64
+}
+
+// Open opens the dump at path, it has to be sorted by hash ("ordered by hash" in the HIBP downloader)
+func Open(path string) (*File, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return &File{file: f, size: info.Size()}, nil
+}
+
+func (f *File) Close() error {
+	return f.file.Close()
+}
+
+// IsBreached reports whether password is in the dump
+func (f *File) IsBreached(_ context.Context, password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	target := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	// smallest offset whose following line holds a hash >= target
+	lo, hi := int64(0), f.size
+
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+
+		hash, err := f.hashFrom(mid)
+		if err != nil {
+			return false, err
+		}
+
+		if hash != "" && hash < target {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+
+	hash, err := f.hashFrom(lo)
+	if err != nil {
+		return false, err
+	}
+
+	return hash == target, nil
+}
+
+// hashFrom returns the hash of the first line starting at or after off, empty past the last line
+func (f *File) hashFrom(off int64) (string, error) {
+	start := max(off-1, 0)
+	r := bufio.NewReaderSize(io.NewSectionReader(f.file, start, f.size-start), 128)
+
+	// the line holding off-1 ends before the wanted one, unless off is the start of the file
+	if off > 0 {
+		if _, err := r.ReadString('\n'); err != nil {
+			if errors.Is(err, io.EOF) {
+				return "", nil
+			}
+
+			return "", err
+		}
+	}
+
+	line, err := r.ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+
+	hash, _, _ := strings.Cut(strings.TrimSpace(line), ":")
+
+	return strings.ToUpper(hash), nil
+}
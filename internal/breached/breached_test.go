@@ -0,0 +1,84 @@
+package breached
+
+import (
+	"context"
+	"crypto/sha1" //nolint:gosec // matches the dump format
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeDump(t *testing.T, passwords ...string) string {
+	t.Helper()
+
+	lines := make([]string, 0, len(passwords))
+
+	for _, p := range passwords {
+		sum := sha1.Sum([]byte(p))
+		lines = append(lines, strings.ToUpper(hex.EncodeToString(sum[:]))+":42")
+	}
+
+	sort.Strings(lines)
+
+	path := filepath.Join(t.TempDir(), "pwned-passwords.txt")
+	require.NoError(t, os.WriteFile(path, []byte(strings.Join(lines, "\r\n")+"\r\n"), 0o600))
+
+	return path
+}
+
+func TestFile_IsBreached(t *testing.T) {
+	breached := []string{"password", "123456", "qwerty", "letmein", "iloveyou", "dragon", "monkey", "football", "admin"}
+
+	f, err := Open(writeDump(t, breached...))
+	require.NoError(t, err)
+
+	defer f.Close()
+
+	tests := []struct {
+		password string
+		want     bool
+	}{
+		{password: "password", want: true},
+		{password: "admin", want: true},
+		{password: "football", want: true},
+		{password: "dragon", want: true},
+		{password: "Correct-Horse9", want: false},
+		{password: "", want: false},
+	}
+
+	for i, tt := range tests {
+		got, err := f.IsBreached(context.Background(), tt.password)
+		assert.NoErrorf(t, err, "TEST[%d] Failed - %s", i, tt.password)
+		assert.Equalf(t, tt.want, got, "TEST[%d] Failed - %s", i, tt.password)
+	}
+
+	// every entry is found, whatever its place in the file
+	for _, p := range breached {
+		got, err := f.IsBreached(context.Background(), p)
+		assert.NoError(t, err)
+		assert.Truef(t, got, "%s not found", p)
+	}
+}
+
+func TestFile_IsBreachedEmpty(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "empty.txt")
+	require.NoError(t, os.WriteFile(path, nil, 0o600))
+
+	f, err := Open(path)
+	require.NoError(t, err)
+
+	defer f.Close()
+
+	got, err := f.IsBreached(context.Background(), "password")
+	assert.NoError(t, err)
+	assert.False(t, got)
+
+	_, err = Open(filepath.Join(t.TempDir(), "missing.txt"))
+	assert.Error(t, err)
+}
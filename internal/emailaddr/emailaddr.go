@@ -0,0 +1,335 @@
+package emailaddr
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/idna"
+)
+
+const (
+	maxLocalLength   = 64
+	maxDomainLength  = 253
+	maxAddressLength = 254
+)
+
+var ErrInvalid = errors.New("invalid email address")
+
+// special characters allowed in an atom besides letters and digits (RFC 5322 atext)
+const atextSpecials = "!#$%&'*+-/=?^_`{|}~"
+
+// Address is a parsed addr-spec, the local part is kept as written and the domain in lowercase ASCII
+type Address struct {
+	Local  string
+	Domain string
+}
+
+// Parse reads an RFC 5322 addr-spec, "local@domain" without display name, comments or folding white
+// space. The local part is a dot-atom or a quoted string and may hold UTF-8 (RFC 6532), internationalized
+// domains are converted to punycode. Domain literals like [192.0.2.1] and single label domains are
+// refused, they do not name a mailbox a user signs up with.
+func Parse(s string) (Address, error) {
+	s = strings.TrimSpace(s)
+
+	at := strings.LastIndexByte(s, '@')
+	if at < 0 {
+		return Address{}, fmt.Errorf("%w: missing @", ErrInvalid)
+	}
+
+	local, err := parseLocal(s[:at])
+	if err != nil {
+		return Address{}, err
+	}
+
+	domain, err := parseDomain(s[at+1:])
+	if err != nil {
+		return Address{}, err
+	}
+
+	if len(local)+1+len(domain) > maxAddressLength {
+		return Address{}, fmt.Errorf("%w: longer than %d characters", ErrInvalid, maxAddressLength)
+	}
+
+	return Address{Local: local, Domain: domain}, nil
+}
+
+// Normalize parses s and returns its normalized form
+func Normalize(s string) (string, error) {
+	addr, err := Parse(s)
+	if err != nil {
+		return "", err
+	}
+
+	return addr.Normalized().String(), nil
+}
+
+// Normalized returns the form addresses are compared with: the local part in lowercase, since mailbox
+// providers treat it case insensitively, the domain is lowercase already
+func (a Address) Normalized() Address {
+	a.Local = strings.ToLower(a.Local)
+
+	return a
+}
+
+func (a Address) String() string {
+	return a.Local + "@" + a.Domain
+}
+
+// parseLocal checks a local part, a quoted string that does not need the quotes is returned without them
+func parseLocal(local string) (string, error) {
+	if local == "" {
+		return "", fmt.Errorf("%w: empty local part", ErrInvalid)
+	}
+
+	if len(local) > maxLocalLength {
+		return "", fmt.Errorf("%w: local part longer than %d characters", ErrInvalid, maxLocalLength)
+	}
+
+	if !utf8.ValidString(local) {
+		return "", fmt.Errorf("%w: local part is not UTF-8", ErrInvalid)
+	}
+
+	if !strings.HasPrefix(local, `"`) {
+		if !isDotAtom(local) {
+			return "", fmt.Errorf("%w: local part", ErrInvalid)
+		}
+
+		return local, nil
+	}
+
+	content, ok := unquote(local)
+	if !ok {
+		return "", fmt.Errorf("%w: quoted local part", ErrInvalid)
+	}
+
+	if isDotAtom(content) {
+		return content, nil
+	}
+
+	return local, nil
+}
+
+// unquote returns the content of a quoted string, quoted pairs resolved
+func unquote(s string) (string, bool) {
+	if len(s) < 2 || !strings.HasSuffix(s, `"`) {
+		return "", false
+	}
+
+	var b strings.Builder
+
+	escaped := false
+
+	for _, r := range s[1 : len(s)-1] {
+		switch {
+		case escaped:
+			// quoted-pair is a backslash before a visible character or white space
+			if r < ' ' && r != '\t' || r == 0x7f {
+				return "", false
+			}
+
+			escaped = false
+		case r == '\\':
+			escaped = true
+			continue
+		case r == '"' || r < ' ' && r != '\t' || r == 0x7f:
+			return "", false
+		}
+
+		b.WriteRune(r)
+	}
+
+	return b.String(), !escaped
+}
+
+func isDotAtom(s string) bool {
+	for _, atom := range strings.Split(s, ".") {
+		if atom == "" {
+			return false
+		}
+
+		for _, r := range atom {
+			if !isAtext(r) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+func isAtext(r rune) bool {
+	return r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' ||
+		strings.ContainsRune(atextSpecials, r) || r >= utf8.RuneSelf && r != utf8.RuneError
+}
+
+// parseDomain converts a domain to lowercase punycode and checks it is a host name with a top level domain
+func parseDomain(domain string) (string, error) {
+	if strings.HasPrefix(domain, "[") {
+		return "", fmt.Errorf("%w: domain literals are not supported", ErrInvalid)
+	}
+
+	ascii, err := idna.Lookup.ToASCII(domain)
+	if err != nil {
+		return "", fmt.Errorf("%w: domain: %w", ErrInvalid, err)
+	}
+
+	if ascii == "" || len(ascii) > maxDomainLength {
+		return "", fmt.Errorf("%w: domain", ErrInvalid)
+	}
+
+	labels := strings.Split(ascii, ".")
+	if len(labels) < 2 {
+		return "", fmt.Errorf("%w: domain without top level domain", ErrInvalid)
+	}
+
+	for _, label := range labels {
+		if !isLabel(label) {
+			return "", fmt.Errorf("%w: domain label %q", ErrInvalid, label)
+		}
+	}
+
+	// a numeric top level domain makes it an IP address
+	if strings.Trim(labels[len(labels)-1], "0123456789") == "" {
+		return "", fmt.Errorf("%w: numeric top level domain", ErrInvalid)
+	}
+
+	return ascii, nil
+}
+
+// isLabel checks an LDH label: letters, digits and inner hyphens, at most 63 characters
+func isLabel(label string) bool {
+	if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+		return false
+	}
+
+	for i := 0; i < len(label); i++ {
+		c := label[i]
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-') {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Policy folds aliases of one mailbox into one address, so they count as one account
+type Policy struct {
+	// StripPlus drops the "+tag" of the local part
+	StripPlus bool
+	// FoldDots lists domains ignoring dots in the local part, e.g. gmail.com
+	FoldDots []string
+}
+
+// Canonical applies the policy to a normalized address, quoted local parts are left alone
+func (p Policy) Canonical(addr Address) Address {
+	if strings.HasPrefix(addr.Local, `"`) {
+		return addr
+	}
+
+	if p.StripPlus {
+		// a local part starting with + is not an alias
+		if i := strings.IndexByte(addr.Local, '+'); i > 0 {
+			addr.Local = addr.Local[:i]
+		}
+	}
+
+	for _, domain := range p.FoldDots {
+		if strings.EqualFold(domain, addr.Domain) {
+			if folded := strings.ReplaceAll(addr.Local, ".", ""); folded != "" {
+				addr.Local = folded
+			}
+
+			break
+		}
+	}
+
+	return addr
+}
+
+// Blocklist holds domains, typically of disposable mail providers, a domain blocks its subdomains too
+type Blocklist struct {
+	domains map[string]struct{}
+}
+
+func NewBlocklist(domains ...string) *Blocklist {
+	b := &Blocklist{domains: make(map[string]struct{}, len(domains))}
+
+	for _, d := range domains {
+		b.add(d)
+	}
+
+	return b
+}
+
+// LoadBlocklist reads one domain per line, empty lines and lines starting with # are skipped
+func LoadBlocklist(path string) (*Blocklist, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	b := NewBlocklist()
+	scanner := bufio.NewScanner(f)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			b.add(line)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// Len returns the number of blocked domains
+func (b *Blocklist) Len() int {
+	if b == nil {
+		return 0
+	}
+
+	return len(b.domains)
+}
+
+// Blocked reports whether domain or one of its parent domains is listed, a nil Blocklist blocks nothing
+func (b *Blocklist) Blocked(domain string) bool {
+	if b == nil || len(b.domains) == 0 {
+		return false
+	}
+
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+
+	for {
+		if _, ok := b.domains[domain]; ok {
+			return true
+		}
+
+		_, parent, ok := strings.Cut(domain, ".")
+		if !ok {
+			return false
+		}
+
+		domain = parent
+	}
+}
+
+func (b *Blocklist) add(domain string) {
+	domain = strings.TrimSuffix(strings.TrimSpace(domain), ".")
+
+	// lists may hold internationalized domains, addresses are compared in punycode
+	if ascii, err := idna.Lookup.ToASCII(domain); err == nil {
+		domain = ascii
+	}
+
+	if domain != "" {
+		b.domains[strings.ToLower(domain)] = struct{}{}
+	}
+}
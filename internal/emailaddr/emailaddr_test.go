@@ -0,0 +1,121 @@
+package emailaddr
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name    string
+		email   string
+		want    string
+		wantErr bool
+	}{
+		{name: "plain address", email: "sumit@kumar.com", want: "sumit@kumar.com"},
+		{name: "mixed case and spaces", email: "  Sumit.Kumar@Example.COM ", want: "sumit.kumar@example.com"},
+		{name: "long top level domain", email: "curator@art.museum", want: "curator@art.museum"},
+		{name: "longer top level domain", email: "dev@team.engineering", want: "dev@team.engineering"},
+		{name: "subdomains", email: "a@mail.eu.example.co.uk", want: "a@mail.eu.example.co.uk"},
+		{name: "atext specials", email: "o'brien+news/{x}=1@example.com", want: "o'brien+news/{x}=1@example.com"},
+		{name: "internationalized domain", email: "info@bücher.de", want: "info@xn--bcher-kva.de"},
+		{name: "punycode domain", email: "info@XN--BCHER-KVA.de", want: "info@xn--bcher-kva.de"},
+		{name: "internationalized local part", email: "Пользователь@пример.рф",
+			want: "пользователь@xn--e1afmkfd.xn--p1ai"},
+		{name: "quoted local part", email: `"john doe"@example.com`, want: `"john doe"@example.com`},
+		{name: "needless quotes are dropped", email: `"John.Doe"@example.com`, want: "john.doe@example.com"},
+		{name: "quoted pair", email: `"a\"b@c"@example.com`, want: `"a\"b@c"@example.com`},
+		{name: "missing @", email: "sumit.kumar.com", wantErr: true},
+		{name: "missing domain", email: "sumit@", wantErr: true},
+		{name: "missing local part", email: "@kumar.com", wantErr: true},
+		{name: "single label domain", email: "sumit@kumar", wantErr: true},
+		{name: "leading dot", email: ".sumit@kumar.com", wantErr: true},
+		{name: "double dot", email: "sumit..kumar@kumar.com", wantErr: true},
+		{name: "unquoted space", email: "sumit kumar@kumar.com", wantErr: true},
+		{name: "unquoted @", email: "sumit@kumar@kumar.com", wantErr: true},
+		{name: "unterminated quote", email: `"sumit@kumar.com`, wantErr: true},
+		{name: "underscore in domain", email: "sumit@ku_mar.com", wantErr: true},
+		{name: "hyphen at label end", email: "sumit@kumar-.com", wantErr: true},
+		{name: "numeric top level domain", email: "sumit@192.168.0.1", wantErr: true},
+		{name: "domain literal", email: "sumit@[192.168.0.1]", wantErr: true},
+		{name: "local part too long", email: strings.Repeat("a", 65) + "@kumar.com", wantErr: true},
+		{name: "address too long", email: "abcd@" + strings.Repeat(strings.Repeat("b", 61)+".", 4) + "com", wantErr: true},
+	}
+
+	for i, tt := range tests {
+		got, err := Normalize(tt.email)
+		if tt.wantErr {
+			assert.ErrorIsf(t, err, ErrInvalid, "TEST[%d] Failed - %s", i, tt.name)
+			continue
+		}
+
+		assert.NoErrorf(t, err, "TEST[%d] Failed - %s", i, tt.name)
+		assert.Equalf(t, tt.want, got, "TEST[%d] Failed - %s", i, tt.name)
+	}
+}
+
+func TestPolicy_Canonical(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy Policy
+		email  string
+		want   string
+	}{
+		{name: "no policy", email: "sumit.kumar+news@gmail.com", want: "sumit.kumar+news@gmail.com"},
+		{name: "strip plus", policy: Policy{StripPlus: true}, email: "sumit+news@example.com", want: "sumit@example.com"},
+		{name: "leading plus is kept", policy: Policy{StripPlus: true}, email: "+news@example.com", want: "+news@example.com"},
+		{name: "fold dots", policy: Policy{FoldDots: []string{"gmail.com"}}, email: "sumit.kumar@gmail.com", want: "sumitkumar@gmail.com"},
+		{name: "fold dots of other domain", policy: Policy{FoldDots: []string{"gmail.com"}}, email: "sumit.kumar@example.com",
+			want: "sumit.kumar@example.com"},
+		{name: "both", policy: Policy{StripPlus: true, FoldDots: []string{"GMail.com"}}, email: "s.u.mit+a.b@gmail.com",
+			want: "sumit@gmail.com"},
+		{name: "quoted local part", policy: Policy{StripPlus: true}, email: `"sumit kumar+x"@example.com`,
+			want: `"sumit kumar+x"@example.com`},
+	}
+
+	for i, tt := range tests {
+		addr, err := Parse(tt.email)
+		require.NoErrorf(t, err, "TEST[%d] Failed - %s", i, tt.name)
+
+		assert.Equalf(t, tt.want, tt.policy.Canonical(addr).String(), "TEST[%d] Failed - %s", i, tt.name)
+	}
+}
+
+func TestBlocklist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "disposable.txt")
+	list := "# disposable providers\nmailinator.com\n\n  Trash-Mail.com \nwegwerf-e-mail.de\nmüll.de\n"
+	require.NoError(t, os.WriteFile(path, []byte(list), 0o600))
+
+	b, err := LoadBlocklist(path)
+	require.NoError(t, err)
+	assert.Equal(t, 4, b.Len())
+
+	tests := []struct {
+		domain string
+		want   bool
+	}{
+		{domain: "mailinator.com", want: true},
+		{domain: "MAILINATOR.com", want: true},
+		{domain: "eu.mailinator.com", want: true},
+		{domain: "trash-mail.com", want: true},
+		{domain: "xn--mll-hoa.de", want: true},
+		{domain: "notmailinator.com", want: false},
+		{domain: "com", want: false},
+		{domain: "example.com", want: false},
+	}
+
+	for i, tt := range tests {
+		assert.Equalf(t, tt.want, b.Blocked(tt.domain), "TEST[%d] Failed - %s", i, tt.domain)
+	}
+
+	var none *Blocklist
+	assert.False(t, none.Blocked("mailinator.com"))
+
+	_, err = LoadBlocklist(filepath.Join(t.TempDir(), "missing.txt"))
+	assert.Error(t, err)
+}
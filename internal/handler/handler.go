@@ -5,8 +5,11 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"log/slog"
+	"math"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"auth-rest-api/internal/models"
@@ -15,9 +18,41 @@ import (
 
 type Servicer interface {
 	SignUp(ctx context.Context, user *models.UserReq) error
-	SignIn(ctx context.Context, user *models.UserReq) (string, string, error)
-	RefreshToken(ctx context.Context, accToken, refToken string) (string, string, error)
-	RevokeToken(ctx context.Context, accToken string) error
+	SignIn(ctx context.Context, user *models.UserReq) (*models.UserResp, error)
+	CompleteMFASignIn(ctx context.Context, req *models.MFASignInReq) (*models.UserResp, error)
+	RequestMagicLink(ctx context.Context, email string) error
+	VerifyMagicLink(ctx context.Context, req *models.MagicLinkVerifyReq) (*models.UserResp, error)
+	EnrollTOTP(ctx context.Context) (*models.TOTPEnrollment, error)
+	ConfirmTOTP(ctx context.Context, code string) (*models.RecoveryCodes, error)
+	BeginPasskeyRegistration(ctx context.Context) (*models.PasskeyCeremony, error)
+	FinishPasskeyRegistration(ctx context.Context, req *models.PasskeyRegistrationReq) (*models.Passkey, error)
+	BeginPasskeySignIn(ctx context.Context, mfaToken string) (*models.PasskeyCeremony, error)
+	FinishPasskeySignIn(ctx context.Context, req *models.PasskeySignInReq) (*models.UserResp, error)
+	RefreshToken(ctx context.Context, accToken, refToken, scope string) (*models.UserResp, error)
+	RevokeToken(ctx context.Context, token, tokenTypeHint string) error
+	JWKS(ctx context.Context) *models.JWKSet
+	RotateKeys(ctx context.Context) error
+	Introspect(ctx context.Context, token, tokenTypeHint string) (*models.Introspection, error)
+	ListSessions(ctx context.Context) ([]models.Session, error)
+	RevokeSession(ctx context.Context, sessionID string) error
+	RevokeAllSessions(ctx context.Context) error
+	VerifyEmail(ctx context.Context, token string) error
+	ResendVerification(ctx context.Context, email string) error
+	ForgotPassword(ctx context.Context, email string) error
+	ResetPassword(ctx context.Context, token, password string) error
+	ChangePassword(ctx context.Context, req *models.PasswordChangeReq) error
+	ChangeEmail(ctx context.Context, req *models.EmailChangeReq) error
+	GetProfile(ctx context.Context) (*models.UserData, error)
+	UpdateProfile(ctx context.Context, req *models.ProfileUpdate) (*models.UserData, error)
+	GetUserAccess(ctx context.Context, userID string) (*models.Access, error)
+	GrantAccess(ctx context.Context, userID string, access *models.Access) (*models.Access, error)
+	RevokeAccess(ctx context.Context, userID string, access *models.Access) (*models.Access, error)
+	ListUsers(ctx context.Context, query *models.UserQuery) (*models.UserPage, error)
+	GetUser(ctx context.Context, userID string) (*models.UserData, error)
+	UpdateUser(ctx context.Context, userID string, req *models.AdminUserUpdate) (*models.UserData, error)
+	DeleteUser(ctx context.Context, userID string) error
+	DisableUser(ctx context.Context, userID string) error
+	LogoutUser(ctx context.Context, userID string) error
 }
 
 type Handler struct {
@@ -52,8 +87,8 @@ func (h *Handler) SignUp(w http.ResponseWriter, r *http.Request) {
 			logger.LogAttrs(ctx, slog.LevelError, err.Error())
 			return
 
-		case errors.Is(err, models.ErrBadRequest(err)):
-			respondWithError(w, http.StatusBadRequest, err.Error())
+		case models.IsBadRequest(err):
+			respondWithBadRequest(w, err)
 			logger.LogAttrs(ctx, slog.LevelError, err.Error())
 			return
 
@@ -91,7 +126,7 @@ func (h *Handler) SignIn(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, refToken, err := h.Service.SignIn(ctx, &u)
+	resp, err := h.Service.SignIn(ctx, &u)
 	if err != nil {
 		switch {
 		case errors.Is(err, models.ErrNotFound("user")):
@@ -99,33 +134,71 @@ func (h *Handler) SignIn(w http.ResponseWriter, r *http.Request) {
 			logger.LogAttrs(ctx, slog.LevelError, "user not found", slog.String("email", u.Email))
 			return
 
-		case errors.Is(err, models.ErrBadRequest(err)):
+		case errors.Is(err, models.ErrPsswdNotMatch):
+			respondWithErrorCode(w, http.StatusUnauthorized, "invalid_credentials", err.Error())
+			logger.LogAttrs(ctx, slog.LevelInfo, err.Error(), slog.String("email", u.Email))
+			return
+
+		case errors.Is(err, models.ErrEmailNotVerified):
+			respondWithErrorCode(w, http.StatusForbidden, "email_not_verified", err.Error())
+			logger.LogAttrs(ctx, slog.LevelInfo, err.Error(), slog.String("email", u.Email))
+			return
+
+		case errors.Is(err, models.ErrAccountDisabled):
+			respondWithErrorCode(w, http.StatusForbidden, "account_disabled", err.Error())
+			logger.LogAttrs(ctx, slog.LevelInfo, err.Error(), slog.String("email", u.Email))
+			return
+
+		case errors.Is(err, models.ErrAccountLocked):
+			respondWithErrorCode(w, http.StatusLocked, "account_locked", err.Error())
+			logger.LogAttrs(ctx, slog.LevelInfo, err.Error(), slog.String("email", u.Email))
+			return
+
+		case errors.Is(err, models.ErrSignInLocked):
+			setRetryAfter(w, err)
+			respondWithErrorCode(w, http.StatusLocked, "signin_locked", err.Error())
+			logger.LogAttrs(ctx, slog.LevelInfo, err.Error(), slog.String("email", u.Email))
+			return
+
+		case errors.Is(err, models.ErrTooManyAttempts):
+			setRetryAfter(w, err)
+			respondWithErrorCode(w, http.StatusTooManyRequests, "too_many_attempts", err.Error())
+			logger.LogAttrs(ctx, slog.LevelInfo, err.Error(), slog.String("email", u.Email))
+			return
+
+		case errors.Is(err, models.ErrInvalidScope):
+			respondWithErrorCode(w, http.StatusBadRequest, "invalid_scope", err.Error())
+			return
+
+		case models.IsBadRequest(err):
 			respondWithError(w, http.StatusBadRequest, err.Error())
 			logger.LogAttrs(ctx, slog.LevelError, err.Error())
 			return
 
 		default:
-			respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("failed to sign up - %s", err.Error()))
+			respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("failed to sign in - %s", err.Error()))
 			logger.LogAttrs(ctx, slog.LevelError, err.Error())
 			return
 		}
 	}
 
-	resp := models.UserResp{Email: u.Email, AccessToken: token, RefreshToken: refToken}
+	// the password was right but a second factor is needed, the client continues at /signin/mfa
+	if resp.MFAToken != "" {
+		respondWithJSON(w, http.StatusAccepted, resp)
+		logger.LogAttrs(ctx, slog.LevelInfo, "mfa challenge issued", slog.String("email", u.Email))
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-
-	if err := json.NewEncoder(w).Encode(resp); err != nil {
-		http.Error(w, "Failed to write response", http.StatusInternalServerError)
+		return
 	}
 
+	respondWithJSON(w, http.StatusCreated, resp)
+
 	logger.LogAttrs(ctx, slog.LevelInfo, "user signed in", slog.String("email", u.Email))
 }
 
 func (h *Handler) RefreshToken(w http.ResponseWriter, r *http.Request) {
 	var t = struct {
 		Token string `json:"refreshToken"`
+		Scope string `json:"scope"`
 	}{}
 
 	ctx := r.Context()
@@ -146,8 +219,29 @@ func (h *Handler) RefreshToken(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	newAccessToken, newRefreshToken, err := h.Service.RefreshToken(ctx, token, t.Token)
+	resp, err := h.Service.RefreshToken(ctx, token, t.Token, t.Scope)
 	if err != nil {
+		if errors.Is(err, models.ErrRefreshTokenReuse) {
+			respondWithErrorCode(w, http.StatusUnauthorized, "refresh_token_reused", "failed to refresh token - "+err.Error())
+			logger.LogAttrs(ctx, slog.LevelWarn, err.Error())
+			return
+		}
+
+		if errors.Is(err, models.ErrInvalidScope) {
+			respondWithErrorCode(w, http.StatusBadRequest, "invalid_scope", err.Error())
+			return
+		}
+
+		if errors.Is(err, models.ErrAccountDisabled) {
+			respondWithErrorCode(w, http.StatusForbidden, "account_disabled", err.Error())
+			return
+		}
+
+		if errors.Is(err, models.ErrAccountLocked) {
+			respondWithErrorCode(w, http.StatusLocked, "account_locked", err.Error())
+			return
+		}
+
 		respondWithError(w, http.StatusUnauthorized, fmt.Sprintf("failed to refresh token - %s", err.Error()))
 		logger.LogAttrs(ctx, slog.LevelError, err.Error())
 		return
@@ -155,41 +249,903 @@ func (h *Handler) RefreshToken(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	if err := json.NewEncoder(w).Encode(models.UserResp{AccessToken: newAccessToken, RefreshToken: newRefreshToken}); err != nil {
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
 		logger.LogAttrs(ctx, slog.LevelError, "failed to write response", slog.String("error", err.Error()))
 		return
 	}
 
-	logger.LogAttrs(ctx, slog.LevelInfo, "user refreshed token", slog.String("token", newRefreshToken))
+	logger.LogAttrs(ctx, slog.LevelInfo, "user refreshed token", slog.String("token", resp.RefreshToken))
 }
 
+// RevokeToken revokes the access or refresh token sent in the form body (RFC 7009), the bearer token
+// from the Authorization header is revoked when the body has none. It always responds 200, even for
+// invalid tokens.
 func (h *Handler) RevokeToken(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	logger := ctx.Value(server.Logger).(*slog.Logger)
 
-	authHeader := r.Header.Get("Authorization")
-	if authHeader == "" {
-		logger.LogAttrs(ctx, slog.LevelError, "Missing Authorization header")
-		respondWithError(w, http.StatusUnauthorized, "Missing Authorization header")
+	if err := r.ParseForm(); err != nil {
+		respondWithErrorCode(w, http.StatusBadRequest, "invalid_request", fmt.Sprintf("failed to parse form - %s", err.Error()))
 		return
 	}
 
-	token := strings.TrimPrefix(authHeader, "Bearer ")
+	token := r.PostForm.Get("token")
+	if token == "" {
+		token = strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	}
+
+	if token == "" {
+		logger.LogAttrs(ctx, slog.LevelError, "missing token")
+		respondWithErrorCode(w, http.StatusBadRequest, "invalid_request", models.ErrRequired("token").Error())
+		return
+	}
 
-	if err := h.Service.RevokeToken(ctx, token); err != nil {
+	if err := h.Service.RevokeToken(ctx, token, r.PostForm.Get("token_type_hint")); err != nil {
 		logger.LogAttrs(ctx, slog.LevelError, "failed to revoke token", slog.String("error", err.Error()))
-		respondWithError(w, http.StatusInternalServerError, "Failed to revoke token")
+		respondWithErrorCode(w, http.StatusServiceUnavailable, "temporarily_unavailable", "Failed to revoke token")
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+
+	logger.LogAttrs(ctx, slog.LevelInfo, "revoked token")
+}
+
+// JWKS publishes the public keys used to verify access tokens
+func (h *Handler) JWKS(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger := ctx.Value(server.Logger).(*slog.Logger)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+
+	if err := json.NewEncoder(w).Encode(h.Service.JWKS(ctx)); err != nil {
+		logger.LogAttrs(ctx, slog.LevelError, "failed to write response", slog.String("error", err.Error()))
+	}
+}
+
+// RotateKeys activates new signing keys, tokens signed with the previous keys stay valid until expiry
+func (h *Handler) RotateKeys(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger := ctx.Value(server.Logger).(*slog.Logger)
+
+	if err := h.Service.RotateKeys(ctx); err != nil {
+		logger.LogAttrs(ctx, slog.LevelError, "failed to rotate keys", slog.String("error", err.Error()))
+
+		if errors.Is(err, models.ErrNoKeyEncryption) {
+			respondWithErrorCode(w, http.StatusConflict, "key_encryption_missing", err.Error())
+			return
+		}
+
+		respondWithError(w, http.StatusInternalServerError, "Failed to rotate keys")
 		return
 	}
 
 	w.WriteHeader(http.StatusNoContent)
+}
+
+// Introspect lets authenticated clients check whether a token is active (RFC 7662)
+func (h *Handler) Introspect(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger := ctx.Value(server.Logger).(*slog.Logger)
+
+	if err := r.ParseForm(); err != nil {
+		respondWithErrorCode(w, http.StatusBadRequest, "invalid_request", fmt.Sprintf("failed to parse form - %s", err.Error()))
+		return
+	}
+
+	token := r.PostForm.Get("token")
+	if token == "" {
+		respondWithErrorCode(w, http.StatusBadRequest, "invalid_request", models.ErrRequired("token").Error())
+		return
+	}
+
+	resp, err := h.Service.Introspect(ctx, token, r.PostForm.Get("token_type_hint"))
+	if err != nil {
+		logger.LogAttrs(ctx, slog.LevelError, "failed to introspect token", slog.String("error", err.Error()))
+		respondWithError(w, http.StatusInternalServerError, "Failed to introspect token")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
 
-	logger.LogAttrs(ctx, slog.LevelInfo, "revoked token", slog.String("token", token))
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		logger.LogAttrs(ctx, slog.LevelError, "failed to write response", slog.String("error", err.Error()))
+	}
 }
 
-func respondWithError(w http.ResponseWriter, code int, reason string) {
-	cErr := models.CustomError{Message: reason, Code: code}
+// ListSessions returns the sessions of the authenticated user
+func (h *Handler) ListSessions(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger := ctx.Value(server.Logger).(*slog.Logger)
+
+	sessions, err := h.Service.ListSessions(ctx)
+	if err != nil {
+		logger.LogAttrs(ctx, slog.LevelError, "failed to list sessions", slog.String("error", err.Error()))
+		respondWithError(w, http.StatusInternalServerError, "Failed to list sessions")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(w).Encode(sessions); err != nil {
+		logger.LogAttrs(ctx, slog.LevelError, "failed to write response", slog.String("error", err.Error()))
+	}
+}
+
+// RevokeSession logs out one session of the authenticated user
+func (h *Handler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger := ctx.Value(server.Logger).(*slog.Logger)
+
+	if err := h.Service.RevokeSession(ctx, r.PathValue("id")); err != nil {
+		if errors.Is(err, models.ErrNotFound("session")) {
+			respondWithError(w, http.StatusNotFound, err.Error())
+			return
+		}
+
+		logger.LogAttrs(ctx, slog.LevelError, "failed to revoke session", slog.String("error", err.Error()))
+		respondWithError(w, http.StatusInternalServerError, "Failed to revoke session")
+
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RevokeAllSessions logs the authenticated user out everywhere
+func (h *Handler) RevokeAllSessions(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger := ctx.Value(server.Logger).(*slog.Logger)
+
+	if err := h.Service.RevokeAllSessions(ctx); err != nil {
+		logger.LogAttrs(ctx, slog.LevelError, "failed to revoke sessions", slog.String("error", err.Error()))
+		respondWithError(w, http.StatusInternalServerError, "Failed to revoke sessions")
+
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// VerifyEmail consumes the token sent after sign up and marks the email as verified
+func (h *Handler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	var t = struct {
+		Token string `json:"token"`
+	}{}
+
+	ctx := r.Context()
+	logger := ctx.Value(server.Logger).(*slog.Logger)
+
+	if err := json.NewDecoder(r.Body).Decode(&t); err != nil {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("failed to bind body - %s", err.Error()))
+		return
+	}
+
+	if err := h.Service.VerifyEmail(ctx, t.Token); err != nil {
+		if models.IsBadRequest(err) {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		logger.LogAttrs(ctx, slog.LevelError, "failed to verify email", slog.String("error", err.Error()))
+		respondWithError(w, http.StatusInternalServerError, "Failed to verify email")
+
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ResendVerification sends a new verification email, it responds 202 whether or not the account exists
+func (h *Handler) ResendVerification(w http.ResponseWriter, r *http.Request) {
+	var u = struct {
+		Email string `json:"email"`
+	}{}
+
+	ctx := r.Context()
+	logger := ctx.Value(server.Logger).(*slog.Logger)
+
+	if err := json.NewDecoder(r.Body).Decode(&u); err != nil {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("failed to bind body - %s", err.Error()))
+		return
+	}
+
+	if err := h.Service.ResendVerification(ctx, u.Email); err != nil {
+		if models.IsBadRequest(err) {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		logger.LogAttrs(ctx, slog.LevelError, "failed to resend verification", slog.String("error", err.Error()))
+		respondWithError(w, http.StatusInternalServerError, "Failed to resend verification")
+
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// ForgotPassword mails a password reset link, it responds 202 whether or not the account exists
+func (h *Handler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var u = struct {
+		Email string `json:"email"`
+	}{}
+
+	ctx := r.Context()
+	logger := ctx.Value(server.Logger).(*slog.Logger)
+
+	if err := json.NewDecoder(r.Body).Decode(&u); err != nil {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("failed to bind body - %s", err.Error()))
+		return
+	}
+
+	if err := h.Service.ForgotPassword(ctx, u.Email); err != nil {
+		if models.IsBadRequest(err) {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		logger.LogAttrs(ctx, slog.LevelError, "failed to send password reset", slog.String("error", err.Error()))
+		respondWithError(w, http.StatusInternalServerError, "Failed to send password reset")
+
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// ResetPassword consumes a reset token and sets the new password, all sessions of the user are logged out
+func (h *Handler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var req = struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}{}
+
+	ctx := r.Context()
+	logger := ctx.Value(server.Logger).(*slog.Logger)
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("failed to bind body - %s", err.Error()))
+		return
+	}
+
+	if err := h.Service.ResetPassword(ctx, req.Token, req.Password); err != nil {
+		if models.IsBadRequest(err) {
+			respondWithBadRequest(w, err)
+			return
+		}
+
+		logger.LogAttrs(ctx, slog.LevelError, "failed to reset password", slog.String("error", err.Error()))
+		respondWithError(w, http.StatusInternalServerError, "Failed to reset password")
+
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetProfile returns the user record of the authenticated user
+func (h *Handler) GetProfile(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	user, err := h.Service.GetProfile(ctx)
+	if err != nil {
+		h.profileError(w, r, err)
+		return
+	}
+
+	respondWithProfile(w, r, user)
+}
+
+// UpdateProfile changes the name, locale or metadata of the authenticated user
+func (h *Handler) UpdateProfile(w http.ResponseWriter, r *http.Request) {
+	var req models.ProfileUpdate
+
+	ctx := r.Context()
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("failed to bind body - %s", err.Error()))
+		return
+	}
+
+	user, err := h.Service.UpdateProfile(ctx, &req)
+	if err != nil {
+		h.profileError(w, r, err)
+		return
+	}
+
+	respondWithProfile(w, r, user)
+}
+
+func (h *Handler) profileError(w http.ResponseWriter, r *http.Request, err error) {
+	ctx := r.Context()
+	logger := ctx.Value(server.Logger).(*slog.Logger)
+
+	switch {
+	case errors.Is(err, models.ErrNotFound("user")):
+		respondWithError(w, http.StatusNotFound, err.Error())
+	case models.IsBadRequest(err):
+		respondWithError(w, http.StatusBadRequest, err.Error())
+	default:
+		logger.LogAttrs(ctx, slog.LevelError, "failed to load profile", slog.String("error", err.Error()))
+		respondWithError(w, http.StatusInternalServerError, "Failed to load profile")
+	}
+}
+
+func respondWithProfile(w http.ResponseWriter, r *http.Request, user *models.UserData) {
+	logger := r.Context().Value(server.Logger).(*slog.Logger)
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(w).Encode(user); err != nil {
+		logger.LogAttrs(r.Context(), slog.LevelError, "failed to write response", slog.String("error", err.Error()))
+	}
+}
+
+// ChangePassword sets a new password for the authenticated user, the current password is required
+func (h *Handler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	var req models.PasswordChangeReq
+
+	ctx := r.Context()
+	logger := ctx.Value(server.Logger).(*slog.Logger)
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("failed to bind body - %s", err.Error()))
+		return
+	}
+
+	if err := h.Service.ChangePassword(ctx, &req); err != nil {
+		switch {
+		case errors.Is(err, models.ErrPsswdNotMatch):
+			respondWithErrorCode(w, http.StatusForbidden, "invalid_password", err.Error())
+		case models.IsBadRequest(err):
+			respondWithBadRequest(w, err)
+		default:
+			logger.LogAttrs(ctx, slog.LevelError, "failed to change password", slog.String("error", err.Error()))
+			respondWithError(w, http.StatusInternalServerError, "Failed to change password")
+		}
+
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ChangeEmail moves the authenticated user to a new email address, the user has to sign in again
+func (h *Handler) ChangeEmail(w http.ResponseWriter, r *http.Request) {
+	var req models.EmailChangeReq
+
+	ctx := r.Context()
+	logger := ctx.Value(server.Logger).(*slog.Logger)
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("failed to bind body - %s", err.Error()))
+		return
+	}
+
+	if err := h.Service.ChangeEmail(ctx, &req); err != nil {
+		switch {
+		case errors.Is(err, models.ErrPsswdNotMatch):
+			respondWithErrorCode(w, http.StatusForbidden, "invalid_password", err.Error())
+		case errors.Is(err, models.ErrUserAlreadyExists):
+			respondWithError(w, http.StatusConflict, err.Error())
+		case models.IsBadRequest(err):
+			respondWithBadRequest(w, err)
+		default:
+			logger.LogAttrs(ctx, slog.LevelError, "failed to change email", slog.String("error", err.Error()))
+			respondWithError(w, http.StatusInternalServerError, "Failed to change email")
+		}
+
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// SignInMFA completes a sign in with the challenge token and an authentication or recovery code
+func (h *Handler) SignInMFA(w http.ResponseWriter, r *http.Request) {
+	var req models.MFASignInReq
+
+	ctx := r.Context()
+	logger := ctx.Value(server.Logger).(*slog.Logger)
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("failed to bind body - %s", err.Error()))
+		return
+	}
+
+	resp, err := h.Service.CompleteMFASignIn(ctx, &req)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrInvalidMFACode):
+			respondWithErrorCode(w, http.StatusUnauthorized, "invalid_mfa_code", err.Error())
+		case errors.Is(err, models.ErrTooManyAttempts):
+			respondWithErrorCode(w, http.StatusTooManyRequests, "too_many_attempts", err.Error())
+		case errors.Is(err, models.ErrAccountDisabled):
+			respondWithErrorCode(w, http.StatusForbidden, "account_disabled", err.Error())
+		case errors.Is(err, models.ErrAccountLocked):
+			respondWithErrorCode(w, http.StatusLocked, "account_locked", err.Error())
+		case errors.Is(err, models.ErrInvalidScope):
+			respondWithErrorCode(w, http.StatusBadRequest, "invalid_scope", err.Error())
+		case models.IsBadRequest(err):
+			respondWithError(w, http.StatusBadRequest, err.Error())
+		default:
+			logger.LogAttrs(ctx, slog.LevelError, "failed to complete mfa sign in", slog.String("error", err.Error()))
+			respondWithError(w, http.StatusInternalServerError, "Failed to sign in")
+		}
+
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, resp)
+	logger.LogAttrs(ctx, slog.LevelInfo, "user signed in", slog.String("email", resp.Email))
+}
+
+// RequestMagicLink mails a sign in link and code, it responds 202 whether or not the account exists
+func (h *Handler) RequestMagicLink(w http.ResponseWriter, r *http.Request) {
+	var u = struct {
+		Email string `json:"email"`
+	}{}
+
+	ctx := r.Context()
+	logger := ctx.Value(server.Logger).(*slog.Logger)
+
+	if err := json.NewDecoder(r.Body).Decode(&u); err != nil {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("failed to bind body - %s", err.Error()))
+		return
+	}
+
+	if err := h.Service.RequestMagicLink(ctx, u.Email); err != nil {
+		if models.IsBadRequest(err) {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		logger.LogAttrs(ctx, slog.LevelError, "failed to send magic link", slog.String("error", err.Error()))
+		respondWithError(w, http.StatusInternalServerError, "Failed to send magic link")
+
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// VerifyMagicLink signs in with the token of a magic link or the code of the mail
+func (h *Handler) VerifyMagicLink(w http.ResponseWriter, r *http.Request) {
+	var req models.MagicLinkVerifyReq
+
+	ctx := r.Context()
+	logger := ctx.Value(server.Logger).(*slog.Logger)
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("failed to bind body - %s", err.Error()))
+		return
+	}
+
+	resp, err := h.Service.VerifyMagicLink(ctx, &req)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrInvalidSignInCode):
+			respondWithErrorCode(w, http.StatusUnauthorized, "invalid_code", err.Error())
+		case errors.Is(err, models.ErrTooManyAttempts):
+			respondWithErrorCode(w, http.StatusTooManyRequests, "too_many_attempts", err.Error())
+		case errors.Is(err, models.ErrAccountDisabled):
+			respondWithErrorCode(w, http.StatusForbidden, "account_disabled", err.Error())
+		case errors.Is(err, models.ErrAccountLocked):
+			respondWithErrorCode(w, http.StatusLocked, "account_locked", err.Error())
+		case errors.Is(err, models.ErrInvalidScope):
+			respondWithErrorCode(w, http.StatusBadRequest, "invalid_scope", err.Error())
+		case models.IsBadRequest(err):
+			respondWithError(w, http.StatusBadRequest, err.Error())
+		default:
+			logger.LogAttrs(ctx, slog.LevelError, "failed to verify magic link", slog.String("error", err.Error()))
+			respondWithError(w, http.StatusInternalServerError, "Failed to sign in")
+		}
+
+		return
+	}
+
+	// the email step is done but a second factor is needed, the client continues at /signin/mfa
+	if resp.MFAToken != "" {
+		respondWithJSON(w, http.StatusAccepted, resp)
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, resp)
+	logger.LogAttrs(ctx, slog.LevelInfo, "user signed in", slog.String("email", resp.Email))
+}
+
+// EnrollTOTP returns a new authenticator app secret for the authenticated user
+func (h *Handler) EnrollTOTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger := ctx.Value(server.Logger).(*slog.Logger)
+
+	enrollment, err := h.Service.EnrollTOTP(ctx)
+	if err != nil {
+		if errors.Is(err, models.ErrMFAEnabled) {
+			respondWithError(w, http.StatusConflict, err.Error())
+			return
+		}
+
+		logger.LogAttrs(ctx, slog.LevelError, "failed to enroll totp", slog.String("error", err.Error()))
+		respondWithError(w, http.StatusInternalServerError, "Failed to enroll authenticator app")
+
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	respondWithJSON(w, http.StatusOK, enrollment)
+}
+
+// ConfirmTOTP enables MFA with the first authenticator app code and returns the recovery codes
+func (h *Handler) ConfirmTOTP(w http.ResponseWriter, r *http.Request) {
+	var req = struct {
+		Code string `json:"code"`
+	}{}
+
+	ctx := r.Context()
+	logger := ctx.Value(server.Logger).(*slog.Logger)
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("failed to bind body - %s", err.Error()))
+		return
+	}
+
+	codes, err := h.Service.ConfirmTOTP(ctx, req.Code)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrMFAEnabled):
+			respondWithError(w, http.StatusConflict, err.Error())
+		case errors.Is(err, models.ErrMFANotEnrolled):
+			respondWithError(w, http.StatusBadRequest, err.Error())
+		case models.IsBadRequest(err):
+			respondWithErrorCode(w, http.StatusBadRequest, "invalid_mfa_code", err.Error())
+		default:
+			logger.LogAttrs(ctx, slog.LevelError, "failed to confirm totp", slog.String("error", err.Error()))
+			respondWithError(w, http.StatusInternalServerError, "Failed to confirm authenticator app")
+		}
+
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	respondWithJSON(w, http.StatusOK, codes)
+}
+
+// BeginPasskeyRegistration returns the options to create a passkey for the authenticated user
+func (h *Handler) BeginPasskeyRegistration(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger := ctx.Value(server.Logger).(*slog.Logger)
+
+	ceremony, err := h.Service.BeginPasskeyRegistration(ctx)
+	if err != nil {
+		logger.LogAttrs(ctx, slog.LevelError, "failed to begin passkey registration", slog.String("error", err.Error()))
+		respondWithError(w, http.StatusInternalServerError, "Failed to begin passkey registration")
+
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	respondWithJSON(w, http.StatusOK, ceremony)
+}
+
+// FinishPasskeyRegistration stores the passkey created by the browser
+func (h *Handler) FinishPasskeyRegistration(w http.ResponseWriter, r *http.Request) {
+	var req models.PasskeyRegistrationReq
+
+	ctx := r.Context()
+	logger := ctx.Value(server.Logger).(*slog.Logger)
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("failed to bind body - %s", err.Error()))
+		return
+	}
+
+	passkey, err := h.Service.FinishPasskeyRegistration(ctx, &req)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrPasskeyExists):
+			respondWithError(w, http.StatusConflict, err.Error())
+		case models.IsBadRequest(err):
+			respondWithError(w, http.StatusBadRequest, err.Error())
+		default:
+			logger.LogAttrs(ctx, slog.LevelError, "failed to finish passkey registration", slog.String("error", err.Error()))
+			respondWithError(w, http.StatusInternalServerError, "Failed to register passkey")
+		}
+
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, passkey)
+}
+
+// BeginPasskeySignIn returns the options to sign in with a passkey, the body is optional and holds
+// the mfaToken when the passkey is used as second factor
+func (h *Handler) BeginPasskeySignIn(w http.ResponseWriter, r *http.Request) {
+	var req = struct {
+		MFAToken string `json:"mfaToken"`
+	}{}
+
+	ctx := r.Context()
+	logger := ctx.Value(server.Logger).(*slog.Logger)
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("failed to bind body - %s", err.Error()))
+		return
+	}
+
+	ceremony, err := h.Service.BeginPasskeySignIn(ctx, req.MFAToken)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrTooManyAttempts):
+			respondWithErrorCode(w, http.StatusTooManyRequests, "too_many_attempts", err.Error())
+		case models.IsBadRequest(err):
+			respondWithError(w, http.StatusBadRequest, err.Error())
+		default:
+			logger.LogAttrs(ctx, slog.LevelError, "failed to begin passkey sign in", slog.String("error", err.Error()))
+			respondWithError(w, http.StatusInternalServerError, "Failed to begin passkey sign in")
+		}
+
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	respondWithJSON(w, http.StatusOK, ceremony)
+}
+
+// FinishPasskeySignIn checks the passkey assertion and returns a token pair
+func (h *Handler) FinishPasskeySignIn(w http.ResponseWriter, r *http.Request) {
+	var req models.PasskeySignInReq
+
+	ctx := r.Context()
+	logger := ctx.Value(server.Logger).(*slog.Logger)
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("failed to bind body - %s", err.Error()))
+		return
+	}
+
+	resp, err := h.Service.FinishPasskeySignIn(ctx, &req)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrPasskeyCloned):
+			respondWithErrorCode(w, http.StatusUnauthorized, "passkey_cloned", err.Error())
+		case errors.Is(err, models.ErrEmailNotVerified):
+			respondWithErrorCode(w, http.StatusForbidden, "email_not_verified", err.Error())
+		case errors.Is(err, models.ErrAccountDisabled):
+			respondWithErrorCode(w, http.StatusForbidden, "account_disabled", err.Error())
+		case errors.Is(err, models.ErrAccountLocked):
+			respondWithErrorCode(w, http.StatusLocked, "account_locked", err.Error())
+		case errors.Is(err, models.ErrInvalidScope):
+			respondWithErrorCode(w, http.StatusBadRequest, "invalid_scope", err.Error())
+		case models.IsBadRequest(err):
+			respondWithError(w, http.StatusBadRequest, err.Error())
+		default:
+			logger.LogAttrs(ctx, slog.LevelError, "failed to finish passkey sign in", slog.String("error", err.Error()))
+			respondWithError(w, http.StatusInternalServerError, "Failed to sign in")
+		}
+
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, resp)
+	logger.LogAttrs(ctx, slog.LevelInfo, "user signed in", slog.String("email", resp.Email))
+}
+
+// GetUserAccess returns the roles and permissions of a user
+func (h *Handler) GetUserAccess(w http.ResponseWriter, r *http.Request) {
+	access, err := h.Service.GetUserAccess(r.Context(), r.PathValue("id"))
+	if err != nil {
+		accessError(w, r, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, access)
+}
+
+// AssignRole adds a role to a user
+func (h *Handler) AssignRole(w http.ResponseWriter, r *http.Request) {
+	access, err := h.Service.GrantAccess(r.Context(), r.PathValue("id"), &models.Access{Roles: []string{r.PathValue("role")}})
+	if err != nil {
+		accessError(w, r, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, access)
+}
+
+// RemoveRole takes a role away from a user
+func (h *Handler) RemoveRole(w http.ResponseWriter, r *http.Request) {
+	access, err := h.Service.RevokeAccess(r.Context(), r.PathValue("id"), &models.Access{Roles: []string{r.PathValue("role")}})
+	if err != nil {
+		accessError(w, r, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, access)
+}
+
+// GrantPermission adds a permission to a user
+func (h *Handler) GrantPermission(w http.ResponseWriter, r *http.Request) {
+	access, err := h.Service.GrantAccess(r.Context(), r.PathValue("id"),
+		&models.Access{Permissions: []string{r.PathValue("permission")}})
+	if err != nil {
+		accessError(w, r, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, access)
+}
+
+// RevokePermission takes a permission away from a user
+func (h *Handler) RevokePermission(w http.ResponseWriter, r *http.Request) {
+	access, err := h.Service.RevokeAccess(r.Context(), r.PathValue("id"),
+		&models.Access{Permissions: []string{r.PathValue("permission")}})
+	if err != nil {
+		accessError(w, r, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, access)
+}
+
+func accessError(w http.ResponseWriter, r *http.Request, err error) {
+	ctx := r.Context()
+	logger := ctx.Value(server.Logger).(*slog.Logger)
+
+	switch {
+	case errors.Is(err, models.ErrNotFound("user")):
+		respondWithError(w, http.StatusNotFound, err.Error())
+	case models.IsBadRequest(err):
+		respondWithError(w, http.StatusBadRequest, err.Error())
+	default:
+		logger.LogAttrs(ctx, slog.LevelError, "failed to update user access", slog.String("error", err.Error()))
+		respondWithError(w, http.StatusInternalServerError, "Failed to update user access")
+	}
+}
+
+// ListUsers returns a page of users, ?email= filters by email prefix and ?cursor= continues after the
+// previous page
+func (h *Handler) ListUsers(w http.ResponseWriter, r *http.Request) {
+	query := models.UserQuery{Cursor: r.URL.Query().Get("cursor"), EmailPrefix: r.URL.Query().Get("email")}
+
+	if limit := r.URL.Query().Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, models.ErrInvalid("limit").Error())
+			return
+		}
+
+		query.Limit = n
+	}
+
+	page, err := h.Service.ListUsers(r.Context(), &query)
+	if err != nil {
+		adminError(w, r, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, page)
+}
+
+// GetUser returns the record of a user
+func (h *Handler) GetUser(w http.ResponseWriter, r *http.Request) {
+	user, err := h.Service.GetUser(r.Context(), r.PathValue("id"))
+	if err != nil {
+		adminError(w, r, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, user)
+}
+
+// UpdateUser changes the profile, email, verification or status of a user
+func (h *Handler) UpdateUser(w http.ResponseWriter, r *http.Request) {
+	var req models.AdminUserUpdate
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("failed to bind body - %s", err.Error()))
+		return
+	}
+
+	user, err := h.Service.UpdateUser(r.Context(), r.PathValue("id"), &req)
+	if err != nil {
+		adminError(w, r, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, user)
+}
+
+// DeleteUser removes a user and logs out the sessions
+func (h *Handler) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	if err := h.Service.DeleteUser(r.Context(), r.PathValue("id")); err != nil {
+		adminError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DisableUser blocks the sign in of a user and logs out the sessions
+func (h *Handler) DisableUser(w http.ResponseWriter, r *http.Request) {
+	if err := h.Service.DisableUser(r.Context(), r.PathValue("id")); err != nil {
+		adminError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// LogoutUser revokes every session of a user
+func (h *Handler) LogoutUser(w http.ResponseWriter, r *http.Request) {
+	if err := h.Service.LogoutUser(r.Context(), r.PathValue("id")); err != nil {
+		adminError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func adminError(w http.ResponseWriter, r *http.Request, err error) {
+	ctx := r.Context()
+	logger := ctx.Value(server.Logger).(*slog.Logger)
+
+	switch {
+	case errors.Is(err, models.ErrNotFound("user")):
+		respondWithError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, models.ErrUserAlreadyExists):
+		respondWithError(w, http.StatusConflict, err.Error())
+	case models.IsBadRequest(err):
+		respondWithBadRequest(w, err)
+	default:
+		logger.LogAttrs(ctx, slog.LevelError, "failed to manage user", slog.String("error", err.Error()))
+		respondWithError(w, http.StatusInternalServerError, "Failed to manage user")
+	}
+}
+
+func respondWithJSON(w http.ResponseWriter, code int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		http.Error(w, "Failed to write response", http.StatusInternalServerError)
+	}
+}
+
+func respondWithError(w http.ResponseWriter, code int, reason string) {
+	respondWithErrorCode(w, code, "", reason)
+}
+
+// setRetryAfter tells the client in whole seconds when to try again, it has to be called before the
+// response is written
+func setRetryAfter(w http.ResponseWriter, err error) {
+	if after, ok := models.RetryAfter(err); ok {
+		w.Header().Set("Retry-After", strconv.FormatInt(int64(math.Ceil(after.Seconds())), 10))
+	}
+}
+
+// respondWithBadRequest answers invalid input, the rules broken by the fields are listed under "fields"
+func respondWithBadRequest(w http.ResponseWriter, err error) {
+	cErr := models.CustomError{Message: err.Error(), Code: http.StatusBadRequest}
+
+	var vErr *models.ValidationError
+	if errors.As(err, &vErr) {
+		cErr.Error = "invalid_input"
+		cErr.Fields = vErr.Fields
+	}
+
+	writeError(w, cErr)
+}
+
+// respondWithErrorCode adds a machine readable error code next to the message
+func respondWithErrorCode(w http.ResponseWriter, code int, errCode, reason string) {
+	writeError(w, models.CustomError{Message: reason, Code: code, Error: errCode})
+}
 
+func writeError(w http.ResponseWriter, cErr models.CustomError) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(cErr.Code)
 
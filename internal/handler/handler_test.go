@@ -11,6 +11,7 @@ import (
 	"net/http/httptest"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
@@ -81,3 +82,114 @@ func TestHandler_SignUp(t *testing.T) {
 		})
 	}
 }
+
+func TestHandler_SignIn(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockService := NewMockServicer(ctrl)
+	h := New(mockService)
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+
+	ctx := context.WithValue(context.Background(), server.Logger, logger)
+	body := json.RawMessage(`{"email":"testuser@gmail.com","password":"12345678"}`)
+
+	tests := []struct {
+		name    string
+		resp    *models.UserResp
+		err     error
+		expCode int
+		expErr  string
+	}{
+		{name: "signed in", resp: &models.UserResp{AccessToken: "access", RefreshToken: "refresh"}, expCode: http.StatusCreated},
+		{name: "wrong password", err: models.ErrPsswdNotMatch, expCode: http.StatusUnauthorized, expErr: "invalid_credentials"},
+		{name: "user not found", err: models.ErrNotFound("user"), expCode: http.StatusNotFound},
+		{name: "invalid email", err: models.ErrBadRequest(models.ErrInvalid("email")), expCode: http.StatusBadRequest},
+		{name: "store error", err: models.ErrDBNotConnected, expCode: http.StatusInternalServerError},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService.EXPECT().SignIn(ctx, gomock.Any()).Return(tt.resp, tt.err)
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequestWithContext(ctx, "POST", "/signin", bytes.NewBuffer(body))
+
+			h.SignIn(w, r)
+
+			var resp models.CustomError
+
+			assert.Equalf(t, tt.expCode, w.Code, "TEST[%d] Failed - %s", i, tt.name)
+			assert.NoErrorf(t, json.NewDecoder(w.Body).Decode(&resp), "TEST[%d] Failed - %s", i, tt.name)
+			assert.Equalf(t, tt.expErr, resp.Error, "TEST[%d] Failed - %s", i, tt.name)
+		})
+	}
+}
+
+func TestHandler_SignInLocked(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockService := NewMockServicer(ctrl)
+	h := New(mockService)
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+
+	ctx := context.WithValue(context.Background(), server.Logger, logger)
+	body := json.RawMessage(`{"email":"testuser@gmail.com","password":"12345678"}`)
+
+	tests := []struct {
+		name       string
+		err        error
+		expCode    int
+		retryAfter string
+	}{
+		{name: "account locked", err: models.ErrRetryAfter(models.ErrSignInLocked, 90*time.Second),
+			expCode: http.StatusLocked, retryAfter: "90"},
+		{name: "ip locked", err: models.ErrRetryAfter(models.ErrTooManyAttempts, 1500*time.Millisecond),
+			expCode: http.StatusTooManyRequests, retryAfter: "2"},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService.EXPECT().SignIn(ctx, gomock.Any()).Return(nil, tt.err)
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequestWithContext(ctx, "POST", "/signin", bytes.NewBuffer(body))
+
+			h.SignIn(w, r)
+
+			assert.Equalf(t, tt.expCode, w.Code, "TEST[%d] Failed - %s", i, tt.name)
+			assert.Equalf(t, tt.retryAfter, w.Header().Get("Retry-After"), "TEST[%d] Failed - %s", i, tt.name)
+		})
+	}
+}
+
+func TestHandler_SignUpPolicy(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockService := NewMockServicer(ctrl)
+	h := New(mockService)
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+
+	ctx := context.WithValue(context.Background(), server.Logger, logger)
+	body := json.RawMessage(`{"email":"testuser@gmail.com","password":"password"}`)
+
+	vErr := &models.ValidationError{}
+	vErr.Add("password", "missing_digit", "password must contain a digit")
+	vErr.Add("password", "breached", "password appeared in a data breach, choose another one")
+
+	mockService.EXPECT().SignUp(ctx, gomock.Any()).Return(models.ErrBadRequest(vErr))
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequestWithContext(ctx, "POST", "/sign-up", bytes.NewBuffer(body))
+
+	h.SignUp(w, r)
+
+	var resp models.CustomError
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+	assert.Equal(t, "invalid_input", resp.Error)
+	assert.Equal(t, vErr.Fields, resp.Fields)
+}
@@ -35,44 +35,449 @@ func (m *MockServicer) EXPECT() *MockServicerMockRecorder {
 	return m.recorder
 }
 
+// BeginPasskeyRegistration mocks base method.
+func (m *MockServicer) BeginPasskeyRegistration(ctx context.Context) (*models.PasskeyCeremony, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "BeginPasskeyRegistration", ctx)
+	ret0, _ := ret[0].(*models.PasskeyCeremony)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// BeginPasskeyRegistration indicates an expected call of BeginPasskeyRegistration.
+func (mr *MockServicerMockRecorder) BeginPasskeyRegistration(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "BeginPasskeyRegistration", reflect.TypeOf((*MockServicer)(nil).BeginPasskeyRegistration), ctx)
+}
+
+// BeginPasskeySignIn mocks base method.
+func (m *MockServicer) BeginPasskeySignIn(ctx context.Context, mfaToken string) (*models.PasskeyCeremony, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "BeginPasskeySignIn", ctx, mfaToken)
+	ret0, _ := ret[0].(*models.PasskeyCeremony)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// BeginPasskeySignIn indicates an expected call of BeginPasskeySignIn.
+func (mr *MockServicerMockRecorder) BeginPasskeySignIn(ctx, mfaToken interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "BeginPasskeySignIn", reflect.TypeOf((*MockServicer)(nil).BeginPasskeySignIn), ctx, mfaToken)
+}
+
+// ChangeEmail mocks base method.
+func (m *MockServicer) ChangeEmail(ctx context.Context, req *models.EmailChangeReq) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ChangeEmail", ctx, req)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ChangeEmail indicates an expected call of ChangeEmail.
+func (mr *MockServicerMockRecorder) ChangeEmail(ctx, req interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ChangeEmail", reflect.TypeOf((*MockServicer)(nil).ChangeEmail), ctx, req)
+}
+
+// ChangePassword mocks base method.
+func (m *MockServicer) ChangePassword(ctx context.Context, req *models.PasswordChangeReq) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ChangePassword", ctx, req)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ChangePassword indicates an expected call of ChangePassword.
+func (mr *MockServicerMockRecorder) ChangePassword(ctx, req interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ChangePassword", reflect.TypeOf((*MockServicer)(nil).ChangePassword), ctx, req)
+}
+
+// CompleteMFASignIn mocks base method.
+func (m *MockServicer) CompleteMFASignIn(ctx context.Context, req *models.MFASignInReq) (*models.UserResp, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CompleteMFASignIn", ctx, req)
+	ret0, _ := ret[0].(*models.UserResp)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CompleteMFASignIn indicates an expected call of CompleteMFASignIn.
+func (mr *MockServicerMockRecorder) CompleteMFASignIn(ctx, req interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CompleteMFASignIn", reflect.TypeOf((*MockServicer)(nil).CompleteMFASignIn), ctx, req)
+}
+
+// ConfirmTOTP mocks base method.
+func (m *MockServicer) ConfirmTOTP(ctx context.Context, code string) (*models.RecoveryCodes, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ConfirmTOTP", ctx, code)
+	ret0, _ := ret[0].(*models.RecoveryCodes)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ConfirmTOTP indicates an expected call of ConfirmTOTP.
+func (mr *MockServicerMockRecorder) ConfirmTOTP(ctx, code interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ConfirmTOTP", reflect.TypeOf((*MockServicer)(nil).ConfirmTOTP), ctx, code)
+}
+
+// DeleteUser mocks base method.
+func (m *MockServicer) DeleteUser(ctx context.Context, userID string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteUser", ctx, userID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteUser indicates an expected call of DeleteUser.
+func (mr *MockServicerMockRecorder) DeleteUser(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteUser", reflect.TypeOf((*MockServicer)(nil).DeleteUser), ctx, userID)
+}
+
+// DisableUser mocks base method.
+func (m *MockServicer) DisableUser(ctx context.Context, userID string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DisableUser", ctx, userID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DisableUser indicates an expected call of DisableUser.
+func (mr *MockServicerMockRecorder) DisableUser(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DisableUser", reflect.TypeOf((*MockServicer)(nil).DisableUser), ctx, userID)
+}
+
+// EnrollTOTP mocks base method.
+func (m *MockServicer) EnrollTOTP(ctx context.Context) (*models.TOTPEnrollment, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "EnrollTOTP", ctx)
+	ret0, _ := ret[0].(*models.TOTPEnrollment)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// EnrollTOTP indicates an expected call of EnrollTOTP.
+func (mr *MockServicerMockRecorder) EnrollTOTP(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EnrollTOTP", reflect.TypeOf((*MockServicer)(nil).EnrollTOTP), ctx)
+}
+
+// FinishPasskeyRegistration mocks base method.
+func (m *MockServicer) FinishPasskeyRegistration(ctx context.Context, req *models.PasskeyRegistrationReq) (*models.Passkey, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FinishPasskeyRegistration", ctx, req)
+	ret0, _ := ret[0].(*models.Passkey)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FinishPasskeyRegistration indicates an expected call of FinishPasskeyRegistration.
+func (mr *MockServicerMockRecorder) FinishPasskeyRegistration(ctx, req interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FinishPasskeyRegistration", reflect.TypeOf((*MockServicer)(nil).FinishPasskeyRegistration), ctx, req)
+}
+
+// FinishPasskeySignIn mocks base method.
+func (m *MockServicer) FinishPasskeySignIn(ctx context.Context, req *models.PasskeySignInReq) (*models.UserResp, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FinishPasskeySignIn", ctx, req)
+	ret0, _ := ret[0].(*models.UserResp)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FinishPasskeySignIn indicates an expected call of FinishPasskeySignIn.
+func (mr *MockServicerMockRecorder) FinishPasskeySignIn(ctx, req interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FinishPasskeySignIn", reflect.TypeOf((*MockServicer)(nil).FinishPasskeySignIn), ctx, req)
+}
+
+// ForgotPassword mocks base method.
+func (m *MockServicer) ForgotPassword(ctx context.Context, email string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ForgotPassword", ctx, email)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ForgotPassword indicates an expected call of ForgotPassword.
+func (mr *MockServicerMockRecorder) ForgotPassword(ctx, email interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ForgotPassword", reflect.TypeOf((*MockServicer)(nil).ForgotPassword), ctx, email)
+}
+
+// GetProfile mocks base method.
+func (m *MockServicer) GetProfile(ctx context.Context) (*models.UserData, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetProfile", ctx)
+	ret0, _ := ret[0].(*models.UserData)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetProfile indicates an expected call of GetProfile.
+func (mr *MockServicerMockRecorder) GetProfile(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetProfile", reflect.TypeOf((*MockServicer)(nil).GetProfile), ctx)
+}
+
+// GetUser mocks base method.
+func (m *MockServicer) GetUser(ctx context.Context, userID string) (*models.UserData, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUser", ctx, userID)
+	ret0, _ := ret[0].(*models.UserData)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUser indicates an expected call of GetUser.
+func (mr *MockServicerMockRecorder) GetUser(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUser", reflect.TypeOf((*MockServicer)(nil).GetUser), ctx, userID)
+}
+
+// GetUserAccess mocks base method.
+func (m *MockServicer) GetUserAccess(ctx context.Context, userID string) (*models.Access, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserAccess", ctx, userID)
+	ret0, _ := ret[0].(*models.Access)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserAccess indicates an expected call of GetUserAccess.
+func (mr *MockServicerMockRecorder) GetUserAccess(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserAccess", reflect.TypeOf((*MockServicer)(nil).GetUserAccess), ctx, userID)
+}
+
+// GrantAccess mocks base method.
+func (m *MockServicer) GrantAccess(ctx context.Context, userID string, access *models.Access) (*models.Access, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GrantAccess", ctx, userID, access)
+	ret0, _ := ret[0].(*models.Access)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GrantAccess indicates an expected call of GrantAccess.
+func (mr *MockServicerMockRecorder) GrantAccess(ctx, userID, access interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GrantAccess", reflect.TypeOf((*MockServicer)(nil).GrantAccess), ctx, userID, access)
+}
+
+// Introspect mocks base method.
+func (m *MockServicer) Introspect(ctx context.Context, token, tokenTypeHint string) (*models.Introspection, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Introspect", ctx, token, tokenTypeHint)
+	ret0, _ := ret[0].(*models.Introspection)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Introspect indicates an expected call of Introspect.
+func (mr *MockServicerMockRecorder) Introspect(ctx, token, tokenTypeHint interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Introspect", reflect.TypeOf((*MockServicer)(nil).Introspect), ctx, token, tokenTypeHint)
+}
+
+// JWKS mocks base method.
+func (m *MockServicer) JWKS(ctx context.Context) *models.JWKSet {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "JWKS", ctx)
+	ret0, _ := ret[0].(*models.JWKSet)
+	return ret0
+}
+
+// JWKS indicates an expected call of JWKS.
+func (mr *MockServicerMockRecorder) JWKS(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "JWKS", reflect.TypeOf((*MockServicer)(nil).JWKS), ctx)
+}
+
+// ListSessions mocks base method.
+func (m *MockServicer) ListSessions(ctx context.Context) ([]models.Session, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListSessions", ctx)
+	ret0, _ := ret[0].([]models.Session)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListSessions indicates an expected call of ListSessions.
+func (mr *MockServicerMockRecorder) ListSessions(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListSessions", reflect.TypeOf((*MockServicer)(nil).ListSessions), ctx)
+}
+
+// ListUsers mocks base method.
+func (m *MockServicer) ListUsers(ctx context.Context, query *models.UserQuery) (*models.UserPage, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListUsers", ctx, query)
+	ret0, _ := ret[0].(*models.UserPage)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListUsers indicates an expected call of ListUsers.
+func (mr *MockServicerMockRecorder) ListUsers(ctx, query interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListUsers", reflect.TypeOf((*MockServicer)(nil).ListUsers), ctx, query)
+}
+
+// LogoutUser mocks base method.
+func (m *MockServicer) LogoutUser(ctx context.Context, userID string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "LogoutUser", ctx, userID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// LogoutUser indicates an expected call of LogoutUser.
+func (mr *MockServicerMockRecorder) LogoutUser(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LogoutUser", reflect.TypeOf((*MockServicer)(nil).LogoutUser), ctx, userID)
+}
+
 // RefreshToken mocks base method.
-func (m *MockServicer) RefreshToken(ctx context.Context, accToken, refToken string) (string, string, error) {
+func (m *MockServicer) RefreshToken(ctx context.Context, accToken, refToken, scope string) (*models.UserResp, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "RefreshToken", ctx, accToken, refToken)
-	ret0, _ := ret[0].(string)
-	ret1, _ := ret[1].(string)
-	ret2, _ := ret[2].(error)
-	return ret0, ret1, ret2
+	ret := m.ctrl.Call(m, "RefreshToken", ctx, accToken, refToken, scope)
+	ret0, _ := ret[0].(*models.UserResp)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
 }
 
 // RefreshToken indicates an expected call of RefreshToken.
-func (mr *MockServicerMockRecorder) RefreshToken(ctx, accToken, refToken interface{}) *gomock.Call {
+func (mr *MockServicerMockRecorder) RefreshToken(ctx, accToken, refToken, scope interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RefreshToken", reflect.TypeOf((*MockServicer)(nil).RefreshToken), ctx, accToken, refToken, scope)
+}
+
+// RequestMagicLink mocks base method.
+func (m *MockServicer) RequestMagicLink(ctx context.Context, email string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RequestMagicLink", ctx, email)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RequestMagicLink indicates an expected call of RequestMagicLink.
+func (mr *MockServicerMockRecorder) RequestMagicLink(ctx, email interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RefreshToken", reflect.TypeOf((*MockServicer)(nil).RefreshToken), ctx, accToken, refToken)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RequestMagicLink", reflect.TypeOf((*MockServicer)(nil).RequestMagicLink), ctx, email)
+}
+
+// ResendVerification mocks base method.
+func (m *MockServicer) ResendVerification(ctx context.Context, email string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ResendVerification", ctx, email)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ResendVerification indicates an expected call of ResendVerification.
+func (mr *MockServicerMockRecorder) ResendVerification(ctx, email interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ResendVerification", reflect.TypeOf((*MockServicer)(nil).ResendVerification), ctx, email)
+}
+
+// ResetPassword mocks base method.
+func (m *MockServicer) ResetPassword(ctx context.Context, token, password string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ResetPassword", ctx, token, password)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ResetPassword indicates an expected call of ResetPassword.
+func (mr *MockServicerMockRecorder) ResetPassword(ctx, token, password interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ResetPassword", reflect.TypeOf((*MockServicer)(nil).ResetPassword), ctx, token, password)
+}
+
+// RevokeAccess mocks base method.
+func (m *MockServicer) RevokeAccess(ctx context.Context, userID string, access *models.Access) (*models.Access, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeAccess", ctx, userID, access)
+	ret0, _ := ret[0].(*models.Access)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RevokeAccess indicates an expected call of RevokeAccess.
+func (mr *MockServicerMockRecorder) RevokeAccess(ctx, userID, access interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeAccess", reflect.TypeOf((*MockServicer)(nil).RevokeAccess), ctx, userID, access)
+}
+
+// RevokeAllSessions mocks base method.
+func (m *MockServicer) RevokeAllSessions(ctx context.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeAllSessions", ctx)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokeAllSessions indicates an expected call of RevokeAllSessions.
+func (mr *MockServicerMockRecorder) RevokeAllSessions(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeAllSessions", reflect.TypeOf((*MockServicer)(nil).RevokeAllSessions), ctx)
+}
+
+// RevokeSession mocks base method.
+func (m *MockServicer) RevokeSession(ctx context.Context, sessionID string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeSession", ctx, sessionID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokeSession indicates an expected call of RevokeSession.
+func (mr *MockServicerMockRecorder) RevokeSession(ctx, sessionID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeSession", reflect.TypeOf((*MockServicer)(nil).RevokeSession), ctx, sessionID)
 }
 
 // RevokeToken mocks base method.
-func (m *MockServicer) RevokeToken(ctx context.Context, accToken string) error {
+func (m *MockServicer) RevokeToken(ctx context.Context, token, tokenTypeHint string) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "RevokeToken", ctx, accToken)
+	ret := m.ctrl.Call(m, "RevokeToken", ctx, token, tokenTypeHint)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // RevokeToken indicates an expected call of RevokeToken.
-func (mr *MockServicerMockRecorder) RevokeToken(ctx, accToken interface{}) *gomock.Call {
+func (mr *MockServicerMockRecorder) RevokeToken(ctx, token, tokenTypeHint interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeToken", reflect.TypeOf((*MockServicer)(nil).RevokeToken), ctx, token, tokenTypeHint)
+}
+
+// RotateKeys mocks base method.
+func (m *MockServicer) RotateKeys(ctx context.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RotateKeys", ctx)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RotateKeys indicates an expected call of RotateKeys.
+func (mr *MockServicerMockRecorder) RotateKeys(ctx interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeToken", reflect.TypeOf((*MockServicer)(nil).RevokeToken), ctx, accToken)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RotateKeys", reflect.TypeOf((*MockServicer)(nil).RotateKeys), ctx)
 }
 
 // SignIn mocks base method.
-func (m *MockServicer) SignIn(ctx context.Context, user *models.UserReq) (string, string, error) {
+func (m *MockServicer) SignIn(ctx context.Context, user *models.UserReq) (*models.UserResp, error) {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "SignIn", ctx, user)
-	ret0, _ := ret[0].(string)
-	ret1, _ := ret[1].(string)
-	ret2, _ := ret[2].(error)
-	return ret0, ret1, ret2
+	ret0, _ := ret[0].(*models.UserResp)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
 }
 
 // SignIn indicates an expected call of SignIn.
@@ -94,3 +499,62 @@ func (mr *MockServicerMockRecorder) SignUp(ctx, user interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SignUp", reflect.TypeOf((*MockServicer)(nil).SignUp), ctx, user)
 }
+
+// UpdateProfile mocks base method.
+func (m *MockServicer) UpdateProfile(ctx context.Context, req *models.ProfileUpdate) (*models.UserData, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateProfile", ctx, req)
+	ret0, _ := ret[0].(*models.UserData)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UpdateProfile indicates an expected call of UpdateProfile.
+func (mr *MockServicerMockRecorder) UpdateProfile(ctx, req interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateProfile", reflect.TypeOf((*MockServicer)(nil).UpdateProfile), ctx, req)
+}
+
+// UpdateUser mocks base method.
+func (m *MockServicer) UpdateUser(ctx context.Context, userID string, req *models.AdminUserUpdate) (*models.UserData, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateUser", ctx, userID, req)
+	ret0, _ := ret[0].(*models.UserData)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UpdateUser indicates an expected call of UpdateUser.
+func (mr *MockServicerMockRecorder) UpdateUser(ctx, userID, req interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateUser", reflect.TypeOf((*MockServicer)(nil).UpdateUser), ctx, userID, req)
+}
+
+// VerifyEmail mocks base method.
+func (m *MockServicer) VerifyEmail(ctx context.Context, token string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "VerifyEmail", ctx, token)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// VerifyEmail indicates an expected call of VerifyEmail.
+func (mr *MockServicerMockRecorder) VerifyEmail(ctx, token interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "VerifyEmail", reflect.TypeOf((*MockServicer)(nil).VerifyEmail), ctx, token)
+}
+
+// VerifyMagicLink mocks base method.
+func (m *MockServicer) VerifyMagicLink(ctx context.Context, req *models.MagicLinkVerifyReq) (*models.UserResp, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "VerifyMagicLink", ctx, req)
+	ret0, _ := ret[0].(*models.UserResp)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// VerifyMagicLink indicates an expected call of VerifyMagicLink.
+func (mr *MockServicerMockRecorder) VerifyMagicLink(ctx, req interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "VerifyMagicLink", reflect.TypeOf((*MockServicer)(nil).VerifyMagicLink), ctx, req)
+}
@@ -0,0 +1,118 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/smtp"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"auth-rest-api/internal/models"
+)
+
+type Mailer interface {
+	Send(ctx context.Context, mail *models.Mail) error
+}
+
+// SMTP delivers mail through an SMTP relay, PLAIN auth is used when a username is set
+type SMTP struct {
+	Addr     string
+	Host     string
+	Username string
+	Password string
+	From     string
+}
+
+func NewSMTP(host string, port int, username, password, from string) *SMTP {
+	return &SMTP{
+		Addr:     net.JoinHostPort(host, strconv.Itoa(port)),
+		Host:     host,
+		Username: username,
+		Password: password,
+		From:     from,
+	}
+}
+
+func (m *SMTP) Send(_ context.Context, mail *models.Mail) error {
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+
+	return smtp.SendMail(m.Addr, auth, m.From, []string{mail.To}, message(m.From, mail))
+}
+
+// File appends every mail to a file for local testing, with an empty path mails are written to the log
+type File struct {
+	mu     sync.Mutex
+	Path   string
+	Logger *slog.Logger
+}
+
+func NewFile(path string, logger *slog.Logger) *File {
+	return &File{Path: path, Logger: logger}
+}
+
+func (m *File) Send(ctx context.Context, mail *models.Mail) error {
+	if m.Path == "" {
+		m.Logger.LogAttrs(ctx, slog.LevelInfo, "mail sent", slog.String("to", mail.To),
+			slog.String("subject", mail.Subject), slog.String("body", mail.Body))
+
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f, err := os.OpenFile(m.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(append(message("no-reply@localhost", mail), []byte("\r\n")...))
+
+	return errors.Join(err, f.Close())
+}
+
+// FromEnv selects the mailer with MAILER: "smtp" uses the SMTP_* envs, "file" writes to MAIL_FILE
+// and anything else logs the mails
+func FromEnv(logger *slog.Logger) (Mailer, error) {
+	switch os.Getenv("MAILER") {
+	case "smtp":
+		host := os.Getenv("SMTP_HOST")
+		if host == "" {
+			return nil, models.ErrRequired("SMTP_HOST")
+		}
+
+		port, err := strconv.Atoi(os.Getenv("SMTP_PORT"))
+		if err != nil {
+			port = 587
+		}
+
+		return NewSMTP(host, port, os.Getenv("SMTP_USERNAME"), os.Getenv("SMTP_PASSWORD"), os.Getenv("SMTP_FROM")), nil
+	case "file":
+		return NewFile(os.Getenv("MAIL_FILE"), logger), nil
+	default:
+		return NewFile("", logger), nil
+	}
+}
+
+func message(from string, mail *models.Mail) []byte {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", mail.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mail.Subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(mail.Body, "\n", "\r\n"))
+
+	return []byte(b.String())
+}
@@ -0,0 +1,51 @@
+package mailer
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"auth-rest-api/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFile_Send(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mail.log")
+	m := NewFile(path, slog.New(slog.NewJSONHandler(os.Stdout, nil)))
+
+	require.NoError(t, m.Send(context.Background(), &models.Mail{To: "sumit@kumar.com", Subject: "first", Body: "hello\nthere"}))
+	require.NoError(t, m.Send(context.Background(), &models.Mail{To: "sumit@kumar.com", Subject: "second", Body: "bye"}))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	assert.Contains(t, string(data), "To: sumit@kumar.com\r\nSubject: first\r\n")
+	assert.Contains(t, string(data), "hello\r\nthere")
+	assert.Contains(t, string(data), "Subject: second\r\n")
+}
+
+func TestFromEnv(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+
+	t.Setenv("MAILER", "smtp")
+	t.Setenv("SMTP_HOST", "")
+
+	_, err := FromEnv(logger)
+	assert.Equal(t, models.ErrRequired("SMTP_HOST"), err)
+
+	t.Setenv("SMTP_HOST", "mail.example.com")
+
+	m, err := FromEnv(logger)
+	require.NoError(t, err)
+	assert.Equal(t, "mail.example.com:587", m.(*SMTP).Addr)
+
+	t.Setenv("MAILER", "")
+
+	m, err = FromEnv(logger)
+	require.NoError(t, err)
+	assert.IsType(t, &File{}, m)
+}
@@ -0,0 +1,32 @@
+package models
+
+import "regexp"
+
+// RoleAdmin is the role of the operators managing other users
+const RoleAdmin = "admin"
+
+// accessNameRegex allows names like admin or users:write
+var accessNameRegex = regexp.MustCompile(`^[a-z][a-z0-9_.:-]{0,63}$`)
+
+// Access holds the roles and permissions of a user, both are embedded in the access tokens
+type Access struct {
+	Roles       []string `json:"roles"`
+	Permissions []string `json:"permissions"`
+}
+
+// Validate checks the role and permission names
+func (a *Access) Validate() error {
+	for _, role := range a.Roles {
+		if !accessNameRegex.MatchString(role) {
+			return ErrInvalid("role")
+		}
+	}
+
+	for _, permission := range a.Permissions {
+		if !accessNameRegex.MatchString(permission) {
+			return ErrInvalid("permission")
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,29 @@
+package models
+
+const (
+	// DefaultUserPageSize and MaxUserPageSize bound the users returned by one call of GET /admin/users
+	DefaultUserPageSize = 50
+	MaxUserPageSize     = 200
+)
+
+// UserQuery selects a page of users, Cursor is the NextCursor of the previous page
+type UserQuery struct {
+	Cursor      string
+	EmailPrefix string
+	Limit       int
+}
+
+// UserPage is a page of users, NextCursor is empty on the last page
+type UserPage struct {
+	Users      []UserData `json:"users"`
+	NextCursor string     `json:"nextCursor,omitempty"`
+}
+
+// AdminUserUpdate is the body of PATCH /admin/users/{id}, fields left out are not changed. Name, locale
+// and metadata behave like in PATCH /me.
+type AdminUserUpdate struct {
+	ProfileUpdate
+	Email    *string     `json:"email"`
+	Verified *bool       `json:"verified"`
+	Status   *UserStatus `json:"status"`
+}
@@ -1,8 +1,10 @@
 package models
 
 import (
+	"errors"
 	"fmt"
 	"strings"
+	"time"
 )
 
 const (
@@ -16,14 +18,57 @@ var (
 	ErrTokenRevoked      = constError("token is revoked")
 	ErrUserAlreadyExists = constError("user already exists")
 	ErrPsswdNotMatch     = constError("password does not match")
+	ErrRefreshTokenReuse = constError("refresh token reuse detected")
+	ErrEmailNotVerified  = constError("email is not verified")
+	ErrInvalidMFACode    = constError("invalid authentication code")
+	ErrInvalidSignInCode = constError("invalid sign in code")
+	ErrTooManyAttempts   = constError("too many attempts")
+	ErrMFAEnabled        = constError("mfa is already enabled")
+	ErrMFANotEnrolled    = constError("mfa enrollment not started")
+	ErrPasskeyExists     = constError("passkey already registered")
+	ErrPasskeyCloned     = constError("passkey may be cloned")
+	ErrInvalidScope      = constError("invalid scope")
+	ErrAccountDisabled   = constError("account is disabled")
+	ErrAccountLocked     = constError("account is locked")
+	ErrSignInLocked      = constError("too many failed sign ins, account is temporarily locked")
+	ErrKeyRingChanged    = constError("key ring was changed by another process")
+	ErrNoKeyEncryption   = constError("JWT_KEY_ENCRYPTION_KEY is required for signing keys kept in the store")
 )
 
 // CustomError error wrapper for sending in http response
 type CustomError struct {
-	Code    int    `json:"code"`
+	Code    int          `json:"code"`
+	Error   string       `json:"error,omitempty"`
+	Message string       `json:"message"`
+	Fields  []FieldError `json:"fields,omitempty"`
+}
+
+// FieldError is one rule a field of the request broke
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
 	Message string `json:"message"`
 }
 
+// ValidationError lists every rule the request broke, not only the first one
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		msgs[i] = f.Message
+	}
+
+	return strings.Join(msgs, "; ")
+}
+
+// Add records a broken rule of field
+func (e *ValidationError) Add(field, code, message string) {
+	e.Fields = append(e.Fields, FieldError{Field: field, Code: code, Message: message})
+}
+
 type constError string
 
 func NewConstError(message string) constError {
@@ -49,8 +94,57 @@ func ErrNotFound(entity string) error {
 	return NewConstError(fmt.Sprintf(notFoundFormat, entity))
 }
 
+// badRequestError marks an error as caused by invalid client input
+type badRequestError struct {
+	err error
+}
+
+func (e badRequestError) Error() string {
+	return e.err.Error()
+}
+
+func (e badRequestError) Unwrap() error {
+	return e.err
+}
+
 func ErrBadRequest(err error) error {
-	return NewConstError(err.Error())
+	return badRequestError{err: err}
+}
+
+// IsBadRequest reports whether err was wrapped with ErrBadRequest
+func IsBadRequest(err error) bool {
+	var br badRequestError
+
+	return errors.As(err, &br)
+}
+
+// retryAfterError tells the client how long to wait before trying again
+type retryAfterError struct {
+	err   error
+	after time.Duration
+}
+
+func (e retryAfterError) Error() string {
+	return e.err.Error()
+}
+
+func (e retryAfterError) Unwrap() error {
+	return e.err
+}
+
+func ErrRetryAfter(err error, after time.Duration) error {
+	return retryAfterError{err: err, after: after}
+}
+
+// RetryAfter returns the wait attached to err with ErrRetryAfter
+func RetryAfter(err error) (time.Duration, bool) {
+	var ra retryAfterError
+
+	if !errors.As(err, &ra) {
+		return 0, false
+	}
+
+	return ra.after, true
 }
 
 func ErrInvalid(entity string) error {
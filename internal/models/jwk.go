@@ -0,0 +1,39 @@
+package models
+
+// JWK is the public part of a signing key as described in RFC 7517
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// EC and OKP
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// JWKSet is the document published at /.well-known/jwks.json
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// StoredKey is a signing key of a key ring shared through the store. Times are unix milliseconds, an
+// ActiveFrom of 0 marks a key only used for verification and a RetireAt of 0 a key that is not rotated out.
+type StoredKey struct {
+	ID  string `json:"id"`
+	Alg string `json:"alg"`
+	// Private is the HMAC secret or the PKCS #8 private key encrypted with the key encryption key, empty
+	// for keys provided by configuration
+	Private    []byte `json:"private,omitempty"`
+	ActiveFrom int64  `json:"activeFrom"`
+	RetireAt   int64  `json:"retireAt,omitempty"`
+}
+
+// KeyRingState is a stored key ring, Version counts the saves and is 0 for a ring that was never saved
+type KeyRingState struct {
+	Version int64
+	Keys    []StoredKey
+}
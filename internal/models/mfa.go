@@ -0,0 +1,32 @@
+package models
+
+const (
+	MFAMethodTOTP     = "totp"
+	MFAMethodRecovery = "recovery_code"
+	MFAMethodPasskey  = "passkey"
+)
+
+// TOTP is the authenticator app enrollment of a user, it is enabled once the first code is confirmed
+type TOTP struct {
+	Secret  string
+	Enabled bool
+	// LastStep is the time step of the last accepted code, codes of that step or older are rejected
+	LastStep int64
+}
+
+// TOTPEnrollment is returned when enrolling an authenticator app
+type TOTPEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauthUri"`
+}
+
+// RecoveryCodes are shown once when MFA is enabled, each code can replace one authentication code
+type RecoveryCodes struct {
+	Codes []string `json:"recoveryCodes"`
+}
+
+// MFASignInReq completes a sign in with the challenge token and an authentication or recovery code
+type MFASignInReq struct {
+	MFAToken string `json:"mfaToken"`
+	Code     string `json:"code"`
+}
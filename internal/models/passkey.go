@@ -0,0 +1,49 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Passkey is a WebAuthn credential registered by a user
+type Passkey struct {
+	// ID is the base64url encoded credential ID
+	ID              string   `json:"id"`
+	UserID          string   `json:"-"`
+	Name            string   `json:"name,omitempty"`
+	PublicKey       []byte   `json:"-"`
+	AttestationType string   `json:"-"`
+	AAGUID          []byte   `json:"-"`
+	Transports      []string `json:"transports,omitempty"`
+	// SignCount is the last signature counter reported by the authenticator, a counter that does not
+	// grow points to a cloned authenticator
+	SignCount      uint32     `json:"-"`
+	CloneWarning   bool       `json:"cloneWarning"`
+	BackupEligible bool       `json:"backupEligible"`
+	BackupState    bool       `json:"backupState"`
+	CreatedAt      time.Time  `json:"createdAt"`
+	LastUsedAt     *time.Time `json:"lastUsedAt,omitempty"`
+}
+
+// PasskeyCeremony starts a registration or sign in with a passkey. Options are passed to
+// navigator.credentials.create() or get(), the session token is sent back with the result.
+type PasskeyCeremony struct {
+	SessionToken string `json:"sessionToken"`
+	Options      any    `json:"options"`
+}
+
+// PasskeyRegistrationReq finishes a registration with the attestation response of the browser
+type PasskeyRegistrationReq struct {
+	SessionToken string          `json:"sessionToken"`
+	Name         string          `json:"name"`
+	Credential   json.RawMessage `json:"credential"`
+}
+
+// PasskeySignInReq finishes a sign in with the assertion response of the browser
+type PasskeySignInReq struct {
+	SessionToken string          `json:"sessionToken"`
+	Credential   json.RawMessage `json:"credential"`
+	// Scope limits the tokens of a sign in with the passkey alone, a second factor keeps the scope
+	// asked for with the password
+	Scope string `json:"scope,omitempty"`
+}
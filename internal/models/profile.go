@@ -0,0 +1,75 @@
+package models
+
+import (
+	"regexp"
+	"unicode/utf8"
+)
+
+const (
+	maxNameLength     = 100
+	maxMetadataKeys   = 20
+	maxMetadataKeyLen = 40
+	maxMetadataValLen = 500
+)
+
+var localeRegex = regexp.MustCompile(`^[a-zA-Z]{2,3}(-[a-zA-Z0-9]{2,8})*$`)
+
+// ProfileUpdate is the body of PATCH /me, fields left out are not changed. Metadata is merged into
+// the stored metadata, a key with an empty value is removed.
+type ProfileUpdate struct {
+	Name     *string           `json:"name"`
+	Locale   *string           `json:"locale"`
+	Metadata map[string]string `json:"metadata"`
+}
+
+// Apply writes the update onto the user record
+func (p *ProfileUpdate) Apply(u *UserData) {
+	if p.Name != nil {
+		u.Name = *p.Name
+	}
+
+	if p.Locale != nil {
+		u.Locale = *p.Locale
+	}
+
+	if len(p.Metadata) == 0 {
+		return
+	}
+
+	if u.Metadata == nil {
+		u.Metadata = make(map[string]string, len(p.Metadata))
+	}
+
+	for k, v := range p.Metadata {
+		if v == "" {
+			delete(u.Metadata, k)
+			continue
+		}
+
+		u.Metadata[k] = v
+	}
+}
+
+// ValidateProfile checks the editable fields of the user record
+func ValidateProfile(u *UserData) error {
+	if utf8.RuneCountInString(u.Name) > maxNameLength {
+		return ErrInvalid("name")
+	}
+
+	// BCP 47 language tag, e.g. en or pt-BR
+	if u.Locale != "" && !localeRegex.MatchString(u.Locale) {
+		return ErrInvalid("locale")
+	}
+
+	if len(u.Metadata) > maxMetadataKeys {
+		return ErrInvalid("metadata")
+	}
+
+	for k, v := range u.Metadata {
+		if k == "" || len(k) > maxMetadataKeyLen || len(v) > maxMetadataValLen {
+			return ErrInvalid("metadata")
+		}
+	}
+
+	return nil
+}
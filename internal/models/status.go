@@ -0,0 +1,31 @@
+package models
+
+// UserStatus is the state of an account, only active accounts and, unless verified emails are
+// required, accounts pending verification get tokens
+type UserStatus string
+
+const (
+	StatusActive UserStatus = "active"
+	// StatusDisabled is set for offboarded or compromised accounts
+	StatusDisabled UserStatus = "disabled"
+	// StatusLocked blocks the account until an admin unlocks it
+	StatusLocked UserStatus = "locked"
+	// StatusPendingVerification is the status of new accounts and accounts with a changed email until
+	// the address is verified
+	StatusPendingVerification UserStatus = "pending_verification"
+)
+
+// Validate checks that s is one of the known statuses
+func (s UserStatus) Validate() error {
+	switch s {
+	case StatusActive, StatusDisabled, StatusLocked, StatusPendingVerification:
+		return nil
+	}
+
+	return ErrInvalid("status")
+}
+
+// Blocked tells whether the status ends the sessions of the user
+func (s UserStatus) Blocked() bool {
+	return s == StatusDisabled || s == StatusLocked
+}
@@ -1,11 +1,17 @@
 package models
 
+import "time"
+
 type TokenResponse struct {
 	AccessToken  string `json:"token,omitempty"`
 	RefreshToken string `json:"refresh_token,omitempty"`
 }
 
 type TokenData struct {
+	// FamilyID groups every refresh token issued through rotation from one sign in
+	FamilyID string
+	// Client that requested the tokens
+	Client ClientInfo
 	// Access Token details
 	AccessToken     string
 	AccessID        string
@@ -15,3 +21,52 @@ type TokenData struct {
 	RefreshID        string
 	RefreshExpiresAt int64
 }
+
+// ClientInfo describes the device a request came from
+type ClientInfo struct {
+	IP        string `json:"ip"`
+	UserAgent string `json:"userAgent"`
+}
+
+// TokenFamily tracks the currently valid token pair of a refresh token family, every family is
+// one session of the user
+type TokenFamily struct {
+	ID          string
+	Email       string
+	AccessID    string
+	RefreshID   string
+	Client      ClientInfo
+	CreatedAt   int64
+	RefreshedAt int64
+}
+
+// Session is a token family as shown to its user
+type Session struct {
+	ID              string    `json:"id"`
+	UserAgent       string    `json:"userAgent"`
+	IP              string    `json:"ip"`
+	CreatedAt       time.Time `json:"createdAt"`
+	LastRefreshedAt time.Time `json:"lastRefreshedAt"`
+	Current         bool      `json:"current"`
+}
+
+const (
+	TokenTypeAccess  = "access_token"
+	TokenTypeRefresh = "refresh_token"
+)
+
+// Introspection is the RFC 7662 token introspection response, only Active is set for inactive tokens
+type Introspection struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	Username  string `json:"username,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	Exp       int64  `json:"exp,omitempty"`
+	Iat       int64  `json:"iat,omitempty"`
+	Sub       string `json:"sub,omitempty"`
+	Iss       string `json:"iss,omitempty"`
+	Jti       string `json:"jti,omitempty"`
+	// Roles and Permissions are extensions carried by access tokens
+	Roles       []string `json:"roles,omitempty"`
+	Permissions []string `json:"permissions,omitempty"`
+}
@@ -1,24 +1,63 @@
 package models
 
 import (
-	"regexp"
 	"strings"
+	"time"
+
+	"auth-rest-api/internal/emailaddr"
 )
 
 type UserReq struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
+	// Scope optionally limits the tokens of a sign in, scopes are separated by spaces
+	Scope string `json:"scope,omitempty"`
 }
 
+// UserResp is the result of a sign in, either the token pair or the challenge for the second factor
 type UserResp struct {
-	Email        string `json:"email,omitempty"`
-	AccessToken  string `json:"accessToken,omitempty"`
-	RefreshToken string `json:"refreshToken,omitempty"`
+	Email        string   `json:"email,omitempty"`
+	AccessToken  string   `json:"accessToken,omitempty"`
+	RefreshToken string   `json:"refreshToken,omitempty"`
+	Scope        string   `json:"scope,omitempty"`
+	MFAToken     string   `json:"mfaToken,omitempty"`
+	MFAMethods   []string `json:"mfaMethods,omitempty"`
 }
 
+// UserData is the user record, it is keyed by the stable ID so the email can change
 type UserData struct {
+	ID          string            `json:"id"`
+	Email       string            `json:"email"`
+	Password    []byte            `json:"-"`
+	Verified    bool              `json:"verified"`
+	Name        string            `json:"name,omitempty"`
+	Locale      string            `json:"locale,omitempty"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+	CreatedAt   time.Time         `json:"createdAt"`
+	LastLoginAt *time.Time        `json:"lastLoginAt,omitempty"`
+	MFAEnabled  bool              `json:"mfaEnabled"`
+	Status      UserStatus        `json:"status"`
+	TOTP        *TOTP             `json:"-"`
+}
+
+// PasswordChangeReq is the body of POST /me/password
+type PasswordChangeReq struct {
+	CurrentPassword     string `json:"currentPassword"`
+	NewPassword         string `json:"newPassword"`
+	RevokeOtherSessions bool   `json:"revokeOtherSessions"`
+}
+
+// EmailChangeReq is the body of POST /me/email, the current password confirms the change
+type EmailChangeReq struct {
 	Email    string `json:"email"`
-	Password []byte `json:"-"`
+	Password string `json:"password"`
+}
+
+// Mail is a message sent through the configured mailer
+type Mail struct {
+	To      string
+	Subject string
+	Body    string
 }
 
 func (u *UserReq) Validate() error {
@@ -26,38 +65,60 @@ func (u *UserReq) Validate() error {
 		return err
 	}
 
-	if err := validatePassword(u.Password); err != nil {
+	if err := ValidatePassword(u.Password); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-func ValidateEmail(email string) error {
-	email = strings.ToLower(strings.TrimSpace(email))
-	emailRegex := regexp.MustCompile(`^[a-z0-9._%+\-]+@[a-z0-9.\-]+\.[a-z]{2,4}$`)
+func (p *PasswordChangeReq) Validate() error {
+	if strings.TrimSpace(p.CurrentPassword) == "" {
+		return ErrRequired("current password")
+	}
 
-	if email == "" {
-		return ErrRequired("email")
+	return ValidatePassword(p.NewPassword)
+}
+
+func (e *EmailChangeReq) Validate() error {
+	if err := ValidateEmail(e.Email); err != nil {
+		return err
 	}
 
-	if !emailRegex.MatchString(email) {
-		return ErrInvalid("email")
+	if strings.TrimSpace(e.Password) == "" {
+		return ErrRequired("password")
 	}
 
 	return nil
 }
 
-func validatePassword(password string) error {
-	passwd := strings.TrimSpace(password)
+// ValidateEmail checks email is an RFC 5322 address, see emailaddr.Parse
+func ValidateEmail(email string) error {
+	if strings.TrimSpace(email) == "" {
+		return ErrRequired("email")
+	}
 
-	if passwd == "" {
-		return ErrRequired("password")
+	if _, err := emailaddr.Parse(email); err != nil {
+		return ErrInvalid("email")
 	}
 
-	if len(passwd) < 8 {
-		return ErrInvalid("password")
+	return nil
+}
+
+// ValidatePassword only checks that a password was sent, the length and the other rules of a new
+// password are the password policy of the service
+func ValidatePassword(password string) error {
+	if strings.TrimSpace(password) == "" {
+		return ErrRequired("password")
 	}
 
 	return nil
 }
+
+// MagicLinkVerifyReq signs in with the token of a magic link or with the email and the code of the mail
+type MagicLinkVerifyReq struct {
+	Token string `json:"token"`
+	Email string `json:"email"`
+	Code  string `json:"code"`
+	Scope string `json:"scope,omitempty"`
+}
@@ -14,7 +14,7 @@ func TestUserReq_Validate(t *testing.T) {
 		{name: "valid case", user: &UserReq{Email: "sumit@kumar.com", Password: "sumit@kumar"}, wantErr: nil},
 		{name: "missing email", user: &UserReq{Email: "", Password: "sumit@kumar"}, wantErr: ErrRequired("email")},
 		{name: "missing password", user: &UserReq{Email: "sumit@kumar.com", Password: ""}, wantErr: ErrRequired("password")},
-		{name: "passwd len < 8", user: &UserReq{Email: "sumit@kumar.com", Password: "sumit"}, wantErr: ErrInvalid("password")},
+		{name: "short password is left to the policy", user: &UserReq{Email: "sumit@kumar.com", Password: "sumit"}, wantErr: nil},
 	}
 
 	for i, tt := range tests {
@@ -34,6 +34,9 @@ func TestValidateEmail(t *testing.T) {
 	}{
 		{name: "valid csae", email: "sumit@kumar.com", wantErr: nil},
 		{name: "invalid email", email: "sumit@kumar", wantErr: ErrInvalid("email")},
+		{name: "long top level domain", email: "sumit@kumar.engineering", wantErr: nil},
+		{name: "internationalized domain", email: "sumit@bücher.de", wantErr: nil},
+		{name: "double dot", email: "sumit..kumar@kumar.com", wantErr: ErrInvalid("email")},
 		{name: "invalid email", email: "", wantErr: ErrRequired("email")},
 	}
 
@@ -46,19 +49,20 @@ func TestValidateEmail(t *testing.T) {
 	}
 }
 
-func Test_validatePassword(t *testing.T) {
+func TestValidatePassword(t *testing.T) {
 	tests := []struct {
 		name     string
 		password string
 		wantErr  error
 	}{
 		{name: "valid case", password: "sumit@kumar", wantErr: nil},
-		{name: "passwd len < 8", password: "sumit", wantErr: ErrInvalid("password")},
+		{name: "short password is left to the policy", password: "sumit", wantErr: nil},
 		{name: "missing password", password: "", wantErr: ErrRequired("password")},
+		{name: "blank password", password: "   ", wantErr: ErrRequired("password")},
 	}
 	for i, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if err := validatePassword(tt.password); tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+			if err := ValidatePassword(tt.password); tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
 				t.Errorf("Test[%d] Failed - %s\nExp:%v\nGot:%v", i, tt.name, err, tt.wantErr)
 			}
 		})
@@ -2,12 +2,17 @@ package server
 
 import (
 	"context"
-	"encoding/json"
+	"crypto/subtle"
+	"fmt"
 	"log/slog"
+	"net"
 	"net/http"
 	"os"
+	"slices"
 	"strings"
 
+	"auth-rest-api/internal/models"
+
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 )
@@ -17,10 +22,17 @@ type ContextKey string
 const (
 	CorrelationID ContextKey = "correlationId"
 	Logger        ContextKey = "logger"
+	// Claims holds the verified claims of the bearer access token
+	Claims ContextKey = "claims"
+	// Client holds the models.ClientInfo of the caller
+	Client ContextKey = "client"
 )
 
 type Middleware func(http.HandlerFunc) http.HandlerFunc
 
+// TokenVerifier validates a bearer access token and returns its claims
+type TokenVerifier func(ctx context.Context, token string) (jwt.Claims, error)
+
 func Chain(f http.HandlerFunc, middlewares ...Middleware) http.HandlerFunc {
 	for _, m := range middlewares {
 		f = m(f)
@@ -30,9 +42,12 @@ func Chain(f http.HandlerFunc, middlewares ...Middleware) http.HandlerFunc {
 }
 
 func AddCorrelation() Middleware {
+	trustProxy := os.Getenv("TRUST_PROXY_HEADERS") == "true"
+
 	return func(f http.HandlerFunc) http.HandlerFunc {
 		return func(w http.ResponseWriter, r *http.Request) {
 			corrID := uuid.NewString()
+			client := models.ClientInfo{IP: clientIP(r, trustProxy), UserAgent: r.UserAgent()}
 
 			logger := slog.With(slog.Group("request",
 				slog.String(string(CorrelationID), corrID),
@@ -43,13 +58,16 @@ func AddCorrelation() Middleware {
 			))
 
 			ctx := context.WithValue(r.Context(), Logger, logger)
+			ctx = context.WithValue(ctx, Client, client)
 
 			f(w, r.WithContext(context.WithValue(ctx, CorrelationID, corrID)))
 		}
 	}
 }
 
-func AuthMiddleware() Middleware {
+// AuthMiddleware rejects requests without a valid bearer access token, the verified claims are
+// stored in the request context under Claims
+func AuthMiddleware(verify TokenVerifier) Middleware {
 	return func(f http.HandlerFunc) http.HandlerFunc {
 		return func(w http.ResponseWriter, r *http.Request) {
 			authHeader := r.Header.Get("Authorization")
@@ -60,25 +78,155 @@ func AuthMiddleware() Middleware {
 
 			tokenString := strings.TrimPrefix(authHeader, "Bearer ")
 
-			token, err := jwt.Parse(tokenString, func(_ *jwt.Token) (any, error) {
-				return getJWTSecret(), nil
-			})
-			if err != nil || !token.Valid {
-				slog.Log(context.Background(), slog.LevelError, "invalid token", slog.String("token", tokenString))
+			claims, err := verify(r.Context(), tokenString)
+			if err != nil {
+				slog.Log(context.Background(), slog.LevelError, "invalid token", slog.String("error", err.Error()))
 				http.Error(w, "Invalid token", http.StatusUnauthorized)
 				return
 			}
 
+			f(w, r.WithContext(context.WithValue(r.Context(), Claims, claims)))
+		}
+	}
+}
+
+// Authorization is implemented by the claims AuthMiddleware stores in the request context
+type Authorization interface {
+	HasRole(role string) bool
+	HasPermission(permission string) bool
+	HasScope(scope string) bool
+}
+
+// RequireRole lets requests through whose access token carries at least one of the roles. It reads the
+// claims stored by AuthMiddleware, so it has to come before AuthMiddleware in Chain.
+func RequireRole(roles ...string) Middleware {
+	return requireAccess(func(a Authorization) bool {
+		return slices.ContainsFunc(roles, a.HasRole)
+	}, forbidden)
+}
+
+// RequirePermission lets requests through whose access token carries every one of the permissions,
+// like RequireRole it has to come before AuthMiddleware in Chain
+func RequirePermission(permissions ...string) Middleware {
+	return requireAccess(func(a Authorization) bool {
+		return hasAll(permissions, a.HasPermission)
+	}, forbidden)
+}
+
+// RequireScopes lets requests through whose access token was granted every one of the scopes, other
+// requests get 403 with an insufficient_scope challenge (RFC 6750). Like RequireRole it has to come
+// before AuthMiddleware in Chain.
+func RequireScopes(scopes ...string) Middleware {
+	challenge := fmt.Sprintf(`Bearer error="insufficient_scope", scope="%s"`, strings.Join(scopes, " "))
+
+	return requireAccess(func(a Authorization) bool {
+		return hasAll(scopes, a.HasScope)
+	}, func(w http.ResponseWriter) {
+		w.Header().Set("WWW-Authenticate", challenge)
+		http.Error(w, "insufficient_scope", http.StatusForbidden)
+	})
+}
+
+func hasAll(values []string, has func(string) bool) bool {
+	for _, v := range values {
+		if !has(v) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func forbidden(w http.ResponseWriter) {
+	http.Error(w, "Forbidden", http.StatusForbidden)
+}
+
+func requireAccess(allowed func(Authorization) bool, deny func(w http.ResponseWriter)) Middleware {
+	return func(f http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := r.Context().Value(Claims).(Authorization)
+			if !ok {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			if !allowed(claims) {
+				deny(w)
+				return
+			}
+
+			f(w, r)
+		}
+	}
+}
+
+// clientIP returns the caller address, X-Forwarded-For is only trusted behind a known proxy
+func clientIP(r *http.Request, trustProxy bool) string {
+	if trustProxy {
+		if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
+			ip, _, _ := strings.Cut(fwd, ",")
+			return strings.TrimSpace(ip)
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+// RequireAPIKey guards operator endpoints with a static key sent in the X-API-Key header,
+// the endpoint is disabled when no key is configured
+func RequireAPIKey(key string) Middleware {
+	return func(f http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if key == "" {
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+
+			if subtle.ConstantTimeCompare([]byte(r.Header.Get("X-API-Key")), []byte(key)) != 1 {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			f(w, r)
+		}
+	}
+}
+
+// RequireClientCredentials authenticates the calling client with HTTP Basic credentials
+// (client_id:client_secret) as used by the OAuth token endpoints
+func RequireClientCredentials(clients map[string]string) Middleware {
+	return func(f http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			id, secret, ok := r.BasicAuth()
+
+			expected, known := clients[id]
+			if !ok || !known || subtle.ConstantTimeCompare([]byte(secret), []byte(expected)) != 1 {
+				w.Header().Set("WWW-Authenticate", `Basic realm="auth-rest-api"`)
+				http.Error(w, "invalid_client", http.StatusUnauthorized)
+
+				return
+			}
+
 			f(w, r)
 		}
 	}
 }
 
-func getJWTSecret() []byte {
-	secret := os.Getenv("ACCESS_SECRET")
-	if secret == "" {
-		return json.RawMessage("my_secret_key")
+// ParseClients reads a comma separated list of client_id:client_secret pairs
+func ParseClients(list string) map[string]string {
+	clients := make(map[string]string)
+
+	for _, pair := range strings.Split(list, ",") {
+		id, secret, ok := strings.Cut(strings.TrimSpace(pair), ":")
+		if ok && id != "" && secret != "" {
+			clients[id] = secret
+		}
 	}
 
-	return json.RawMessage(secret)
+	return clients
 }
@@ -0,0 +1,417 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"auth-rest-api/internal/models"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+const rateLimitPrefix = "ratelimit:"
+
+// RateAlgorithm decides how requests of a period are spread
+type RateAlgorithm string
+
+const (
+	// TokenBucket allows bursts of up to Requests, the bucket refills evenly over Period
+	TokenBucket RateAlgorithm = "token-bucket"
+	// SlidingWindow allows Requests within any Period long window
+	SlidingWindow RateAlgorithm = "sliding-window"
+)
+
+// RateKey picks the caller a request is counted for
+type RateKey func(r *http.Request) string
+
+// RateLimitRule is the limit of one route
+type RateLimitRule struct {
+	Algorithm RateAlgorithm
+	Requests  int
+	Period    time.Duration
+	Key       RateKey
+}
+
+// RateDecision is the answer of a RateLimiter for one request
+type RateDecision struct {
+	Allowed   bool
+	Remaining int
+	// Reset is the time until the quota is fully restored, RetryAfter the time until the next request
+	// is allowed when this one was not
+	Reset      time.Duration
+	RetryAfter time.Duration
+}
+
+// RateLimiter counts a request for key against the rule
+type RateLimiter interface {
+	Allow(ctx context.Context, key string, rule RateLimitRule) (*RateDecision, error)
+}
+
+// KeyByIP counts requests per client IP, it reads the client stored by AddCorrelation
+func KeyByIP(r *http.Request) string {
+	if client, ok := r.Context().Value(Client).(models.ClientInfo); ok && client.IP != "" {
+		return "ip:" + client.IP
+	}
+
+	return "ip:" + clientIP(r, false)
+}
+
+// KeyByUser counts requests per token subject, requests without verified claims are counted per IP
+func KeyByUser(r *http.Request) string {
+	if claims, ok := r.Context().Value(Claims).(jwt.Claims); ok {
+		if sub, err := claims.GetSubject(); err == nil && sub != "" {
+			return "user:" + sub
+		}
+	}
+
+	return KeyByIP(r)
+}
+
+// KeyByRoute counts every request of the route together
+func KeyByRoute(_ *http.Request) string {
+	return "route"
+}
+
+// RateLimit rejects requests over the rule with 429 and a Retry-After header, every response carries
+// the RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset headers. Requests are counted per route
+// pattern and key. It reads the client and claims stored by AddCorrelation and AuthMiddleware, so it
+// has to come before both in Chain. Requests pass when the limiter fails.
+func RateLimit(limiter RateLimiter, rule RateLimitRule) Middleware {
+	if rule.Key == nil {
+		rule.Key = KeyByIP
+	}
+
+	policy := fmt.Sprintf("%d;w=%d", rule.Requests, int64(rule.Period.Seconds()))
+
+	return func(f http.HandlerFunc) http.HandlerFunc {
+		// a rule without requests or a deployment without a limiter leaves the route unlimited
+		if limiter == nil || rule.Requests <= 0 || rule.Period <= 0 {
+			return f
+		}
+
+		return func(w http.ResponseWriter, r *http.Request) {
+			key := r.Pattern + ":" + rule.Key(r)
+
+			decision, err := limiter.Allow(r.Context(), key, rule)
+			if err != nil {
+				slog.Log(r.Context(), slog.LevelError, "rate limiter failed", slog.String("key", key),
+					slog.String("error", err.Error()))
+				f(w, r)
+
+				return
+			}
+
+			w.Header().Set("RateLimit-Policy", policy)
+			w.Header().Set("RateLimit-Limit", strconv.Itoa(rule.Requests))
+			w.Header().Set("RateLimit-Remaining", strconv.Itoa(decision.Remaining))
+			w.Header().Set("RateLimit-Reset", seconds(decision.Reset))
+
+			if !decision.Allowed {
+				slog.Log(r.Context(), slog.LevelInfo, "rate limit exceeded", slog.String("key", key))
+				w.Header().Set("Retry-After", seconds(decision.RetryAfter))
+				http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+
+				return
+			}
+
+			f(w, r)
+		}
+	}
+}
+
+// seconds rounds d up to whole seconds
+func seconds(d time.Duration) string {
+	return strconv.FormatInt(int64(math.Ceil(d.Seconds())), 10)
+}
+
+// tokenBucketScript refills the bucket for the time passed since the last request and takes a token,
+// the time is read from Redis so replicas with drifting clocks share a bucket
+var tokenBucketScript = redis.NewScript(`
+local capacity = tonumber(ARGV[1])
+local period = tonumber(ARGV[2])
+local t = redis.call('TIME')
+local now = t[1] * 1000 + math.floor(t[2] / 1000)
+local rate = capacity / period
+
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1]) or capacity
+local ts = tonumber(state[2]) or now
+tokens = math.min(capacity, tokens + math.max(0, now - ts) * rate)
+
+local allowed, retry = 0, 0
+if tokens >= 1 then
+  tokens = tokens - 1
+  allowed = 1
+else
+  retry = math.ceil((1 - tokens) / rate)
+end
+
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', now)
+redis.call('PEXPIRE', KEYS[1], period)
+
+return {allowed, math.floor(tokens), math.ceil((capacity - tokens) / rate), retry}
+`)
+
+// slidingWindowScript keeps the requests of the last period in a sorted set scored by time
+var slidingWindowScript = redis.NewScript(`
+local limit = tonumber(ARGV[1])
+local period = tonumber(ARGV[2])
+local t = redis.call('TIME')
+local now = t[1] * 1000 + math.floor(t[2] / 1000)
+
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now - period)
+
+local count = redis.call('ZCARD', KEYS[1])
+local allowed = 0
+if count < limit then
+  redis.call('ZADD', KEYS[1], now, ARGV[3])
+  redis.call('PEXPIRE', KEYS[1], period)
+  count = count + 1
+  allowed = 1
+end
+
+local oldest = redis.call('ZRANGE', KEYS[1], 0, 0, 'WITHSCORES')
+local reset = 0
+if oldest[2] then
+  reset = tonumber(oldest[2]) + period - now
+end
+
+local retry = 0
+if allowed == 0 then
+  retry = reset
+end
+
+return {allowed, limit - count, reset, retry}
+`)
+
+// RedisRateLimiter shares the counts of every replica, each request is one atomic script call
+type RedisRateLimiter struct {
+	Client redis.Scripter
+}
+
+func NewRedisRateLimiter(c redis.Scripter) *RedisRateLimiter {
+	return &RedisRateLimiter{Client: c}
+}
+
+func (l *RedisRateLimiter) Allow(ctx context.Context, key string, rule RateLimitRule) (*RateDecision, error) {
+	var res []int64
+
+	var err error
+
+	switch rule.Algorithm {
+	case SlidingWindow:
+		res, err = slidingWindowScript.Run(ctx, l.Client, []string{rateLimitPrefix + string(SlidingWindow) + ":" + key},
+			rule.Requests, rule.Period.Milliseconds(), uuid.NewString()).Int64Slice()
+	case TokenBucket, "":
+		res, err = tokenBucketScript.Run(ctx, l.Client, []string{rateLimitPrefix + string(TokenBucket) + ":" + key},
+			rule.Requests, rule.Period.Milliseconds()).Int64Slice()
+	default:
+		return nil, fmt.Errorf("unknown rate limit algorithm %q", rule.Algorithm)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(res) != 4 {
+		return nil, fmt.Errorf("unexpected rate limit script result %v", res)
+	}
+
+	return &RateDecision{
+		Allowed:    res[0] == 1,
+		Remaining:  int(res[1]),
+		Reset:      time.Duration(res[2]) * time.Millisecond,
+		RetryAfter: time.Duration(res[3]) * time.Millisecond,
+	}, nil
+}
+
+// MemoryRateLimiter counts in process for deployments without Redis, every replica counts on its own.
+// Keys idle for a full period are dropped.
+type MemoryRateLimiter struct {
+	mu        sync.Mutex
+	entries   map[string]*rateEntry
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type rateEntry struct {
+	// tokens and ts are the state of a token bucket, hits the request times of a sliding window
+	tokens  float64
+	ts      time.Time
+	hits    []time.Time
+	expires time.Time
+}
+
+func NewMemoryRateLimiter() *MemoryRateLimiter {
+	return &MemoryRateLimiter{entries: map[string]*rateEntry{}, now: time.Now}
+}
+
+func (l *MemoryRateLimiter) Allow(_ context.Context, key string, rule RateLimitRule) (*RateDecision, error) {
+	alg := rule.Algorithm
+	if alg == "" {
+		alg = TokenBucket
+	}
+
+	if alg != TokenBucket && alg != SlidingWindow {
+		return nil, fmt.Errorf("unknown rate limit algorithm %q", rule.Algorithm)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	key = string(alg) + ":" + key
+
+	e, ok := l.entries[key]
+	if !ok || !now.Before(e.expires) {
+		e = &rateEntry{tokens: float64(rule.Requests), ts: now}
+		l.entries[key] = e
+	}
+
+	e.expires = now.Add(rule.Period)
+
+	if alg == SlidingWindow {
+		return e.slidingWindow(now, rule), nil
+	}
+
+	return e.tokenBucket(now, rule), nil
+}
+
+// tokenBucket works like tokenBucketScript
+func (e *rateEntry) tokenBucket(now time.Time, rule RateLimitRule) *RateDecision {
+	capacity := float64(rule.Requests)
+	// tokens per millisecond
+	rate := capacity / float64(rule.Period.Milliseconds())
+
+	e.tokens = min(capacity, e.tokens+float64(max(now.Sub(e.ts).Milliseconds(), 0))*rate)
+	e.ts = now
+
+	d := &RateDecision{}
+
+	if e.tokens >= 1 {
+		e.tokens--
+		d.Allowed = true
+	} else {
+		d.RetryAfter = time.Duration(math.Ceil((1-e.tokens)/rate)) * time.Millisecond
+	}
+
+	d.Remaining = int(e.tokens)
+	d.Reset = time.Duration(math.Ceil((capacity-e.tokens)/rate)) * time.Millisecond
+
+	return d
+}
+
+// slidingWindow works like slidingWindowScript
+func (e *rateEntry) slidingWindow(now time.Time, rule RateLimitRule) *RateDecision {
+	start := now.Add(-rule.Period)
+	e.hits = slices.DeleteFunc(e.hits, func(hit time.Time) bool { return !hit.After(start) })
+
+	d := &RateDecision{}
+
+	if len(e.hits) < rule.Requests {
+		e.hits = append(e.hits, now)
+		d.Allowed = true
+	}
+
+	d.Remaining = rule.Requests - len(e.hits)
+
+	if len(e.hits) > 0 {
+		d.Reset = e.hits[0].Add(rule.Period).Sub(now)
+	}
+
+	if !d.Allowed {
+		d.RetryAfter = d.Reset
+	}
+
+	return d
+}
+
+// sweep drops idle keys at most once a minute
+func (l *MemoryRateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+
+	l.lastSweep = now
+
+	for key, e := range l.entries {
+		if !now.Before(e.expires) {
+			delete(l.entries, key)
+		}
+	}
+}
+
+// RateLimitFromEnv reads a rule like "10/1m" or "100/1h sliding-window" from env, defaultValue is used
+// when unset and a rule of "0" leaves the route unlimited
+func RateLimitFromEnv(name, defaultValue string, key RateKey) RateLimitRule {
+	value := os.Getenv(name)
+	if value == "" {
+		value = defaultValue
+	}
+
+	rule, err := ParseRateLimit(value)
+	if err != nil {
+		slog.Log(context.Background(), slog.LevelError, "invalid rate limit, using the default", slog.String("env", name),
+			slog.String("error", err.Error()))
+
+		rule, _ = ParseRateLimit(defaultValue)
+	}
+
+	rule.Key = key
+
+	return rule
+}
+
+// ParseRateLimit reads "<requests>/<period> [token-bucket|sliding-window]", the algorithm defaults to
+// TokenBucket
+func ParseRateLimit(value string) (RateLimitRule, error) {
+	var rule RateLimitRule
+
+	fields := strings.Fields(value)
+	if len(fields) == 0 || len(fields) > 2 {
+		return rule, fmt.Errorf("invalid rate limit %q", value)
+	}
+
+	requests, period, _ := strings.Cut(fields[0], "/")
+
+	n, err := strconv.Atoi(requests)
+	if err != nil || n < 0 {
+		return rule, fmt.Errorf("invalid rate limit requests %q", requests)
+	}
+
+	// "0" turns the limit off
+	if n == 0 {
+		return rule, nil
+	}
+
+	d, err := time.ParseDuration(period)
+	if err != nil || d < time.Millisecond {
+		return rule, fmt.Errorf("invalid rate limit period %q", period)
+	}
+
+	rule.Requests, rule.Period, rule.Algorithm = n, d, TokenBucket
+
+	if len(fields) == 2 {
+		switch alg := RateAlgorithm(fields[1]); alg {
+		case TokenBucket, SlidingWindow:
+			rule.Algorithm = alg
+		default:
+			return rule, fmt.Errorf("unknown rate limit algorithm %q", alg)
+		}
+	}
+
+	return rule, nil
+}
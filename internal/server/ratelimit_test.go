@@ -0,0 +1,170 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"auth-rest-api/internal/models"
+
+	"github.com/go-redis/redismock/v9"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeLimiter struct {
+	key      string
+	decision *RateDecision
+	err      error
+}
+
+func (l *fakeLimiter) Allow(_ context.Context, key string, _ RateLimitRule) (*RateDecision, error) {
+	l.key = key
+	return l.decision, l.err
+}
+
+func TestRateLimit(t *testing.T) {
+	rule := RateLimitRule{Algorithm: SlidingWindow, Requests: 10, Period: time.Minute}
+
+	tests := []struct {
+		name       string
+		limiter    *fakeLimiter
+		expCode    int
+		remaining  string
+		retryAfter string
+	}{
+		{name: "allowed", limiter: &fakeLimiter{decision: &RateDecision{Allowed: true, Remaining: 4, Reset: 30 * time.Second}},
+			expCode: http.StatusOK, remaining: "4"},
+		{name: "exceeded", limiter: &fakeLimiter{decision: &RateDecision{Remaining: 0, Reset: time.Minute,
+			RetryAfter: 1500 * time.Millisecond}}, expCode: http.StatusTooManyRequests, remaining: "0", retryAfter: "2"},
+		{name: "limiter failed", limiter: &fakeLimiter{err: errors.New("connection refused")}, expCode: http.StatusOK},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			mux.HandleFunc("POST /signin", Chain(func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}, RateLimit(tt.limiter, rule), AddCorrelation()))
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/signin", http.NoBody)
+			r.RemoteAddr = "10.0.0.1:5000"
+
+			mux.ServeHTTP(w, r)
+
+			assert.Equalf(t, tt.expCode, w.Code, "TEST[%d] Failed - %s", i, tt.name)
+			assert.Equalf(t, "POST /signin:ip:10.0.0.1", tt.limiter.key, "TEST[%d] Failed - %s", i, tt.name)
+			assert.Equalf(t, tt.remaining, w.Header().Get("RateLimit-Remaining"), "TEST[%d] Failed - %s", i, tt.name)
+			assert.Equalf(t, tt.retryAfter, w.Header().Get("Retry-After"), "TEST[%d] Failed - %s", i, tt.name)
+		})
+	}
+}
+
+func TestKeyByUser(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/me", http.NoBody)
+	r = r.WithContext(context.WithValue(r.Context(), Client, models.ClientInfo{IP: "10.0.0.1"}))
+
+	assert.Equal(t, "ip:10.0.0.1", KeyByUser(r))
+
+	r = r.WithContext(context.WithValue(r.Context(), Claims, jwt.RegisteredClaims{Subject: "dummy@testmail.com"}))
+
+	assert.Equal(t, "user:dummy@testmail.com", KeyByUser(r))
+}
+
+func TestRedisRateLimiter_Allow(t *testing.T) {
+	db, mock := redismock.NewClientMock()
+	l := NewRedisRateLimiter(db)
+	rule := RateLimitRule{Algorithm: TokenBucket, Requests: 10, Period: time.Minute}
+
+	mock.ExpectEvalSha(tokenBucketScript.Hash(), []string{"ratelimit:token-bucket:GET /me:user:dummy@testmail.com"},
+		10, int64(60000)).SetVal([]any{int64(0), int64(0), int64(60000), int64(6000)})
+
+	got, err := l.Allow(context.Background(), "GET /me:user:dummy@testmail.com", rule)
+	require.NoError(t, err)
+	assert.Equal(t, &RateDecision{Reset: time.Minute, RetryAfter: 6 * time.Second}, got)
+
+	_, err = l.Allow(context.Background(), "GET /me", RateLimitRule{Algorithm: "leaky-bucket", Requests: 1, Period: time.Second})
+	assert.Error(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMemoryRateLimiter_Allow(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	l := NewMemoryRateLimiter()
+	l.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	bucket := RateLimitRule{Algorithm: TokenBucket, Requests: 2, Period: time.Minute}
+	window := RateLimitRule{Algorithm: SlidingWindow, Requests: 2, Period: time.Minute}
+
+	tests := []struct {
+		name    string
+		advance time.Duration
+		key     string
+		rule    RateLimitRule
+		want    *RateDecision
+	}{
+		{name: "bucket full", key: "a", rule: bucket, want: &RateDecision{Allowed: true, Remaining: 1, Reset: 30 * time.Second}},
+		{name: "bucket last token", key: "a", rule: bucket, want: &RateDecision{Allowed: true, Reset: time.Minute}},
+		{name: "bucket empty", key: "a", rule: bucket, want: &RateDecision{Reset: time.Minute, RetryAfter: 30 * time.Second}},
+		{name: "other key", key: "b", rule: bucket, want: &RateDecision{Allowed: true, Remaining: 1, Reset: 30 * time.Second}},
+		{name: "bucket refilled", advance: 30 * time.Second, key: "a", rule: bucket,
+			want: &RateDecision{Allowed: true, Reset: time.Minute}},
+		{name: "window first", key: "a", rule: window, want: &RateDecision{Allowed: true, Remaining: 1, Reset: time.Minute}},
+		{name: "window second", advance: 20 * time.Second, key: "a", rule: window,
+			want: &RateDecision{Allowed: true, Reset: 40 * time.Second}},
+		{name: "window full", advance: 20 * time.Second, key: "a", rule: window,
+			want: &RateDecision{Reset: 20 * time.Second, RetryAfter: 20 * time.Second}},
+		{name: "window slid", advance: 20 * time.Second, key: "a", rule: window,
+			want: &RateDecision{Allowed: true, Reset: 20 * time.Second}},
+	}
+
+	for i, tt := range tests {
+		now = now.Add(tt.advance)
+
+		got, err := l.Allow(ctx, tt.key, tt.rule)
+		require.NoErrorf(t, err, "TEST[%d] Failed - %s", i, tt.name)
+		assert.Equalf(t, tt.want, got, "TEST[%d] Failed - %s", i, tt.name)
+	}
+
+	// idle keys are dropped
+	now = now.Add(2 * time.Minute)
+	_, err := l.Allow(ctx, "c", bucket)
+	require.NoError(t, err)
+	assert.Len(t, l.entries, 1)
+
+	_, err = l.Allow(ctx, "a", RateLimitRule{Algorithm: "leaky-bucket", Requests: 1, Period: time.Second})
+	assert.Error(t, err)
+}
+
+func TestParseRateLimit(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    RateLimitRule
+		wantErr bool
+	}{
+		{value: "10/1m", want: RateLimitRule{Algorithm: TokenBucket, Requests: 10, Period: time.Minute}},
+		{value: "5/15m sliding-window", want: RateLimitRule{Algorithm: SlidingWindow, Requests: 5, Period: 15 * time.Minute}},
+		{value: "0"},
+		{value: "10", wantErr: true},
+		{value: "ten/1m", wantErr: true},
+		{value: "10/1m leaky-bucket", wantErr: true},
+		{value: "", wantErr: true},
+	}
+
+	for i, tt := range tests {
+		got, err := ParseRateLimit(tt.value)
+		if tt.wantErr {
+			assert.Errorf(t, err, "TEST[%d] Failed - %q", i, tt.value)
+			continue
+		}
+
+		assert.NoErrorf(t, err, "TEST[%d] Failed - %q", i, tt.value)
+		assert.Equalf(t, tt.want, got, "TEST[%d] Failed - %q", i, tt.value)
+	}
+}
@@ -0,0 +1,78 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+
+	"auth-rest-api/internal/models"
+	"auth-rest-api/internal/server"
+)
+
+// GetUserAccess returns the roles and permissions assigned to the user
+func (s *Service) GetUserAccess(ctx context.Context, userID string) (*models.Access, error) {
+	if _, err := s.Store.GetUserByID(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	return s.Store.GetAccess(ctx, userID)
+}
+
+// GrantAccess assigns roles and permissions to the user, they are added to the access tokens issued
+// from the next sign in or refresh on
+func (s *Service) GrantAccess(ctx context.Context, userID string, access *models.Access) (*models.Access, error) {
+	return s.updateAccess(ctx, userID, access, true)
+}
+
+// RevokeAccess removes roles and permissions from the user, access tokens issued before keep them until
+// they are refreshed or expire
+func (s *Service) RevokeAccess(ctx context.Context, userID string, access *models.Access) (*models.Access, error) {
+	return s.updateAccess(ctx, userID, access, false)
+}
+
+func (s *Service) updateAccess(ctx context.Context, userID string, access *models.Access, grant bool) (*models.Access, error) {
+	logger := ctx.Value(server.Logger).(*slog.Logger)
+
+	if access == nil || (len(access.Roles) == 0 && len(access.Permissions) == 0) {
+		return nil, models.ErrBadRequest(models.ErrRequired("role or permission"))
+	}
+
+	if err := access.Validate(); err != nil {
+		return nil, models.ErrBadRequest(err)
+	}
+
+	update := s.Store.GrantAccess
+	if !grant {
+		update = s.Store.RevokeAccess
+	}
+
+	if err := update(ctx, userID, access); err != nil {
+		return nil, err
+	}
+
+	logger.LogAttrs(ctx, slog.LevelInfo, "user access changed", slog.String("user", userID), slog.Bool("grant", grant),
+		slog.Any("roles", access.Roles), slog.Any("permissions", access.Permissions))
+
+	return s.Store.GetAccess(ctx, userID)
+}
+
+// tokenGrant collects what a new token pair of the user carries: the roles, the assigned permissions
+// plus the ones of the roles in Config.RolePermissions and the scope narrowed to what the roles allow
+func (s *Service) tokenGrant(ctx context.Context, userID, scope string) (*TokenGrant, error) {
+	access, err := s.Store.GetAccess(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, role := range access.Roles {
+		access.Permissions = append(access.Permissions, s.Config.RolePermissions[role]...)
+	}
+
+	slices.Sort(access.Permissions)
+
+	return &TokenGrant{
+		Scope:       s.userScope(scope, access.Roles),
+		Roles:       access.Roles,
+		Permissions: slices.Compact(access.Permissions),
+	}, nil
+}
@@ -0,0 +1,111 @@
+package service
+
+import (
+	"testing"
+
+	"auth-rest-api/internal/models"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_GrantAccess(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStore := NewMockStorer(ctrl)
+	s := New(mockStore)
+	ctx := testContext()
+	admin := &models.Access{Roles: []string{models.RoleAdmin}}
+
+	tests := []struct {
+		name     string
+		access   *models.Access
+		mockCall func()
+		want     *models.Access
+		wantErr  error
+	}{
+		{
+			name:   "valid case",
+			access: admin,
+			mockCall: func() {
+				mockStore.EXPECT().GrantAccess(ctx, userID, admin).Return(nil)
+				mockStore.EXPECT().GetAccess(ctx, userID).Return(&models.Access{Roles: []string{"admin", "support"}}, nil)
+			},
+			want: &models.Access{Roles: []string{"admin", "support"}},
+		},
+		{
+			name:     "invalid permission",
+			access:   &models.Access{Permissions: []string{"Users Write"}},
+			mockCall: func() {},
+			wantErr:  models.ErrBadRequest(models.ErrInvalid("permission")),
+		},
+		{
+			name:     "nothing to grant",
+			access:   &models.Access{},
+			mockCall: func() {},
+			wantErr:  models.ErrBadRequest(models.ErrRequired("role or permission")),
+		},
+		{
+			name:     "unknown user",
+			access:   admin,
+			mockCall: func() { mockStore.EXPECT().GrantAccess(ctx, userID, admin).Return(models.ErrNotFound("user")) },
+			wantErr:  models.ErrNotFound("user"),
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockCall()
+
+			got, err := s.GrantAccess(ctx, userID, tt.access)
+
+			assert.Equalf(t, tt.wantErr, err, "TEST[%d] Failed - %s", i, tt.name)
+			assert.Equalf(t, tt.want, got, "TEST[%d] Failed - %s", i, tt.name)
+		})
+	}
+}
+
+func TestService_RefreshTokenAccess(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStore := NewMockStorer(ctrl)
+	s := New(mockStore)
+	s.Config.RolePermissions = map[string][]string{"admin": {"users:read", "users:write"}}
+	ctx := testContext()
+
+	td, err := s.Keys.GenerateToken(email, userID, "", &TokenGrant{Roles: []string{"support"}})
+	require.NoError(t, err)
+
+	// the role was changed after the sign in
+	mockStore.EXPECT().GetFamily(ctx, td.FamilyID).Return(&models.TokenFamily{ID: td.FamilyID, RefreshID: td.RefreshID}, nil)
+	mockStore.EXPECT().IsTokenRevoked(ctx, td.AccessID).Return(false, nil)
+	mockStore.EXPECT().GetUserByID(ctx, userID).Return(&models.UserData{ID: userID, Email: email, Status: models.StatusActive}, nil)
+	mockStore.EXPECT().DeleteToken(ctx, td.AccessID, td.RefreshID).Return(nil)
+	mockStore.EXPECT().GetAccess(ctx, userID).Return(&models.Access{Roles: []string{"admin"}, Permissions: []string{"users:read"}}, nil)
+	mockStore.EXPECT().CreateToken(ctx, email, gomock.Any()).Return(nil)
+
+	resp, err := s.RefreshToken(ctx, td.AccessToken, td.RefreshToken, "")
+	require.NoError(t, err)
+
+	claims, err := s.Keys.ParseToken(resp.AccessToken, "access")
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"admin"}, claims.Roles)
+	assert.Equal(t, []string{"users:read", "users:write"}, claims.Permissions)
+	assert.True(t, claims.HasRole("admin"))
+	assert.False(t, claims.HasRole("support"))
+	assert.True(t, claims.HasPermission("users:write"))
+	assert.False(t, claims.HasPermission("users:delete"))
+}
+
+func TestConfig_RolePermissions(t *testing.T) {
+	t.Setenv("ROLE_PERMISSIONS", "admin=users:read users:write, support=users:read,=orphan,viewer")
+
+	assert.Equal(t, map[string][]string{
+		"admin":   {"users:read", "users:write"},
+		"support": {"users:read"},
+	}, ConfigFromEnv().RolePermissions)
+}
@@ -0,0 +1,145 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"auth-rest-api/internal/models"
+	"auth-rest-api/internal/server"
+)
+
+var errSameEmail = models.NewConstError("new email must differ from the current one")
+
+// ChangePassword replaces the password of the authenticated user after checking the current one,
+// the other sessions of the user are logged out on request
+func (s *Service) ChangePassword(ctx context.Context, req *models.PasswordChangeReq) error {
+	logger := ctx.Value(server.Logger).(*slog.Logger)
+
+	claims, err := claimsFromContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	if req == nil {
+		return models.ErrBadRequest(models.ErrInvalid("password change"))
+	}
+
+	if err := req.Validate(); err != nil {
+		return models.ErrBadRequest(err)
+	}
+
+	user, err := s.checkPassword(ctx, claims, req.CurrentPassword)
+	if err != nil {
+		return err
+	}
+
+	if err := s.checkNewPassword(ctx, user.Email, req.NewPassword, user); err != nil {
+		return err
+	}
+
+	if err := s.storePassword(ctx, user, req.NewPassword); err != nil {
+		return err
+	}
+
+	logger.LogAttrs(ctx, slog.LevelInfo, "password changed", slog.String("email", claims.Email))
+
+	if !req.RevokeOtherSessions {
+		return nil
+	}
+
+	return s.revokeUserSessions(ctx, claims.Email, claims.FamilyID)
+}
+
+// ChangeEmail moves the authenticated user to a new email address. The new address has to be
+// verified again and all sessions are logged out, since their tokens still carry the old address.
+func (s *Service) ChangeEmail(ctx context.Context, req *models.EmailChangeReq) error {
+	logger := ctx.Value(server.Logger).(*slog.Logger)
+
+	claims, err := claimsFromContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	if req == nil {
+		return models.ErrBadRequest(models.ErrInvalid("email change"))
+	}
+
+	if err := req.Validate(); err != nil {
+		return models.ErrBadRequest(err)
+	}
+
+	email, err := s.checkNewEmail(req.Email)
+	if err != nil {
+		return err
+	}
+
+	if email == claims.Email {
+		return models.ErrBadRequest(errSameEmail)
+	}
+
+	user, err := s.checkPassword(ctx, claims, req.Password)
+	if err != nil {
+		return err
+	}
+
+	if err := s.Store.ChangeEmail(ctx, user.ID, email); err != nil {
+		return err
+	}
+
+	logger.LogAttrs(ctx, slog.LevelInfo, "email changed", slog.String("from", user.Email), slog.String("to", email))
+
+	if err := s.revokeUserSessions(ctx, user.Email, ""); err != nil {
+		return err
+	}
+
+	// the change is done at this point, mail delivery failures are only logged
+	if err := s.sendVerification(ctx, email); err != nil {
+		logger.LogAttrs(ctx, slog.LevelError, "failed to send verification email", slog.String("email", email),
+			slog.String("error", err.Error()))
+	}
+
+	if err := s.sendMail(ctx, &models.Mail{
+		To:      user.Email,
+		Subject: "Your email address was changed",
+		Body: fmt.Sprintf("The email address of your account was changed to %s. "+
+			"If you did not make this change, contact support right away.\n", email),
+	}); err != nil {
+		logger.LogAttrs(ctx, slog.LevelError, "failed to notify previous email", slog.String("email", user.Email),
+			slog.String("error", err.Error()))
+	}
+
+	return nil
+}
+
+// checkPassword compares password with the stored hash of the authenticated user
+func (s *Service) checkPassword(ctx context.Context, claims *Claims, password string) (*models.UserData, error) {
+	logger := ctx.Value(server.Logger).(*slog.Logger)
+
+	user, err := s.currentUser(ctx, claims)
+	if err != nil {
+		return nil, err
+	}
+
+	match, err := s.Hasher.Verify(user.Password, password)
+	if err != nil {
+		return nil, err
+	}
+
+	if !match {
+		logger.LogAttrs(ctx, slog.LevelError, "wrong password", slog.String("email", user.Email))
+		return nil, models.ErrPsswdNotMatch
+	}
+
+	return user, nil
+}
+
+// currentUser loads the user the access token was issued to, tokens issued before user IDs
+// existed are resolved by email
+func (s *Service) currentUser(ctx context.Context, claims *Claims) (*models.UserData, error) {
+	if claims.UserID != "" {
+		return s.Store.GetUserByID(ctx, claims.UserID)
+	}
+
+	return s.Store.GetUserByEmail(ctx, claims.Email)
+}
@@ -0,0 +1,152 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"auth-rest-api/internal/models"
+	"auth-rest-api/internal/server"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestService_ChangePassword(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStore := NewMockStorer(ctrl)
+	s := New(mockStore)
+	ctx := context.WithValue(testContext(), server.Claims, &Claims{Email: email, FamilyID: "current"})
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("sumit@kumar"), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	user := &models.UserData{ID: userID, Email: email, Password: hash}
+
+	tests := []struct {
+		name     string
+		req      *models.PasswordChangeReq
+		mockCall func()
+		wantErr  error
+	}{
+		{
+			name: "keep other sessions",
+			req:  &models.PasswordChangeReq{CurrentPassword: "sumit@kumar", NewPassword: "new-password"},
+			mockCall: func() {
+				mockStore.EXPECT().GetUserByEmail(ctx, email).Return(user, nil)
+				mockStore.EXPECT().UpdatePassword(ctx, userID, gomock.Any()).Return(nil)
+			},
+		},
+		{
+			name: "revoke other sessions",
+			req:  &models.PasswordChangeReq{CurrentPassword: "sumit@kumar", NewPassword: "new-password", RevokeOtherSessions: true},
+			mockCall: func() {
+				mockStore.EXPECT().GetUserByEmail(ctx, email).Return(user, nil)
+				mockStore.EXPECT().UpdatePassword(ctx, userID, gomock.Any()).Return(nil)
+				mockStore.EXPECT().ListFamilies(ctx, email).Return([]models.TokenFamily{{ID: "current"}, {ID: "other"}}, nil)
+				mockStore.EXPECT().RevokeFamily(ctx, "other").Return(nil)
+			},
+		},
+		{
+			name: "wrong current password",
+			req:  &models.PasswordChangeReq{CurrentPassword: "wrong-password", NewPassword: "new-password"},
+			mockCall: func() {
+				mockStore.EXPECT().GetUserByEmail(ctx, email).Return(user, nil)
+			},
+			wantErr: models.ErrPsswdNotMatch,
+		},
+		{
+			name:     "missing new password",
+			req:      &models.PasswordChangeReq{CurrentPassword: "sumit@kumar", NewPassword: " "},
+			mockCall: func() {},
+			wantErr:  models.ErrBadRequest(models.ErrRequired("password")),
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockCall()
+
+			assert.Equalf(t, tt.wantErr, s.ChangePassword(ctx, tt.req), "TEST[%d] Failed - %s", i, tt.name)
+		})
+	}
+}
+
+func TestService_ChangeEmail(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStore := NewMockStorer(ctrl)
+	mockMailer := NewMockMailer(ctrl)
+	s := New(mockStore, WithMailer(mockMailer))
+	ctx := context.WithValue(testContext(), server.Claims, &Claims{Email: email, FamilyID: "current"})
+	newEmail := "new@kumar.com"
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("sumit@kumar"), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	user := &models.UserData{ID: userID, Email: email, Password: hash}
+
+	tests := []struct {
+		name     string
+		req      *models.EmailChangeReq
+		mockCall func()
+		wantErr  error
+	}{
+		{
+			name: "valid case",
+			req:  &models.EmailChangeReq{Email: newEmail, Password: "sumit@kumar"},
+			mockCall: func() {
+				mockStore.EXPECT().GetUserByEmail(ctx, email).Return(user, nil)
+				mockStore.EXPECT().ChangeEmail(ctx, userID, newEmail).Return(nil)
+				mockStore.EXPECT().ListFamilies(ctx, email).Return([]models.TokenFamily{{ID: "current"}}, nil)
+				mockStore.EXPECT().RevokeFamily(ctx, "current").Return(nil)
+				mockStore.EXPECT().SaveOneTimeToken(ctx, purposeVerifyEmail, gomock.Any(), newEmail, s.Config.VerificationTTL).Return(nil)
+				gomock.InOrder(
+					mockMailer.EXPECT().Send(ctx, gomock.Any()).DoAndReturn(func(_ context.Context, mail *models.Mail) error {
+						assert.Equal(t, newEmail, mail.To)
+						return nil
+					}),
+					mockMailer.EXPECT().Send(ctx, gomock.Any()).DoAndReturn(func(_ context.Context, mail *models.Mail) error {
+						assert.Equal(t, email, mail.To)
+						return nil
+					}),
+				)
+			},
+		},
+		{
+			name: "email taken",
+			req:  &models.EmailChangeReq{Email: newEmail, Password: "sumit@kumar"},
+			mockCall: func() {
+				mockStore.EXPECT().GetUserByEmail(ctx, email).Return(user, nil)
+				mockStore.EXPECT().ChangeEmail(ctx, userID, newEmail).Return(models.ErrUserAlreadyExists)
+			},
+			wantErr: models.ErrUserAlreadyExists,
+		},
+		{
+			name: "wrong password",
+			req:  &models.EmailChangeReq{Email: newEmail, Password: "wrong-password"},
+			mockCall: func() {
+				mockStore.EXPECT().GetUserByEmail(ctx, email).Return(user, nil)
+			},
+			wantErr: models.ErrPsswdNotMatch,
+		},
+		{
+			name:     "same email",
+			req:      &models.EmailChangeReq{Email: email, Password: "sumit@kumar"},
+			mockCall: func() {},
+			wantErr:  models.ErrBadRequest(errSameEmail),
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockCall()
+
+			assert.Equalf(t, tt.wantErr, s.ChangeEmail(ctx, tt.req), "TEST[%d] Failed - %s", i, tt.name)
+		})
+	}
+}
@@ -0,0 +1,177 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+
+	"auth-rest-api/internal/models"
+	"auth-rest-api/internal/server"
+)
+
+// ListUsers returns a page of users, optionally only the ones whose email starts with query.EmailPrefix
+func (s *Service) ListUsers(ctx context.Context, query *models.UserQuery) (*models.UserPage, error) {
+	if query == nil {
+		query = &models.UserQuery{}
+	}
+
+	// stored emails are lowercase
+	query.EmailPrefix = strings.ToLower(query.EmailPrefix)
+
+	switch {
+	case query.Limit < 0:
+		return nil, models.ErrBadRequest(models.ErrInvalid("limit"))
+	case query.Limit == 0:
+		query.Limit = models.DefaultUserPageSize
+	case query.Limit > models.MaxUserPageSize:
+		query.Limit = models.MaxUserPageSize
+	}
+
+	page, err := s.Store.ListUsers(ctx, query)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalid("cursor")) {
+			return nil, models.ErrBadRequest(err)
+		}
+
+		return nil, err
+	}
+
+	return page, nil
+}
+
+// GetUser returns the record of any user
+func (s *Service) GetUser(ctx context.Context, userID string) (*models.UserData, error) {
+	return s.Store.GetUserByID(ctx, userID)
+}
+
+// UpdateUser changes the profile, email, verification or status of a user. A new email is not
+// verified unless the update says so, and the sessions of the user are logged out since their tokens
+// carry the old address.
+func (s *Service) UpdateUser(ctx context.Context, userID string, req *models.AdminUserUpdate) (*models.UserData, error) {
+	logger := ctx.Value(server.Logger).(*slog.Logger)
+
+	if req == nil {
+		return nil, models.ErrBadRequest(models.ErrInvalid("user update"))
+	}
+
+	user, err := s.Store.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	oldEmail := user.Email
+
+	if req.Email != nil {
+		email, err := s.checkNewEmail(*req.Email)
+		if err != nil {
+			return nil, err
+		}
+
+		req.Email = &email
+	}
+
+	emailChanged := req.Email != nil && *req.Email != user.Email
+
+	if req.Status != nil {
+		if err := req.Status.Validate(); err != nil {
+			return nil, models.ErrBadRequest(err)
+		}
+	}
+
+	req.Apply(user)
+
+	if err := models.ValidateProfile(user); err != nil {
+		return nil, models.ErrBadRequest(err)
+	}
+
+	// the email change is the write that can be refused, it goes first so a taken address leaves the
+	// user untouched
+	if emailChanged {
+		if err := s.Store.ChangeEmail(ctx, userID, *req.Email); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.Store.UpdateProfile(ctx, user); err != nil {
+		return nil, err
+	}
+
+	if emailChanged {
+		if err := s.revokeUserSessions(ctx, oldEmail, ""); err != nil {
+			return nil, err
+		}
+	}
+
+	if req.Verified != nil {
+		if err := s.Store.SetVerified(ctx, userID, *req.Verified); err != nil {
+			return nil, err
+		}
+	}
+
+	if req.Status != nil {
+		if err := s.setStatus(ctx, userID, *req.Status); err != nil {
+			return nil, err
+		}
+	}
+
+	logger.LogAttrs(ctx, slog.LevelInfo, "user updated by admin", slog.String("user", userID),
+		slog.Bool("emailChanged", emailChanged))
+
+	return s.Store.GetUserByID(ctx, userID)
+}
+
+// DeleteUser logs the user out everywhere and removes the account with its roles, permissions,
+// recovery codes and passkeys
+func (s *Service) DeleteUser(ctx context.Context, userID string) error {
+	logger := ctx.Value(server.Logger).(*slog.Logger)
+
+	user, err := s.Store.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.revokeUserSessions(ctx, user.Email, ""); err != nil {
+		return err
+	}
+
+	if err := s.Store.DeleteUser(ctx, userID); err != nil {
+		return err
+	}
+
+	logger.LogAttrs(ctx, slog.LevelInfo, "user deleted by admin", slog.String("user", userID), slog.String("email", user.Email))
+
+	return nil
+}
+
+// DisableUser blocks every sign in of the user and logs out the sessions
+func (s *Service) DisableUser(ctx context.Context, userID string) error {
+	return s.setStatus(ctx, userID, models.StatusDisabled)
+}
+
+// LogoutUser revokes every session of the user, access tokens already issued stay valid until they expire
+func (s *Service) LogoutUser(ctx context.Context, userID string) error {
+	user, err := s.Store.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	return s.revokeUserSessions(ctx, user.Email, "")
+}
+
+// setStatus changes the status of the user, disabling or locking the account revokes every live token
+func (s *Service) setStatus(ctx context.Context, userID string, status models.UserStatus) error {
+	logger := ctx.Value(server.Logger).(*slog.Logger)
+
+	if err := s.Store.SetStatus(ctx, userID, status); err != nil {
+		return err
+	}
+
+	logger.LogAttrs(ctx, slog.LevelInfo, "user status changed", slog.String("user", userID), slog.String("status", string(status)))
+
+	if !status.Blocked() {
+		return nil
+	}
+
+	return s.LogoutUser(ctx, userID)
+}
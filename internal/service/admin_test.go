@@ -0,0 +1,165 @@
+package service
+
+import (
+	"testing"
+
+	"auth-rest-api/internal/models"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestService_ListUsers(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStore := NewMockStorer(ctrl)
+	s := New(mockStore)
+	ctx := testContext()
+	page := &models.UserPage{Users: []models.UserData{{ID: userID, Email: email}}}
+
+	tests := []struct {
+		name     string
+		query    *models.UserQuery
+		mockCall func()
+		want     *models.UserPage
+		wantErr  error
+	}{
+		{
+			name:  "default page size",
+			query: &models.UserQuery{EmailPrefix: "dummy"},
+			mockCall: func() {
+				mockStore.EXPECT().ListUsers(ctx, &models.UserQuery{EmailPrefix: "dummy", Limit: models.DefaultUserPageSize}).Return(page, nil)
+			},
+			want: page,
+		},
+		{
+			name:  "page size capped",
+			query: &models.UserQuery{Limit: 1000},
+			mockCall: func() {
+				mockStore.EXPECT().ListUsers(ctx, &models.UserQuery{Limit: models.MaxUserPageSize}).Return(page, nil)
+			},
+			want: page,
+		},
+		{
+			name:  "invalid cursor",
+			query: &models.UserQuery{Cursor: "abc"},
+			mockCall: func() {
+				mockStore.EXPECT().ListUsers(ctx, gomock.Any()).Return(nil, models.ErrInvalid("cursor"))
+			},
+			wantErr: models.ErrBadRequest(models.ErrInvalid("cursor")),
+		},
+		{
+			name:     "negative limit",
+			query:    &models.UserQuery{Limit: -1},
+			mockCall: func() {},
+			wantErr:  models.ErrBadRequest(models.ErrInvalid("limit")),
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockCall()
+
+			got, err := s.ListUsers(ctx, tt.query)
+			assert.Equalf(t, tt.wantErr, err, "TEST[%d] Failed - %s", i, tt.name)
+			assert.Equalf(t, tt.want, got, "TEST[%d] Failed - %s", i, tt.name)
+		})
+	}
+}
+
+func TestService_UpdateUser(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStore := NewMockStorer(ctrl)
+	s := New(mockStore)
+	ctx := testContext()
+	newEmail, name, invalidEmail, yes := "new@testmail.com", "Sumit", "not-an-email", true
+	disabled, unknown := models.StatusDisabled, models.UserStatus("gone")
+
+	tests := []struct {
+		name     string
+		req      *models.AdminUserUpdate
+		mockCall func()
+		wantErr  error
+	}{
+		{
+			name: "email changed and verified, account disabled",
+			req: &models.AdminUserUpdate{ProfileUpdate: models.ProfileUpdate{Name: &name}, Email: &newEmail,
+				Verified: &yes, Status: &disabled},
+			mockCall: func() {
+				mockStore.EXPECT().GetUserByID(ctx, userID).Return(&models.UserData{ID: userID, Email: email}, nil)
+				gomock.InOrder(
+					mockStore.EXPECT().ChangeEmail(ctx, userID, newEmail).Return(nil),
+					mockStore.EXPECT().UpdateProfile(ctx, &models.UserData{ID: userID, Email: email, Name: name}).Return(nil),
+				)
+				mockStore.EXPECT().ListFamilies(ctx, email).Return([]models.TokenFamily{{ID: "f1"}}, nil)
+				mockStore.EXPECT().RevokeFamily(ctx, "f1").Return(nil)
+				mockStore.EXPECT().SetVerified(ctx, userID, true).Return(nil)
+				mockStore.EXPECT().SetStatus(ctx, userID, models.StatusDisabled).Return(nil)
+				mockStore.EXPECT().GetUserByID(ctx, userID).Return(&models.UserData{ID: userID, Email: newEmail}, nil)
+				mockStore.EXPECT().ListFamilies(ctx, newEmail).Return(nil, nil)
+				mockStore.EXPECT().GetUserByID(ctx, userID).Return(&models.UserData{ID: userID, Email: newEmail}, nil)
+			},
+		},
+		{
+			name: "email taken leaves the profile untouched",
+			req:  &models.AdminUserUpdate{ProfileUpdate: models.ProfileUpdate{Name: &name}, Email: &newEmail},
+			mockCall: func() {
+				mockStore.EXPECT().GetUserByID(ctx, userID).Return(&models.UserData{ID: userID, Email: email}, nil)
+				mockStore.EXPECT().ChangeEmail(ctx, userID, newEmail).Return(models.ErrUserAlreadyExists)
+			},
+			wantErr: models.ErrUserAlreadyExists,
+		},
+		{
+			name: "invalid email",
+			req:  &models.AdminUserUpdate{Email: &invalidEmail},
+			mockCall: func() {
+				mockStore.EXPECT().GetUserByID(ctx, userID).Return(&models.UserData{ID: userID, Email: email}, nil)
+			},
+			wantErr: models.ErrBadRequest(models.ErrInvalid("email")),
+		},
+		{
+			name: "unknown status",
+			req:  &models.AdminUserUpdate{Status: &unknown},
+			mockCall: func() {
+				mockStore.EXPECT().GetUserByID(ctx, userID).Return(&models.UserData{ID: userID, Email: email}, nil)
+			},
+			wantErr: models.ErrBadRequest(models.ErrInvalid("status")),
+		},
+		{
+			name:     "unknown user",
+			req:      &models.AdminUserUpdate{},
+			mockCall: func() { mockStore.EXPECT().GetUserByID(ctx, userID).Return(nil, models.ErrNotFound("user")) },
+			wantErr:  models.ErrNotFound("user"),
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockCall()
+
+			_, err := s.UpdateUser(ctx, userID, tt.req)
+			assert.Equalf(t, tt.wantErr, err, "TEST[%d] Failed - %s", i, tt.name)
+		})
+	}
+}
+
+func TestService_DeleteUser(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStore := NewMockStorer(ctrl)
+	s := New(mockStore)
+	ctx := testContext()
+
+	gomock.InOrder(
+		mockStore.EXPECT().GetUserByID(ctx, userID).Return(&models.UserData{ID: userID, Email: email}, nil),
+		mockStore.EXPECT().ListFamilies(ctx, email).Return([]models.TokenFamily{{ID: "f1"}}, nil),
+		mockStore.EXPECT().RevokeFamily(ctx, "f1").Return(nil),
+		mockStore.EXPECT().DeleteUser(ctx, userID).Return(nil),
+	)
+
+	assert.NoError(t, s.DeleteUser(ctx, userID))
+}
@@ -0,0 +1,169 @@
+package service
+
+import (
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config holds the settings of the account flows
+type Config struct {
+	// AppURL is the base of the links sent in emails
+	AppURL string
+	// TokenSecret signs the single use tokens sent by email
+	TokenSecret []byte
+	// RequireVerifiedEmail blocks sign in until the email address is verified
+	RequireVerifiedEmail bool
+	VerificationTTL      time.Duration
+	PasswordResetTTL     time.Duration
+	MagicLinkTTL         time.Duration
+	// CheckAccountStatus makes the auth middleware reject revoked access tokens and tokens of users who
+	// may not sign in, at the cost of two store reads per request
+	CheckAccountStatus bool
+	// MFAIssuer names the service in authenticator apps
+	MFAIssuer       string
+	MFAChallengeTTL time.Duration
+	// WebAuthnRPID is the domain passkeys are bound to, WebAuthnOrigins are the origins allowed to use them
+	WebAuthnRPID    string
+	WebAuthnOrigins []string
+	// RolePermissions lists the permissions every role grants on top of the ones assigned to a user
+	RolePermissions map[string][]string
+	// Scopes are the OAuth scopes tokens can be limited to, ScopeRoles restricts scopes to users
+	// holding one of the listed roles
+	Scopes     []string
+	ScopeRoles map[string][]string
+	// SignInMaxAttempts and SignInMaxIPAttempts are the failed sign ins per account and per client IP
+	// within SignInAttemptWindow before they are locked, every further lock doubles SignInLockout up
+	// to SignInMaxLockout
+	SignInMaxAttempts   int
+	SignInMaxIPAttempts int
+	SignInAttemptWindow time.Duration
+	SignInLockout       time.Duration
+	SignInMaxLockout    time.Duration
+	// PasswordMinLength and PasswordMaxLength count characters, a new password needs every one of
+	// PasswordClasses and may not repeat a character more than PasswordMaxRepeated times in a row
+	PasswordMinLength   int
+	PasswordMaxLength   int
+	PasswordClasses     []string
+	PasswordMaxRepeated int
+	// PasswordAllowEmail allows passwords containing the local part of the email address
+	PasswordAllowEmail bool
+	// PasswordHistory is the number of last passwords, the current one included, a new password may not repeat
+	PasswordHistory int
+	// EmailStripPlus and EmailFoldDots fold aliases of one mailbox into one account, see emailaddr.Policy
+	EmailStripPlus bool
+	EmailFoldDots  []string
+}
+
+// ConfigFromEnv reads the Config, ONE_TIME_TOKEN_SECRET falls back to REFRESH_SECRET
+func ConfigFromEnv() Config {
+	_, refSecret := getJWTSecrets()
+
+	cfg := Config{
+		AppURL:               strings.TrimSuffix(os.Getenv("APP_URL"), "/"),
+		TokenSecret:          refSecret,
+		RequireVerifiedEmail: os.Getenv("REQUIRE_EMAIL_VERIFICATION") == "true",
+		CheckAccountStatus:   os.Getenv("AUTH_CHECK_ACCOUNT_STATUS") == "true",
+		VerificationTTL:      GetEnvAsDuration("EMAIL_VERIFICATION_TTL", 24*time.Hour),
+		PasswordResetTTL:     GetEnvAsDuration("PASSWORD_RESET_TTL", 30*time.Minute),
+		MagicLinkTTL:         GetEnvAsDuration("MAGIC_LINK_TTL", 15*time.Minute),
+		MFAIssuer:            os.Getenv("MFA_ISSUER"),
+		MFAChallengeTTL:      GetEnvAsDuration("MFA_CHALLENGE_TTL", 5*time.Minute),
+		WebAuthnRPID:         os.Getenv("WEBAUTHN_RP_ID"),
+		WebAuthnOrigins:      getEnvAsList("WEBAUTHN_ORIGINS"),
+		RolePermissions:      getEnvAsListMap("ROLE_PERMISSIONS"),
+		Scopes:               getEnvAsList("OAUTH_SCOPES"),
+		ScopeRoles:           getEnvAsListMap("SCOPE_ROLES"),
+		SignInMaxAttempts:    getEnvAsInt("SIGNIN_MAX_ATTEMPTS", 5),
+		SignInMaxIPAttempts:  getEnvAsInt("SIGNIN_MAX_IP_ATTEMPTS", 20),
+		SignInAttemptWindow:  GetEnvAsDuration("SIGNIN_ATTEMPT_WINDOW", 15*time.Minute),
+		SignInLockout:        GetEnvAsDuration("SIGNIN_LOCKOUT", time.Minute),
+		SignInMaxLockout:     GetEnvAsDuration("SIGNIN_MAX_LOCKOUT", time.Hour),
+		PasswordMinLength:    getEnvAsInt("PASSWORD_MIN_LENGTH", 8),
+		PasswordMaxLength:    getEnvAsInt("PASSWORD_MAX_LENGTH", 64),
+		PasswordClasses:      getEnvAsList("PASSWORD_REQUIRED_CLASSES"),
+		PasswordMaxRepeated:  getEnvAsInt("PASSWORD_MAX_REPEATED", 0),
+		PasswordAllowEmail:   os.Getenv("PASSWORD_ALLOW_EMAIL") == "true",
+		PasswordHistory:      getEnvAsInt("PASSWORD_HISTORY", 0),
+		EmailStripPlus:       os.Getenv("EMAIL_STRIP_PLUS_TAG") == "true",
+		EmailFoldDots:        getEnvAsList("EMAIL_FOLD_DOTS_DOMAINS"),
+	}
+
+	if cfg.AppURL == "" {
+		cfg.AppURL = "http://localhost:9001"
+	}
+
+	// passkeys default to the host and origin of the app
+	if cfg.WebAuthnRPID == "" {
+		if u, err := url.Parse(cfg.AppURL); err == nil {
+			cfg.WebAuthnRPID = u.Hostname()
+		}
+	}
+
+	if len(cfg.WebAuthnOrigins) == 0 {
+		cfg.WebAuthnOrigins = []string{cfg.AppURL}
+	}
+
+	if cfg.MFAIssuer == "" {
+		cfg.MFAIssuer = "auth-rest-api"
+	}
+
+	if secret := os.Getenv("ONE_TIME_TOKEN_SECRET"); secret != "" {
+		cfg.TokenSecret = []byte(secret)
+	}
+
+	return cfg
+}
+
+// getEnvAsList splits a comma separated env value, empty entries are dropped
+func getEnvAsList(key string) []string {
+	var list []string
+
+	for _, v := range strings.Split(os.Getenv(key), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+
+	return list
+}
+
+// getEnvAsListMap reads a comma separated list of key=values pairs, several values are separated by
+// spaces, e.g. "admin=users:read users:write,support=users:read"
+func getEnvAsListMap(key string) map[string][]string {
+	m := make(map[string][]string)
+
+	for _, entry := range getEnvAsList(key) {
+		k, values, ok := strings.Cut(entry, "=")
+		if k = strings.TrimSpace(k); ok && k != "" {
+			m[k] = append(m[k], strings.Fields(values)...)
+		}
+	}
+
+	return m
+}
+
+// getEnvAsInt reads an int from env, defaultValue is returned when unset or invalid
+func getEnvAsInt(key string, defaultValue int) int {
+	if n, err := strconv.Atoi(os.Getenv(key)); err == nil {
+		return n
+	}
+
+	return defaultValue
+}
+
+// GetEnvAsDuration parses a duration like "720h" from env, defaultValue is returned when unset or invalid
+func GetEnvAsDuration(key string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	if d, err := time.ParseDuration(value); err == nil {
+		return d
+	}
+
+	return defaultValue
+}
@@ -0,0 +1,122 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+
+	"auth-rest-api/internal/emailaddr"
+	"auth-rest-api/internal/models"
+	"auth-rest-api/internal/server"
+)
+
+// normalizeBatch is the page size NormalizeEmails walks the users with
+const normalizeBatch = 200
+
+// normalizeEmail validates email and returns the form users are stored and looked up with: lowercase,
+// the domain in punycode and aliases folded as configured
+func (s *Service) normalizeEmail(email string) (string, error) {
+	addr, err := s.parseEmail(email)
+	if err != nil {
+		return "", err
+	}
+
+	return addr.String(), nil
+}
+
+// checkNewEmail normalizes an address a user signs up or moves to, domains of the blocklist are refused
+func (s *Service) checkNewEmail(email string) (string, error) {
+	addr, err := s.parseEmail(email)
+	if err != nil {
+		return "", err
+	}
+
+	if s.Blocklist.Blocked(addr.Domain) {
+		vErr := &models.ValidationError{}
+		vErr.Add("email", "disposable_domain", "email addresses of "+addr.Domain+" are not accepted")
+
+		return "", models.ErrBadRequest(vErr)
+	}
+
+	return addr.String(), nil
+}
+
+func (s *Service) parseEmail(email string) (emailaddr.Address, error) {
+	if strings.TrimSpace(email) == "" {
+		return emailaddr.Address{}, models.ErrBadRequest(models.ErrRequired("email"))
+	}
+
+	addr, err := emailaddr.Parse(email)
+	if err != nil {
+		return emailaddr.Address{}, models.ErrBadRequest(models.ErrInvalid("email"))
+	}
+
+	policy := emailaddr.Policy{StripPlus: s.Config.EmailStripPlus, FoldDots: s.Config.EmailFoldDots}
+
+	return policy.Canonical(addr.Normalized()), nil
+}
+
+// NormalizeEmails moves users whose stored email is not in the normalized form to it, e.g. users stored
+// before normalization or before alias folding was enabled, since lookups only use the normalized form.
+// Verification and status are kept and the sessions of a moved user are logged out. A user whose
+// normalized address belongs to another user keeps the stored one and is logged. It returns the number
+// of moved users.
+func (s *Service) NormalizeEmails(ctx context.Context) (int, error) {
+	logger := ctx.Value(server.Logger).(*slog.Logger)
+
+	moved := 0
+	query := &models.UserQuery{Limit: normalizeBatch}
+
+	for {
+		page, err := s.Store.ListUsers(ctx, query)
+		if err != nil {
+			return moved, err
+		}
+
+		for i := range page.Users {
+			user := &page.Users[i]
+
+			email, err := s.normalizeEmail(user.Email)
+			if err != nil {
+				logger.LogAttrs(ctx, slog.LevelWarn, "stored email is not valid, left as is", slog.String("user", user.ID),
+					slog.String("email", user.Email))
+
+				continue
+			}
+
+			if email == user.Email {
+				continue
+			}
+
+			if err := s.Store.RenameEmail(ctx, user.ID, email); err != nil {
+				// the user was deleted while the page was walked
+				if errors.Is(err, models.ErrNotFound("user")) {
+					continue
+				}
+
+				if errors.Is(err, models.ErrUserAlreadyExists) {
+					logger.LogAttrs(ctx, slog.LevelWarn, "normalized email belongs to another user, left as is",
+						slog.String("user", user.ID), slog.String("email", user.Email), slog.String("normalized", email))
+
+					continue
+				}
+
+				return moved, err
+			}
+
+			// the tokens and the session index of the user carry the stored email
+			if err := s.revokeUserSessions(ctx, user.Email, ""); err != nil {
+				return moved, err
+			}
+
+			moved++
+		}
+
+		if page.NextCursor == "" {
+			return moved, nil
+		}
+
+		query.Cursor = page.NextCursor
+	}
+}
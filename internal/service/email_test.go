@@ -0,0 +1,119 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"auth-rest-api/internal/emailaddr"
+	"auth-rest-api/internal/models"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_checkNewEmail(t *testing.T) {
+	s := New(nil, WithEmailBlocklist(emailaddr.NewBlocklist("mailinator.com")))
+	s.Config.EmailStripPlus = true
+	s.Config.EmailFoldDots = []string{"gmail.com"}
+
+	tests := []struct {
+		name     string
+		email    string
+		want     string
+		wantCode string
+		wantErr  error
+	}{
+		{name: "mixed case", email: " Sumit@Example.ENGINEERING ", want: "sumit@example.engineering"},
+		{name: "internationalized domain", email: "info@Bücher.de", want: "info@xn--bcher-kva.de"},
+		{name: "plus tag", email: "sumit+news@example.com", want: "sumit@example.com"},
+		{name: "dots of gmail", email: "Sumit.Kumar+x@gmail.com", want: "sumitkumar@gmail.com"},
+		{name: "disposable domain", email: "sumit@mailinator.com", wantCode: "disposable_domain"},
+		{name: "disposable subdomain", email: "sumit@eu.MAILINATOR.com", wantCode: "disposable_domain"},
+		{name: "invalid", email: "sumit@kumar", wantErr: models.ErrBadRequest(models.ErrInvalid("email"))},
+		{name: "missing", email: " ", wantErr: models.ErrBadRequest(models.ErrRequired("email"))},
+	}
+
+	for i, tt := range tests {
+		got, err := s.checkNewEmail(tt.email)
+
+		var vErr *models.ValidationError
+
+		switch {
+		case tt.wantErr != nil:
+			assert.Equalf(t, tt.wantErr, err, "TEST[%d] Failed - %s", i, tt.name)
+		case tt.wantCode != "":
+			require.Truef(t, errors.As(err, &vErr), "TEST[%d] Failed - %s", i, tt.name)
+			assert.Equalf(t, tt.wantCode, vErr.Fields[0].Code, "TEST[%d] Failed - %s", i, tt.name)
+		default:
+			assert.NoErrorf(t, err, "TEST[%d] Failed - %s", i, tt.name)
+			assert.Equalf(t, tt.want, got, "TEST[%d] Failed - %s", i, tt.name)
+		}
+	}
+
+	// addresses of blocked domains signed up before the blocklist keep signing in
+	got, err := s.normalizeEmail("sumit@mailinator.com")
+	require.NoError(t, err)
+	assert.Equal(t, "sumit@mailinator.com", got)
+}
+
+func TestService_SignUpNormalizesEmail(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStore := NewMockStorer(ctrl)
+	s := New(mockStore, WithPasswordHasher(testHasher))
+	ctx := testContext()
+
+	mockStore.EXPECT().CreateUser(ctx, gomock.Any()).DoAndReturn(func(_ context.Context, u *models.UserData) error {
+		assert.Equal(t, email, u.Email)
+		return nil
+	})
+	mockStore.EXPECT().SaveOneTimeToken(ctx, purposeVerifyEmail, gomock.Any(), email, s.Config.VerificationTTL).Return(nil)
+
+	require.NoError(t, s.SignUp(ctx, &models.UserReq{Email: "  Test@EXAMPLE.com", Password: "sumit@kumar"}))
+
+	// the sign in finds the user whatever the case of the address
+	expectSignInUnlocked(ctx, mockStore)
+	mockStore.EXPECT().GetUserByEmail(ctx, email).Return(nil, models.ErrNotFound("user"))
+	mockStore.EXPECT().IncrCounter(ctx, gomock.Any(), gomock.Any()).Return(int64(1), nil).AnyTimes()
+
+	_, err := s.SignIn(ctx, &models.UserReq{Email: "TEST@example.com", Password: "sumit@kumar"})
+	assert.Equal(t, models.ErrNotFound("user"), err)
+}
+
+func TestService_NormalizeEmails(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStore := NewMockStorer(ctrl)
+	s := New(mockStore)
+	s.Config.EmailStripPlus = true
+	ctx := testContext()
+
+	gomock.InOrder(
+		mockStore.EXPECT().ListUsers(ctx, &models.UserQuery{Limit: normalizeBatch}).Return(&models.UserPage{Users: []models.UserData{
+			{ID: "normalized", Email: "sumit@example.com"},
+			{ID: "uppercase", Email: "Kumar@Example.com"},
+			{ID: "taken", Email: "sumit+news@example.com"},
+		}, NextCursor: "next"}, nil),
+		mockStore.EXPECT().RenameEmail(ctx, "uppercase", "kumar@example.com").Return(nil),
+		mockStore.EXPECT().ListFamilies(ctx, "Kumar@Example.com").Return([]models.TokenFamily{{ID: "f1"}}, nil),
+		mockStore.EXPECT().RevokeFamily(ctx, "f1").Return(nil),
+		mockStore.EXPECT().RenameEmail(ctx, "taken", "sumit@example.com").Return(models.ErrUserAlreadyExists),
+		mockStore.EXPECT().ListUsers(ctx, &models.UserQuery{Cursor: "next", Limit: normalizeBatch}).Return(&models.UserPage{
+			Users: []models.UserData{{ID: "invalid", Email: "sumit@kumar"}, {ID: "gone", Email: "Gone@Example.com"}},
+		}, nil),
+		mockStore.EXPECT().RenameEmail(ctx, "gone", "gone@example.com").Return(models.ErrNotFound("user")),
+	)
+
+	moved, err := s.NormalizeEmails(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, moved)
+
+	mockStore.EXPECT().ListUsers(ctx, gomock.Any()).Return(nil, models.ErrDBNotConnected)
+
+	_, err = s.NormalizeEmails(ctx)
+	assert.Equal(t, models.ErrDBNotConnected, err)
+}
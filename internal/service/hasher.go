@@ -0,0 +1,196 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"auth-rest-api/internal/models"
+	"auth-rest-api/internal/server"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	HashAlgBcrypt   = "bcrypt"
+	HashAlgArgon2id = "argon2id"
+
+	argon2idPrefix = "$argon2id$"
+)
+
+// PasswordHasher turns passwords into self describing hashes, bcrypt hashes keep their $2a$ format
+// and argon2id hashes use the PHC string format
+type PasswordHasher interface {
+	Hash(password string) ([]byte, error)
+	// Verify checks password against a hash of any supported algorithm, a wrong password is not an error
+	Verify(hash []byte, password string) (bool, error)
+	// NeedsRehash reports whether hash was made with another algorithm or other parameters
+	NeedsRehash(hash []byte) bool
+}
+
+// PasswordHasherFromEnv returns the hasher selected with PASSWORD_HASH_ALG, argon2id by default
+func PasswordHasherFromEnv() PasswordHasher {
+	if os.Getenv("PASSWORD_HASH_ALG") == HashAlgBcrypt {
+		return &BcryptHasher{Cost: getEnvAsInt("BCRYPT_COST", bcrypt.DefaultCost)}
+	}
+
+	return &Argon2idHasher{
+		Memory:      uint32(getEnvAsInt("ARGON2_MEMORY", 64*1024)),
+		Iterations:  uint32(getEnvAsInt("ARGON2_ITERATIONS", 3)),
+		Parallelism: uint8(getEnvAsInt("ARGON2_PARALLELISM", 2)),
+		SaltLength:  16,
+		KeyLength:   32,
+	}
+}
+
+type BcryptHasher struct {
+	Cost int
+}
+
+func (h *BcryptHasher) Hash(password string) ([]byte, error) {
+	return bcrypt.GenerateFromPassword([]byte(password), h.Cost)
+}
+
+func (h *BcryptHasher) Verify(hash []byte, password string) (bool, error) {
+	return verifyPassword(hash, password)
+}
+
+func (h *BcryptHasher) NeedsRehash(hash []byte) bool {
+	cost, err := bcrypt.Cost(hash)
+
+	return err != nil || cost != h.Cost
+}
+
+// Argon2idHasher hashes with argon2id (RFC 9106), Memory is in KiB
+type Argon2idHasher struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// argon2Hash is a decoded PHC string
+type argon2Hash struct {
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+	salt        []byte
+	key         []byte
+}
+
+func (h *Argon2idHasher) Hash(password string) ([]byte, error) {
+	salt := make([]byte, h.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, h.Iterations, h.Memory, h.Parallelism, h.KeyLength)
+
+	return []byte(fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s", argon2idPrefix, argon2.Version, h.Memory, h.Iterations,
+		h.Parallelism, base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key))), nil
+}
+
+func (h *Argon2idHasher) Verify(hash []byte, password string) (bool, error) {
+	return verifyPassword(hash, password)
+}
+
+func (h *Argon2idHasher) NeedsRehash(hash []byte) bool {
+	decoded, err := decodeArgon2id(hash)
+	if err != nil {
+		return true
+	}
+
+	return decoded.memory != h.Memory || decoded.iterations != h.Iterations || decoded.parallelism != h.Parallelism ||
+		len(decoded.salt) != int(h.SaltLength) || len(decoded.key) != int(h.KeyLength)
+}
+
+// rehashPassword replaces a hash made with an outdated algorithm or parameters after the password was
+// verified, a failure leaves the old hash in place
+func (s *Service) rehashPassword(ctx context.Context, user *models.UserData, password string) {
+	logger := ctx.Value(server.Logger).(*slog.Logger)
+
+	if !s.Hasher.NeedsRehash(user.Password) {
+		return
+	}
+
+	hash, err := s.Hasher.Hash(password)
+	if err == nil {
+		err = s.Store.UpdatePassword(ctx, user.ID, hash)
+	}
+
+	if err != nil {
+		logger.LogAttrs(ctx, slog.LevelError, "failed to rehash password", slog.String("user", user.ID),
+			slog.String("error", err.Error()))
+
+		return
+	}
+
+	user.Password = hash
+
+	logger.LogAttrs(ctx, slog.LevelInfo, "password rehashed", slog.String("user", user.ID))
+}
+
+// verifyPassword picks the algorithm from the hash, so hashes outlive a change of the configured one
+func verifyPassword(hash []byte, password string) (bool, error) {
+	if bytes.HasPrefix(hash, []byte(argon2idPrefix)) {
+		decoded, err := decodeArgon2id(hash)
+		if err != nil {
+			return false, err
+		}
+
+		key := argon2.IDKey([]byte(password), decoded.salt, decoded.iterations, decoded.memory, decoded.parallelism,
+			uint32(len(decoded.key)))
+
+		return subtle.ConstantTimeCompare(key, decoded.key) == 1, nil
+	}
+
+	err := bcrypt.CompareHashAndPassword(hash, []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, models.ErrInvalid("password hash")
+	}
+
+	return true, nil
+}
+
+// decodeArgon2id parses $argon2id$v=19$m=65536,t=3,p=2$<salt>$<key>
+func decodeArgon2id(hash []byte) (*argon2Hash, error) {
+	parts := strings.Split(string(hash), "$")
+	if len(parts) != 6 || parts[1] != HashAlgArgon2id {
+		return nil, models.ErrInvalid("password hash")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return nil, models.ErrInvalid("password hash")
+	}
+
+	var decoded argon2Hash
+
+	_, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &decoded.memory, &decoded.iterations, &decoded.parallelism)
+	if err != nil || decoded.iterations == 0 || decoded.parallelism == 0 {
+		return nil, models.ErrInvalid("password hash")
+	}
+
+	if decoded.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return nil, models.ErrInvalid("password hash")
+	}
+
+	if decoded.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil || len(decoded.key) == 0 {
+		return nil, models.ErrInvalid("password hash")
+	}
+
+	return &decoded, nil
+}
@@ -0,0 +1,116 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"auth-rest-api/internal/models"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// testHasher keeps the hashes of test users cheap and current
+var testHasher = &BcryptHasher{Cost: bcrypt.MinCost}
+
+// testArgon2id uses far less memory than the defaults to keep tests fast
+var testArgon2id = &Argon2idHasher{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+func TestArgon2idHasher(t *testing.T) {
+	hash, err := testArgon2id.Hash("sumit@kumar")
+	require.NoError(t, err)
+	assert.Regexp(t, `^\$argon2id\$v=19\$m=1024,t=1,p=1\$[A-Za-z0-9+/]{22}\$[A-Za-z0-9+/]{43}$`, string(hash))
+
+	other, err := testArgon2id.Hash("sumit@kumar")
+	require.NoError(t, err)
+	assert.NotEqual(t, hash, other, "every hash gets its own salt")
+
+	match, err := testArgon2id.Verify(hash, "sumit@kumar")
+	require.NoError(t, err)
+	assert.True(t, match)
+
+	match, err = testArgon2id.Verify(hash, "wrong@password")
+	require.NoError(t, err)
+	assert.False(t, match)
+
+	assert.False(t, testArgon2id.NeedsRehash(hash))
+	assert.True(t, (&Argon2idHasher{Memory: 2048, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}).NeedsRehash(hash))
+
+	_, err = testArgon2id.Verify([]byte("$argon2id$v=19$m=1024,t=1,p=1$c2FsdA"), "sumit@kumar")
+	assert.Equal(t, models.ErrInvalid("password hash"), err)
+}
+
+func TestPasswordHasher_crossAlgorithm(t *testing.T) {
+	bcryptHash, err := testHasher.Hash("sumit@kumar")
+	require.NoError(t, err)
+
+	argonHash, err := testArgon2id.Hash("sumit@kumar")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name        string
+		hasher      PasswordHasher
+		hash        []byte
+		needsRehash bool
+	}{
+		{name: "bcrypt hash, bcrypt hasher", hasher: testHasher, hash: bcryptHash},
+		{name: "bcrypt hash, higher cost", hasher: &BcryptHasher{Cost: bcrypt.MinCost + 1}, hash: bcryptHash, needsRehash: true},
+		{name: "bcrypt hash, argon2id hasher", hasher: testArgon2id, hash: bcryptHash, needsRehash: true},
+		{name: "argon2id hash, bcrypt hasher", hasher: testHasher, hash: argonHash, needsRehash: true},
+	}
+
+	for i, tt := range tests {
+		match, err := tt.hasher.Verify(tt.hash, "sumit@kumar")
+		assert.NoErrorf(t, err, "TEST[%d] Failed - %s", i, tt.name)
+		assert.Truef(t, match, "TEST[%d] Failed - %s", i, tt.name)
+		assert.Equalf(t, tt.needsRehash, tt.hasher.NeedsRehash(tt.hash), "TEST[%d] Failed - %s", i, tt.name)
+	}
+}
+
+func TestService_SignInRehash(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStore := NewMockStorer(ctrl)
+	s := New(mockStore, WithPasswordHasher(testArgon2id))
+	ctx := testContext()
+
+	// users signed up before argon2id keep their bcrypt hash until the next sign in
+	hash, err := bcrypt.GenerateFromPassword([]byte("sumit@kumar"), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	expectSignInUnlocked(ctx, mockStore)
+	mockStore.EXPECT().GetUserByEmail(ctx, email).Return(&models.UserData{ID: userID, Email: email, Password: hash}, nil)
+	mockStore.EXPECT().UpdatePassword(ctx, userID, gomock.Any()).DoAndReturn(func(_ context.Context, _ string, newHash []byte) error {
+		assert.False(t, testArgon2id.NeedsRehash(newHash))
+
+		match, err := verifyPassword(newHash, "sumit@kumar")
+		assert.NoError(t, err)
+		assert.True(t, match)
+
+		return nil
+	})
+	mockStore.EXPECT().GetAccess(ctx, userID).Return(&models.Access{}, nil)
+	mockStore.EXPECT().CreateToken(ctx, email, gomock.Any()).Return(nil)
+	mockStore.EXPECT().UpdateLastLogin(ctx, userID, gomock.Any()).Return(nil)
+
+	resp, err := s.SignIn(ctx, &models.UserReq{Email: email, Password: "sumit@kumar"})
+	require.NoError(t, err)
+	assert.NotEmpty(t, resp.AccessToken)
+
+	// a failed rehash does not fail the sign in
+	outdated := &Argon2idHasher{Memory: 512, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+	oldHash, err := outdated.Hash("sumit@kumar")
+	require.NoError(t, err)
+
+	mockStore.EXPECT().GetUserByEmail(ctx, email).Return(&models.UserData{ID: userID, Email: email, Password: oldHash}, nil)
+	mockStore.EXPECT().UpdatePassword(ctx, userID, gomock.Any()).Return(models.ErrDBNotConnected)
+	mockStore.EXPECT().GetAccess(ctx, userID).Return(&models.Access{}, nil)
+	mockStore.EXPECT().CreateToken(ctx, email, gomock.Any()).Return(nil)
+	mockStore.EXPECT().UpdateLastLogin(ctx, userID, gomock.Any()).Return(nil)
+
+	_, err = s.SignIn(ctx, &models.UserReq{Email: email, Password: "sumit@kumar"})
+	require.NoError(t, err)
+}
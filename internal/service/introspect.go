@@ -0,0 +1,71 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+
+	"auth-rest-api/internal/models"
+	"auth-rest-api/internal/server"
+)
+
+// Introspect reports whether an access or refresh token is still active (RFC 7662). The hint only
+// decides which token type is tried first, a token that fails to parse or whose ID is gone from the
+// store is inactive.
+func (s *Service) Introspect(ctx context.Context, token, tokenTypeHint string) (*models.Introspection, error) {
+	logger := ctx.Value(server.Logger).(*slog.Logger)
+
+	order := []string{models.TokenTypeAccess, models.TokenTypeRefresh}
+	if tokenTypeHint == models.TokenTypeRefresh {
+		order = []string{models.TokenTypeRefresh, models.TokenTypeAccess}
+	}
+
+	for _, tokenType := range order {
+		claims, err := s.Keys.ParseToken(token, parseType(tokenType))
+		if err != nil {
+			continue
+		}
+
+		revoked, err := s.Store.IsTokenRevoked(ctx, claims.ClaimUID)
+		if err != nil {
+			return nil, err
+		}
+
+		if revoked {
+			logger.LogAttrs(ctx, slog.LevelDebug, "introspected revoked token", slog.String("jti", claims.ClaimUID))
+			return &models.Introspection{Active: false}, nil
+		}
+
+		resp := &models.Introspection{
+			Active:      true,
+			Scope:       claims.Scope,
+			Username:    claims.Email,
+			TokenType:   tokenType,
+			Sub:         claims.Subject,
+			Iss:         claims.Issuer,
+			Jti:         claims.ClaimUID,
+			Roles:       claims.Roles,
+			Permissions: claims.Permissions,
+		}
+
+		if claims.ExpiresAt != nil {
+			resp.Exp = claims.ExpiresAt.Unix()
+		}
+
+		if claims.IssuedAt != nil {
+			resp.Iat = claims.IssuedAt.Unix()
+		}
+
+		return resp, nil
+	}
+
+	return &models.Introspection{Active: false}, nil
+}
+
+// parseType maps RFC 7009/7662 token type hints to the types understood by ParseToken
+func parseType(tokenType string) string {
+	if tokenType == models.TokenTypeRefresh {
+		return "refresh"
+	}
+
+	return "access"
+}
@@ -0,0 +1,79 @@
+package service
+
+import (
+	"testing"
+
+	"auth-rest-api/internal/models"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_Introspect(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStore := NewMockStorer(ctrl)
+	s := New(mockStore)
+	ctx := testContext()
+
+	td, err := s.Keys.GenerateToken(email, "", "", nil)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		token    string
+		hint     string
+		mockCall func()
+		want     *models.Introspection
+	}{
+		{
+			name:  "active access token",
+			token: td.AccessToken,
+			mockCall: func() {
+				mockStore.EXPECT().IsTokenRevoked(ctx, td.AccessID).Return(false, nil)
+			},
+			want: &models.Introspection{Active: true, Username: email, TokenType: models.TokenTypeAccess, Sub: email,
+				Iss: "sumit kumar", Jti: td.AccessID, Exp: td.AccessExpiresAt},
+		},
+		{
+			name:  "active refresh token without hint",
+			token: td.RefreshToken,
+			mockCall: func() {
+				mockStore.EXPECT().IsTokenRevoked(ctx, td.RefreshID).Return(false, nil)
+			},
+			want: &models.Introspection{Active: true, Username: email, TokenType: models.TokenTypeRefresh, Sub: email,
+				Jti: td.RefreshID, Exp: td.RefreshExpiresAt},
+		},
+		{
+			name:  "revoked refresh token",
+			token: td.RefreshToken,
+			hint:  models.TokenTypeRefresh,
+			mockCall: func() {
+				mockStore.EXPECT().IsTokenRevoked(ctx, td.RefreshID).Return(true, nil)
+			},
+			want: &models.Introspection{Active: false},
+		},
+		{
+			name:     "malformed token",
+			token:    "not-a-token",
+			mockCall: func() {},
+			want:     &models.Introspection{Active: false},
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockCall()
+
+			got, err := s.Introspect(ctx, tt.token, tt.hint)
+			require.NoError(t, err)
+
+			// iat depends on the time the token was generated
+			got.Iat = 0
+
+			assert.Equalf(t, tt.want, got, "TEST[%d] Failed - %s", i, tt.name)
+		})
+	}
+}
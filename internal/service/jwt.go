@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"errors"
 	"os"
+	"slices"
+	"strings"
 	"time"
 
 	"auth-rest-api/internal/models"
@@ -12,21 +14,73 @@ import (
 	"github.com/google/uuid"
 )
 
+const (
+	accessTokenTTL  = 15 * time.Minute
+	refreshTokenTTL = 24 * time.Hour
+)
+
+var errInvalidTokenType = errors.New("invalid token type")
+
 type Claims struct {
 	Email    string `json:"email"`
+	UserID   string `json:"uid,omitempty"`
 	ClaimUID string `json:"claimID"`
+	FamilyID string `json:"fid,omitempty"`
+	// Scope is the space separated OAuth scope the token pair is limited to
+	Scope string `json:"scope,omitempty"`
+	// Roles and Permissions are only set on access tokens
+	Roles       []string `json:"roles,omitempty"`
+	Permissions []string `json:"permissions,omitempty"`
 	jwt.RegisteredClaims
 }
 
-// GenerateToken generates a JWT token with 15 minutes of expiry
-func GenerateToken(email string) (*models.TokenData, error) {
+// TokenGrant is what a new token pair carries besides the user
+type TokenGrant struct {
+	Scope       string
+	Roles       []string
+	Permissions []string
+}
+
+// HasRole reports whether the token carries the role, it makes Claims a server.Authorization
+func (c *Claims) HasRole(role string) bool {
+	return slices.Contains(c.Roles, role)
+}
+
+// HasPermission reports whether the token carries the permission
+func (c *Claims) HasPermission(permission string) bool {
+	return slices.Contains(c.Permissions, permission)
+}
+
+// HasScope reports whether the token is allowed the scope
+func (c *Claims) HasScope(scope string) bool {
+	return slices.Contains(strings.Fields(c.Scope), scope)
+}
+
+// GenerateToken generates a JWT token with 15 minutes of expiry, every token carries the kid of its signing key.
+// An empty familyID starts a new refresh token family, both tokens get the scope of the grant and the
+// access token its roles and permissions.
+func (k *Keys) GenerateToken(email, userID, familyID string, grant *TokenGrant) (*models.TokenData, error) {
 	accID := uuid.NewString()
 	refID := uuid.NewString()
+
+	if familyID == "" {
+		familyID = uuid.NewString()
+	}
+
+	if grant == nil {
+		grant = &TokenGrant{}
+	}
+
 	claims := Claims{
-		Email:    email,
-		ClaimUID: accID,
+		Email:       email,
+		UserID:      userID,
+		ClaimUID:    accID,
+		FamilyID:    familyID,
+		Scope:       grant.Scope,
+		Roles:       grant.Roles,
+		Permissions: grant.Permissions,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute * 15)),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(accessTokenTTL)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			NotBefore: jwt.NewNumericDate(time.Now()),
 			Issuer:    "sumit kumar",
@@ -36,32 +90,30 @@ func GenerateToken(email string) (*models.TokenData, error) {
 	}
 
 	refClaims := jwt.RegisteredClaims{
-		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour * 24)),
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(refreshTokenTTL)),
 		IssuedAt:  jwt.NewNumericDate(time.Now()),
 		Subject:   email,
 	}
 
-	accessKey, refKey := getJWTSecrets()
-
-	accessToken := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	accessTokenStr, err := signToken(k.Access.Active(), claims)
+	if err != nil {
+		return nil, err
+	}
 
-	refToken := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{
+	refTokenStr, err := signToken(k.Refresh.Active(), Claims{
 		Email:            email,
+		UserID:           userID,
 		ClaimUID:         refID,
+		FamilyID:         familyID,
+		Scope:            grant.Scope,
 		RegisteredClaims: refClaims,
 	})
-
-	accessTokenStr, err := accessToken.SignedString(accessKey)
-	if err != nil {
-		return nil, err
-	}
-
-	refTokenStr, err := refToken.SignedString(refKey)
 	if err != nil {
 		return nil, err
 	}
 
 	tkData := models.TokenData{
+		FamilyID:         familyID,
 		AccessID:         accID,
 		AccessExpiresAt:  claims.ExpiresAt.Unix(),
 		AccessToken:      accessTokenStr,
@@ -73,27 +125,19 @@ func GenerateToken(email string) (*models.TokenData, error) {
 	return &tkData, nil
 }
 
-func ParseToken(tokenString, tokenType string) (*Claims, error) {
-	var (
-		token *jwt.Token
-		err   error
-	)
-
-	accSecret, refSecret := getJWTSecrets()
+func (k *Keys) ParseToken(tokenString, tokenType string) (*Claims, error) {
+	var ring *KeyRing
 
 	switch tokenType {
 	case "access":
-		token, err = jwt.ParseWithClaims(tokenString, &Claims{}, func(_ *jwt.Token) (any, error) {
-			return accSecret, nil
-		})
+		ring = k.Access
 	case "refresh":
-		token, err = jwt.ParseWithClaims(tokenString, &Claims{}, func(_ *jwt.Token) (any, error) {
-			return refSecret, nil
-		})
+		ring = k.Refresh
 	default:
-		return nil, errors.New("invalid token type")
+		return nil, errInvalidTokenType
 	}
 
+	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, ring.Keyfunc)
 	if err != nil {
 		return nil, err
 	}
@@ -109,6 +153,13 @@ func ParseToken(tokenString, tokenType string) (*Claims, error) {
 	return nil, err
 }
 
+func signToken(key *SigningKey, claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+
+	return token.SignedString(key.Private)
+}
+
 func getJWTSecrets() (accessSecret, refreshSecret []byte) {
 	access := os.Getenv("ACCESS_SECRET")
 	if access == "" {
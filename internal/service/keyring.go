@@ -0,0 +1,320 @@
+package service
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"sort"
+	"sync"
+	"time"
+
+	"auth-rest-api/internal/models"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// KeyRing holds one active signing key and any number of verification-only keys selected by kid.
+// Keys that are rotated out stay valid for verification until retireAfter has passed, which is
+// the max lifetime of the tokens they signed.
+type KeyRing struct {
+	mu sync.RWMutex
+	// base is the active key provided by configuration, it signs until the first rotation
+	base        *SigningKey
+	keys        map[string]*ringKey
+	retireAfter time.Duration
+	// delay is how long a rotated key is published before it signs, processes sharing the ring through
+	// the store need that long to learn about it
+	delay time.Duration
+	// version is the stored version the ring was restored from or saved as
+	version int64
+	now     func() time.Time
+}
+
+type ringKey struct {
+	key *SigningKey
+	// activeFrom is when the key starts signing, zero for verification keys
+	activeFrom time.Time
+	// retireAt is zero for the active key and for verification keys provided by configuration
+	retireAt time.Time
+	// configured keys come from the environment, only their times are stored
+	configured bool
+}
+
+func NewKeyRing(active *SigningKey, retireAfter time.Duration, verify ...*SigningKey) *KeyRing {
+	kr := &KeyRing{
+		base:        active,
+		keys:        map[string]*ringKey{active.ID: {key: active, activeFrom: time.Now(), configured: true}},
+		retireAfter: retireAfter,
+		now:         time.Now,
+	}
+
+	for _, k := range verify {
+		if _, ok := kr.keys[k.ID]; !ok {
+			kr.keys[k.ID] = &ringKey{key: k, configured: true}
+		}
+	}
+
+	return kr
+}
+
+// Active returns the key new tokens are signed with
+func (kr *KeyRing) Active() *SigningKey {
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+
+	return kr.active()
+}
+
+// Lookup returns the non retired key for kid
+func (kr *KeyRing) Lookup(kid string) (*SigningKey, bool) {
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+
+	rk, ok := kr.keys[kid]
+	if !ok || kr.retired(rk) {
+		return nil, false
+	}
+
+	return rk.key, true
+}
+
+// Rotate generates a new key with the same algorithm that signs after the publish delay, the previous
+// key is kept for verification until it is retired
+func (kr *KeyRing) Rotate() (*SigningKey, error) {
+	next, err := generateSigningKey(kr.Active().Method.Alg())
+	if err != nil {
+		return nil, err
+	}
+
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+
+	activeFrom := kr.now().Add(kr.delay)
+
+	if latest := kr.latest(); latest != nil {
+		latest.retireAt = activeFrom.Add(kr.retireAfter)
+	}
+
+	kr.keys[next.ID] = &ringKey{key: next, activeFrom: activeFrom}
+
+	kr.prune()
+
+	return next, nil
+}
+
+// Prune drops the keys whose retirement time has passed
+func (kr *KeyRing) Prune() {
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+
+	kr.prune()
+}
+
+// Keys returns the active and verification keys, the active key first. A rotated key is listed
+// while it waits to sign, so resource servers know it before the first token.
+func (kr *KeyRing) Keys() []*SigningKey {
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+
+	active := kr.active()
+	keys := []*SigningKey{active}
+
+	ids := make([]string, 0, len(kr.keys))
+	for id := range kr.keys {
+		ids = append(ids, id)
+	}
+
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		rk := kr.keys[id]
+		if rk.key != active && !kr.retired(rk) {
+			keys = append(keys, rk.key)
+		}
+	}
+
+	return keys
+}
+
+// Keyfunc resolves the verification key from the kid header of the token
+func (kr *KeyRing) Keyfunc(token *jwt.Token) (any, error) {
+	key := kr.Active()
+
+	// tokens issued before kid headers were introduced are checked against the active key
+	if kid, ok := token.Header["kid"].(string); ok {
+		if key, ok = kr.Lookup(kid); !ok {
+			return nil, errUnknownKid
+		}
+	}
+
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, errUnexpectedAlg
+	}
+
+	return key.Public, nil
+}
+
+// active returns the key that started signing last
+func (kr *KeyRing) active() *SigningKey {
+	now := kr.now()
+
+	var active *ringKey
+
+	for _, rk := range kr.keys {
+		if rk.activeFrom.IsZero() || now.Before(rk.activeFrom) || kr.retired(rk) {
+			continue
+		}
+
+		if active == nil || rk.activeFrom.After(active.activeFrom) {
+			active = rk
+		}
+	}
+
+	// a ring restored from processes with another configuration may hold no key this one can sign with
+	if active == nil {
+		return kr.base
+	}
+
+	return active.key
+}
+
+// newest returns the key that was activated last, after a rotation it may still wait to sign
+func (kr *KeyRing) newest() *SigningKey {
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+
+	if latest := kr.latest(); latest != nil {
+		return latest.key
+	}
+
+	return kr.base
+}
+
+// latest returns the key that was activated last, it may still wait to sign
+func (kr *KeyRing) latest() *ringKey {
+	var latest *ringKey
+
+	for _, rk := range kr.keys {
+		if rk.activeFrom.IsZero() || kr.retired(rk) {
+			continue
+		}
+
+		if latest == nil || rk.activeFrom.After(latest.activeFrom) {
+			latest = rk
+		}
+	}
+
+	return latest
+}
+
+func (kr *KeyRing) retired(rk *ringKey) bool {
+	return !rk.retireAt.IsZero() && !kr.now().Before(rk.retireAt)
+}
+
+// prune keeps retired keys of the configuration, their retirement has to be stored for other processes
+func (kr *KeyRing) prune() {
+	for id, rk := range kr.keys {
+		if kr.retired(rk) && !rk.configured {
+			delete(kr.keys, id)
+		}
+	}
+}
+
+// Rotate rotates the access and refresh key rings. With a store the rotated rings are saved, the new
+// keys sign once the publish delay has passed.
+func (k *Keys) Rotate(ctx context.Context) error {
+	for _, r := range k.rings() {
+		if err := k.rotate(ctx, r.name, r.ring); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// StartRotation rotates both key rings every interval and prunes retired keys until ctx is done. With
+// a store the rings are synced every sync interval instead and rotated once their latest key is older
+// than interval, so one process rotates for all of them; rotating them needs the key encryption key.
+func (k *Keys) StartRotation(ctx context.Context, interval time.Duration, onErr func(error)) error {
+	tick := interval
+	if k.store != nil {
+		tick = k.syncEvery
+
+		if interval > 0 && k.kek == nil {
+			return models.ErrNoKeyEncryption
+		}
+	}
+
+	if tick <= 0 {
+		return nil
+	}
+
+	go func() {
+		ticker := time.NewTicker(tick)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := k.tick(ctx, interval); err != nil {
+					onErr(err)
+				}
+			}
+		}
+	}()
+
+	return nil
+}
+
+// JWKS returns the public keys that resource servers can use to verify access tokens
+func (k *Keys) JWKS() *models.JWKSet {
+	set := &models.JWKSet{Keys: []models.JWK{}}
+
+	for _, key := range k.Access.Keys() {
+		if jwk, ok := key.JWK(); ok {
+			set.Keys = append(set.Keys, jwk)
+		}
+	}
+
+	return set
+}
+
+func generateSigningKey(alg string) (*SigningKey, error) {
+	switch alg {
+	case AlgHS256:
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, err
+		}
+
+		return NewHMACKey(secret), nil
+	case AlgRS256:
+		priv, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return nil, err
+		}
+
+		return NewSigningKey(alg, priv)
+	case AlgES256:
+		priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+
+		return NewSigningKey(alg, priv)
+	case AlgEdDSA:
+		_, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+
+		return NewSigningKey(alg, priv)
+	default:
+		return nil, errUnsupportedAlg
+	}
+}
@@ -0,0 +1,339 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/cipher"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"auth-rest-api/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyRing_Rotate(t *testing.T) {
+	now := time.Now()
+
+	ring := NewKeyRing(NewHMACKey([]byte("ABCD")), accessTokenTTL)
+	ring.now = func() time.Time { return now }
+
+	keys := NewKeys(ring, NewKeyRing(NewHMACKey([]byte("XYZ")), refreshTokenTTL))
+
+	before, err := keys.GenerateToken(email, "", "", nil)
+	require.NoError(t, err)
+
+	oldKid := ring.Active().ID
+
+	newKey, err := ring.Rotate()
+	require.NoError(t, err)
+	assert.NotEqual(t, oldKid, newKey.ID)
+	assert.Equal(t, newKey, ring.Active())
+	assert.Len(t, ring.Keys(), 2)
+
+	after, err := keys.GenerateToken(email, "", "", nil)
+	require.NoError(t, err)
+
+	// tokens from both keys verify during the overlap
+	_, err = keys.ParseToken(before.AccessToken, "access")
+	assert.NoError(t, err)
+
+	_, err = keys.ParseToken(after.AccessToken, "access")
+	assert.NoError(t, err)
+
+	// once the max token lifetime has passed the old key is retired
+	now = now.Add(accessTokenTTL)
+
+	_, ok := ring.Lookup(oldKid)
+	assert.False(t, ok)
+
+	_, err = keys.ParseToken(before.AccessToken, "access")
+	assert.ErrorIs(t, err, errUnknownKid)
+
+	ring.Prune()
+	assert.Len(t, ring.Keys(), 1)
+}
+
+func TestKeyRing_VerificationKeys(t *testing.T) {
+	previous := NewKeys(NewKeyRing(NewHMACKey([]byte("OLD")), accessTokenTTL), NewKeyRing(NewHMACKey([]byte("XYZ")), refreshTokenTTL))
+
+	td, err := previous.GenerateToken(email, "", "", nil)
+	require.NoError(t, err)
+
+	current := NewKeys(NewKeyRing(NewHMACKey([]byte("NEW")), accessTokenTTL, NewHMACKey([]byte("OLD"))),
+		NewKeyRing(NewHMACKey([]byte("XYZ")), refreshTokenTTL))
+
+	claims, err := current.ParseToken(td.AccessToken, "access")
+	require.NoError(t, err)
+	assert.Equal(t, email, claims.Email)
+
+	// new tokens are always signed by the active key
+	td, err = current.GenerateToken(email, "", "", nil)
+	require.NoError(t, err)
+
+	_, err = previous.ParseToken(td.AccessToken, "access")
+	assert.ErrorIs(t, err, errUnknownKid)
+}
+
+func TestKeysFromEnv(t *testing.T) {
+	t.Setenv("ACCESS_SECRET", "ABCD")
+	t.Setenv("REFRESH_SECRET", "XYZ")
+	t.Setenv("ACCESS_SECRET_PREVIOUS", "OLD1, OLD2")
+	t.Setenv("JWT_SIGNING_ALG", "")
+
+	keys, err := KeysFromEnv()
+	require.NoError(t, err)
+
+	assert.Equal(t, NewHMACKey([]byte("ABCD")).ID, keys.Access.Active().ID)
+	assert.Len(t, keys.Access.Keys(), 3)
+	assert.Len(t, keys.Refresh.Keys(), 1)
+
+	t.Setenv("JWT_SIGNING_ALG", AlgRS256)
+	t.Setenv("JWT_PRIVATE_KEY_FILE", "does-not-exist.pem")
+
+	_, err = KeysFromEnv()
+	assert.Error(t, err)
+}
+
+// testKEK returns a key encryption key filled with b
+func testKEK(t *testing.T, b byte) cipher.AEAD {
+	t.Helper()
+
+	kek, err := newKeyEncryption(bytes.Repeat([]byte{b}, 32))
+	require.NoError(t, err)
+
+	return kek
+}
+
+// memKeyRingStore keeps key rings like the store backends do
+type memKeyRingStore struct {
+	rings map[string]models.KeyRingState
+}
+
+func (m *memKeyRingStore) GetKeyRing(_ context.Context, name string) (*models.KeyRingState, error) {
+	state := m.rings[name]
+
+	return &state, nil
+}
+
+func (m *memKeyRingStore) SaveKeyRing(_ context.Context, name string, state *models.KeyRingState) error {
+	if m.rings[name].Version != state.Version {
+		return models.ErrKeyRingChanged
+	}
+
+	m.rings[name] = models.KeyRingState{Version: state.Version + 1, Keys: state.Keys}
+
+	return nil
+}
+
+func TestKeys_Load(t *testing.T) {
+	ctx := context.Background()
+	st := &memKeyRingStore{rings: map[string]models.KeyRingState{}}
+	now := time.Now()
+	clock := func() time.Time { return now }
+
+	// replicas and restarts build their rings from the same configuration
+	newReplica := func(alg string) *Keys {
+		access := NewKeyRing(NewHMACKey([]byte("ABCD")), accessTokenTTL)
+		if alg != AlgHS256 {
+			key, err := generateSigningKey(alg)
+			require.NoError(t, err)
+
+			access = NewKeyRing(key, accessTokenTTL)
+		}
+
+		keys := NewKeys(access, NewKeyRing(NewHMACKey([]byte("XYZ")), refreshTokenTTL))
+		keys.Access.now, keys.Refresh.now = clock, clock
+		keys.kek = testKEK(t, 1)
+
+		require.NoError(t, keys.Load(ctx, st, time.Minute))
+
+		return keys
+	}
+
+	first, second := newReplica(AlgHS256), newReplica(AlgHS256)
+	assert.Equal(t, int64(1), st.rings[accessKeyRing].Version)
+
+	configured := first.Access.Active().ID
+	before, err := first.GenerateToken(email, "", "", nil)
+	require.NoError(t, err)
+
+	require.NoError(t, first.Rotate(ctx))
+
+	rotated := first.Access.newest().ID
+	assert.NotEqual(t, configured, rotated)
+
+	// the rotated key is published before it signs
+	assert.Equal(t, configured, first.Access.Active().ID)
+	require.NoError(t, second.Sync(ctx))
+	assert.Len(t, second.Access.Keys(), 2)
+
+	now = now.Add(time.Minute)
+	assert.Equal(t, rotated, first.Access.Active().ID)
+	assert.Equal(t, rotated, second.Access.Active().ID)
+
+	// tokens of either replica verify on the other one
+	after, err := second.GenerateToken(email, "", "", nil)
+	require.NoError(t, err)
+
+	_, err = first.ParseToken(after.AccessToken, "access")
+	assert.NoError(t, err)
+
+	_, err = first.ParseToken(after.RefreshToken, "refresh")
+	assert.NoError(t, err)
+
+	_, err = second.ParseToken(before.AccessToken, "access")
+	assert.NoError(t, err)
+
+	// a restart keeps the rotated keys
+	restarted := newReplica(AlgHS256)
+	assert.Equal(t, rotated, restarted.Access.Active().ID)
+
+	_, err = restarted.ParseToken(after.AccessToken, "access")
+	assert.NoError(t, err)
+
+	// the configured key retires after the max token lifetime and is not brought back by a restart
+	now = now.Add(accessTokenTTL)
+
+	_, err = restarted.ParseToken(before.AccessToken, "access")
+	assert.ErrorIs(t, err, errUnknownKid)
+
+	restarted = newReplica(AlgHS256)
+	_, ok := restarted.Access.Lookup(configured)
+	assert.False(t, ok)
+	assert.Equal(t, rotated, restarted.Access.Active().ID)
+
+	// a replica that did not sync yet rotates on top of the stored ring
+	require.NoError(t, second.Rotate(ctx))
+
+	now = now.Add(time.Second)
+	require.NoError(t, first.Rotate(ctx))
+	require.NoError(t, second.Sync(ctx))
+	assert.Equal(t, int64(4), st.rings[accessKeyRing].Version)
+	assert.Equal(t, first.Access.newest().ID, second.Access.newest().ID)
+	assert.Len(t, second.Access.Keys(), 3)
+
+	now = now.Add(time.Minute)
+	latest := first.Access.Active().ID
+	assert.Equal(t, latest, second.Access.Active().ID)
+
+	// another configured active key takes over and retires the stored keys
+	changed := newReplica(AlgES256)
+	assert.Equal(t, changed.Access.base.ID, changed.Access.Active().ID)
+	assert.Len(t, changed.JWKS().Keys, 1)
+
+	_, err = changed.ParseToken(after.AccessToken, "access")
+	assert.NoError(t, err)
+
+	require.NoError(t, first.Sync(ctx))
+	assert.Equal(t, latest, first.Access.Active().ID, "the other configuration can not sign here")
+
+	now = now.Add(accessTokenTTL)
+
+	_, err = changed.ParseToken(after.AccessToken, "access")
+	assert.ErrorIs(t, err, errUnknownKid)
+}
+
+func TestKeys_StartRotation(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	st := &memKeyRingStore{rings: map[string]models.KeyRingState{}}
+	keys := NewKeys(NewKeyRing(NewHMACKey([]byte("ABCD")), accessTokenTTL), NewKeyRing(NewHMACKey([]byte("XYZ")), refreshTokenTTL))
+	keys.kek = testKEK(t, 1)
+	require.NoError(t, keys.Load(ctx, st, time.Minute))
+
+	// the configured keys are not due yet
+	require.NoError(t, keys.tick(ctx, time.Hour))
+	assert.Equal(t, int64(1), st.rings[accessKeyRing].Version)
+
+	now := time.Now().Add(time.Hour)
+	keys.Access.now, keys.Refresh.now = func() time.Time { return now }, func() time.Time { return now }
+
+	require.NoError(t, keys.tick(ctx, time.Hour))
+	assert.Equal(t, int64(2), st.rings[accessKeyRing].Version)
+	assert.Equal(t, int64(2), st.rings[refreshKeyRing].Version)
+
+	// the rotated keys are not due before they signed for an interval
+	require.NoError(t, keys.tick(ctx, time.Hour))
+	assert.Equal(t, int64(2), st.rings[accessKeyRing].Version)
+}
+
+func TestKeys_KeyEncryption(t *testing.T) {
+	ctx := context.Background()
+	st := &memKeyRingStore{rings: map[string]models.KeyRingState{}}
+
+	newReplica := func(kek cipher.AEAD) *Keys {
+		keys := NewKeys(NewKeyRing(NewHMACKey([]byte("ABCD")), accessTokenTTL), NewKeyRing(NewHMACKey([]byte("XYZ")), refreshTokenTTL))
+		keys.kek = kek
+
+		return keys
+	}
+
+	// configured keys are stored without key material, so a ring that was never rotated needs no key
+	plain := newReplica(nil)
+	require.NoError(t, plain.Load(ctx, st, time.Minute))
+	assert.ErrorIs(t, plain.Rotate(ctx), models.ErrNoKeyEncryption)
+	assert.ErrorIs(t, plain.StartRotation(ctx, time.Hour, func(error) {}), models.ErrNoKeyEncryption)
+	assert.Equal(t, int64(1), st.rings[accessKeyRing].Version)
+
+	sealed := newReplica(testKEK(t, 1))
+	require.NoError(t, sealed.Load(ctx, st, time.Minute))
+	require.NoError(t, sealed.Rotate(ctx))
+
+	rotated, err := privateKeyBytes(sealed.Access.newest())
+	require.NoError(t, err)
+
+	for _, sk := range st.rings[accessKeyRing].Keys {
+		assert.NotContains(t, string(sk.Private), string(rotated))
+	}
+
+	// the rotated keys can only be read with the same key
+	assert.ErrorIs(t, newReplica(nil).Load(ctx, st, time.Minute), models.ErrNoKeyEncryption)
+	assert.Error(t, newReplica(testKEK(t, 2)).Load(ctx, st, time.Minute))
+
+	// key material is bound to its kid
+	stored := st.rings[accessKeyRing]
+	moved := models.KeyRingState{Version: stored.Version, Keys: append([]models.StoredKey(nil), stored.Keys...)}
+
+	for i := range moved.Keys {
+		if len(moved.Keys[i].Private) > 0 {
+			moved.Keys[i].ID = "other"
+		}
+	}
+
+	st.rings[accessKeyRing] = moved
+	assert.Error(t, newReplica(testKEK(t, 1)).Load(ctx, st, time.Minute))
+
+	st.rings[accessKeyRing] = stored
+	restarted := newReplica(testKEK(t, 1))
+	require.NoError(t, restarted.Load(ctx, st, time.Minute))
+	assert.Equal(t, sealed.Access.newest().ID, restarted.Access.newest().ID)
+}
+
+func TestKeyEncryptionFromEnv(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		wantKEK bool
+		wantErr bool
+	}{
+		{name: "unset", value: ""},
+		{name: "32 bytes", value: base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32)), wantKEK: true},
+		{name: "16 bytes", value: base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 16)), wantErr: true},
+		{name: "not base64", value: "not base64!", wantErr: true},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("JWT_KEY_ENCRYPTION_KEY", tt.value)
+
+			kek, err := keyEncryptionFromEnv()
+
+			assert.Equalf(t, tt.wantErr, err != nil, "TEST[%d] Failed - %s", i, tt.name)
+			assert.Equalf(t, tt.wantKEK, kek != nil, "TEST[%d] Failed - %s", i, tt.name)
+		})
+	}
+}
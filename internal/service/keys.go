@@ -0,0 +1,308 @@
+package service
+
+import (
+	"crypto"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"time"
+
+	"auth-rest-api/internal/models"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgES256 = "ES256"
+	AlgEdDSA = "EdDSA"
+)
+
+var (
+	errUnsupportedAlg = errors.New("unsupported signing algorithm")
+	errKeyMismatch    = errors.New("private key does not match signing algorithm")
+	errNoPEMBlock     = errors.New("no PEM block found in key file")
+	errUnknownKid     = errors.New("unknown signing key id")
+	errUnexpectedAlg  = errors.New("unexpected signing algorithm")
+)
+
+// SigningKey holds the material used to sign and verify tokens for one kid
+type SigningKey struct {
+	ID      string
+	Method  jwt.SigningMethod
+	Private any
+	Public  any
+}
+
+// Keys holds the key rings for access and refresh tokens. Access tokens may use an
+// asymmetric algorithm so that resource servers can verify them through the JWKS,
+// refresh tokens are only ever verified by us and stay on HMAC.
+type Keys struct {
+	Access  *KeyRing
+	Refresh *KeyRing
+	// store shares the rings with other processes once Load was called, syncEvery is how often they are
+	// read back
+	store     KeyRingStore
+	syncEvery time.Duration
+	// kek encrypts the generated keys kept in the store
+	kek cipher.AEAD
+}
+
+func NewKeys(access, refresh *KeyRing) *Keys {
+	return &Keys{Access: access, Refresh: refresh}
+}
+
+// KeysFromEnv builds the key rings from the environment:
+//   - JWT_SIGNING_ALG and JWT_PRIVATE_KEY_FILE select the access token key, HS256 with ACCESS_SECRET by default
+//   - JWT_VERIFY_KEY_FILES lists previous asymmetric private keys that are only used for verification
+//   - ACCESS_SECRET_PREVIOUS and REFRESH_SECRET_PREVIOUS list previous HMAC secrets
+//   - JWT_KEY_ENCRYPTION_KEY encrypts the rotated keys kept in the store
+func KeysFromEnv() (*Keys, error) {
+	kek, err := keyEncryptionFromEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	keys, err := keyRingsFromEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	keys.kek = kek
+
+	return keys, nil
+}
+
+func keyRingsFromEnv() (*Keys, error) {
+	accSecret, refSecret := getJWTSecrets()
+
+	refresh := NewKeyRing(NewHMACKey(refSecret), refreshTokenTTL, hmacKeys(getEnvAsList("REFRESH_SECRET_PREVIOUS"))...)
+
+	alg := os.Getenv("JWT_SIGNING_ALG")
+	if alg == "" || alg == AlgHS256 {
+		access := NewKeyRing(NewHMACKey(accSecret), accessTokenTTL, hmacKeys(getEnvAsList("ACCESS_SECRET_PREVIOUS"))...)
+
+		return NewKeys(access, refresh), nil
+	}
+
+	active, err := LoadSigningKey(alg, os.Getenv("JWT_PRIVATE_KEY_FILE"))
+	if err != nil {
+		return nil, err
+	}
+
+	var verify []*SigningKey
+
+	for _, path := range getEnvAsList("JWT_VERIFY_KEY_FILES") {
+		key, err := LoadSigningKey("", path)
+		if err != nil {
+			return nil, err
+		}
+
+		verify = append(verify, key)
+	}
+
+	return NewKeys(NewKeyRing(active, accessTokenTTL, verify...), refresh), nil
+}
+
+func hmacKeys(secrets []string) []*SigningKey {
+	keys := make([]*SigningKey, 0, len(secrets))
+
+	for _, secret := range secrets {
+		keys = append(keys, NewHMACKey([]byte(secret)))
+	}
+
+	return keys
+}
+
+// NewHMACKey returns a HS256 key, the kid is derived from a hash of the secret
+func NewHMACKey(secret []byte) *SigningKey {
+	sum := sha256.Sum256(secret)
+
+	return &SigningKey{
+		ID:      hex.EncodeToString(sum[:8]),
+		Method:  jwt.SigningMethodHS256,
+		Private: secret,
+		Public:  secret,
+	}
+}
+
+// LoadSigningKey reads a PEM encoded private key (PKCS#8, PKCS#1 or SEC 1) for the given algorithm,
+// an empty alg is inferred from the key type
+func LoadSigningKey(alg, path string) (*SigningKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read signing key: %w", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errNoPEMBlock
+	}
+
+	priv, err := parsePrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	if alg == "" {
+		alg = inferAlg(priv)
+	}
+
+	return NewSigningKey(alg, priv)
+}
+
+func inferAlg(priv crypto.Signer) string {
+	switch k := priv.(type) {
+	case *rsa.PrivateKey:
+		return AlgRS256
+	case *ecdsa.PrivateKey:
+		if k.Curve == elliptic.P256() {
+			return AlgES256
+		}
+	case ed25519.PrivateKey:
+		return AlgEdDSA
+	}
+
+	return ""
+}
+
+// NewSigningKey wraps an asymmetric private key, the kid is the RFC 7638 thumbprint of its public key
+func NewSigningKey(alg string, priv crypto.Signer) (*SigningKey, error) {
+	var method jwt.SigningMethod
+
+	switch alg {
+	case AlgRS256:
+		if _, ok := priv.(*rsa.PrivateKey); !ok {
+			return nil, errKeyMismatch
+		}
+
+		method = jwt.SigningMethodRS256
+	case AlgES256:
+		k, ok := priv.(*ecdsa.PrivateKey)
+		if !ok || k.Curve != elliptic.P256() {
+			return nil, errKeyMismatch
+		}
+
+		method = jwt.SigningMethodES256
+	case AlgEdDSA:
+		if _, ok := priv.(ed25519.PrivateKey); !ok {
+			return nil, errKeyMismatch
+		}
+
+		method = jwt.SigningMethodEdDSA
+	default:
+		return nil, errUnsupportedAlg
+	}
+
+	key := &SigningKey{Method: method, Private: priv, Public: priv.Public()}
+
+	jwk, _ := key.JWK()
+
+	kid, err := thumbprint(jwk)
+	if err != nil {
+		return nil, err
+	}
+
+	key.ID = kid
+
+	return key, nil
+}
+
+// JWK returns the public key in JWK format, HMAC keys are never published
+func (k *SigningKey) JWK() (models.JWK, bool) {
+	jwk := models.JWK{Kid: k.ID, Use: "sig", Alg: k.Method.Alg()}
+
+	switch pub := k.Public.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = b64(pub.N.Bytes())
+		jwk.E = b64(big.NewInt(int64(pub.E)).Bytes())
+	case *ecdsa.PublicKey:
+		ecdh, err := pub.ECDH()
+		if err != nil {
+			return models.JWK{}, false
+		}
+
+		// uncompressed point: 0x04 || X || Y
+		point := ecdh.Bytes()
+		size := (len(point) - 1) / 2
+
+		jwk.Kty = "EC"
+		jwk.Crv = pub.Curve.Params().Name
+		jwk.X = b64(point[1 : 1+size])
+		jwk.Y = b64(point[1+size:])
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = b64(pub)
+	default:
+		return models.JWK{}, false
+	}
+
+	return jwk, true
+}
+
+func parsePrivateKey(der []byte) (crypto.Signer, error) {
+	if key, err := x509.ParsePKCS8PrivateKey(der); err == nil {
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, errUnsupportedAlg
+		}
+
+		return signer, nil
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return key, nil
+	}
+
+	key, err := x509.ParseECPrivateKey(der)
+	if err != nil {
+		return nil, errors.New("unsupported private key format")
+	}
+
+	return key, nil
+}
+
+// thumbprint computes the RFC 7638 JWK thumbprint, the required members are
+// marshalled in lexicographic order which encoding/json does for maps
+func thumbprint(jwk models.JWK) (string, error) {
+	var members map[string]string
+
+	switch jwk.Kty {
+	case "RSA":
+		members = map[string]string{"e": jwk.E, "kty": jwk.Kty, "n": jwk.N}
+	case "EC":
+		members = map[string]string{"crv": jwk.Crv, "kty": jwk.Kty, "x": jwk.X, "y": jwk.Y}
+	case "OKP":
+		members = map[string]string{"crv": jwk.Crv, "kty": jwk.Kty, "x": jwk.X}
+	default:
+		return "", errUnsupportedAlg
+	}
+
+	data, err := json.Marshal(members)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(data)
+
+	return b64(sum[:]), nil
+}
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,113 @@
+package service
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writePEMKey(t *testing.T, priv crypto.Signer) string {
+	t.Helper()
+
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "key.pem")
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600))
+
+	return path
+}
+
+func TestLoadSigningKey(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	ecP384Key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	require.NoError(t, err)
+
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		alg     string
+		key     crypto.Signer
+		wantKty string
+		wantErr error
+	}{
+		{name: "RS256", alg: AlgRS256, key: rsaKey, wantKty: "RSA"},
+		{name: "ES256", alg: AlgES256, key: ecKey, wantKty: "EC"},
+		{name: "EdDSA", alg: AlgEdDSA, key: edKey, wantKty: "OKP"},
+		{name: "ES256 with P-384 key", alg: AlgES256, key: ecP384Key, wantErr: errKeyMismatch},
+		{name: "RS256 with ed25519 key", alg: AlgRS256, key: edKey, wantErr: errKeyMismatch},
+		{name: "unsupported alg", alg: "PS512", key: rsaKey, wantErr: errUnsupportedAlg},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := LoadSigningKey(tt.alg, writePEMKey(t, tt.key))
+			if tt.wantErr != nil {
+				assert.ErrorIsf(t, err, tt.wantErr, "TEST[%d] Failed - %s", i, tt.name)
+				return
+			}
+
+			require.NoError(t, err)
+
+			keys := NewKeys(NewKeyRing(key, accessTokenTTL), NewKeyRing(NewHMACKey([]byte("XYZ")), refreshTokenTTL))
+
+			jwks := keys.JWKS()
+			require.Len(t, jwks.Keys, 1)
+			assert.Equalf(t, tt.wantKty, jwks.Keys[0].Kty, "TEST[%d] Failed - %s", i, tt.name)
+			assert.Equalf(t, key.ID, jwks.Keys[0].Kid, "TEST[%d] Failed - %s", i, tt.name)
+
+			td, err := keys.GenerateToken(email, "", "", nil)
+			require.NoError(t, err)
+
+			token, err := jwt.Parse(td.AccessToken, keys.Access.Keyfunc)
+			require.NoError(t, err)
+			assert.Equalf(t, key.ID, token.Header["kid"], "TEST[%d] Failed - %s", i, tt.name)
+			assert.Equalf(t, tt.alg, token.Method.Alg(), "TEST[%d] Failed - %s", i, tt.name)
+		})
+	}
+}
+
+func TestKeyRing_Keyfunc(t *testing.T) {
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	key, err := NewSigningKey(AlgEdDSA, edKey)
+	require.NoError(t, err)
+
+	keys := NewKeys(NewKeyRing(key, accessTokenTTL), NewKeyRing(NewHMACKey([]byte("XYZ")), refreshTokenTTL))
+
+	// a HS256 token keyed with the public key must not pass as the asymmetric algorithm
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": email})
+	forged.Header["kid"] = key.ID
+
+	forgedStr, err := forged.SignedString([]byte(edKey.Public().(ed25519.PublicKey)))
+	require.NoError(t, err)
+
+	_, err = jwt.Parse(forgedStr, keys.Access.Keyfunc)
+	assert.ErrorIs(t, err, errUnexpectedAlg)
+}
+
+func TestKeys_JWKSOmitsHMAC(t *testing.T) {
+	keys := NewKeys(NewKeyRing(NewHMACKey([]byte("ABCD")), accessTokenTTL), NewKeyRing(NewHMACKey([]byte("XYZ")), refreshTokenTTL))
+
+	assert.Empty(t, keys.JWKS().Keys)
+}
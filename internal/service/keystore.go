@@ -0,0 +1,416 @@
+package service
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"auth-rest-api/internal/models"
+)
+
+// Names the key rings are stored under
+const (
+	accessKeyRing  = "access"
+	refreshKeyRing = "refresh"
+)
+
+// KeyRingStore keeps the key rings shared by every process, the Storer of each backend implements it
+type KeyRingStore interface {
+	GetKeyRing(ctx context.Context, name string) (*models.KeyRingState, error)
+	SaveKeyRing(ctx context.Context, name string, state *models.KeyRingState) error
+}
+
+type namedRing struct {
+	name string
+	ring *KeyRing
+}
+
+func (k *Keys) rings() []namedRing {
+	return []namedRing{{accessKeyRing, k.Access}, {refreshKeyRing, k.Refresh}}
+}
+
+// Load shares the key rings through st, so rotated keys survive restarts and every replica signs with
+// the same key. Rings saved by another process are restored, rings missing in st are saved. Rotated
+// keys are published for syncEvery before they sign, the time every process needs to sync them.
+func (k *Keys) Load(ctx context.Context, st KeyRingStore, syncEvery time.Duration) error {
+	k.store, k.syncEvery = st, syncEvery
+
+	for _, r := range k.rings() {
+		r.ring.mu.Lock()
+		r.ring.delay = syncEvery
+		r.ring.mu.Unlock()
+	}
+
+	return k.Sync(ctx)
+}
+
+// Sync restores the key rings from the store, rotations of other processes take effect
+func (k *Keys) Sync(ctx context.Context) error {
+	for _, r := range k.rings() {
+		if err := k.sync(ctx, r.name, r.ring); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (k *Keys) sync(ctx context.Context, name string, ring *KeyRing) error {
+	state, err := k.store.GetKeyRing(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	state, err = k.open(name, state)
+	if err != nil {
+		return err
+	}
+
+	changed, err := ring.restore(state)
+	if err != nil || !changed {
+		return err
+	}
+
+	sealed, err := k.seal(name, ring)
+	if err != nil {
+		return err
+	}
+
+	// the ring is new to the store or the configuration brought another active key, a process saving
+	// first wins and is restored with the next sync
+	if err := k.store.SaveKeyRing(ctx, name, sealed); err != nil && !errors.Is(err, models.ErrKeyRingChanged) {
+		return err
+	}
+
+	return nil
+}
+
+// rotate rotates a copy of the ring and only takes it over once it is saved, a key that is not in the
+// store never signs
+func (k *Keys) rotate(ctx context.Context, name string, ring *KeyRing) error {
+	if k.store == nil {
+		_, err := ring.Rotate()
+
+		return err
+	}
+
+	// generated keys are only stored encrypted
+	if k.kek == nil {
+		return models.ErrNoKeyEncryption
+	}
+
+	if err := k.sync(ctx, name, ring); err != nil {
+		return err
+	}
+
+	next := ring.clone()
+	if _, err := next.Rotate(); err != nil {
+		return err
+	}
+
+	state, err := k.seal(name, next)
+	if err != nil {
+		return err
+	}
+
+	if err := k.store.SaveKeyRing(ctx, name, state); err != nil {
+		// another process saved the ring in the meantime, its keys are used
+		if errors.Is(err, models.ErrKeyRingChanged) {
+			return k.sync(ctx, name, ring)
+		}
+
+		return err
+	}
+
+	// the ring takes the plain key material of the saved keys
+	plain, err := next.snapshot()
+	if err != nil {
+		return err
+	}
+
+	plain.Version = state.Version + 1
+
+	_, err = ring.restore(plain)
+
+	return err
+}
+
+// tick is a step of StartRotation
+func (k *Keys) tick(ctx context.Context, interval time.Duration) error {
+	if k.store == nil {
+		return k.Rotate(ctx)
+	}
+
+	for _, r := range k.rings() {
+		if err := k.sync(ctx, r.name, r.ring); err != nil {
+			return err
+		}
+
+		if interval > 0 && r.ring.due(interval) {
+			if err := k.rotate(ctx, r.name, r.ring); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// due tells whether the latest key of the ring started signing interval ago
+func (kr *KeyRing) due(interval time.Duration) bool {
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+
+	latest := kr.latest()
+
+	return latest == nil || !kr.now().Before(latest.activeFrom.Add(interval))
+}
+
+func (kr *KeyRing) clone() *KeyRing {
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+
+	c := &KeyRing{base: kr.base, keys: make(map[string]*ringKey, len(kr.keys)), retireAfter: kr.retireAfter, delay: kr.delay,
+		version: kr.version, now: kr.now}
+
+	for id, rk := range kr.keys {
+		cp := *rk
+		c.keys[id] = &cp
+	}
+
+	return c
+}
+
+// snapshot returns the ring with the plain key material of generated keys, keys of the configuration
+// are stored without key material
+func (kr *KeyRing) snapshot() (*models.KeyRingState, error) {
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+
+	state := &models.KeyRingState{Version: kr.version, Keys: make([]models.StoredKey, 0, len(kr.keys))}
+
+	for _, rk := range kr.keys {
+		sk := models.StoredKey{ID: rk.key.ID, Alg: rk.key.Method.Alg(), ActiveFrom: unixMilli(rk.activeFrom),
+			RetireAt: unixMilli(rk.retireAt)}
+
+		if !rk.configured {
+			der, err := privateKeyBytes(rk.key)
+			if err != nil {
+				return nil, err
+			}
+
+			sk.Private = der
+		}
+
+		state.Keys = append(state.Keys, sk)
+	}
+
+	sort.Slice(state.Keys, func(i, j int) bool { return state.Keys[i].ID < state.Keys[j].ID })
+
+	return state, nil
+}
+
+// seal returns the ring as it is stored, the key material is encrypted with the key encryption key and
+// bound to the ring and kid, so it cannot be moved to another key
+func (k *Keys) seal(name string, ring *KeyRing) (*models.KeyRingState, error) {
+	state, err := ring.snapshot()
+	if err != nil {
+		return nil, err
+	}
+
+	for i, sk := range state.Keys {
+		if len(sk.Private) == 0 {
+			continue
+		}
+
+		if k.kek == nil {
+			return nil, models.ErrNoKeyEncryption
+		}
+
+		nonce := make([]byte, k.kek.NonceSize())
+		if _, err := rand.Read(nonce); err != nil {
+			return nil, err
+		}
+
+		state.Keys[i].Private = k.kek.Seal(nonce, nonce, sk.Private, keyAAD(name, sk.ID))
+	}
+
+	return state, nil
+}
+
+// open returns a stored ring with the key material decrypted
+func (k *Keys) open(name string, state *models.KeyRingState) (*models.KeyRingState, error) {
+	plain := &models.KeyRingState{Version: state.Version, Keys: make([]models.StoredKey, len(state.Keys))}
+
+	for i, sk := range state.Keys {
+		plain.Keys[i] = sk
+
+		if len(sk.Private) == 0 {
+			continue
+		}
+
+		if k.kek == nil {
+			return nil, models.ErrNoKeyEncryption
+		}
+
+		size := k.kek.NonceSize()
+		if len(sk.Private) < size {
+			return nil, fmt.Errorf("decrypt signing key %s: ciphertext too short", sk.ID)
+		}
+
+		der, err := k.kek.Open(nil, sk.Private[:size], sk.Private[size:], keyAAD(name, sk.ID))
+		if err != nil {
+			return nil, fmt.Errorf("decrypt signing key %s: %w", sk.ID, err)
+		}
+
+		plain.Keys[i].Private = der
+	}
+
+	return plain, nil
+}
+
+func keyAAD(name, kid string) []byte {
+	return []byte(name + ":" + kid)
+}
+
+// keyEncryptionFromEnv reads JWT_KEY_ENCRYPTION_KEY, 32 base64 encoded bytes for AES-256-GCM, nil is
+// returned when it is unset
+func keyEncryptionFromEnv() (cipher.AEAD, error) {
+	value := os.Getenv("JWT_KEY_ENCRYPTION_KEY")
+	if value == "" {
+		return nil, nil
+	}
+
+	key, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("JWT_KEY_ENCRYPTION_KEY: %w", err)
+	}
+
+	return newKeyEncryption(key)
+}
+
+func newKeyEncryption(key []byte) (cipher.AEAD, error) {
+	if len(key) != 32 {
+		return nil, errors.New("JWT_KEY_ENCRYPTION_KEY must be 32 bytes")
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// restore replaces the ring with the stored one. Keys of the configuration keep their key material and
+// take the stored times, keys only another process was configured with are skipped. It tells whether
+// the ring has to be saved: it was never stored or the configured active key is new to it, which then
+// takes over and retires the stored keys.
+func (kr *KeyRing) restore(state *models.KeyRingState) (bool, error) {
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+
+	keys := map[string]*ringKey{}
+
+	for id, rk := range kr.keys {
+		if rk.configured {
+			cp := *rk
+			keys[id] = &cp
+		}
+	}
+
+	baseStored := false
+
+	for _, sk := range state.Keys {
+		activeFrom, retireAt := fromUnixMilli(sk.ActiveFrom), fromUnixMilli(sk.RetireAt)
+
+		if rk, ok := keys[sk.ID]; ok {
+			rk.activeFrom, rk.retireAt = activeFrom, retireAt
+			baseStored = baseStored || sk.ID == kr.base.ID
+
+			continue
+		}
+
+		if len(sk.Private) == 0 {
+			continue
+		}
+
+		key, err := parseStoredKey(sk)
+		if err != nil {
+			return false, err
+		}
+
+		keys[sk.ID] = &ringKey{key: key, activeFrom: activeFrom, retireAt: retireAt}
+	}
+
+	if len(state.Keys) > 0 && !baseStored {
+		now := kr.now()
+
+		for _, rk := range keys {
+			switch {
+			case rk.key.ID == kr.base.ID:
+				rk.activeFrom = now
+			case rk.activeFrom.After(now):
+				// a rotated key that did not sign yet is only kept for verification
+				rk.activeFrom, rk.retireAt = time.Time{}, now.Add(kr.retireAfter)
+			case !rk.activeFrom.IsZero() && rk.retireAt.IsZero():
+				rk.retireAt = now.Add(kr.retireAfter)
+			}
+		}
+	}
+
+	kr.keys, kr.version = keys, state.Version
+	kr.prune()
+
+	return len(state.Keys) == 0 || !baseStored, nil
+}
+
+func privateKeyBytes(key *SigningKey) ([]byte, error) {
+	if secret, ok := key.Private.([]byte); ok {
+		return secret, nil
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(key.Private)
+	if err != nil {
+		return nil, fmt.Errorf("encode signing key %s: %w", key.ID, err)
+	}
+
+	return der, nil
+}
+
+func parseStoredKey(sk models.StoredKey) (*SigningKey, error) {
+	if sk.Alg == AlgHS256 {
+		return NewHMACKey(sk.Private), nil
+	}
+
+	priv, err := parsePrivateKey(sk.Private)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewSigningKey(sk.Alg, priv)
+}
+
+func unixMilli(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+
+	return t.UnixMilli()
+}
+
+func fromUnixMilli(ms int64) time.Time {
+	if ms == 0 {
+		return time.Time{}
+	}
+
+	return time.UnixMilli(ms)
+}
@@ -0,0 +1,134 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"time"
+
+	"auth-rest-api/internal/models"
+	"auth-rest-api/internal/server"
+)
+
+const (
+	signInCounter  = "signin"
+	signInLockouts = "signin-lockouts"
+	// lockoutMemory is how long a lockout makes the next one of the same account or IP longer
+	lockoutMemory = 24 * time.Hour
+)
+
+// signInKey is an account or a client IP whose failed sign ins are counted
+type signInKey struct {
+	name string
+	max  int
+	// err is answered while the key is locked
+	err error
+}
+
+// signInKeys returns the keys a sign in for email counts against, a limit below 1 disables the key
+func (s *Service) signInKeys(ctx context.Context, email string) []signInKey {
+	var keys []signInKey
+
+	if s.Config.SignInMaxAttempts > 0 {
+		keys = append(keys, signInKey{name: "email:" + strings.ToLower(email), max: s.Config.SignInMaxAttempts,
+			err: models.ErrSignInLocked})
+	}
+
+	if ip := clientFromContext(ctx).IP; ip != "" && s.Config.SignInMaxIPAttempts > 0 {
+		keys = append(keys, signInKey{name: "ip:" + ip, max: s.Config.SignInMaxIPAttempts, err: models.ErrTooManyAttempts})
+	}
+
+	return keys
+}
+
+// checkSignInLock refuses the sign in while the account or the client IP is locked, even with the
+// right password
+func (s *Service) checkSignInLock(ctx context.Context, keys []signInKey) error {
+	for _, k := range keys {
+		d, err := s.Store.LockedFor(ctx, signInCounter+":"+k.name)
+		if err != nil {
+			return err
+		}
+
+		if d > 0 {
+			return models.ErrRetryAfter(k.err, d)
+		}
+	}
+
+	return nil
+}
+
+// countFailedSignIn counts a wrong password or unknown email. A key reaching its limit within
+// SignInAttemptWindow is locked and starts counting from zero once the lock ends, the lock error is
+// returned for the attempt that caused it.
+func (s *Service) countFailedSignIn(ctx context.Context, keys []signInKey) error {
+	logger := ctx.Value(server.Logger).(*slog.Logger)
+
+	var lockErr error
+
+	for _, k := range keys {
+		name := signInCounter + ":" + k.name
+
+		failures, err := s.Store.IncrCounter(ctx, name, s.Config.SignInAttemptWindow)
+		if err != nil {
+			return err
+		}
+
+		if failures < int64(k.max) {
+			continue
+		}
+
+		lockouts, err := s.Store.IncrCounter(ctx, signInLockouts+":"+k.name, lockoutMemory)
+		if err != nil {
+			return err
+		}
+
+		d := s.lockoutDuration(lockouts)
+
+		if err := s.Store.Lock(ctx, name, d); err != nil {
+			return err
+		}
+
+		if err := s.Store.ResetCounter(ctx, name); err != nil {
+			return err
+		}
+
+		logger.LogAttrs(ctx, slog.LevelWarn, "security event: too many failed sign ins, locking",
+			slog.String("event", "signin_lockout"), slog.String("key", k.name), slog.Int64("lockouts", lockouts),
+			slog.Duration("duration", d))
+
+		if lockErr == nil {
+			lockErr = models.ErrRetryAfter(k.err, d)
+		}
+	}
+
+	return lockErr
+}
+
+// lockoutDuration doubles SignInLockout with every lockout within lockoutMemory, up to SignInMaxLockout
+func (s *Service) lockoutDuration(lockouts int64) time.Duration {
+	d := s.Config.SignInLockout
+
+	for i := int64(1); i < lockouts && d < s.Config.SignInMaxLockout; i++ {
+		d *= 2
+	}
+
+	return min(d, s.Config.SignInMaxLockout)
+}
+
+// resetSignInFailures forgets the failed sign ins of an account after the right password, the count of
+// the client IP is kept so signing in to an own account does not help guessing others
+func (s *Service) resetSignInFailures(ctx context.Context, email string) {
+	logger := ctx.Value(server.Logger).(*slog.Logger)
+
+	if s.Config.SignInMaxAttempts <= 0 {
+		return
+	}
+
+	name := "email:" + strings.ToLower(email)
+
+	if err := s.Store.ResetCounter(ctx, signInCounter+":"+name, signInLockouts+":"+name); err != nil {
+		logger.LogAttrs(ctx, slog.LevelError, "failed to reset failed sign ins", slog.String("email", email),
+			slog.String("error", err.Error()))
+	}
+}
@@ -0,0 +1,134 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"auth-rest-api/internal/models"
+	"auth-rest-api/internal/server"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// expectSignInUnlocked lets a sign in with the right password pass the lockout checks
+func expectSignInUnlocked(ctx context.Context, mockStore *MockStorer) {
+	mockStore.EXPECT().LockedFor(ctx, gomock.Any()).Return(time.Duration(0), nil).AnyTimes()
+	mockStore.EXPECT().ResetCounter(ctx, gomock.Any()).Return(nil).AnyTimes()
+}
+
+func TestService_lockoutDuration(t *testing.T) {
+	s := New(nil)
+	s.Config.SignInLockout = time.Minute
+	s.Config.SignInMaxLockout = 10 * time.Minute
+
+	tests := []struct {
+		lockouts int64
+		want     time.Duration
+	}{
+		{lockouts: 1, want: time.Minute},
+		{lockouts: 2, want: 2 * time.Minute},
+		{lockouts: 4, want: 8 * time.Minute},
+		{lockouts: 5, want: 10 * time.Minute},
+		{lockouts: 60, want: 10 * time.Minute},
+	}
+
+	for i, tt := range tests {
+		assert.Equalf(t, tt.want, s.lockoutDuration(tt.lockouts), "TEST[%d] Failed - %d lockouts", i, tt.lockouts)
+	}
+}
+
+func TestService_SignInLockout(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStore := NewMockStorer(ctrl)
+	s := New(mockStore, WithPasswordHasher(testHasher))
+	s.Config.SignInMaxAttempts = 3
+	s.Config.SignInMaxIPAttempts = 10
+	s.Config.SignInAttemptWindow = 15 * time.Minute
+	s.Config.SignInLockout = time.Minute
+	s.Config.SignInMaxLockout = time.Hour
+	ctx := context.WithValue(testContext(), server.Client, models.ClientInfo{IP: "10.0.0.1"})
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("sumit@kumar"), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	user := &models.UserData{ID: userID, Email: email, Password: hash, Status: models.StatusActive}
+	accKey, ipKey := "signin:email:"+email, "signin:ip:10.0.0.1"
+
+	t.Run("wrong password is counted", func(t *testing.T) {
+		mockStore.EXPECT().LockedFor(ctx, accKey).Return(time.Duration(0), nil)
+		mockStore.EXPECT().LockedFor(ctx, ipKey).Return(time.Duration(0), nil)
+		mockStore.EXPECT().GetUserByEmail(ctx, email).Return(user, nil)
+		mockStore.EXPECT().IncrCounter(ctx, accKey, 15*time.Minute).Return(int64(1), nil)
+		mockStore.EXPECT().IncrCounter(ctx, ipKey, 15*time.Minute).Return(int64(1), nil)
+
+		_, err := s.SignIn(ctx, &models.UserReq{Email: email, Password: "wrong@password"})
+		assert.Equal(t, models.ErrPsswdNotMatch, err)
+	})
+
+	t.Run("reaching the limit locks the account", func(t *testing.T) {
+		mockStore.EXPECT().LockedFor(ctx, accKey).Return(time.Duration(0), nil)
+		mockStore.EXPECT().LockedFor(ctx, ipKey).Return(time.Duration(0), nil)
+		mockStore.EXPECT().GetUserByEmail(ctx, email).Return(user, nil)
+		mockStore.EXPECT().IncrCounter(ctx, accKey, 15*time.Minute).Return(int64(3), nil)
+		mockStore.EXPECT().IncrCounter(ctx, "signin-lockouts:email:"+email, lockoutMemory).Return(int64(2), nil)
+		mockStore.EXPECT().Lock(ctx, accKey, 2*time.Minute).Return(nil)
+		mockStore.EXPECT().ResetCounter(ctx, accKey).Return(nil)
+		mockStore.EXPECT().IncrCounter(ctx, ipKey, 15*time.Minute).Return(int64(4), nil)
+
+		_, err := s.SignIn(ctx, &models.UserReq{Email: email, Password: "wrong@password"})
+		assert.ErrorIs(t, err, models.ErrSignInLocked)
+
+		after, ok := models.RetryAfter(err)
+		assert.True(t, ok)
+		assert.Equal(t, 2*time.Minute, after)
+	})
+
+	t.Run("locked account refuses the right password", func(t *testing.T) {
+		mockStore.EXPECT().LockedFor(ctx, accKey).Return(90*time.Second, nil)
+
+		_, err := s.SignIn(ctx, &models.UserReq{Email: email, Password: "sumit@kumar"})
+		assert.ErrorIs(t, err, models.ErrSignInLocked)
+
+		after, _ := models.RetryAfter(err)
+		assert.Equal(t, 90*time.Second, after)
+	})
+
+	t.Run("locked ip", func(t *testing.T) {
+		mockStore.EXPECT().LockedFor(ctx, accKey).Return(time.Duration(0), nil)
+		mockStore.EXPECT().LockedFor(ctx, ipKey).Return(30*time.Second, nil)
+
+		_, err := s.SignIn(ctx, &models.UserReq{Email: email, Password: "sumit@kumar"})
+		assert.ErrorIs(t, err, models.ErrTooManyAttempts)
+	})
+
+	t.Run("unknown email is counted", func(t *testing.T) {
+		mockStore.EXPECT().LockedFor(ctx, accKey).Return(time.Duration(0), nil)
+		mockStore.EXPECT().LockedFor(ctx, ipKey).Return(time.Duration(0), nil)
+		mockStore.EXPECT().GetUserByEmail(ctx, email).Return(nil, models.ErrNotFound("user"))
+		mockStore.EXPECT().IncrCounter(ctx, accKey, 15*time.Minute).Return(int64(1), nil)
+		mockStore.EXPECT().IncrCounter(ctx, ipKey, 15*time.Minute).Return(int64(5), nil)
+
+		_, err := s.SignIn(ctx, &models.UserReq{Email: email, Password: "sumit@kumar"})
+		assert.Equal(t, models.ErrNotFound("user"), err)
+	})
+
+	t.Run("success resets the account", func(t *testing.T) {
+		mockStore.EXPECT().LockedFor(ctx, accKey).Return(time.Duration(0), nil)
+		mockStore.EXPECT().LockedFor(ctx, ipKey).Return(time.Duration(0), nil)
+		mockStore.EXPECT().GetUserByEmail(ctx, email).Return(user, nil)
+		mockStore.EXPECT().ResetCounter(ctx, accKey, "signin-lockouts:email:"+email).Return(nil)
+		mockStore.EXPECT().GetAccess(ctx, userID).Return(&models.Access{}, nil)
+		mockStore.EXPECT().CreateToken(ctx, email, gomock.Any()).Return(nil)
+		mockStore.EXPECT().UpdateLastLogin(ctx, userID, gomock.Any()).Return(nil)
+
+		resp, err := s.SignIn(ctx, &models.UserReq{Email: email, Password: "sumit@kumar"})
+		require.NoError(t, err)
+		assert.NotEmpty(t, resp.AccessToken)
+	})
+}
@@ -0,0 +1,263 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net/url"
+	"strings"
+
+	"auth-rest-api/internal/models"
+	"auth-rest-api/internal/server"
+)
+
+const (
+	// maxMagicLinkRequests is the number of sign in mails a user gets within MagicLinkTTL
+	maxMagicLinkRequests = 5
+	// maxMagicCodeAttempts is the number of wrong codes after which a sign in mail is used up
+	maxMagicCodeAttempts = 5
+)
+
+// RequestMagicLink mails a sign in link and a 6 digit code, either one signs the user in once.
+// Unknown addresses are silently ignored so the endpoint does not reveal which accounts exist.
+func (s *Service) RequestMagicLink(ctx context.Context, email string) error {
+	logger := ctx.Value(server.Logger).(*slog.Logger)
+
+	email, err := s.normalizeEmail(email)
+	if err != nil {
+		return err
+	}
+
+	user, err := s.Store.GetUserByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound("user")) {
+			logger.LogAttrs(ctx, slog.LevelInfo, "magic link requested for unknown email", slog.String("email", email))
+			return nil
+		}
+
+		return err
+	}
+
+	requests, err := s.Store.IncrCounter(ctx, purposeMagicLink+"-request:"+user.ID, s.Config.MagicLinkTTL)
+	if err != nil {
+		return err
+	}
+
+	// answered like any other request so the limit does not tell whether the account exists
+	if requests > maxMagicLinkRequests {
+		logger.LogAttrs(ctx, slog.LevelWarn, "too many magic link requests", slog.String("user", user.ID))
+		return nil
+	}
+
+	code, err := newSignInCode()
+	if err != nil {
+		return err
+	}
+
+	// the link token holds the user and the signed code, the code is found through the user
+	token, err := s.issueOneTimeToken(ctx, purposeMagicLink, user.ID+"."+s.signMagicCode(user.ID, code), s.Config.MagicLinkTTL)
+	if err != nil {
+		return err
+	}
+
+	id, _, _ := strings.Cut(token, ".")
+
+	// a newer mail replaces the code of an older one
+	if err := s.Store.SaveOneTimeToken(ctx, purposeMagicCode, user.ID, id, s.Config.MagicLinkTTL); err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/signin/magic-link?token=%s", s.Config.AppURL, url.QueryEscape(token))
+
+	return s.sendMail(ctx, &models.Mail{
+		To:      user.Email,
+		Subject: "Your sign in link",
+		Body: fmt.Sprintf("Sign in by opening the link below or by entering the code %s, both expire in %s "+
+			"and work once. If you did not try to sign in you can ignore this email.\n\n%s\n", code, s.Config.MagicLinkTTL, link),
+	})
+}
+
+// VerifyMagicLink signs the user in with the token of the link or with email and code. Users with
+// MFA enabled get a challenge token like after a password sign in.
+func (s *Service) VerifyMagicLink(ctx context.Context, req *models.MagicLinkVerifyReq) (*models.UserResp, error) {
+	logger := ctx.Value(server.Logger).(*slog.Logger)
+
+	if req == nil || (req.Token == "" && (req.Email == "" || req.Code == "")) {
+		return nil, models.ErrBadRequest(models.ErrRequired("token or email and code"))
+	}
+
+	scope, err := s.requestedScope(req.Scope)
+	if err != nil {
+		return nil, err
+	}
+
+	var userID string
+
+	if req.Token != "" {
+		userID, err = s.verifyMagicToken(ctx, req.Token)
+	} else {
+		userID, err = s.verifyMagicCode(ctx, req.Email, strings.TrimSpace(req.Code))
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.Store.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// the mail reached its owner, so the address is verified as well
+	if !user.Verified {
+		if err := s.Store.MarkUserVerified(ctx, user.Email); err != nil {
+			logger.LogAttrs(ctx, slog.LevelError, "failed to mark email verified", slog.String("email", user.Email),
+				slog.String("error", err.Error()))
+		}
+
+		if user.Status == models.StatusPendingVerification {
+			user.Status = models.StatusActive
+		}
+	}
+
+	logger.LogAttrs(ctx, slog.LevelInfo, "magic link sign in", slog.String("user", user.ID), slog.Bool("code", req.Token == ""))
+
+	if user.MFAEnabled {
+		return s.mfaChallenge(ctx, user, scope)
+	}
+
+	return s.issueTokens(ctx, user, scope)
+}
+
+// verifyMagicToken consumes the link token and returns the user it was sent to
+func (s *Service) verifyMagicToken(ctx context.Context, token string) (string, error) {
+	id, err := s.oneTimeTokenID(purposeMagicLink, token)
+	if err != nil {
+		return "", models.ErrBadRequest(models.ErrInvalid("magic link"))
+	}
+
+	value, err := s.Store.ConsumeOneTimeToken(ctx, purposeMagicLink, id)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound("token")) {
+			return "", models.ErrBadRequest(models.ErrInvalid("magic link"))
+		}
+
+		return "", err
+	}
+
+	userID, _, _ := strings.Cut(value, ".")
+
+	// the code of the same mail cannot be used anymore
+	if current, err := s.Store.GetOneTimeToken(ctx, purposeMagicCode, userID); err == nil && current == id {
+		if err := s.dropMagicCode(ctx, userID); err != nil {
+			return "", err
+		}
+	}
+
+	return userID, nil
+}
+
+// verifyMagicCode checks the code of the latest sign in mail of the user, after maxMagicCodeAttempts
+// wrong codes the mail is used up
+func (s *Service) verifyMagicCode(ctx context.Context, email, code string) (string, error) {
+	logger := ctx.Value(server.Logger).(*slog.Logger)
+
+	email, err := s.normalizeEmail(email)
+	if err != nil {
+		return "", models.ErrInvalidSignInCode
+	}
+
+	user, err := s.Store.GetUserByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound("user")) {
+			return "", models.ErrInvalidSignInCode
+		}
+
+		return "", err
+	}
+
+	id, err := s.Store.GetOneTimeToken(ctx, purposeMagicCode, user.ID)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound("token")) {
+			return "", models.ErrInvalidSignInCode
+		}
+
+		return "", err
+	}
+
+	attempts, err := s.Store.IncrCounter(ctx, purposeMagicCode+":"+id, s.Config.MagicLinkTTL)
+	if err != nil {
+		return "", err
+	}
+
+	if attempts > maxMagicCodeAttempts {
+		// the mail is used up, the user has to ask for a new one
+		if _, err := s.Store.ConsumeOneTimeToken(ctx, purposeMagicLink, id); err != nil && !errors.Is(err, models.ErrNotFound("token")) {
+			return "", err
+		}
+
+		if err := s.dropMagicCode(ctx, user.ID); err != nil {
+			return "", err
+		}
+
+		logger.LogAttrs(ctx, slog.LevelWarn, "too many magic link code attempts", slog.String("user", user.ID))
+
+		return "", models.ErrTooManyAttempts
+	}
+
+	value, err := s.Store.GetOneTimeToken(ctx, purposeMagicLink, id)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound("token")) {
+			return "", models.ErrInvalidSignInCode
+		}
+
+		return "", err
+	}
+
+	_, mac, _ := strings.Cut(value, ".")
+	if subtle.ConstantTimeCompare([]byte(mac), []byte(s.signMagicCode(user.ID, code))) != 1 {
+		return "", models.ErrInvalidSignInCode
+	}
+
+	// two requests racing with the same code only get one session
+	if _, err := s.Store.ConsumeOneTimeToken(ctx, purposeMagicLink, id); err != nil {
+		if errors.Is(err, models.ErrNotFound("token")) {
+			return "", models.ErrInvalidSignInCode
+		}
+
+		return "", err
+	}
+
+	if err := s.dropMagicCode(ctx, user.ID); err != nil {
+		return "", err
+	}
+
+	return user.ID, nil
+}
+
+func (s *Service) dropMagicCode(ctx context.Context, userID string) error {
+	if _, err := s.Store.ConsumeOneTimeToken(ctx, purposeMagicCode, userID); err != nil && !errors.Is(err, models.ErrNotFound("token")) {
+		return err
+	}
+
+	return nil
+}
+
+// signMagicCode binds the code to the user, only the signature is stored
+func (s *Service) signMagicCode(userID, code string) string {
+	return s.signOneTimeID(purposeMagicCode, userID+"."+code)
+}
+
+// newSignInCode returns a random 6 digit code
+func newSignInCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1_000_000))
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
@@ -0,0 +1,204 @@
+package service
+
+import (
+	"context"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+
+	"auth-rest-api/internal/models"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_RequestMagicLink(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStore := NewMockStorer(ctrl)
+	mockMailer := NewMockMailer(ctrl)
+	s := New(mockStore, WithMailer(mockMailer))
+	ctx := testContext()
+	user := &models.UserData{ID: userID, Email: email}
+	counter := purposeMagicLink + "-request:" + userID
+
+	tests := []struct {
+		name     string
+		email    string
+		mockCall func()
+		wantErr  error
+	}{
+		{
+			name:  "registered email",
+			email: email,
+			mockCall: func() {
+				mockStore.EXPECT().GetUserByEmail(ctx, email).Return(user, nil)
+				mockStore.EXPECT().IncrCounter(ctx, counter, s.Config.MagicLinkTTL).Return(int64(1), nil)
+				mockStore.EXPECT().SaveOneTimeToken(ctx, purposeMagicLink, gomock.Any(), gomock.Any(), s.Config.MagicLinkTTL).Return(nil)
+				mockStore.EXPECT().SaveOneTimeToken(ctx, purposeMagicCode, userID, gomock.Any(), s.Config.MagicLinkTTL).Return(nil)
+				mockMailer.EXPECT().Send(ctx, gomock.Any()).DoAndReturn(func(_ context.Context, mail *models.Mail) error {
+					assert.Equal(t, email, mail.To)
+					assert.Regexp(t, `code \d{6},`, mail.Body)
+					return nil
+				})
+			},
+		},
+		{
+			name:  "too many requests",
+			email: email,
+			mockCall: func() {
+				mockStore.EXPECT().GetUserByEmail(ctx, email).Return(user, nil)
+				mockStore.EXPECT().IncrCounter(ctx, counter, s.Config.MagicLinkTTL).Return(int64(maxMagicLinkRequests+1), nil)
+			},
+		},
+		{
+			name:  "unknown email",
+			email: "unknown@example.com",
+			mockCall: func() {
+				mockStore.EXPECT().GetUserByEmail(ctx, "unknown@example.com").Return(nil, models.ErrNotFound("user"))
+			},
+		},
+		{
+			name:     "invalid email",
+			email:    "not-an-email",
+			mockCall: func() {},
+			wantErr:  models.ErrBadRequest(models.ErrInvalid("email")),
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockCall()
+
+			assert.Equalf(t, tt.wantErr, s.RequestMagicLink(ctx, tt.email), "TEST[%d] Failed - %s", i, tt.name)
+		})
+	}
+}
+
+func TestService_VerifyMagicLink(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStore := NewMockStorer(ctrl)
+	mockMailer := NewMockMailer(ctrl)
+	s := New(mockStore, WithMailer(mockMailer))
+	ctx := testContext()
+	user := &models.UserData{ID: userID, Email: email, Verified: true}
+
+	// the single use tokens are kept in memory instead of redis
+	tokens := map[string]string{}
+
+	mockStore.EXPECT().SaveOneTimeToken(ctx, gomock.Any(), gomock.Any(), gomock.Any(), s.Config.MagicLinkTTL).
+		DoAndReturn(func(_ context.Context, purpose, id, value string, _ time.Duration) error {
+			tokens[purpose+":"+id] = value
+			return nil
+		}).AnyTimes()
+	mockStore.EXPECT().GetOneTimeToken(ctx, gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, purpose, id string) (string, error) {
+			value, ok := tokens[purpose+":"+id]
+			if !ok {
+				return "", models.ErrNotFound("token")
+			}
+
+			return value, nil
+		}).AnyTimes()
+	mockStore.EXPECT().ConsumeOneTimeToken(ctx, gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, purpose, id string) (string, error) {
+			value, ok := tokens[purpose+":"+id]
+			if !ok {
+				return "", models.ErrNotFound("token")
+			}
+
+			delete(tokens, purpose+":"+id)
+
+			return value, nil
+		}).AnyTimes()
+	mockStore.EXPECT().GetUserByEmail(ctx, email).Return(user, nil).AnyTimes()
+	mockStore.EXPECT().GetUserByID(ctx, userID).Return(user, nil).AnyTimes()
+	mockStore.EXPECT().GetAccess(ctx, userID).Return(&models.Access{}, nil).AnyTimes()
+	mockStore.EXPECT().CreateToken(ctx, email, gomock.Any()).Return(nil).AnyTimes()
+	mockStore.EXPECT().UpdateLastLogin(ctx, userID, gomock.Any()).Return(nil).AnyTimes()
+
+	tokenRe := regexp.MustCompile(`token=(\S+)`)
+	codeRe := regexp.MustCompile(`code (\d{6}),`)
+
+	// requestMail returns token and code of a new sign in mail
+	requestMail := func() (token, code string) {
+		mockStore.EXPECT().IncrCounter(ctx, purposeMagicLink+"-request:"+userID, s.Config.MagicLinkTTL).Return(int64(1), nil)
+		mockMailer.EXPECT().Send(ctx, gomock.Any()).DoAndReturn(func(_ context.Context, mail *models.Mail) error {
+			token, _ = url.QueryUnescape(tokenRe.FindStringSubmatch(mail.Body)[1])
+			code = codeRe.FindStringSubmatch(mail.Body)[1]
+			return nil
+		})
+
+		require.NoError(t, s.RequestMagicLink(ctx, email))
+
+		return token, code
+	}
+
+	attempt := func(n int64) {
+		mockStore.EXPECT().IncrCounter(ctx, gomock.Any(), s.Config.MagicLinkTTL).Return(n, nil)
+	}
+
+	t.Run("link", func(t *testing.T) {
+		token, code := requestMail()
+
+		resp, err := s.VerifyMagicLink(ctx, &models.MagicLinkVerifyReq{Token: token})
+		require.NoError(t, err)
+		assert.NotEmpty(t, resp.AccessToken)
+
+		// the link works once and the code of the same mail is used up with it
+		_, err = s.VerifyMagicLink(ctx, &models.MagicLinkVerifyReq{Token: token})
+		assert.Equal(t, models.ErrBadRequest(models.ErrInvalid("magic link")), err)
+
+		_, err = s.VerifyMagicLink(ctx, &models.MagicLinkVerifyReq{Email: email, Code: code})
+		assert.Equal(t, models.ErrInvalidSignInCode, err)
+	})
+
+	t.Run("code", func(t *testing.T) {
+		token, code := requestMail()
+
+		attempt(1)
+		_, err := s.VerifyMagicLink(ctx, &models.MagicLinkVerifyReq{Email: email, Code: "abcdef"})
+		assert.Equal(t, models.ErrInvalidSignInCode, err)
+
+		attempt(2)
+		resp, err := s.VerifyMagicLink(ctx, &models.MagicLinkVerifyReq{Email: email, Code: code})
+		require.NoError(t, err)
+		assert.NotEmpty(t, resp.AccessToken)
+
+		_, err = s.VerifyMagicLink(ctx, &models.MagicLinkVerifyReq{Token: token})
+		assert.Equal(t, models.ErrBadRequest(models.ErrInvalid("magic link")), err)
+	})
+
+	t.Run("too many attempts", func(t *testing.T) {
+		token, code := requestMail()
+
+		attempt(maxMagicCodeAttempts + 1)
+		_, err := s.VerifyMagicLink(ctx, &models.MagicLinkVerifyReq{Email: email, Code: code})
+		assert.Equal(t, models.ErrTooManyAttempts, err)
+
+		_, err = s.VerifyMagicLink(ctx, &models.MagicLinkVerifyReq{Token: token})
+		assert.Equal(t, models.ErrBadRequest(models.ErrInvalid("magic link")), err)
+	})
+
+	t.Run("newer mail replaces the code", func(t *testing.T) {
+		_, oldCode := requestMail()
+		token, _ := requestMail()
+
+		attempt(1)
+		_, err := s.VerifyMagicLink(ctx, &models.MagicLinkVerifyReq{Email: email, Code: oldCode})
+		assert.Equal(t, models.ErrInvalidSignInCode, err)
+
+		_, err = s.VerifyMagicLink(ctx, &models.MagicLinkVerifyReq{Token: token})
+		assert.NoError(t, err)
+	})
+
+	t.Run("missing fields", func(t *testing.T) {
+		_, err := s.VerifyMagicLink(ctx, &models.MagicLinkVerifyReq{Email: email})
+		assert.Equal(t, models.ErrBadRequest(models.ErrRequired("token or email and code")), err)
+	})
+}
@@ -0,0 +1,263 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"strings"
+	"time"
+
+	"auth-rest-api/internal/models"
+	"auth-rest-api/internal/server"
+)
+
+const (
+	recoveryCodeCount = 10
+	// maxMFAAttempts is the number of wrong codes after which a challenge token is dropped
+	maxMFAAttempts = 5
+)
+
+// EnrollTOTP starts the authenticator app enrollment of the authenticated user, MFA is enabled
+// once a code is confirmed with ConfirmTOTP. Enrolling again replaces an unconfirmed secret.
+func (s *Service) EnrollTOTP(ctx context.Context) (*models.TOTPEnrollment, error) {
+	claims, err := claimsFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.currentUser(ctx, claims)
+	if err != nil {
+		return nil, err
+	}
+
+	// a user signing in with passkeys can still add an authenticator app
+	if totpEnabled(user) {
+		return nil, models.ErrMFAEnabled
+	}
+
+	secret, err := newTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.Store.SaveTOTP(ctx, user.ID, &models.TOTP{Secret: secret}); err != nil {
+		return nil, err
+	}
+
+	return &models.TOTPEnrollment{Secret: secret, URI: totpURI(s.Config.MFAIssuer, user.Email, secret)}, nil
+}
+
+// ConfirmTOTP enables MFA with the first code of the authenticator app and returns the recovery
+// codes, they are only stored as hashes and cannot be shown again
+func (s *Service) ConfirmTOTP(ctx context.Context, code string) (*models.RecoveryCodes, error) {
+	logger := ctx.Value(server.Logger).(*slog.Logger)
+
+	claims, err := claimsFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.currentUser(ctx, claims)
+	if err != nil {
+		return nil, err
+	}
+
+	if totpEnabled(user) {
+		return nil, models.ErrMFAEnabled
+	}
+
+	if user.TOTP == nil {
+		return nil, models.ErrMFANotEnrolled
+	}
+
+	step, ok := verifyTOTP(user.TOTP.Secret, strings.TrimSpace(code), time.Now(), user.TOTP.LastStep)
+	if !ok {
+		return nil, models.ErrBadRequest(models.ErrInvalidMFACode)
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.Store.SaveRecoveryCodes(ctx, user.ID, hashes); err != nil {
+		return nil, err
+	}
+
+	if err := s.Store.SaveTOTP(ctx, user.ID, &models.TOTP{Secret: user.TOTP.Secret, Enabled: true, LastStep: step}); err != nil {
+		return nil, err
+	}
+
+	logger.LogAttrs(ctx, slog.LevelInfo, "mfa enabled", slog.String("user", user.ID), slog.String("method", models.MFAMethodTOTP))
+
+	return &models.RecoveryCodes{Codes: codes}, nil
+}
+
+// CompleteMFASignIn finishes a sign in that was answered with a challenge token. The code is either
+// a code of the authenticator app or one of the recovery codes.
+func (s *Service) CompleteMFASignIn(ctx context.Context, req *models.MFASignInReq) (*models.UserResp, error) {
+	logger := ctx.Value(server.Logger).(*slog.Logger)
+
+	if req == nil || req.MFAToken == "" || req.Code == "" {
+		return nil, models.ErrBadRequest(models.ErrRequired("mfa token and code"))
+	}
+
+	id, challenge, err := s.peekOneTimeToken(ctx, purposeMFAChallenge, req.MFAToken)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalid("token")) {
+			return nil, models.ErrBadRequest(models.ErrInvalid("mfa token"))
+		}
+
+		return nil, err
+	}
+
+	userID, scope, _ := strings.Cut(challenge, " ")
+
+	if err := s.countMFAAttempt(ctx, id, userID); err != nil {
+		return nil, err
+	}
+
+	user, err := s.Store.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	method, err := s.verifySecondFactor(ctx, user, req.Code)
+	if err != nil {
+		return nil, err
+	}
+
+	// two requests racing with the same challenge only get one session
+	if _, err := s.consumeOneTimeToken(ctx, purposeMFAChallenge, req.MFAToken); err != nil {
+		if errors.Is(err, models.ErrInvalid("token")) {
+			return nil, models.ErrBadRequest(models.ErrInvalid("mfa token"))
+		}
+
+		return nil, err
+	}
+
+	logger.LogAttrs(ctx, slog.LevelInfo, "mfa sign in completed", slog.String("user", user.ID), slog.String("method", method))
+
+	return s.issueTokens(ctx, user, scope)
+}
+
+// countMFAAttempt counts an attempt to answer the challenge with the given ID, the challenge is
+// dropped after maxMFAAttempts and the user has to sign in with the password again
+func (s *Service) countMFAAttempt(ctx context.Context, id, userID string) error {
+	logger := ctx.Value(server.Logger).(*slog.Logger)
+
+	attempts, err := s.Store.IncrCounter(ctx, purposeMFAChallenge+":"+id, s.Config.MFAChallengeTTL)
+	if err != nil {
+		return err
+	}
+
+	if attempts <= maxMFAAttempts {
+		return nil
+	}
+
+	if _, err := s.Store.ConsumeOneTimeToken(ctx, purposeMFAChallenge, id); err != nil && !errors.Is(err, models.ErrNotFound("token")) {
+		return err
+	}
+
+	logger.LogAttrs(ctx, slog.LevelWarn, "too many mfa attempts", slog.String("user", userID))
+
+	return models.ErrTooManyAttempts
+}
+
+// mfaChallenge answers a correct password of a user with MFA enabled, the challenge keeps the user ID
+// and the requested scope separated by a space. It offers the authenticator app with its recovery codes
+// and the passkeys the user registered.
+func (s *Service) mfaChallenge(ctx context.Context, user *models.UserData, scope string) (*models.UserResp, error) {
+	var methods []string
+
+	if totpEnabled(user) {
+		methods = append(methods, models.MFAMethodTOTP, models.MFAMethodRecovery)
+	}
+
+	passkeys, err := s.Store.ListPasskeys(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(passkeys) > 0 {
+		methods = append(methods, models.MFAMethodPasskey)
+	}
+
+	token, err := s.issueOneTimeToken(ctx, purposeMFAChallenge, strings.TrimSpace(user.ID+" "+scope), s.Config.MFAChallengeTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.UserResp{Email: user.Email, MFAToken: token, MFAMethods: methods}, nil
+}
+
+// totpEnabled tells whether the user confirmed an authenticator app, MFA is enabled by passkeys as well
+func totpEnabled(user *models.UserData) bool {
+	return user.TOTP != nil && user.TOTP.Enabled
+}
+
+// verifySecondFactor checks code as authenticator app code or recovery code and returns the method used
+func (s *Service) verifySecondFactor(ctx context.Context, user *models.UserData, code string) (string, error) {
+	code = strings.TrimSpace(code)
+
+	if totpEnabled(user) {
+		if step, ok := verifyTOTP(user.TOTP.Secret, code, time.Now(), user.TOTP.LastStep); ok {
+			totp := *user.TOTP
+			totp.LastStep = step
+
+			if err := s.Store.SaveTOTP(ctx, user.ID, &totp); err != nil {
+				return "", err
+			}
+
+			return models.MFAMethodTOTP, nil
+		}
+	}
+
+	ok, err := s.Store.ConsumeRecoveryCode(ctx, user.ID, hashRecoveryCode(code))
+	if err != nil {
+		return "", err
+	}
+
+	if !ok {
+		return "", models.ErrInvalidMFACode
+	}
+
+	return models.MFAMethodRecovery, nil
+}
+
+// newRecoveryCodes returns codes like "k7dq2-mx9pa" together with the hashes to store
+func newRecoveryCodes() (codes, hashes []string, err error) {
+	// Crockford base32, 32 symbols so every byte maps without bias
+	const alphabet = "0123456789abcdefghjkmnpqrstvwxyz"
+
+	codes = make([]string, recoveryCodeCount)
+	hashes = make([]string, recoveryCodeCount)
+
+	for i := range codes {
+		raw := make([]byte, 10)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, nil, err
+		}
+
+		for j, b := range raw {
+			raw[j] = alphabet[int(b)%len(alphabet)]
+		}
+
+		codes[i] = string(raw[:5]) + "-" + string(raw[5:])
+		hashes[i] = hashRecoveryCode(codes[i])
+	}
+
+	return codes, hashes, nil
+}
+
+// hashRecoveryCode hashes the code ignoring case and dashes, the codes are random so a plain
+// SHA-256 is enough
+func hashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	sum := sha256.Sum256([]byte(normalized))
+
+	return hex.EncodeToString(sum[:])
+}
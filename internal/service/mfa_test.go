@@ -0,0 +1,248 @@
+package service
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"auth-rest-api/internal/models"
+	"auth-rest-api/internal/server"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestService_ConfirmTOTP(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStore := NewMockStorer(ctrl)
+	s := New(mockStore)
+	ctx := context.WithValue(testContext(), server.Claims, &Claims{Email: email, UserID: userID})
+
+	code, err := totpCode(rfcSecret, time.Now().Unix()/totpPeriod)
+	require.NoError(t, err)
+
+	pending := &models.UserData{ID: userID, Email: email, TOTP: &models.TOTP{Secret: rfcSecret}}
+
+	tests := []struct {
+		name     string
+		code     string
+		mockCall func()
+		wantErr  error
+	}{
+		{
+			name: "valid code",
+			code: code,
+			mockCall: func() {
+				mockStore.EXPECT().GetUserByID(ctx, userID).Return(pending, nil)
+				mockStore.EXPECT().SaveRecoveryCodes(ctx, userID, gomock.Len(recoveryCodeCount)).Return(nil)
+				mockStore.EXPECT().SaveTOTP(ctx, userID, gomock.Any()).DoAndReturn(
+					func(_ context.Context, _ string, totp *models.TOTP) error {
+						assert.True(t, totp.Enabled)
+						return nil
+					})
+			},
+		},
+		{
+			name: "wrong code",
+			code: "000000",
+			mockCall: func() {
+				mockStore.EXPECT().GetUserByID(ctx, userID).Return(pending, nil)
+			},
+			wantErr: models.ErrBadRequest(models.ErrInvalidMFACode),
+		},
+		{
+			name: "not enrolled",
+			code: code,
+			mockCall: func() {
+				mockStore.EXPECT().GetUserByID(ctx, userID).Return(&models.UserData{ID: userID, Email: email}, nil)
+			},
+			wantErr: models.ErrMFANotEnrolled,
+		},
+		{
+			name: "already enabled",
+			code: code,
+			mockCall: func() {
+				mockStore.EXPECT().GetUserByID(ctx, userID).Return(&models.UserData{ID: userID, MFAEnabled: true,
+					TOTP: &models.TOTP{Secret: rfcSecret, Enabled: true}}, nil)
+			},
+			wantErr: models.ErrMFAEnabled,
+		},
+		{
+			name: "passkey user adds the authenticator app",
+			code: code,
+			mockCall: func() {
+				mockStore.EXPECT().GetUserByID(ctx, userID).Return(&models.UserData{ID: userID, Email: email, MFAEnabled: true,
+					TOTP: &models.TOTP{Secret: rfcSecret}}, nil)
+				mockStore.EXPECT().SaveRecoveryCodes(ctx, userID, gomock.Len(recoveryCodeCount)).Return(nil)
+				mockStore.EXPECT().SaveTOTP(ctx, userID, gomock.Any()).Return(nil)
+			},
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockCall()
+
+			_, err := s.ConfirmTOTP(ctx, tt.code)
+			assert.Equalf(t, tt.wantErr, err, "TEST[%d] Failed - %s", i, tt.name)
+		})
+	}
+}
+
+func TestService_CompleteMFASignIn(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStore := NewMockStorer(ctrl)
+	s := New(mockStore, WithPasswordHasher(testHasher))
+	ctx := testContext()
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("sumit@kumar"), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	user := &models.UserData{ID: userID, Email: email, Password: hash, MFAEnabled: true,
+		TOTP: &models.TOTP{Secret: rfcSecret, Enabled: true}}
+
+	var challengeID string
+
+	expectSignInUnlocked(ctx, mockStore)
+	mockStore.EXPECT().GetUserByEmail(ctx, email).Return(user, nil)
+	mockStore.EXPECT().ListPasskeys(ctx, userID).Return(nil, nil)
+	mockStore.EXPECT().SaveOneTimeToken(ctx, purposeMFAChallenge, gomock.Any(), userID, s.Config.MFAChallengeTTL).
+		DoAndReturn(func(_ context.Context, _, id, _ string, _ time.Duration) error {
+			challengeID = id
+			return nil
+		})
+
+	resp, err := s.SignIn(ctx, &models.UserReq{Email: email, Password: "sumit@kumar"})
+	require.NoError(t, err)
+	assert.Empty(t, resp.AccessToken)
+	assert.NotEmpty(t, resp.MFAToken)
+	assert.Equal(t, []string{models.MFAMethodTOTP, models.MFAMethodRecovery}, resp.MFAMethods)
+
+	code, err := totpCode(rfcSecret, time.Now().Unix()/totpPeriod)
+	require.NoError(t, err)
+
+	counter := purposeMFAChallenge + ":" + challengeID
+
+	tests := []struct {
+		name     string
+		code     string
+		mockCall func()
+		wantErr  error
+	}{
+		{
+			name: "wrong code",
+			code: "000000",
+			mockCall: func() {
+				mockStore.EXPECT().GetOneTimeToken(ctx, purposeMFAChallenge, challengeID).Return(userID, nil)
+				mockStore.EXPECT().IncrCounter(ctx, counter, s.Config.MFAChallengeTTL).Return(int64(1), nil)
+				mockStore.EXPECT().GetUserByID(ctx, userID).Return(user, nil)
+				mockStore.EXPECT().ConsumeRecoveryCode(ctx, userID, hashRecoveryCode("000000")).Return(false, nil)
+			},
+			wantErr: models.ErrInvalidMFACode,
+		},
+		{
+			name: "too many attempts",
+			code: code,
+			mockCall: func() {
+				mockStore.EXPECT().GetOneTimeToken(ctx, purposeMFAChallenge, challengeID).Return(userID, nil)
+				mockStore.EXPECT().IncrCounter(ctx, counter, s.Config.MFAChallengeTTL).Return(int64(maxMFAAttempts+1), nil)
+				mockStore.EXPECT().ConsumeOneTimeToken(ctx, purposeMFAChallenge, challengeID).Return(userID, nil)
+			},
+			wantErr: models.ErrTooManyAttempts,
+		},
+		{
+			name: "authenticator code",
+			code: code,
+			mockCall: func() {
+				mockStore.EXPECT().GetOneTimeToken(ctx, purposeMFAChallenge, challengeID).Return(userID, nil)
+				mockStore.EXPECT().IncrCounter(ctx, counter, s.Config.MFAChallengeTTL).Return(int64(2), nil)
+				mockStore.EXPECT().GetUserByID(ctx, userID).Return(user, nil)
+				mockStore.EXPECT().SaveTOTP(ctx, userID, gomock.Any()).Return(nil)
+				mockStore.EXPECT().ConsumeOneTimeToken(ctx, purposeMFAChallenge, challengeID).Return(userID, nil)
+				mockStore.EXPECT().GetAccess(ctx, userID).Return(&models.Access{}, nil)
+				mockStore.EXPECT().CreateToken(ctx, email, gomock.Any()).Return(nil)
+				mockStore.EXPECT().UpdateLastLogin(ctx, userID, gomock.Any()).Return(nil)
+			},
+		},
+		{
+			name: "recovery code",
+			code: "ABCDE-12345",
+			mockCall: func() {
+				mockStore.EXPECT().GetOneTimeToken(ctx, purposeMFAChallenge, challengeID).Return(userID, nil)
+				mockStore.EXPECT().IncrCounter(ctx, counter, s.Config.MFAChallengeTTL).Return(int64(1), nil)
+				mockStore.EXPECT().GetUserByID(ctx, userID).Return(user, nil)
+				mockStore.EXPECT().ConsumeRecoveryCode(ctx, userID, hashRecoveryCode("abcde12345")).Return(true, nil)
+				mockStore.EXPECT().ConsumeOneTimeToken(ctx, purposeMFAChallenge, challengeID).Return(userID, nil)
+				mockStore.EXPECT().GetAccess(ctx, userID).Return(&models.Access{}, nil)
+				mockStore.EXPECT().CreateToken(ctx, email, gomock.Any()).Return(nil)
+				mockStore.EXPECT().UpdateLastLogin(ctx, userID, gomock.Any()).Return(nil)
+			},
+		},
+		{
+			name: "expired challenge",
+			code: code,
+			mockCall: func() {
+				mockStore.EXPECT().GetOneTimeToken(ctx, purposeMFAChallenge, challengeID).Return("", models.ErrNotFound("token"))
+			},
+			wantErr: models.ErrBadRequest(models.ErrInvalid("mfa token")),
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockCall()
+
+			got, err := s.CompleteMFASignIn(ctx, &models.MFASignInReq{MFAToken: resp.MFAToken, Code: tt.code})
+			assert.Equalf(t, tt.wantErr, err, "TEST[%d] Failed - %s", i, tt.name)
+
+			if tt.wantErr == nil {
+				assert.NotEmptyf(t, got.AccessToken, "TEST[%d] Failed - %s", i, tt.name)
+			}
+		})
+	}
+}
+
+func TestService_SignInPasskeyMFA(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStore := NewMockStorer(ctrl)
+	s := New(mockStore, WithPasswordHasher(testHasher))
+	ctx := testContext()
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("sumit@kumar"), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	// the store enables MFA for a user with passkeys, no authenticator app was confirmed
+	user := &models.UserData{ID: userID, Email: email, Password: hash, MFAEnabled: true}
+
+	expectSignInUnlocked(ctx, mockStore)
+	mockStore.EXPECT().GetUserByEmail(ctx, email).Return(user, nil)
+	mockStore.EXPECT().ListPasskeys(ctx, userID).Return([]models.Passkey{{ID: "cred", UserID: userID}}, nil)
+	mockStore.EXPECT().SaveOneTimeToken(ctx, purposeMFAChallenge, gomock.Any(), userID, s.Config.MFAChallengeTTL).Return(nil)
+
+	resp, err := s.SignIn(ctx, &models.UserReq{Email: email, Password: "sumit@kumar"})
+	require.NoError(t, err)
+	assert.Empty(t, resp.AccessToken)
+	assert.NotEmpty(t, resp.MFAToken)
+	assert.Equal(t, []string{models.MFAMethodPasskey}, resp.MFAMethods)
+}
+
+func Test_newRecoveryCodes(t *testing.T) {
+	codes, hashes, err := newRecoveryCodes()
+	require.NoError(t, err)
+
+	require.Len(t, codes, recoveryCodeCount)
+
+	for i, code := range codes {
+		assert.Regexp(t, regexp.MustCompile(`^[0-9a-z]{5}-[0-9a-z]{5}$`), code)
+		assert.Equal(t, hashes[i], hashRecoveryCode(code))
+	}
+}
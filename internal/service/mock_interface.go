@@ -8,6 +8,7 @@ import (
 	models "auth-rest-api/internal/models"
 	context "context"
 	reflect "reflect"
+	time "time"
 
 	gomock "github.com/golang/mock/gomock"
 )
@@ -35,6 +36,78 @@ func (m *MockStorer) EXPECT() *MockStorerMockRecorder {
 	return m.recorder
 }
 
+// AddPasswordHistory mocks base method.
+func (m *MockStorer) AddPasswordHistory(ctx context.Context, id string, hash []byte, keep int) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddPasswordHistory", ctx, id, hash, keep)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AddPasswordHistory indicates an expected call of AddPasswordHistory.
+func (mr *MockStorerMockRecorder) AddPasswordHistory(ctx, id, hash, keep interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddPasswordHistory", reflect.TypeOf((*MockStorer)(nil).AddPasswordHistory), ctx, id, hash, keep)
+}
+
+// ChangeEmail mocks base method.
+func (m *MockStorer) ChangeEmail(ctx context.Context, id, newEmail string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ChangeEmail", ctx, id, newEmail)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ChangeEmail indicates an expected call of ChangeEmail.
+func (mr *MockStorerMockRecorder) ChangeEmail(ctx, id, newEmail interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ChangeEmail", reflect.TypeOf((*MockStorer)(nil).ChangeEmail), ctx, id, newEmail)
+}
+
+// ConsumeOneTimeToken mocks base method.
+func (m *MockStorer) ConsumeOneTimeToken(ctx context.Context, purpose, id string) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ConsumeOneTimeToken", ctx, purpose, id)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ConsumeOneTimeToken indicates an expected call of ConsumeOneTimeToken.
+func (mr *MockStorerMockRecorder) ConsumeOneTimeToken(ctx, purpose, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ConsumeOneTimeToken", reflect.TypeOf((*MockStorer)(nil).ConsumeOneTimeToken), ctx, purpose, id)
+}
+
+// ConsumeRecoveryCode mocks base method.
+func (m *MockStorer) ConsumeRecoveryCode(ctx context.Context, id, hash string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ConsumeRecoveryCode", ctx, id, hash)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ConsumeRecoveryCode indicates an expected call of ConsumeRecoveryCode.
+func (mr *MockStorerMockRecorder) ConsumeRecoveryCode(ctx, id, hash interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ConsumeRecoveryCode", reflect.TypeOf((*MockStorer)(nil).ConsumeRecoveryCode), ctx, id, hash)
+}
+
+// CreatePasskey mocks base method.
+func (m *MockStorer) CreatePasskey(ctx context.Context, p *models.Passkey) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreatePasskey", ctx, p)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreatePasskey indicates an expected call of CreatePasskey.
+func (mr *MockStorerMockRecorder) CreatePasskey(ctx, p interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreatePasskey", reflect.TypeOf((*MockStorer)(nil).CreatePasskey), ctx, p)
+}
+
 // CreateToken mocks base method.
 func (m *MockStorer) CreateToken(ctx context.Context, email string, td *models.TokenData) error {
 	m.ctrl.T.Helper()
@@ -82,6 +155,95 @@ func (mr *MockStorerMockRecorder) DeleteToken(ctx interface{}, tokenID ...interf
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteToken", reflect.TypeOf((*MockStorer)(nil).DeleteToken), varargs...)
 }
 
+// DeleteUser mocks base method.
+func (m *MockStorer) DeleteUser(ctx context.Context, id string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteUser", ctx, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteUser indicates an expected call of DeleteUser.
+func (mr *MockStorerMockRecorder) DeleteUser(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteUser", reflect.TypeOf((*MockStorer)(nil).DeleteUser), ctx, id)
+}
+
+// GetAccess mocks base method.
+func (m *MockStorer) GetAccess(ctx context.Context, id string) (*models.Access, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetAccess", ctx, id)
+	ret0, _ := ret[0].(*models.Access)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetAccess indicates an expected call of GetAccess.
+func (mr *MockStorerMockRecorder) GetAccess(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAccess", reflect.TypeOf((*MockStorer)(nil).GetAccess), ctx, id)
+}
+
+// GetFamily mocks base method.
+func (m *MockStorer) GetFamily(ctx context.Context, familyID string) (*models.TokenFamily, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetFamily", ctx, familyID)
+	ret0, _ := ret[0].(*models.TokenFamily)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetFamily indicates an expected call of GetFamily.
+func (mr *MockStorerMockRecorder) GetFamily(ctx, familyID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetFamily", reflect.TypeOf((*MockStorer)(nil).GetFamily), ctx, familyID)
+}
+
+// GetKeyRing mocks base method.
+func (m *MockStorer) GetKeyRing(ctx context.Context, name string) (*models.KeyRingState, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetKeyRing", ctx, name)
+	ret0, _ := ret[0].(*models.KeyRingState)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetKeyRing indicates an expected call of GetKeyRing.
+func (mr *MockStorerMockRecorder) GetKeyRing(ctx, name interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetKeyRing", reflect.TypeOf((*MockStorer)(nil).GetKeyRing), ctx, name)
+}
+
+// GetOneTimeToken mocks base method.
+func (m *MockStorer) GetOneTimeToken(ctx context.Context, purpose, id string) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetOneTimeToken", ctx, purpose, id)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetOneTimeToken indicates an expected call of GetOneTimeToken.
+func (mr *MockStorerMockRecorder) GetOneTimeToken(ctx, purpose, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOneTimeToken", reflect.TypeOf((*MockStorer)(nil).GetOneTimeToken), ctx, purpose, id)
+}
+
+// GetPasswordHistory mocks base method.
+func (m *MockStorer) GetPasswordHistory(ctx context.Context, id string) ([][]byte, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetPasswordHistory", ctx, id)
+	ret0, _ := ret[0].([][]byte)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetPasswordHistory indicates an expected call of GetPasswordHistory.
+func (mr *MockStorerMockRecorder) GetPasswordHistory(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPasswordHistory", reflect.TypeOf((*MockStorer)(nil).GetPasswordHistory), ctx, id)
+}
+
 // GetUserByEmail mocks base method.
 func (m *MockStorer) GetUserByEmail(ctx context.Context, email string) (*models.UserData, error) {
 	m.ctrl.T.Helper()
@@ -97,6 +259,50 @@ func (mr *MockStorerMockRecorder) GetUserByEmail(ctx, email interface{}) *gomock
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserByEmail", reflect.TypeOf((*MockStorer)(nil).GetUserByEmail), ctx, email)
 }
 
+// GetUserByID mocks base method.
+func (m *MockStorer) GetUserByID(ctx context.Context, id string) (*models.UserData, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserByID", ctx, id)
+	ret0, _ := ret[0].(*models.UserData)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserByID indicates an expected call of GetUserByID.
+func (mr *MockStorerMockRecorder) GetUserByID(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserByID", reflect.TypeOf((*MockStorer)(nil).GetUserByID), ctx, id)
+}
+
+// GrantAccess mocks base method.
+func (m *MockStorer) GrantAccess(ctx context.Context, id string, access *models.Access) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GrantAccess", ctx, id, access)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// GrantAccess indicates an expected call of GrantAccess.
+func (mr *MockStorerMockRecorder) GrantAccess(ctx, id, access interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GrantAccess", reflect.TypeOf((*MockStorer)(nil).GrantAccess), ctx, id, access)
+}
+
+// IncrCounter mocks base method.
+func (m *MockStorer) IncrCounter(ctx context.Context, name string, ttl time.Duration) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "IncrCounter", ctx, name, ttl)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// IncrCounter indicates an expected call of IncrCounter.
+func (mr *MockStorerMockRecorder) IncrCounter(ctx, name, ttl interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IncrCounter", reflect.TypeOf((*MockStorer)(nil).IncrCounter), ctx, name, ttl)
+}
+
 // IsTokenRevoked mocks base method.
 func (m *MockStorer) IsTokenRevoked(ctx context.Context, tokenID string) (bool, error) {
 	m.ctrl.T.Helper()
@@ -111,3 +317,329 @@ func (mr *MockStorerMockRecorder) IsTokenRevoked(ctx, tokenID interface{}) *gomo
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IsTokenRevoked", reflect.TypeOf((*MockStorer)(nil).IsTokenRevoked), ctx, tokenID)
 }
+
+// ListFamilies mocks base method.
+func (m *MockStorer) ListFamilies(ctx context.Context, email string) ([]models.TokenFamily, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListFamilies", ctx, email)
+	ret0, _ := ret[0].([]models.TokenFamily)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListFamilies indicates an expected call of ListFamilies.
+func (mr *MockStorerMockRecorder) ListFamilies(ctx, email interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListFamilies", reflect.TypeOf((*MockStorer)(nil).ListFamilies), ctx, email)
+}
+
+// ListPasskeys mocks base method.
+func (m *MockStorer) ListPasskeys(ctx context.Context, userID string) ([]models.Passkey, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListPasskeys", ctx, userID)
+	ret0, _ := ret[0].([]models.Passkey)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListPasskeys indicates an expected call of ListPasskeys.
+func (mr *MockStorerMockRecorder) ListPasskeys(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListPasskeys", reflect.TypeOf((*MockStorer)(nil).ListPasskeys), ctx, userID)
+}
+
+// ListUsers mocks base method.
+func (m *MockStorer) ListUsers(ctx context.Context, query *models.UserQuery) (*models.UserPage, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListUsers", ctx, query)
+	ret0, _ := ret[0].(*models.UserPage)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListUsers indicates an expected call of ListUsers.
+func (mr *MockStorerMockRecorder) ListUsers(ctx, query interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListUsers", reflect.TypeOf((*MockStorer)(nil).ListUsers), ctx, query)
+}
+
+// Lock mocks base method.
+func (m *MockStorer) Lock(ctx context.Context, name string, d time.Duration) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Lock", ctx, name, d)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Lock indicates an expected call of Lock.
+func (mr *MockStorerMockRecorder) Lock(ctx, name, d interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Lock", reflect.TypeOf((*MockStorer)(nil).Lock), ctx, name, d)
+}
+
+// LockedFor mocks base method.
+func (m *MockStorer) LockedFor(ctx context.Context, name string) (time.Duration, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "LockedFor", ctx, name)
+	ret0, _ := ret[0].(time.Duration)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// LockedFor indicates an expected call of LockedFor.
+func (mr *MockStorerMockRecorder) LockedFor(ctx, name interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LockedFor", reflect.TypeOf((*MockStorer)(nil).LockedFor), ctx, name)
+}
+
+// MarkUserVerified mocks base method.
+func (m *MockStorer) MarkUserVerified(ctx context.Context, email string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MarkUserVerified", ctx, email)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// MarkUserVerified indicates an expected call of MarkUserVerified.
+func (mr *MockStorerMockRecorder) MarkUserVerified(ctx, email interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MarkUserVerified", reflect.TypeOf((*MockStorer)(nil).MarkUserVerified), ctx, email)
+}
+
+// RenameEmail mocks base method.
+func (m *MockStorer) RenameEmail(ctx context.Context, id, email string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RenameEmail", ctx, id, email)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RenameEmail indicates an expected call of RenameEmail.
+func (mr *MockStorerMockRecorder) RenameEmail(ctx, id, email interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RenameEmail", reflect.TypeOf((*MockStorer)(nil).RenameEmail), ctx, id, email)
+}
+
+// ResetCounter mocks base method.
+func (m *MockStorer) ResetCounter(ctx context.Context, names ...string) error {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{ctx}
+	for _, a := range names {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "ResetCounter", varargs...)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ResetCounter indicates an expected call of ResetCounter.
+func (mr *MockStorerMockRecorder) ResetCounter(ctx interface{}, names ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{ctx}, names...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ResetCounter", reflect.TypeOf((*MockStorer)(nil).ResetCounter), varargs...)
+}
+
+// RevokeAccess mocks base method.
+func (m *MockStorer) RevokeAccess(ctx context.Context, id string, access *models.Access) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeAccess", ctx, id, access)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokeAccess indicates an expected call of RevokeAccess.
+func (mr *MockStorerMockRecorder) RevokeAccess(ctx, id, access interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeAccess", reflect.TypeOf((*MockStorer)(nil).RevokeAccess), ctx, id, access)
+}
+
+// RevokeFamily mocks base method.
+func (m *MockStorer) RevokeFamily(ctx context.Context, familyID string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeFamily", ctx, familyID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokeFamily indicates an expected call of RevokeFamily.
+func (mr *MockStorerMockRecorder) RevokeFamily(ctx, familyID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeFamily", reflect.TypeOf((*MockStorer)(nil).RevokeFamily), ctx, familyID)
+}
+
+// SaveKeyRing mocks base method.
+func (m *MockStorer) SaveKeyRing(ctx context.Context, name string, state *models.KeyRingState) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveKeyRing", ctx, name, state)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveKeyRing indicates an expected call of SaveKeyRing.
+func (mr *MockStorerMockRecorder) SaveKeyRing(ctx, name, state interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveKeyRing", reflect.TypeOf((*MockStorer)(nil).SaveKeyRing), ctx, name, state)
+}
+
+// SaveOneTimeToken mocks base method.
+func (m *MockStorer) SaveOneTimeToken(ctx context.Context, purpose, id, value string, ttl time.Duration) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveOneTimeToken", ctx, purpose, id, value, ttl)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveOneTimeToken indicates an expected call of SaveOneTimeToken.
+func (mr *MockStorerMockRecorder) SaveOneTimeToken(ctx, purpose, id, value, ttl interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveOneTimeToken", reflect.TypeOf((*MockStorer)(nil).SaveOneTimeToken), ctx, purpose, id, value, ttl)
+}
+
+// SaveRecoveryCodes mocks base method.
+func (m *MockStorer) SaveRecoveryCodes(ctx context.Context, id string, hashes []string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveRecoveryCodes", ctx, id, hashes)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveRecoveryCodes indicates an expected call of SaveRecoveryCodes.
+func (mr *MockStorerMockRecorder) SaveRecoveryCodes(ctx, id, hashes interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveRecoveryCodes", reflect.TypeOf((*MockStorer)(nil).SaveRecoveryCodes), ctx, id, hashes)
+}
+
+// SaveTOTP mocks base method.
+func (m *MockStorer) SaveTOTP(ctx context.Context, id string, totp *models.TOTP) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveTOTP", ctx, id, totp)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveTOTP indicates an expected call of SaveTOTP.
+func (mr *MockStorerMockRecorder) SaveTOTP(ctx, id, totp interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveTOTP", reflect.TypeOf((*MockStorer)(nil).SaveTOTP), ctx, id, totp)
+}
+
+// SetStatus mocks base method.
+func (m *MockStorer) SetStatus(ctx context.Context, id string, status models.UserStatus) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetStatus", ctx, id, status)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetStatus indicates an expected call of SetStatus.
+func (mr *MockStorerMockRecorder) SetStatus(ctx, id, status interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetStatus", reflect.TypeOf((*MockStorer)(nil).SetStatus), ctx, id, status)
+}
+
+// SetVerified mocks base method.
+func (m *MockStorer) SetVerified(ctx context.Context, id string, verified bool) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetVerified", ctx, id, verified)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetVerified indicates an expected call of SetVerified.
+func (mr *MockStorerMockRecorder) SetVerified(ctx, id, verified interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetVerified", reflect.TypeOf((*MockStorer)(nil).SetVerified), ctx, id, verified)
+}
+
+// UpdateLastLogin mocks base method.
+func (m *MockStorer) UpdateLastLogin(ctx context.Context, id string, at time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateLastLogin", ctx, id, at)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateLastLogin indicates an expected call of UpdateLastLogin.
+func (mr *MockStorerMockRecorder) UpdateLastLogin(ctx, id, at interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateLastLogin", reflect.TypeOf((*MockStorer)(nil).UpdateLastLogin), ctx, id, at)
+}
+
+// UpdatePasskeyUsage mocks base method.
+func (m *MockStorer) UpdatePasskeyUsage(ctx context.Context, p *models.Passkey) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdatePasskeyUsage", ctx, p)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdatePasskeyUsage indicates an expected call of UpdatePasskeyUsage.
+func (mr *MockStorerMockRecorder) UpdatePasskeyUsage(ctx, p interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdatePasskeyUsage", reflect.TypeOf((*MockStorer)(nil).UpdatePasskeyUsage), ctx, p)
+}
+
+// UpdatePassword mocks base method.
+func (m *MockStorer) UpdatePassword(ctx context.Context, id string, hash []byte) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdatePassword", ctx, id, hash)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdatePassword indicates an expected call of UpdatePassword.
+func (mr *MockStorerMockRecorder) UpdatePassword(ctx, id, hash interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdatePassword", reflect.TypeOf((*MockStorer)(nil).UpdatePassword), ctx, id, hash)
+}
+
+// UpdateProfile mocks base method.
+func (m *MockStorer) UpdateProfile(ctx context.Context, u *models.UserData) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateProfile", ctx, u)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateProfile indicates an expected call of UpdateProfile.
+func (mr *MockStorerMockRecorder) UpdateProfile(ctx, u interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateProfile", reflect.TypeOf((*MockStorer)(nil).UpdateProfile), ctx, u)
+}
+
+// MockMailer is a mock of Mailer interface.
+type MockMailer struct {
+	ctrl     *gomock.Controller
+	recorder *MockMailerMockRecorder
+}
+
+// MockMailerMockRecorder is the mock recorder for MockMailer.
+type MockMailerMockRecorder struct {
+	mock *MockMailer
+}
+
+// NewMockMailer creates a new mock instance.
+func NewMockMailer(ctrl *gomock.Controller) *MockMailer {
+	mock := &MockMailer{ctrl: ctrl}
+	mock.recorder = &MockMailerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockMailer) EXPECT() *MockMailerMockRecorder {
+	return m.recorder
+}
+
+// Send mocks base method.
+func (m *MockMailer) Send(ctx context.Context, mail *models.Mail) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Send", ctx, mail)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Send indicates an expected call of Send.
+func (mr *MockMailerMockRecorder) Send(ctx, mail interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Send", reflect.TypeOf((*MockMailer)(nil).Send), ctx, mail)
+}
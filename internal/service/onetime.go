@@ -0,0 +1,100 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"strings"
+	"time"
+
+	"auth-rest-api/internal/models"
+)
+
+const (
+	purposeVerifyEmail   = "verify-email"
+	purposeResetPassword = "reset-password"
+	purposeMFAChallenge  = "mfa-challenge"
+	purposeMagicLink     = "magic-link"
+	// points from the user to the latest magic link, the code is checked against it
+	purposeMagicCode = "magic-code"
+	// the state of a passkey ceremony between its begin and finish request
+	purposePasskeyRegistration = "passkey-registration"
+	purposePasskeySignIn       = "passkey-signin"
+)
+
+// issueOneTimeToken creates a signed single use token and stores value under its ID until ttl passes.
+// The token has the form <id>.<signature>, the signature binds the ID to the purpose so a token
+// issued for one flow cannot be replayed in another.
+func (s *Service) issueOneTimeToken(ctx context.Context, purpose, value string, ttl time.Duration) (string, error) {
+	raw := make([]byte, 24)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+
+	id := b64(raw)
+
+	if err := s.Store.SaveOneTimeToken(ctx, purpose, id, value, ttl); err != nil {
+		return "", err
+	}
+
+	return id + "." + s.signOneTimeID(purpose, id), nil
+}
+
+// consumeOneTimeToken checks the signature of the token and returns the stored value, the token
+// cannot be used again afterwards
+func (s *Service) consumeOneTimeToken(ctx context.Context, purpose, token string) (string, error) {
+	id, err := s.oneTimeTokenID(purpose, token)
+	if err != nil {
+		return "", err
+	}
+
+	value, err := s.Store.ConsumeOneTimeToken(ctx, purpose, id)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound("token")) {
+			return "", models.ErrInvalid("token")
+		}
+
+		return "", err
+	}
+
+	return value, nil
+}
+
+// peekOneTimeToken returns the stored value of a token that stays usable, for flows that allow
+// several attempts before the token is consumed
+func (s *Service) peekOneTimeToken(ctx context.Context, purpose, token string) (id, value string, err error) {
+	if id, err = s.oneTimeTokenID(purpose, token); err != nil {
+		return "", "", err
+	}
+
+	value, err = s.Store.GetOneTimeToken(ctx, purpose, id)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound("token")) {
+			return "", "", models.ErrInvalid("token")
+		}
+
+		return "", "", err
+	}
+
+	return id, value, nil
+}
+
+// oneTimeTokenID checks the signature of the token and returns its ID
+func (s *Service) oneTimeTokenID(purpose, token string) (string, error) {
+	id, sig, ok := strings.Cut(token, ".")
+	if !ok || subtle.ConstantTimeCompare([]byte(sig), []byte(s.signOneTimeID(purpose, id))) != 1 {
+		return "", models.ErrInvalid("token")
+	}
+
+	return id, nil
+}
+
+func (s *Service) signOneTimeID(purpose, id string) string {
+	mac := hmac.New(sha256.New, s.Config.TokenSecret)
+	mac.Write([]byte(purpose + "." + id))
+
+	return b64(mac.Sum(nil))
+}
@@ -0,0 +1,446 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"auth-rest-api/internal/models"
+	"auth-rest-api/internal/server"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+const (
+	// passkeyCeremonyTTL is the time the browser gets between the begin and finish request
+	passkeyCeremonyTTL   = 5 * time.Minute
+	maxPasskeyNameLength = 64
+)
+
+// passkeyCeremony is kept between the begin and finish request of a ceremony
+type passkeyCeremony struct {
+	Session webauthn.SessionData `json:"session"`
+	// MFAChallenge is the ID of the challenge token a sign in with a second factor completes
+	MFAChallenge string `json:"mfaChallenge,omitempty"`
+}
+
+// passkeyUser adapts a user and the registered passkeys to webauthn.User
+type passkeyUser struct {
+	user     *models.UserData
+	passkeys []models.Passkey
+}
+
+func (u *passkeyUser) WebAuthnID() []byte {
+	return []byte(u.user.ID)
+}
+
+func (u *passkeyUser) WebAuthnName() string {
+	return u.user.Email
+}
+
+func (u *passkeyUser) WebAuthnDisplayName() string {
+	if u.user.Name != "" {
+		return u.user.Name
+	}
+
+	return u.user.Email
+}
+
+func (u *passkeyUser) WebAuthnCredentials() []webauthn.Credential {
+	creds := make([]webauthn.Credential, 0, len(u.passkeys))
+
+	for _, p := range u.passkeys {
+		id, err := base64.RawURLEncoding.DecodeString(p.ID)
+		if err != nil {
+			continue
+		}
+
+		transports := make([]protocol.AuthenticatorTransport, len(p.Transports))
+		for i, t := range p.Transports {
+			transports[i] = protocol.AuthenticatorTransport(t)
+		}
+
+		creds = append(creds, webauthn.Credential{
+			ID:              id,
+			PublicKey:       p.PublicKey,
+			AttestationType: p.AttestationType,
+			Transport:       transports,
+			Flags:           webauthn.CredentialFlags{BackupEligible: p.BackupEligible, BackupState: p.BackupState},
+			Authenticator: webauthn.Authenticator{
+				AAGUID: p.AAGUID, SignCount: p.SignCount, CloneWarning: p.CloneWarning,
+			},
+		})
+	}
+
+	return creds
+}
+
+// passkey returns the stored passkey of a credential
+func (u *passkeyUser) passkey(credID []byte) *models.Passkey {
+	id := base64.RawURLEncoding.EncodeToString(credID)
+
+	for i := range u.passkeys {
+		if u.passkeys[i].ID == id {
+			return &u.passkeys[i]
+		}
+	}
+
+	return nil
+}
+
+// BeginPasskeyRegistration returns the options to create a passkey for the authenticated user
+func (s *Service) BeginPasskeyRegistration(ctx context.Context) (*models.PasskeyCeremony, error) {
+	claims, err := claimsFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.currentUser(ctx, claims)
+	if err != nil {
+		return nil, err
+	}
+
+	pu, err := s.passkeyUser(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+
+	wa, err := s.webAuthn()
+	if err != nil {
+		return nil, err
+	}
+
+	exclusions := make([]protocol.CredentialDescriptor, 0, len(pu.passkeys))
+	for _, cred := range pu.WebAuthnCredentials() {
+		exclusions = append(exclusions, cred.Descriptor())
+	}
+
+	// passkeys are discoverable credentials, the sign in starts without an email
+	creation, session, err := wa.BeginRegistration(pu, webauthn.WithExclusions(exclusions),
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementRequired))
+	if err != nil {
+		return nil, err
+	}
+
+	return s.startPasskeyCeremony(ctx, purposePasskeyRegistration, &passkeyCeremony{Session: *session}, creation)
+}
+
+// FinishPasskeyRegistration checks the attestation of the browser and stores the new passkey
+func (s *Service) FinishPasskeyRegistration(ctx context.Context, req *models.PasskeyRegistrationReq) (*models.Passkey, error) {
+	logger := ctx.Value(server.Logger).(*slog.Logger)
+
+	claims, err := claimsFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if req == nil || req.SessionToken == "" || len(req.Credential) == 0 {
+		return nil, models.ErrBadRequest(models.ErrRequired("session token and credential"))
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if utf8.RuneCountInString(name) > maxPasskeyNameLength {
+		return nil, models.ErrBadRequest(models.ErrInvalid("passkey name"))
+	}
+
+	ceremony, err := s.finishPasskeyCeremony(ctx, purposePasskeyRegistration, req.SessionToken)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.currentUser(ctx, claims)
+	if err != nil {
+		return nil, err
+	}
+
+	// a session token only works for the user who started the registration
+	if string(ceremony.Session.UserID) != user.ID {
+		return nil, models.ErrBadRequest(models.ErrInvalid("passkey session"))
+	}
+
+	pu, err := s.passkeyUser(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+
+	wa, err := s.webAuthn()
+	if err != nil {
+		return nil, err
+	}
+
+	parsed, err := protocol.ParseCredentialCreationResponseBytes(req.Credential)
+	if err != nil {
+		return nil, passkeyError(err)
+	}
+
+	cred, err := wa.CreateCredential(pu, ceremony.Session, parsed)
+	if err != nil {
+		return nil, passkeyError(err)
+	}
+
+	passkey := &models.Passkey{
+		ID:              base64.RawURLEncoding.EncodeToString(cred.ID),
+		UserID:          user.ID,
+		Name:            name,
+		PublicKey:       cred.PublicKey,
+		AttestationType: cred.AttestationType,
+		AAGUID:          cred.Authenticator.AAGUID,
+		SignCount:       cred.Authenticator.SignCount,
+		BackupEligible:  cred.Flags.BackupEligible,
+		BackupState:     cred.Flags.BackupState,
+		CreatedAt:       time.Now().UTC(),
+	}
+
+	for _, t := range cred.Transport {
+		passkey.Transports = append(passkey.Transports, string(t))
+	}
+
+	if err := s.Store.CreatePasskey(ctx, passkey); err != nil {
+		return nil, err
+	}
+
+	logger.LogAttrs(ctx, slog.LevelInfo, "passkey registered", slog.String("user", user.ID), slog.String("passkey", passkey.ID))
+
+	return passkey, nil
+}
+
+// BeginPasskeySignIn returns the options to sign in with a passkey. Without an MFA token any passkey
+// of any user is accepted, with the challenge token of a password sign in only the passkeys of
+// that user are and the passkey completes the sign in as second factor.
+func (s *Service) BeginPasskeySignIn(ctx context.Context, mfaToken string) (*models.PasskeyCeremony, error) {
+	wa, err := s.webAuthn()
+	if err != nil {
+		return nil, err
+	}
+
+	if mfaToken == "" {
+		// the passkey replaces password and second factor, so the user has to be verified on the device
+		assertion, session, err := wa.BeginDiscoverableLogin(webauthn.WithUserVerification(protocol.VerificationRequired))
+		if err != nil {
+			return nil, err
+		}
+
+		return s.startPasskeyCeremony(ctx, purposePasskeySignIn, &passkeyCeremony{Session: *session}, assertion)
+	}
+
+	id, challenge, err := s.peekOneTimeToken(ctx, purposeMFAChallenge, mfaToken)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalid("token")) {
+			return nil, models.ErrBadRequest(models.ErrInvalid("mfa token"))
+		}
+
+		return nil, err
+	}
+
+	userID, _, _ := strings.Cut(challenge, " ")
+
+	// every ceremony counts as an attempt, a failed one cannot be retried with the same session
+	if err := s.countMFAAttempt(ctx, id, userID); err != nil {
+		return nil, err
+	}
+
+	user, err := s.Store.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	pu, err := s.passkeyUser(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(pu.passkeys) == 0 {
+		return nil, models.ErrBadRequest(models.ErrNotFound("passkey"))
+	}
+
+	assertion, session, err := wa.BeginLogin(pu, webauthn.WithUserVerification(protocol.VerificationPreferred))
+	if err != nil {
+		return nil, err
+	}
+
+	return s.startPasskeyCeremony(ctx, purposePasskeySignIn, &passkeyCeremony{Session: *session, MFAChallenge: id}, assertion)
+}
+
+// FinishPasskeySignIn checks the assertion of the browser and issues a token pair. The signature
+// counter of the passkey has to grow with every use, a passkey that reports an older counter may
+// have been cloned and is refused from then on.
+func (s *Service) FinishPasskeySignIn(ctx context.Context, req *models.PasskeySignInReq) (*models.UserResp, error) {
+	logger := ctx.Value(server.Logger).(*slog.Logger)
+
+	if req == nil || req.SessionToken == "" || len(req.Credential) == 0 {
+		return nil, models.ErrBadRequest(models.ErrRequired("session token and credential"))
+	}
+
+	scope, err := s.requestedScope(req.Scope)
+	if err != nil {
+		return nil, err
+	}
+
+	ceremony, err := s.finishPasskeyCeremony(ctx, purposePasskeySignIn, req.SessionToken)
+	if err != nil {
+		return nil, err
+	}
+
+	wa, err := s.webAuthn()
+	if err != nil {
+		return nil, err
+	}
+
+	parsed, err := protocol.ParseCredentialRequestResponseBytes(req.Credential)
+	if err != nil {
+		return nil, passkeyError(err)
+	}
+
+	var (
+		pu   *passkeyUser
+		cred *webauthn.Credential
+	)
+
+	if ceremony.MFAChallenge == "" {
+		cred, err = wa.ValidateDiscoverableLogin(func(_, userHandle []byte) (webauthn.User, error) {
+			user, err := s.Store.GetUserByID(ctx, string(userHandle))
+			if err != nil {
+				return nil, err
+			}
+
+			pu, err = s.passkeyUser(ctx, user)
+
+			return pu, err
+		}, ceremony.Session, parsed)
+	} else {
+		var user *models.UserData
+
+		if user, err = s.Store.GetUserByID(ctx, string(ceremony.Session.UserID)); err != nil {
+			return nil, err
+		}
+
+		if pu, err = s.passkeyUser(ctx, user); err != nil {
+			return nil, err
+		}
+
+		cred, err = wa.ValidateLogin(pu, ceremony.Session, parsed)
+	}
+
+	if err != nil {
+		return nil, passkeyError(err)
+	}
+
+	passkey := pu.passkey(cred.ID)
+	if passkey == nil {
+		return nil, models.ErrBadRequest(models.ErrNotFound("passkey"))
+	}
+
+	now := time.Now().UTC()
+	passkey.CloneWarning = cred.Authenticator.CloneWarning
+	passkey.SignCount = cred.Authenticator.SignCount
+	passkey.BackupState = cred.Flags.BackupState
+	passkey.LastUsedAt = &now
+
+	if err := s.Store.UpdatePasskeyUsage(ctx, passkey); err != nil {
+		return nil, err
+	}
+
+	if passkey.CloneWarning {
+		logger.LogAttrs(ctx, slog.LevelWarn, "security event: passkey signature counter did not grow, the passkey may be cloned",
+			slog.String("event", "passkey_clone_warning"), slog.String("user", pu.user.ID), slog.String("passkey", passkey.ID),
+			slog.Uint64("signCount", uint64(parsed.Response.AuthenticatorData.Counter)))
+
+		return nil, models.ErrPasskeyCloned
+	}
+
+	if ceremony.MFAChallenge != "" {
+		// the password step is done, the challenge is used up like with an authentication code
+		challenge, err := s.Store.ConsumeOneTimeToken(ctx, purposeMFAChallenge, ceremony.MFAChallenge)
+		if err != nil {
+			if errors.Is(err, models.ErrNotFound("token")) {
+				return nil, models.ErrBadRequest(models.ErrInvalid("mfa token"))
+			}
+
+			return nil, err
+		}
+
+		// the scope asked for with the password applies
+		_, scope, _ = strings.Cut(challenge, " ")
+	}
+
+	logger.LogAttrs(ctx, slog.LevelInfo, "passkey sign in completed", slog.String("user", pu.user.ID),
+		slog.Bool("mfa", ceremony.MFAChallenge != ""))
+
+	return s.issueTokens(ctx, pu.user, scope)
+}
+
+func (s *Service) passkeyUser(ctx context.Context, user *models.UserData) (*passkeyUser, error) {
+	passkeys, err := s.Store.ListPasskeys(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &passkeyUser{user: user, passkeys: passkeys}, nil
+}
+
+// startPasskeyCeremony keeps the ceremony until the browser answers and returns the options for it
+func (s *Service) startPasskeyCeremony(ctx context.Context, purpose string, ceremony *passkeyCeremony, options any) (*models.PasskeyCeremony, error) {
+	value, err := json.Marshal(ceremony)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := s.issueOneTimeToken(ctx, purpose, string(value), passkeyCeremonyTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.PasskeyCeremony{SessionToken: token, Options: options}, nil
+}
+
+// finishPasskeyCeremony returns the ceremony of the session token, every session works once
+func (s *Service) finishPasskeyCeremony(ctx context.Context, purpose, token string) (*passkeyCeremony, error) {
+	value, err := s.consumeOneTimeToken(ctx, purpose, token)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalid("token")) {
+			return nil, models.ErrBadRequest(models.ErrInvalid("passkey session"))
+		}
+
+		return nil, err
+	}
+
+	var ceremony passkeyCeremony
+	if err := json.Unmarshal([]byte(value), &ceremony); err != nil {
+		return nil, err
+	}
+
+	return &ceremony, nil
+}
+
+func (s *Service) webAuthn() (*webauthn.WebAuthn, error) {
+	return webauthn.New(&webauthn.Config{
+		RPID:          s.Config.WebAuthnRPID,
+		RPDisplayName: s.Config.MFAIssuer,
+		RPOrigins:     s.Config.WebAuthnOrigins,
+		Timeouts: webauthn.TimeoutsConfig{
+			Login:        webauthn.TimeoutConfig{Timeout: passkeyCeremonyTTL, TimeoutUVD: passkeyCeremonyTTL},
+			Registration: webauthn.TimeoutConfig{Timeout: passkeyCeremonyTTL, TimeoutUVD: passkeyCeremonyTTL},
+		},
+	})
+}
+
+// passkeyError turns a failed ceremony into a client error, the details tell which check failed
+func passkeyError(err error) error {
+	var pErr *protocol.Error
+	if !errors.As(err, &pErr) {
+		return err
+	}
+
+	if pErr.Details == "" {
+		return models.ErrBadRequest(models.ErrInvalid("passkey"))
+	}
+
+	return models.ErrBadRequest(fmt.Errorf("%w: %s", models.ErrInvalid("passkey"), pErr.Details))
+}
@@ -0,0 +1,252 @@
+package service
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"auth-rest-api/internal/models"
+	"auth-rest-api/internal/server"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/go-webauthn/webauthn/protocol/webauthncose"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testAuthenticator is a software passkey answering the ceremonies like a browser would
+type testAuthenticator struct {
+	t      *testing.T
+	key    *ecdsa.PrivateKey
+	credID []byte
+	rpID   string
+	origin string
+}
+
+func newTestAuthenticator(t *testing.T, cfg Config) *testAuthenticator {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	credID := make([]byte, 16)
+	_, err = rand.Read(credID)
+	require.NoError(t, err)
+
+	return &testAuthenticator{t: t, key: key, credID: credID, rpID: cfg.WebAuthnRPID, origin: cfg.WebAuthnOrigins[0]}
+}
+
+func (a *testAuthenticator) authData(flags protocol.AuthenticatorFlags, signCount uint32, attested []byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(a.rpID))
+
+	data := append(rpIDHash[:], byte(flags))
+	data = binary.BigEndian.AppendUint32(data, signCount)
+
+	return append(data, attested...)
+}
+
+func (a *testAuthenticator) clientData(ceremony protocol.CeremonyType, challenge string) []byte {
+	data, err := json.Marshal(map[string]string{"type": string(ceremony), "challenge": challenge, "origin": a.origin})
+	require.NoError(a.t, err)
+
+	return data
+}
+
+// create answers navigator.credentials.create() with a "none" attestation
+func (a *testAuthenticator) create(options any) json.RawMessage {
+	creation := options.(*protocol.CredentialCreation)
+
+	pubKey, err := webauthncbor.Marshal(webauthncose.EC2PublicKeyData{
+		PublicKeyData: webauthncose.PublicKeyData{KeyType: int64(webauthncose.EllipticKey), Algorithm: int64(webauthncose.AlgES256)},
+		Curve:         1,
+		XCoord:        a.key.X.FillBytes(make([]byte, 32)),
+		YCoord:        a.key.Y.FillBytes(make([]byte, 32)),
+	})
+	require.NoError(a.t, err)
+
+	attested := append(make([]byte, 16), byte(len(a.credID)>>8), byte(len(a.credID)))
+	attested = append(append(attested, a.credID...), pubKey...)
+
+	attObj, err := webauthncbor.Marshal(map[string]any{
+		"fmt":      "none",
+		"attStmt":  map[string]any{},
+		"authData": a.authData(protocol.FlagUserPresent|protocol.FlagUserVerified|protocol.FlagAttestedCredentialData, 0, attested),
+	})
+	require.NoError(a.t, err)
+
+	return a.credential(map[string]string{
+		"clientDataJSON":    b64(a.clientData(protocol.CreateCeremony, creation.Response.Challenge.String())),
+		"attestationObject": b64(attObj),
+	})
+}
+
+// get answers navigator.credentials.get() with a signature over the given counter
+func (a *testAuthenticator) get(options any, userID string, signCount uint32) json.RawMessage {
+	assertion := options.(*protocol.CredentialAssertion)
+
+	authData := a.authData(protocol.FlagUserPresent|protocol.FlagUserVerified, signCount, nil)
+	clientData := a.clientData(protocol.AssertCeremony, assertion.Response.Challenge.String())
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(authData, clientDataHash[:]...))
+
+	sig, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	require.NoError(a.t, err)
+
+	return a.credential(map[string]string{
+		"clientDataJSON":    b64(clientData),
+		"authenticatorData": b64(authData),
+		"signature":         b64(sig),
+		"userHandle":        b64([]byte(userID)),
+	})
+}
+
+func (a *testAuthenticator) credential(response map[string]string) json.RawMessage {
+	data, err := json.Marshal(map[string]any{
+		"id": b64(a.credID), "rawId": b64(a.credID), "type": "public-key", "response": response,
+	})
+	require.NoError(a.t, err)
+
+	return data
+}
+
+func TestService_Passkey(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStore := NewMockStorer(ctrl)
+	s := New(mockStore)
+	ctx := testContext()
+	authCtx := context.WithValue(ctx, server.Claims, &Claims{Email: email, UserID: userID})
+	user := &models.UserData{ID: userID, Email: email}
+	auth := newTestAuthenticator(t, s.Config)
+
+	// the ceremony state is kept in memory instead of redis
+	ceremonies := map[string]string{}
+
+	mockStore.EXPECT().SaveOneTimeToken(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), passkeyCeremonyTTL).
+		DoAndReturn(func(_ context.Context, purpose, id, value string, _ time.Duration) error {
+			ceremonies[purpose+":"+id] = value
+			return nil
+		}).AnyTimes()
+	mockStore.EXPECT().ConsumeOneTimeToken(gomock.Any(), gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, purpose, id string) (string, error) {
+			value, ok := ceremonies[purpose+":"+id]
+			if !ok {
+				return "", models.ErrNotFound("token")
+			}
+
+			delete(ceremonies, purpose+":"+id)
+
+			return value, nil
+		}).AnyTimes()
+
+	// registration
+	var stored models.Passkey
+
+	mockStore.EXPECT().GetUserByID(authCtx, userID).Return(user, nil).Times(2)
+	mockStore.EXPECT().ListPasskeys(authCtx, userID).Return(nil, nil).Times(2)
+	mockStore.EXPECT().CreatePasskey(authCtx, gomock.Any()).DoAndReturn(func(_ context.Context, p *models.Passkey) error {
+		stored = *p
+		return nil
+	})
+
+	ceremony, err := s.BeginPasskeyRegistration(authCtx)
+	require.NoError(t, err)
+
+	passkey, err := s.FinishPasskeyRegistration(authCtx, &models.PasskeyRegistrationReq{
+		SessionToken: ceremony.SessionToken, Name: "Laptop", Credential: auth.create(ceremony.Options),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, base64.RawURLEncoding.EncodeToString(auth.credID), passkey.ID)
+	assert.Equal(t, "Laptop", stored.Name)
+	assert.Equal(t, userID, stored.UserID)
+	assert.NotEmpty(t, stored.PublicKey)
+
+	// a session token works once
+	_, err = s.FinishPasskeyRegistration(authCtx, &models.PasskeyRegistrationReq{
+		SessionToken: ceremony.SessionToken, Credential: auth.create(ceremony.Options),
+	})
+	assert.Equal(t, models.ErrBadRequest(models.ErrInvalid("passkey session")), err)
+
+	mockStore.EXPECT().GetUserByID(ctx, userID).Return(user, nil).AnyTimes()
+	mockStore.EXPECT().ListPasskeys(ctx, userID).DoAndReturn(func(context.Context, string) ([]models.Passkey, error) {
+		return []models.Passkey{stored}, nil
+	}).AnyTimes()
+	mockStore.EXPECT().UpdatePasskeyUsage(ctx, gomock.Any()).DoAndReturn(func(_ context.Context, p *models.Passkey) error {
+		stored = *p
+		return nil
+	}).AnyTimes()
+	mockStore.EXPECT().GetAccess(ctx, userID).Return(&models.Access{}, nil).AnyTimes()
+	mockStore.EXPECT().CreateToken(ctx, email, gomock.Any()).Return(nil).AnyTimes()
+	mockStore.EXPECT().UpdateLastLogin(ctx, userID, gomock.Any()).Return(nil).AnyTimes()
+
+	signIn := func(mfaToken string, signCount uint32) (*models.UserResp, error) {
+		ceremony, err := s.BeginPasskeySignIn(ctx, mfaToken)
+		require.NoError(t, err)
+
+		return s.FinishPasskeySignIn(ctx, &models.PasskeySignInReq{
+			SessionToken: ceremony.SessionToken, Credential: auth.get(ceremony.Options, userID, signCount),
+		})
+	}
+
+	// primary sign in
+	resp, err := signIn("", 5)
+	require.NoError(t, err)
+	assert.NotEmpty(t, resp.AccessToken)
+	assert.Equal(t, uint32(5), stored.SignCount)
+	assert.NotNil(t, stored.LastUsedAt)
+
+	// second factor after the password
+	mfaToken, err := s.issueOneTimeToken(ctx, purposeMFAChallenge, userID, passkeyCeremonyTTL)
+	require.NoError(t, err)
+
+	mockStore.EXPECT().GetOneTimeToken(ctx, purposeMFAChallenge, gomock.Any()).Return(userID, nil)
+	mockStore.EXPECT().IncrCounter(ctx, gomock.Any(), s.Config.MFAChallengeTTL).Return(int64(1), nil)
+
+	resp, err = signIn(mfaToken, 6)
+	require.NoError(t, err)
+	assert.NotEmpty(t, resp.AccessToken)
+	assert.Empty(t, ceremonies, "mfa challenge not consumed")
+
+	// a counter that does not grow points to a cloned passkey
+	_, err = signIn("", 6)
+	assert.Equal(t, models.ErrPasskeyCloned, err)
+	assert.True(t, stored.CloneWarning)
+
+	// and the passkey stays refused
+	_, err = signIn("", 7)
+	assert.Equal(t, models.ErrPasskeyCloned, err)
+}
+
+func Test_passkeyError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{
+			name: "ceremony check failed",
+			err:  protocol.ErrVerification.WithDetails("Error validating challenge"),
+			want: models.ErrBadRequest(models.ErrInvalid("passkey: Error validating challenge")),
+		},
+		{
+			name: "other error",
+			err:  models.ErrDBNotConnected,
+			want: models.ErrDBNotConnected,
+		},
+	}
+
+	for i, tt := range tests {
+		got := passkeyError(tt.err)
+
+		assert.Equalf(t, tt.want.Error(), got.Error(), "TEST[%d] Failed - %s", i, tt.name)
+		assert.Equalf(t, models.IsBadRequest(tt.want), models.IsBadRequest(got), "TEST[%d] Failed - %s", i, tt.name)
+	}
+}
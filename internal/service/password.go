@@ -0,0 +1,95 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+
+	"auth-rest-api/internal/models"
+	"auth-rest-api/internal/server"
+)
+
+// ForgotPassword mails a password reset link. Unknown addresses are silently ignored so the
+// endpoint does not reveal which accounts exist.
+func (s *Service) ForgotPassword(ctx context.Context, email string) error {
+	logger := ctx.Value(server.Logger).(*slog.Logger)
+
+	email, err := s.normalizeEmail(email)
+	if err != nil {
+		return err
+	}
+
+	user, err := s.Store.GetUserByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound("user")) {
+			logger.LogAttrs(ctx, slog.LevelInfo, "password reset requested for unknown email", slog.String("email", email))
+			return nil
+		}
+
+		return err
+	}
+
+	// the token points to the user ID, so it keeps working if the email changes in the meantime
+	token, err := s.issueOneTimeToken(ctx, purposeResetPassword, user.ID, s.Config.PasswordResetTTL)
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/password/reset?token=%s", s.Config.AppURL, url.QueryEscape(token))
+
+	return s.sendMail(ctx, &models.Mail{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Choose a new password by opening the link below, it expires in %s. "+
+			"If you did not ask for a password reset you can ignore this email.\n\n%s\n\nReset token: %s\n",
+			s.Config.PasswordResetTTL, link, token),
+	})
+}
+
+// ResetPassword sets a new password for the owner of a reset token and logs the user out
+// everywhere, every token works once
+func (s *Service) ResetPassword(ctx context.Context, token, password string) error {
+	logger := ctx.Value(server.Logger).(*slog.Logger)
+
+	// checked first so a weak password does not use up the token
+	if err := models.ValidatePassword(password); err != nil {
+		return models.ErrBadRequest(err)
+	}
+
+	_, id, err := s.peekOneTimeToken(ctx, purposeResetPassword, token)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalid("token")) {
+			return models.ErrBadRequest(models.ErrInvalid("reset token"))
+		}
+
+		return err
+	}
+
+	user, err := s.Store.GetUserByID(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if err := s.checkNewPassword(ctx, user.Email, password, user); err != nil {
+		return err
+	}
+
+	// the token is only used up by a password the policy accepts
+	if _, err := s.consumeOneTimeToken(ctx, purposeResetPassword, token); err != nil {
+		if errors.Is(err, models.ErrInvalid("token")) {
+			return models.ErrBadRequest(models.ErrInvalid("reset token"))
+		}
+
+		return err
+	}
+
+	if err := s.storePassword(ctx, user, password); err != nil {
+		return err
+	}
+
+	logger.LogAttrs(ctx, slog.LevelInfo, "password reset", slog.String("email", user.Email))
+
+	return s.revokeUserSessions(ctx, user.Email, "")
+}
@@ -0,0 +1,160 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"auth-rest-api/internal/models"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_ForgotPassword(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStore := NewMockStorer(ctrl)
+	mockMailer := NewMockMailer(ctrl)
+	s := New(mockStore, WithMailer(mockMailer))
+	ctx := testContext()
+
+	tests := []struct {
+		name     string
+		email    string
+		mockCall func()
+		wantErr  error
+	}{
+		{
+			name:  "registered email",
+			email: email,
+			mockCall: func() {
+				mockStore.EXPECT().GetUserByEmail(ctx, email).Return(&models.UserData{ID: userID, Email: email}, nil)
+				mockStore.EXPECT().SaveOneTimeToken(ctx, purposeResetPassword, gomock.Any(), userID, s.Config.PasswordResetTTL).Return(nil)
+				mockMailer.EXPECT().Send(ctx, gomock.Any()).Return(nil)
+			},
+		},
+		{
+			name:  "unknown email",
+			email: "unknown@example.com",
+			mockCall: func() {
+				mockStore.EXPECT().GetUserByEmail(ctx, "unknown@example.com").Return(nil, models.ErrNotFound("user"))
+			},
+		},
+		{
+			name:     "invalid email",
+			email:    "not-an-email",
+			mockCall: func() {},
+			wantErr:  models.ErrBadRequest(models.ErrInvalid("email")),
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockCall()
+
+			assert.Equalf(t, tt.wantErr, s.ForgotPassword(ctx, tt.email), "TEST[%d] Failed - %s", i, tt.name)
+		})
+	}
+}
+
+func TestService_ResetPassword(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStore := NewMockStorer(ctrl)
+	mockMailer := NewMockMailer(ctrl)
+	s := New(mockStore, WithMailer(mockMailer))
+	ctx := testContext()
+
+	var (
+		storedID string
+		token    string
+	)
+
+	mockStore.EXPECT().GetUserByEmail(ctx, email).Return(&models.UserData{ID: userID, Email: email}, nil)
+	mockStore.EXPECT().SaveOneTimeToken(ctx, purposeResetPassword, gomock.Any(), userID, s.Config.PasswordResetTTL).
+		DoAndReturn(func(_ context.Context, _, id, _ string, _ time.Duration) error {
+			storedID = id
+			return nil
+		})
+	mockMailer.EXPECT().Send(ctx, gomock.Any()).DoAndReturn(func(_ context.Context, mail *models.Mail) error {
+		token = tokenRe.FindStringSubmatch(mail.Body)[1]
+		return nil
+	})
+
+	require.NoError(t, s.ForgotPassword(ctx, email))
+
+	tests := []struct {
+		name     string
+		token    string
+		password string
+		mockCall func()
+		wantErr  error
+	}{
+		{
+			name:     "missing password keeps the token",
+			token:    token,
+			password: "",
+			mockCall: func() {},
+			wantErr:  models.ErrBadRequest(models.ErrRequired("password")),
+		},
+		{
+			name:     "valid token",
+			token:    token,
+			password: "new-password",
+			mockCall: func() {
+				mockStore.EXPECT().GetOneTimeToken(ctx, purposeResetPassword, storedID).Return(userID, nil)
+				mockStore.EXPECT().GetUserByID(ctx, userID).Return(&models.UserData{ID: userID, Email: email}, nil)
+				mockStore.EXPECT().ConsumeOneTimeToken(ctx, purposeResetPassword, storedID).Return(userID, nil)
+				mockStore.EXPECT().UpdatePassword(ctx, userID, gomock.Any()).DoAndReturn(
+					func(_ context.Context, _ string, hash []byte) error {
+						match, err := verifyPassword(hash, "new-password")
+						assert.NoError(t, err)
+						assert.True(t, match)
+						return nil
+					})
+				mockStore.EXPECT().ListFamilies(ctx, email).Return([]models.TokenFamily{{ID: "f1"}, {ID: "f2"}}, nil)
+				mockStore.EXPECT().RevokeFamily(ctx, "f1").Return(nil)
+				mockStore.EXPECT().RevokeFamily(ctx, "f2").Return(models.ErrNotFound("token family"))
+			},
+		},
+		{
+			name:     "token already used",
+			token:    token,
+			password: "new-password",
+			mockCall: func() {
+				mockStore.EXPECT().GetOneTimeToken(ctx, purposeResetPassword, storedID).Return("", models.ErrNotFound("token"))
+			},
+			wantErr: models.ErrBadRequest(models.ErrInvalid("reset token")),
+		},
+		{
+			name:     "password breaking the policy keeps the token",
+			token:    token,
+			password: "test@example.com1",
+			mockCall: func() {
+				mockStore.EXPECT().GetOneTimeToken(ctx, purposeResetPassword, storedID).Return(userID, nil)
+				mockStore.EXPECT().GetUserByID(ctx, userID).Return(&models.UserData{ID: userID, Email: email}, nil)
+			},
+			wantErr: models.ErrBadRequest(&models.ValidationError{Fields: []models.FieldError{{Field: "password",
+				Code: "contains_email", Message: "password may not contain the email address"}}}),
+		},
+		{
+			name:     "verification token used for reset",
+			token:    storedID + "." + s.signOneTimeID(purposeVerifyEmail, storedID),
+			password: "new-password",
+			mockCall: func() {},
+			wantErr:  models.ErrBadRequest(models.ErrInvalid("reset token")),
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockCall()
+
+			assert.Equalf(t, tt.wantErr, s.ResetPassword(ctx, tt.token, tt.password), "TEST[%d] Failed - %s", i, tt.name)
+		})
+	}
+}
@@ -0,0 +1,181 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"auth-rest-api/internal/models"
+)
+
+// Character classes a password can be required to contain
+const (
+	ClassLower  = "lower"
+	ClassUpper  = "upper"
+	ClassDigit  = "digit"
+	ClassSymbol = "symbol"
+)
+
+var classNames = map[string]string{
+	ClassLower:  "a lowercase letter",
+	ClassUpper:  "an uppercase letter",
+	ClassDigit:  "a digit",
+	ClassSymbol: "a symbol",
+}
+
+// BreachChecker tells whether a password appeared in a data breach
+type BreachChecker interface {
+	IsBreached(ctx context.Context, password string) (bool, error)
+}
+
+// checkNewPassword applies the password policy to a password chosen on sign up or a password change,
+// every broken rule is listed. user is nil on sign up, otherwise the password may not repeat one of
+// the last PasswordHistory passwords of the user.
+func (s *Service) checkNewPassword(ctx context.Context, email, password string, user *models.UserData) error {
+	cfg := s.Config
+	vErr := &models.ValidationError{}
+
+	if n := utf8.RuneCountInString(password); n < cfg.PasswordMinLength {
+		vErr.Add("password", "too_short", fmt.Sprintf("password must have at least %d characters", cfg.PasswordMinLength))
+	} else if cfg.PasswordMaxLength > 0 && n > cfg.PasswordMaxLength {
+		vErr.Add("password", "too_long", fmt.Sprintf("password must have at most %d characters", cfg.PasswordMaxLength))
+	}
+
+	for _, class := range cfg.PasswordClasses {
+		if name, ok := classNames[class]; ok && !strings.ContainsFunc(password, classFunc(class)) {
+			vErr.Add("password", "missing_"+class, "password must contain "+name)
+		}
+	}
+
+	if cfg.PasswordMaxRepeated > 0 && longestRun(password) > cfg.PasswordMaxRepeated {
+		vErr.Add("password", "repeated_characters",
+			fmt.Sprintf("password may not repeat a character more than %d times in a row", cfg.PasswordMaxRepeated))
+	}
+
+	// very short local parts would match by chance
+	local, _, _ := strings.Cut(strings.ToLower(email), "@")
+	if !cfg.PasswordAllowEmail && utf8.RuneCountInString(local) >= 3 && strings.Contains(strings.ToLower(password), local) {
+		vErr.Add("password", "contains_email", "password may not contain the email address")
+	}
+
+	// the lookups below are expensive, a password breaking a simple rule is rejected without them
+	if len(vErr.Fields) == 0 && s.Breached != nil {
+		breached, err := s.Breached.IsBreached(ctx, password)
+		if err != nil {
+			return err
+		}
+
+		if breached {
+			vErr.Add("password", "breached", "password appeared in a data breach, choose another one")
+		}
+	}
+
+	if len(vErr.Fields) == 0 && user != nil {
+		reused, err := s.passwordReused(ctx, user, password)
+		if err != nil {
+			return err
+		}
+
+		if reused {
+			vErr.Add("password", "reused", fmt.Sprintf("password may not be one of the last %d passwords", cfg.PasswordHistory))
+		}
+	}
+
+	if len(vErr.Fields) > 0 {
+		return models.ErrBadRequest(vErr)
+	}
+
+	return nil
+}
+
+// passwordReused compares password with the current and the previous passwords of the user
+func (s *Service) passwordReused(ctx context.Context, user *models.UserData, password string) (bool, error) {
+	if s.Config.PasswordHistory <= 0 {
+		return false, nil
+	}
+
+	hashes := [][]byte{user.Password}
+
+	if s.Config.PasswordHistory > 1 {
+		history, err := s.Store.GetPasswordHistory(ctx, user.ID)
+		if err != nil {
+			return false, err
+		}
+
+		hashes = append(hashes, history[:min(len(history), s.Config.PasswordHistory-1)]...)
+	}
+
+	for _, hash := range hashes {
+		if len(hash) == 0 {
+			continue
+		}
+
+		match, err := s.Hasher.Verify(hash, password)
+		if err != nil {
+			return false, err
+		}
+
+		if match {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// storePassword replaces the password of the user, the old hash goes to the password history
+func (s *Service) storePassword(ctx context.Context, user *models.UserData, password string) error {
+	hash, err := s.Hasher.Hash(password)
+	if err != nil {
+		return err
+	}
+
+	if err := s.Store.UpdatePassword(ctx, user.ID, hash); err != nil {
+		return err
+	}
+
+	if s.Config.PasswordHistory > 1 && len(user.Password) > 0 {
+		if err := s.Store.AddPasswordHistory(ctx, user.ID, user.Password, s.Config.PasswordHistory-1); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func classFunc(class string) func(rune) bool {
+	switch class {
+	case ClassLower:
+		return unicode.IsLower
+	case ClassUpper:
+		return unicode.IsUpper
+	case ClassDigit:
+		return unicode.IsDigit
+	default:
+		return func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r) && !unicode.IsSpace(r)
+		}
+	}
+}
+
+// longestRun returns the length of the longest run of one character
+func longestRun(s string) int {
+	longest, run := 0, 0
+
+	var prev rune
+
+	for i, r := range []rune(s) {
+		if i > 0 && r == prev {
+			run++
+		} else {
+			run = 1
+		}
+
+		prev = r
+		longest = max(longest, run)
+	}
+
+	return longest
+}
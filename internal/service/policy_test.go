@@ -0,0 +1,183 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"auth-rest-api/internal/models"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeBreaches map[string]bool
+
+func (f fakeBreaches) IsBreached(_ context.Context, password string) (bool, error) {
+	if strings.Contains(strings.ToLower(password), "error") {
+		return false, errors.New("dump unreadable")
+	}
+
+	return f[password], nil
+}
+
+func TestService_checkNewPassword(t *testing.T) {
+	s := New(nil, WithPasswordHasher(testHasher), WithBreachChecker(fakeBreaches{"Password123!": true}))
+	s.Config.PasswordMinLength = 10
+	s.Config.PasswordMaxLength = 20
+	s.Config.PasswordClasses = []string{ClassLower, ClassUpper, ClassDigit, ClassSymbol}
+	s.Config.PasswordMaxRepeated = 3
+	ctx := testContext()
+
+	tests := []struct {
+		name      string
+		password  string
+		wantCodes []string
+		wantErr   error
+	}{
+		{name: "meets the policy", password: "Correct-Horse9"},
+		{name: "too short", password: "Sh0rt!", wantCodes: []string{"too_short"}},
+		{name: "too long", password: "Much-Too-Long-Password-1", wantCodes: []string{"too_long"}},
+		{name: "length counts characters", password: "Pässwörd-ÄÖÜ-1"},
+		{name: "missing classes", password: "alllowercase", wantCodes: []string{"missing_upper", "missing_digit", "missing_symbol"}},
+		{name: "repeated characters", password: "Correct-Hoooorse9", wantCodes: []string{"repeated_characters"}},
+		{name: "contains email", password: "My-sumit.kumar9", wantCodes: []string{"contains_email"}},
+		{name: "breached", password: "Password123!", wantCodes: []string{"breached"}},
+		{name: "simple rules skip the breach check", password: "breach@error1", wantCodes: []string{"missing_upper"}},
+		{name: "breach check failing", password: "breach@Error1", wantErr: errors.New("dump unreadable")},
+	}
+
+	for i, tt := range tests {
+		err := s.checkNewPassword(ctx, "Sumit.Kumar@example.com", tt.password, nil)
+
+		var vErr *models.ValidationError
+
+		switch {
+		case tt.wantErr != nil:
+			assert.Equalf(t, tt.wantErr, err, "TEST[%d] Failed - %s", i, tt.name)
+		case tt.wantCodes == nil:
+			assert.NoErrorf(t, err, "TEST[%d] Failed - %s", i, tt.name)
+		default:
+			assert.Truef(t, models.IsBadRequest(err), "TEST[%d] Failed - %s", i, tt.name)
+			require.Truef(t, errors.As(err, &vErr), "TEST[%d] Failed - %s", i, tt.name)
+
+			codes := make([]string, 0, len(vErr.Fields))
+			for _, f := range vErr.Fields {
+				codes = append(codes, f.Code)
+			}
+
+			assert.Equalf(t, tt.wantCodes, codes, "TEST[%d] Failed - %s", i, tt.name)
+		}
+	}
+}
+
+func TestService_passwordHistory(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStore := NewMockStorer(ctrl)
+	s := New(mockStore, WithPasswordHasher(testHasher))
+	s.Config.PasswordMinLength = 8
+	s.Config.PasswordHistory = 3
+	ctx := testContext()
+
+	current, err := testHasher.Hash("current@pass1")
+	require.NoError(t, err)
+
+	previous, err := testHasher.Hash("previous@pass1")
+	require.NoError(t, err)
+
+	oldest, err := testHasher.Hash("oldest@pass1")
+	require.NoError(t, err)
+
+	user := &models.UserData{ID: userID, Email: email, Password: current}
+
+	tests := []struct {
+		name     string
+		password string
+		reused   bool
+	}{
+		{name: "current password", password: "current@pass1", reused: true},
+		{name: "previous password", password: "previous@pass1", reused: true},
+		{name: "password beyond the history", password: "oldest@pass1"},
+		{name: "new password", password: "brand@new1"},
+	}
+
+	for i, tt := range tests {
+		mockStore.EXPECT().GetPasswordHistory(ctx, userID).Return([][]byte{previous, previous, oldest}, nil)
+
+		err := s.checkNewPassword(ctx, email, tt.password, user)
+
+		if tt.reused {
+			var vErr *models.ValidationError
+
+			require.Truef(t, errors.As(err, &vErr), "TEST[%d] Failed - %s", i, tt.name)
+			assert.Equalf(t, "reused", vErr.Fields[0].Code, "TEST[%d] Failed - %s", i, tt.name)
+
+			continue
+		}
+
+		assert.NoErrorf(t, err, "TEST[%d] Failed - %s", i, tt.name)
+	}
+
+	// the replaced hash is kept next to the PasswordHistory-1 previous ones
+	mockStore.EXPECT().UpdatePassword(ctx, userID, gomock.Any()).Return(nil)
+	mockStore.EXPECT().AddPasswordHistory(ctx, userID, current, 2).Return(nil)
+
+	require.NoError(t, s.storePassword(ctx, user, "brand@new1"))
+}
+
+// the request validation only checks a password was sent, PASSWORD_MIN_LENGTH is the only length rule
+func TestService_SignUpMinLength(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	t.Setenv("PASSWORD_MIN_LENGTH", "6")
+
+	mockStore := NewMockStorer(ctrl)
+	s := New(mockStore, WithPasswordHasher(testHasher))
+	ctx := testContext()
+
+	tests := []struct {
+		name      string
+		password  string
+		mockCall  func()
+		wantCodes []string
+	}{
+		{
+			name:     "six characters",
+			password: "pa55wd",
+			mockCall: func() {
+				mockStore.EXPECT().CreateUser(ctx, gomock.Any()).Return(nil)
+				mockStore.EXPECT().SaveOneTimeToken(ctx, purposeVerifyEmail, gomock.Any(), email, gomock.Any()).Return(nil)
+			},
+		},
+		{
+			name:     "white space counts like the policy counts it",
+			password: " pa5d ",
+			mockCall: func() {
+				mockStore.EXPECT().CreateUser(ctx, gomock.Any()).Return(nil)
+				mockStore.EXPECT().SaveOneTimeToken(ctx, purposeVerifyEmail, gomock.Any(), email, gomock.Any()).Return(nil)
+			},
+		},
+		{name: "five characters", password: "pa55w", mockCall: func() {}, wantCodes: []string{"too_short"}},
+	}
+
+	for i, tt := range tests {
+		tt.mockCall()
+
+		err := s.SignUp(ctx, &models.UserReq{Email: email, Password: tt.password})
+		if tt.wantCodes == nil {
+			assert.NoErrorf(t, err, "TEST[%d] Failed - %s", i, tt.name)
+			continue
+		}
+
+		var vErr *models.ValidationError
+
+		require.Truef(t, errors.As(err, &vErr), "TEST[%d] Failed - %s", i, tt.name)
+		require.Lenf(t, vErr.Fields, 1, "TEST[%d] Failed - %s", i, tt.name)
+		assert.Equalf(t, tt.wantCodes[0], vErr.Fields[0].Code, "TEST[%d] Failed - %s", i, tt.name)
+	}
+}
@@ -0,0 +1,53 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+
+	"auth-rest-api/internal/models"
+	"auth-rest-api/internal/server"
+)
+
+// GetProfile returns the user record of the authenticated user
+func (s *Service) GetProfile(ctx context.Context) (*models.UserData, error) {
+	claims, err := claimsFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.currentUser(ctx, claims)
+}
+
+// UpdateProfile changes the name, locale and metadata of the authenticated user and returns the
+// updated record
+func (s *Service) UpdateProfile(ctx context.Context, req *models.ProfileUpdate) (*models.UserData, error) {
+	logger := ctx.Value(server.Logger).(*slog.Logger)
+
+	claims, err := claimsFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if req == nil {
+		return nil, models.ErrBadRequest(models.ErrInvalid("profile"))
+	}
+
+	user, err := s.currentUser(ctx, claims)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Apply(user)
+
+	if err := models.ValidateProfile(user); err != nil {
+		return nil, models.ErrBadRequest(err)
+	}
+
+	if err := s.Store.UpdateProfile(ctx, user); err != nil {
+		return nil, err
+	}
+
+	logger.LogAttrs(ctx, slog.LevelInfo, "profile updated", slog.String("user", user.ID))
+
+	return user, nil
+}
@@ -0,0 +1,122 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"auth-rest-api/internal/models"
+	"auth-rest-api/internal/server"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestService_GetProfile(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStore := NewMockStorer(ctrl)
+	s := New(mockStore)
+	user := &models.UserData{ID: userID, Email: email, CreatedAt: time.Unix(100, 0).UTC()}
+
+	tests := []struct {
+		name     string
+		claims   *Claims
+		mockCall func(ctx context.Context)
+		want     *models.UserData
+		wantErr  error
+	}{
+		{
+			name:     "resolved by user ID",
+			claims:   &Claims{Email: email, UserID: userID},
+			mockCall: func(ctx context.Context) { mockStore.EXPECT().GetUserByID(ctx, userID).Return(user, nil) },
+			want:     user,
+		},
+		{
+			name:     "token without user ID",
+			claims:   &Claims{Email: email},
+			mockCall: func(ctx context.Context) { mockStore.EXPECT().GetUserByEmail(ctx, email).Return(user, nil) },
+			want:     user,
+		},
+		{
+			name:     "missing claims",
+			mockCall: func(context.Context) {},
+			wantErr:  models.ErrRequired("access token"),
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := testContext()
+			if tt.claims != nil {
+				ctx = context.WithValue(ctx, server.Claims, tt.claims)
+			}
+
+			tt.mockCall(ctx)
+
+			got, err := s.GetProfile(ctx)
+			assert.Equalf(t, tt.wantErr, err, "TEST[%d] Failed - %s", i, tt.name)
+			assert.Equalf(t, tt.want, got, "TEST[%d] Failed - %s", i, tt.name)
+		})
+	}
+}
+
+func TestService_UpdateProfile(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStore := NewMockStorer(ctrl)
+	s := New(mockStore)
+	ctx := context.WithValue(testContext(), server.Claims, &Claims{Email: email, UserID: userID})
+
+	name, locale, invalidLocale := "Sumit", "pt-BR", "not a locale"
+	longName := strings.Repeat("x", 101)
+
+	tests := []struct {
+		name     string
+		req      *models.ProfileUpdate
+		mockCall func()
+		want     *models.UserData
+		wantErr  error
+	}{
+		{
+			name: "merge fields and metadata",
+			req:  &models.ProfileUpdate{Name: &name, Locale: &locale, Metadata: map[string]string{"team": "auth", "old": ""}},
+			mockCall: func() {
+				mockStore.EXPECT().GetUserByID(ctx, userID).Return(&models.UserData{ID: userID, Email: email,
+					Metadata: map[string]string{"old": "value", "keep": "me"}}, nil)
+				mockStore.EXPECT().UpdateProfile(ctx, gomock.Any()).Return(nil)
+			},
+			want: &models.UserData{ID: userID, Email: email, Name: name, Locale: locale,
+				Metadata: map[string]string{"team": "auth", "keep": "me"}},
+		},
+		{
+			name: "invalid locale",
+			req:  &models.ProfileUpdate{Locale: &invalidLocale},
+			mockCall: func() {
+				mockStore.EXPECT().GetUserByID(ctx, userID).Return(&models.UserData{ID: userID, Email: email}, nil)
+			},
+			wantErr: models.ErrBadRequest(models.ErrInvalid("locale")),
+		},
+		{
+			name: "name too long",
+			req:  &models.ProfileUpdate{Name: &longName},
+			mockCall: func() {
+				mockStore.EXPECT().GetUserByID(ctx, userID).Return(&models.UserData{ID: userID, Email: email}, nil)
+			},
+			wantErr: models.ErrBadRequest(models.ErrInvalid("name")),
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockCall()
+
+			got, err := s.UpdateProfile(ctx, tt.req)
+			assert.Equalf(t, tt.wantErr, err, "TEST[%d] Failed - %s", i, tt.name)
+			assert.Equalf(t, tt.want, got, "TEST[%d] Failed - %s", i, tt.name)
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package service
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+
+	"auth-rest-api/internal/models"
+)
+
+// requestedScope checks a space separated scope sent by a client, every scope has to be one of
+// Config.Scopes. It is returned without duplicates in the order of Config.Scopes.
+func (s *Service) requestedScope(scope string) (string, error) {
+	requested := strings.Fields(scope)
+
+	for _, sc := range requested {
+		if !slices.Contains(s.Config.Scopes, sc) {
+			return "", models.ErrBadRequest(models.ErrInvalidScope)
+		}
+	}
+
+	return joinScopes(s.Config.Scopes, func(sc string) bool { return slices.Contains(requested, sc) }), nil
+}
+
+// userScope narrows a requested scope to the scopes of Config.Scopes the roles allow, without a
+// requested scope the user gets all of them
+func (s *Service) userScope(requested string, roles []string) string {
+	wanted := strings.Fields(requested)
+
+	return joinScopes(s.Config.Scopes, func(sc string) bool {
+		if len(wanted) > 0 && !slices.Contains(wanted, sc) {
+			return false
+		}
+
+		allowed := s.Config.ScopeRoles[sc]
+
+		return len(allowed) == 0 || slices.ContainsFunc(roles, func(role string) bool { return slices.Contains(allowed, role) })
+	})
+}
+
+// refreshScope returns the scope of a refreshed token pair, it is the scope of the old pair or a part
+// of it. Pairs issued before scopes were configured carry none and get a new one.
+func (s *Service) refreshScope(current, requested string) (string, error) {
+	requested, err := s.requestedScope(requested)
+	if err != nil {
+		return "", err
+	}
+
+	if requested == "" || current == "" {
+		return cmp.Or(requested, current), nil
+	}
+
+	granted := strings.Fields(current)
+
+	for _, sc := range strings.Fields(requested) {
+		if !slices.Contains(granted, sc) {
+			return "", models.ErrBadRequest(models.ErrInvalidScope)
+		}
+	}
+
+	return requested, nil
+}
+
+func joinScopes(scopes []string, keep func(string) bool) string {
+	var kept []string
+
+	for _, sc := range scopes {
+		if keep(sc) {
+			kept = append(kept, sc)
+		}
+	}
+
+	return strings.Join(kept, " ")
+}
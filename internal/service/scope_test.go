@@ -0,0 +1,201 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"auth-rest-api/internal/models"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func scopeConfig(s *Service) {
+	s.Config.Scopes = []string{"profile", "sessions", "admin"}
+	s.Config.ScopeRoles = map[string][]string{"admin": {models.RoleAdmin}}
+}
+
+func TestService_SignInScope(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStore := NewMockStorer(ctrl)
+	s := New(mockStore, WithPasswordHasher(testHasher))
+	scopeConfig(s)
+	ctx := testContext()
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("sumit@kumar"), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	user := &models.UserData{ID: userID, Email: email, Password: hash}
+
+	signIn := func(roles ...string) func() {
+		return func() {
+			expectSignInUnlocked(ctx, mockStore)
+			mockStore.EXPECT().GetUserByEmail(ctx, email).Return(user, nil)
+			mockStore.EXPECT().GetAccess(ctx, userID).Return(&models.Access{Roles: roles}, nil)
+			mockStore.EXPECT().CreateToken(ctx, email, gomock.Any()).Return(nil).MaxTimes(1)
+			mockStore.EXPECT().UpdateLastLogin(ctx, userID, gomock.Any()).Return(nil).MaxTimes(1)
+		}
+	}
+
+	tests := []struct {
+		name      string
+		scope     string
+		mockCall  func()
+		wantScope string
+		wantErr   error
+	}{
+		{
+			name:      "no scope requested",
+			mockCall:  signIn(),
+			wantScope: "profile sessions",
+		},
+		{
+			name:      "requested scopes in configured order",
+			scope:     "sessions profile sessions",
+			mockCall:  signIn(),
+			wantScope: "profile sessions",
+		},
+		{
+			name:      "scope of a missing role is left out",
+			scope:     "sessions admin",
+			mockCall:  signIn(),
+			wantScope: "sessions",
+		},
+		{
+			name:      "scope of a held role",
+			scope:     "admin",
+			mockCall:  signIn(models.RoleAdmin),
+			wantScope: "admin",
+		},
+		{
+			name:     "no requested scope allowed",
+			scope:    "admin",
+			mockCall: signIn(),
+			wantErr:  models.ErrBadRequest(models.ErrInvalidScope),
+		},
+		{
+			name:     "unknown scope",
+			scope:    "profile write",
+			mockCall: func() {},
+			wantErr:  models.ErrBadRequest(models.ErrInvalidScope),
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockCall()
+
+			resp, err := s.SignIn(ctx, &models.UserReq{Email: email, Password: "sumit@kumar", Scope: tt.scope})
+			assert.Equalf(t, tt.wantErr, err, "TEST[%d] Failed - %s", i, tt.name)
+
+			if tt.wantErr != nil {
+				return
+			}
+
+			claims, err := s.Keys.ParseToken(resp.AccessToken, "access")
+			require.NoError(t, err)
+
+			assert.Equalf(t, tt.wantScope, resp.Scope, "TEST[%d] Failed - %s", i, tt.name)
+			assert.Equalf(t, tt.wantScope, claims.Scope, "TEST[%d] Failed - %s", i, tt.name)
+		})
+	}
+}
+
+func TestService_MFASignInScope(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStore := NewMockStorer(ctrl)
+	s := New(mockStore, WithPasswordHasher(testHasher))
+	scopeConfig(s)
+	ctx := testContext()
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("sumit@kumar"), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	user := &models.UserData{ID: userID, Email: email, Password: hash, MFAEnabled: true,
+		TOTP: &models.TOTP{Secret: rfcSecret, Enabled: true}}
+
+	var challenge string
+
+	// the scope asked for with the password is kept by the challenge
+	expectSignInUnlocked(ctx, mockStore)
+	mockStore.EXPECT().GetUserByEmail(ctx, email).Return(user, nil)
+	mockStore.EXPECT().ListPasskeys(ctx, userID).Return(nil, nil)
+	mockStore.EXPECT().SaveOneTimeToken(ctx, purposeMFAChallenge, gomock.Any(), gomock.Any(), s.Config.MFAChallengeTTL).
+		DoAndReturn(func(_ context.Context, _, _, value string, _ time.Duration) error {
+			challenge = value
+			return nil
+		})
+
+	resp, err := s.SignIn(ctx, &models.UserReq{Email: email, Password: "sumit@kumar", Scope: "profile"})
+	require.NoError(t, err)
+	assert.Equal(t, userID+" profile", challenge)
+
+	mockStore.EXPECT().GetOneTimeToken(ctx, purposeMFAChallenge, gomock.Any()).Return(challenge, nil)
+	mockStore.EXPECT().IncrCounter(ctx, gomock.Any(), s.Config.MFAChallengeTTL).Return(int64(1), nil)
+	mockStore.EXPECT().GetUserByID(ctx, userID).Return(user, nil)
+	mockStore.EXPECT().ConsumeRecoveryCode(ctx, userID, hashRecoveryCode("abcde12345")).Return(true, nil)
+	mockStore.EXPECT().ConsumeOneTimeToken(ctx, purposeMFAChallenge, gomock.Any()).Return(challenge, nil)
+	mockStore.EXPECT().GetAccess(ctx, userID).Return(&models.Access{}, nil)
+	mockStore.EXPECT().CreateToken(ctx, email, gomock.Any()).Return(nil)
+	mockStore.EXPECT().UpdateLastLogin(ctx, userID, gomock.Any()).Return(nil)
+
+	resp, err = s.CompleteMFASignIn(ctx, &models.MFASignInReq{MFAToken: resp.MFAToken, Code: "ABCDE-12345"})
+	require.NoError(t, err)
+	assert.Equal(t, "profile", resp.Scope)
+}
+
+func TestService_refreshScope(t *testing.T) {
+	s := New(nil)
+	scopeConfig(s)
+
+	tests := []struct {
+		name      string
+		current   string
+		requested string
+		want      string
+		wantErr   error
+	}{
+		{
+			name:    "scope is kept",
+			current: "profile sessions",
+			want:    "profile sessions",
+		},
+		{
+			name:      "scope is narrowed",
+			current:   "profile sessions",
+			requested: "sessions",
+			want:      "sessions",
+		},
+		{
+			name:      "scope cannot be widened",
+			current:   "profile",
+			requested: "profile sessions",
+			wantErr:   models.ErrBadRequest(models.ErrInvalidScope),
+		},
+		{
+			name:      "pair without scope",
+			requested: "profile",
+			want:      "profile",
+		},
+		{
+			name:      "unknown scope",
+			current:   "profile",
+			requested: "write",
+			wantErr:   models.ErrBadRequest(models.ErrInvalidScope),
+		},
+	}
+
+	for i, tt := range tests {
+		got, err := s.refreshScope(tt.current, tt.requested)
+
+		assert.Equalf(t, tt.wantErr, err, "TEST[%d] Failed - %s", i, tt.name)
+		assert.Equalf(t, tt.want, got, "TEST[%d] Failed - %s", i, tt.name)
+	}
+}
@@ -4,29 +4,136 @@ import (
 	"context"
 	"errors"
 	"log/slog"
+	"time"
 
+	"auth-rest-api/internal/emailaddr"
 	"auth-rest-api/internal/models"
 	"auth-rest-api/internal/server"
 
-	"golang.org/x/crypto/bcrypt"
+	"github.com/google/uuid"
 )
 
 type Storer interface {
 	// User
 	CreateUser(ctx context.Context, u *models.UserData) error
 	GetUserByEmail(ctx context.Context, email string) (*models.UserData, error)
+	GetUserByID(ctx context.Context, id string) (*models.UserData, error)
+	UpdatePassword(ctx context.Context, id string, hash []byte) error
+	AddPasswordHistory(ctx context.Context, id string, hash []byte, keep int) error
+	GetPasswordHistory(ctx context.Context, id string) ([][]byte, error)
+	UpdateProfile(ctx context.Context, u *models.UserData) error
+	UpdateLastLogin(ctx context.Context, id string, at time.Time) error
+	ChangeEmail(ctx context.Context, id, newEmail string) error
+	RenameEmail(ctx context.Context, id, email string) error
+	MarkUserVerified(ctx context.Context, email string) error
+	SetVerified(ctx context.Context, id string, verified bool) error
+	SetStatus(ctx context.Context, id string, status models.UserStatus) error
+	ListUsers(ctx context.Context, query *models.UserQuery) (*models.UserPage, error)
+	DeleteUser(ctx context.Context, id string) error
+	// MFA
+	SaveTOTP(ctx context.Context, id string, totp *models.TOTP) error
+	SaveRecoveryCodes(ctx context.Context, id string, hashes []string) error
+	ConsumeRecoveryCode(ctx context.Context, id, hash string) (bool, error)
+	// Passkeys
+	CreatePasskey(ctx context.Context, p *models.Passkey) error
+	ListPasskeys(ctx context.Context, userID string) ([]models.Passkey, error)
+	UpdatePasskeyUsage(ctx context.Context, p *models.Passkey) error
+	// Roles and permissions
+	GetAccess(ctx context.Context, id string) (*models.Access, error)
+	GrantAccess(ctx context.Context, id string, access *models.Access) error
+	RevokeAccess(ctx context.Context, id string, access *models.Access) error
+	// Single use tokens sent by email or handed out during sign in
+	SaveOneTimeToken(ctx context.Context, purpose, id, value string, ttl time.Duration) error
+	GetOneTimeToken(ctx context.Context, purpose, id string) (string, error)
+	ConsumeOneTimeToken(ctx context.Context, purpose, id string) (string, error)
+	// Attempt counters
+	IncrCounter(ctx context.Context, name string, ttl time.Duration) (int64, error)
+	ResetCounter(ctx context.Context, names ...string) error
+	Lock(ctx context.Context, name string, d time.Duration) error
+	LockedFor(ctx context.Context, name string) (time.Duration, error)
 	// Token
 	IsTokenRevoked(ctx context.Context, tokenID string) (bool, error)
 	CreateToken(ctx context.Context, email string, td *models.TokenData) error
 	DeleteToken(ctx context.Context, tokenID ...string) error
+	// Token family
+	GetFamily(ctx context.Context, familyID string) (*models.TokenFamily, error)
+	RevokeFamily(ctx context.Context, familyID string) error
+	ListFamilies(ctx context.Context, email string) ([]models.TokenFamily, error)
+	// Signing keys
+	GetKeyRing(ctx context.Context, name string) (*models.KeyRingState, error)
+	SaveKeyRing(ctx context.Context, name string, state *models.KeyRingState) error
+}
+
+type Mailer interface {
+	Send(ctx context.Context, mail *models.Mail) error
 }
 
 type Service struct {
-	Store Storer
+	Store  Storer
+	Keys   *Keys
+	Mailer Mailer
+	Hasher PasswordHasher
+	// Breached is optional, without it new passwords are not checked against breaches
+	Breached BreachChecker
+	// Blocklist refuses new email addresses of its domains, nil allows every domain
+	Blocklist *emailaddr.Blocklist
+	Config    Config
 }
 
-func New(s Storer) *Service {
-	return &Service{Store: s}
+type Opts func(s *Service)
+
+func New(s Storer, opts ...Opts) *Service {
+	accSecret, refSecret := getJWTSecrets()
+
+	svc := &Service{
+		Store: s,
+		Keys: NewKeys(NewKeyRing(NewHMACKey(accSecret), accessTokenTTL),
+			NewKeyRing(NewHMACKey(refSecret), refreshTokenTTL)),
+		Hasher: PasswordHasherFromEnv(),
+		Config: ConfigFromEnv(),
+	}
+
+	for _, fn := range opts {
+		fn(svc)
+	}
+
+	return svc
+}
+
+func WithKeys(k *Keys) Opts {
+	return func(s *Service) {
+		s.Keys = k
+	}
+}
+
+func WithMailer(m Mailer) Opts {
+	return func(s *Service) {
+		s.Mailer = m
+	}
+}
+
+func WithPasswordHasher(h PasswordHasher) Opts {
+	return func(s *Service) {
+		s.Hasher = h
+	}
+}
+
+func WithBreachChecker(b BreachChecker) Opts {
+	return func(s *Service) {
+		s.Breached = b
+	}
+}
+
+func WithEmailBlocklist(b *emailaddr.Blocklist) Opts {
+	return func(s *Service) {
+		s.Blocklist = b
+	}
+}
+
+func WithConfig(cfg Config) Opts {
+	return func(s *Service) {
+		s.Config = cfg
+	}
 }
 
 func (s *Service) SignUp(ctx context.Context, user *models.UserReq) error {
@@ -41,121 +148,329 @@ func (s *Service) SignUp(ctx context.Context, user *models.UserReq) error {
 		return models.ErrBadRequest(err)
 	}
 
-	exUser, err := s.Store.GetUserByEmail(ctx, user.Email)
-	if err != nil && !errors.Is(models.ErrNotFound("user"), err) {
+	email, err := s.checkNewEmail(user.Email)
+	if err != nil {
 		return err
 	}
 
-	if exUser != nil {
-		return models.ErrUserAlreadyExists
+	if err := s.checkNewPassword(ctx, email, user.Password, nil); err != nil {
+		return err
 	}
 
-	hash, err := bcrypt.GenerateFromPassword([]byte(user.Password), 10)
+	hash, err := s.Hasher.Hash(user.Password)
 	if err != nil {
 		return err
 	}
 
 	ud := models.UserData{
-		Email:    user.Email,
-		Password: hash,
+		ID:        uuid.NewString(),
+		Email:     email,
+		Password:  hash,
+		Status:    models.StatusPendingVerification,
+		CreatedAt: time.Now().UTC(),
 	}
 
+	// CreateUser claims the email atomically, of concurrent sign ups for one email only one succeeds
 	if err := s.Store.CreateUser(ctx, &ud); err != nil {
 		return err
 	}
 
+	// the user can ask for a new verification mail, a failed delivery does not undo the sign up
+	if err := s.sendVerification(ctx, ud.Email); err != nil {
+		logger.LogAttrs(ctx, slog.LevelError, "failed to send verification email", slog.String("email", ud.Email),
+			slog.String("error", err.Error()))
+	}
+
 	return nil
 }
 
-func (s *Service) SignIn(ctx context.Context, user *models.UserReq) (access, refresh string, err error) {
+// SignIn checks the password and issues a token pair. Users with MFA enabled get a challenge token
+// instead, the sign in is completed with CompleteMFASignIn.
+func (s *Service) SignIn(ctx context.Context, user *models.UserReq) (*models.UserResp, error) {
 	logger := ctx.Value(server.Logger).(*slog.Logger)
 
 	if user == nil {
 		logger.LogAttrs(ctx, slog.LevelError, "empty user struct provided")
-		return "", "", models.ErrBadRequest(models.ErrInvalid("user"))
+		return nil, models.ErrBadRequest(models.ErrInvalid("user"))
 	}
 
 	if valErr := user.Validate(); valErr != nil {
-		return "", "", models.ErrBadRequest(valErr)
+		return nil, models.ErrBadRequest(valErr)
+	}
+
+	email, err := s.normalizeEmail(user.Email)
+	if err != nil {
+		return nil, err
 	}
 
-	exUser, err := s.Store.GetUserByEmail(ctx, user.Email)
+	scope, err := s.requestedScope(user.Scope)
 	if err != nil {
-		return "", "", err
+		return nil, err
 	}
 
-	if err = bcrypt.CompareHashAndPassword(exUser.Password, []byte(user.Password)); err != nil {
+	keys := s.signInKeys(ctx, email)
+
+	if err := s.checkSignInLock(ctx, keys); err != nil {
+		return nil, err
+	}
+
+	exUser, err := s.Store.GetUserByEmail(ctx, email)
+	if err != nil {
+		// guessing emails counts like guessing passwords
+		if errors.Is(err, models.ErrNotFound("user")) {
+			if lockErr := s.countFailedSignIn(ctx, keys); lockErr != nil {
+				return nil, lockErr
+			}
+		}
+
+		return nil, err
+	}
+
+	match, err := s.Hasher.Verify(exUser.Password, user.Password)
+	if err != nil {
+		return nil, err
+	}
+
+	if !match {
 		logger.LogAttrs(ctx, slog.LevelError, "wrong password")
-		return "", "", models.ErrPsswdNotMatch
+
+		if lockErr := s.countFailedSignIn(ctx, keys); lockErr != nil {
+			return nil, lockErr
+		}
+
+		return nil, models.ErrPsswdNotMatch
 	}
 
-	tokenData, err := GenerateToken(user.Email)
+	s.resetSignInFailures(ctx, exUser.Email)
+	s.rehashPassword(ctx, exUser, user.Password)
+
+	if err := s.checkStatus(ctx, exUser); err != nil {
+		return nil, err
+	}
+
+	if exUser.MFAEnabled {
+		return s.mfaChallenge(ctx, exUser, scope)
+	}
+
+	return s.issueTokens(ctx, exUser, scope)
+}
+
+// issueTokens starts a new session for a user who completed every sign in step, scope is the checked
+// scope the client asked for
+func (s *Service) issueTokens(ctx context.Context, user *models.UserData, scope string) (*models.UserResp, error) {
+	logger := ctx.Value(server.Logger).(*slog.Logger)
+
+	if err := s.checkStatus(ctx, user); err != nil {
+		return nil, err
+	}
+
+	grant, err := s.tokenGrant(ctx, user.ID, scope)
 	if err != nil {
-		return "", "", err
+		return nil, err
 	}
 
+	// none of the requested scopes is allowed for the user
+	if scope != "" && grant.Scope == "" {
+		return nil, models.ErrBadRequest(models.ErrInvalidScope)
+	}
+
+	tokenData, err := s.Keys.GenerateToken(user.Email, user.ID, "", grant)
+	if err != nil {
+		return nil, err
+	}
+
+	tokenData.Client = clientFromContext(ctx)
+
 	if err := s.Store.CreateToken(ctx, user.Email, tokenData); err != nil {
-		return "", "", err
+		return nil, err
+	}
+
+	if err := s.Store.UpdateLastLogin(ctx, user.ID, time.Now()); err != nil {
+		logger.LogAttrs(ctx, slog.LevelError, "failed to record last login", slog.String("email", user.Email),
+			slog.String("error", err.Error()))
 	}
 
-	return tokenData.AccessToken, tokenData.RefreshToken, nil
+	return &models.UserResp{Email: user.Email, AccessToken: tokenData.AccessToken, RefreshToken: tokenData.RefreshToken,
+		Scope: grant.Scope}, nil
 }
 
-func (s *Service) RefreshToken(ctx context.Context, accessToken, refreshToken string) (access, refresh string, err error) {
+// RefreshToken rotates the token pair, the new pair keeps the scope of the old one or is narrowed to the
+// requested scope
+func (s *Service) RefreshToken(ctx context.Context, accessToken, refreshToken, scope string) (*models.UserResp, error) {
 	logger := ctx.Value(server.Logger).(*slog.Logger)
 
-	accClaims, err := ParseToken(accessToken, "access")
+	accClaims, err := s.Keys.ParseToken(accessToken, "access")
 	if err != nil {
 		logger.LogAttrs(ctx, slog.LevelError, "invalid access token", slog.String("token", accessToken), slog.String("error", err.Error()))
-		return "", "", err
+		return nil, err
 	}
 
-	refClaims, err := ParseToken(refreshToken, "refresh")
+	refClaims, err := s.Keys.ParseToken(refreshToken, "refresh")
 	if err != nil {
 		logger.LogAttrs(ctx, slog.LevelError, "invalid refresh token", slog.String("token", refreshToken), slog.String("error", err.Error()))
-		return "", "", err
+		return nil, err
+	}
+
+	if accClaims.FamilyID != refClaims.FamilyID {
+		return nil, models.ErrInvalid("token pair")
+	}
+
+	// tokens issued before families were introduced carry no family ID and are rotated into a new one
+	if refClaims.FamilyID != "" {
+		if err = s.checkFamily(ctx, refClaims); err != nil {
+			return nil, err
+		}
+	}
+
+	scope, err = s.refreshScope(refClaims.Scope, scope)
+	if err != nil {
+		return nil, err
 	}
 
 	// check if token is revoked
 	isRevoked, err := s.Store.IsTokenRevoked(ctx, accClaims.ClaimUID)
 	if err != nil {
-		return "", "", err
+		return nil, err
 	}
 
 	if isRevoked {
-		return "", "", models.ErrTokenRevoked
+		return nil, models.ErrTokenRevoked
 	}
 
-	// Deleting old active tokens
+	// a disabled or locked user keeps no session, not even one the revocation missed
+	user, err := s.currentUser(ctx, accClaims)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound("user")) {
+			return nil, models.ErrTokenRevoked
+		}
+
+		return nil, err
+	}
+
+	if err := s.checkStatus(ctx, user); err != nil {
+		return nil, err
+	}
+
+	// roles and permissions are read again so changes apply with the next refresh
+	grant := &TokenGrant{Scope: scope}
+
+	if accClaims.UserID != "" {
+		if grant, err = s.tokenGrant(ctx, accClaims.UserID, scope); err != nil {
+			return nil, err
+		}
+	}
+
+	// the user lost every scope of the pair
+	if scope != "" && grant.Scope == "" {
+		return nil, models.ErrBadRequest(models.ErrInvalidScope)
+	}
+
+	// Deleting old active tokens, when two requests race with the same refresh token only one of them deletes it
 	if delErr := s.Store.DeleteToken(ctx, accClaims.ClaimUID, refClaims.ClaimUID); delErr != nil {
-		return "", "", delErr
+		return nil, delErr
 	}
 
-	td, err := GenerateToken(accClaims.Email)
+	td, err := s.Keys.GenerateToken(accClaims.Email, accClaims.UserID, refClaims.FamilyID, grant)
 	if err != nil {
-		return "", "", err
+		return nil, err
 	}
 
+	td.Client = clientFromContext(ctx)
+
 	// store the newly generated tokens UIDs
 	if err := s.Store.CreateToken(ctx, accClaims.Email, td); err != nil {
-		return "", "", err
+		return nil, err
 	}
 
-	return td.AccessToken, td.RefreshToken, nil
+	return &models.UserResp{AccessToken: td.AccessToken, RefreshToken: td.RefreshToken, Scope: grant.Scope}, nil
 }
 
-func (s *Service) RevokeToken(ctx context.Context, token string) error {
+// checkFamily makes sure the refresh token is the latest one of its family. Presenting a refresh token
+// that was already rotated means it was copied, so the whole family is revoked.
+func (s *Service) checkFamily(ctx context.Context, refClaims *Claims) error {
 	logger := ctx.Value(server.Logger).(*slog.Logger)
 
-	accClaims, err := ParseToken(token, "access")
+	family, err := s.Store.GetFamily(ctx, refClaims.FamilyID)
 	if err != nil {
-		logger.LogAttrs(ctx, slog.LevelError, "invalid access token", slog.String("token", token), slog.String("error", err.Error()))
+		if errors.Is(err, models.ErrNotFound("token family")) {
+			return models.ErrTokenRevoked
+		}
+
 		return err
 	}
 
-	if delErr := s.Store.DeleteToken(ctx, accClaims.ClaimUID); delErr != nil {
-		return delErr
+	if family.RefreshID == refClaims.ClaimUID {
+		return nil
+	}
+
+	logger.LogAttrs(ctx, slog.LevelWarn, "security event: refresh token reuse detected, revoking token family",
+		slog.String("event", "refresh_token_reuse"), slog.String("family", family.ID),
+		slog.String("email", family.Email), slog.String("refreshID", refClaims.ClaimUID))
+
+	if err := s.Store.RevokeFamily(ctx, family.ID); err != nil {
+		return err
 	}
 
+	return models.ErrRefreshTokenReuse
+}
+
+// RevokeToken revokes an access or refresh token (RFC 7009) together with its paired token by
+// revoking the token family. Invalid or already revoked tokens are not an error.
+func (s *Service) RevokeToken(ctx context.Context, token, tokenTypeHint string) error {
+	logger := ctx.Value(server.Logger).(*slog.Logger)
+
+	order := []string{models.TokenTypeAccess, models.TokenTypeRefresh}
+	if tokenTypeHint == models.TokenTypeRefresh {
+		order = []string{models.TokenTypeRefresh, models.TokenTypeAccess}
+	}
+
+	var claims *Claims
+
+	for _, tokenType := range order {
+		if c, err := s.Keys.ParseToken(token, parseType(tokenType)); err == nil {
+			claims = c
+			break
+		}
+	}
+
+	if claims == nil {
+		logger.LogAttrs(ctx, slog.LevelInfo, "ignoring revocation of invalid token")
+		return nil
+	}
+
+	// tokens issued before families were introduced only know their own ID
+	if claims.FamilyID == "" {
+		err := s.Store.DeleteToken(ctx, claims.ClaimUID)
+		if err != nil && !errors.Is(err, models.NewConstError("delete error")) {
+			return err
+		}
+
+		return nil
+	}
+
+	if err := s.Store.RevokeFamily(ctx, claims.FamilyID); err != nil && !errors.Is(err, models.ErrNotFound("token family")) {
+		return err
+	}
+
+	return nil
+}
+
+// JWKS returns the public keys used to sign access tokens
+func (s *Service) JWKS(_ context.Context) *models.JWKSet {
+	return s.Keys.JWKS()
+}
+
+// RotateKeys generates new signing keys, they sign once every process had the time to sync them and
+// tokens signed with the previous keys stay valid until they expire
+func (s *Service) RotateKeys(ctx context.Context) error {
+	logger := ctx.Value(server.Logger).(*slog.Logger)
+
+	if err := s.Keys.Rotate(ctx); err != nil {
+		return err
+	}
+
+	logger.LogAttrs(ctx, slog.LevelInfo, "signing keys rotated",
+		slog.String("accessKid", s.Keys.Access.newest().ID), slog.String("refreshKid", s.Keys.Refresh.newest().ID))
+
 	return nil
 }
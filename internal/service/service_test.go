@@ -0,0 +1,243 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"auth-rest-api/internal/models"
+	"auth-rest-api/internal/server"
+	"auth-rest-api/internal/store"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/golang/mock/gomock"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testContext() context.Context {
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+
+	return context.WithValue(context.Background(), server.Logger, logger)
+}
+
+func TestService_RefreshToken(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStore := NewMockStorer(ctrl)
+	s := New(mockStore)
+	ctx := testContext()
+
+	current, err := s.Keys.GenerateToken(email, "", "", nil)
+	require.NoError(t, err)
+
+	rotated, err := s.Keys.GenerateToken(email, "", current.FamilyID, nil)
+	require.NoError(t, err)
+
+	family := &models.TokenFamily{ID: current.FamilyID, Email: email, AccessID: rotated.AccessID, RefreshID: rotated.RefreshID}
+
+	tests := []struct {
+		name     string
+		access   string
+		refresh  string
+		mockCall func()
+		wantErr  error
+	}{
+		{
+			name:    "valid case",
+			access:  rotated.AccessToken,
+			refresh: rotated.RefreshToken,
+			mockCall: func() {
+				mockStore.EXPECT().GetFamily(ctx, current.FamilyID).Return(family, nil)
+				mockStore.EXPECT().IsTokenRevoked(ctx, rotated.AccessID).Return(false, nil)
+				mockStore.EXPECT().GetUserByEmail(ctx, email).Return(&models.UserData{Email: email, Status: models.StatusActive}, nil)
+				mockStore.EXPECT().DeleteToken(ctx, rotated.AccessID, rotated.RefreshID).Return(nil)
+				mockStore.EXPECT().CreateToken(ctx, email, gomock.Any()).DoAndReturn(
+					func(_ context.Context, _ string, td *models.TokenData) error {
+						assert.Equal(t, current.FamilyID, td.FamilyID)
+						return nil
+					})
+			},
+		},
+		{
+			name:    "rotated refresh token reused",
+			access:  current.AccessToken,
+			refresh: current.RefreshToken,
+			mockCall: func() {
+				mockStore.EXPECT().GetFamily(ctx, current.FamilyID).Return(family, nil)
+				mockStore.EXPECT().RevokeFamily(ctx, current.FamilyID).Return(nil)
+			},
+			wantErr: models.ErrRefreshTokenReuse,
+		},
+		{
+			name:    "family revoked",
+			access:  rotated.AccessToken,
+			refresh: rotated.RefreshToken,
+			mockCall: func() {
+				mockStore.EXPECT().GetFamily(ctx, current.FamilyID).Return(nil, models.ErrNotFound("token family"))
+			},
+			wantErr: models.ErrTokenRevoked,
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockCall()
+
+			_, err := s.RefreshToken(ctx, tt.access, tt.refresh, "")
+			assert.Equalf(t, tt.wantErr, err, "TEST[%d] Failed - %s", i, tt.name)
+		})
+	}
+}
+
+func TestService_RevokeToken(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStore := NewMockStorer(ctrl)
+	s := New(mockStore)
+	ctx := testContext()
+
+	td, err := s.Keys.GenerateToken(email, "", "", nil)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		token    string
+		hint     string
+		mockCall func()
+		wantErr  error
+	}{
+		{
+			name:  "access token revokes its family",
+			token: td.AccessToken,
+			mockCall: func() {
+				mockStore.EXPECT().RevokeFamily(ctx, td.FamilyID).Return(nil)
+			},
+		},
+		{
+			name:  "refresh token revokes its family",
+			token: td.RefreshToken,
+			hint:  models.TokenTypeRefresh,
+			mockCall: func() {
+				mockStore.EXPECT().RevokeFamily(ctx, td.FamilyID).Return(nil)
+			},
+		},
+		{
+			name:  "refresh token with wrong hint",
+			token: td.RefreshToken,
+			hint:  models.TokenTypeAccess,
+			mockCall: func() {
+				mockStore.EXPECT().RevokeFamily(ctx, td.FamilyID).Return(nil)
+			},
+		},
+		{
+			name:  "already revoked",
+			token: td.AccessToken,
+			mockCall: func() {
+				mockStore.EXPECT().RevokeFamily(ctx, td.FamilyID).Return(models.ErrNotFound("token family"))
+			},
+		},
+		{
+			name:     "invalid token",
+			token:    "not-a-token",
+			mockCall: func() {},
+		},
+		{
+			name:  "store error",
+			token: td.AccessToken,
+			mockCall: func() {
+				mockStore.EXPECT().RevokeFamily(ctx, td.FamilyID).Return(models.ErrDBNotConnected)
+			},
+			wantErr: models.ErrDBNotConnected,
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockCall()
+
+			assert.Equalf(t, tt.wantErr, s.RevokeToken(ctx, tt.token, tt.hint), "TEST[%d] Failed - %s", i, tt.name)
+		})
+	}
+}
+
+func TestService_SignUpConcurrent(t *testing.T) {
+	mr := miniredis.RunT(t)
+	st := store.New(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	s := New(st, WithPasswordHasher(testHasher))
+	ctx := testContext()
+
+	const n = 20
+
+	var (
+		wg        sync.WaitGroup
+		created   atomic.Int32
+		conflicts atomic.Int32
+	)
+
+	start := make(chan struct{})
+
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+			<-start
+
+			err := s.SignUp(ctx, &models.UserReq{Email: email, Password: fmt.Sprintf("password-%02d", i)})
+
+			switch {
+			case err == nil:
+				created.Add(1)
+			case errors.Is(err, models.ErrUserAlreadyExists):
+				conflicts.Add(1)
+			default:
+				t.Errorf("unexpected sign up error: %v", err)
+			}
+		}(i)
+	}
+
+	close(start)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), created.Load())
+	assert.Equal(t, int32(n-1), conflicts.Load())
+
+	// the index and the record agree on the one user, its password is the one of the winning sign up
+	user, err := st.GetUserByEmail(ctx, email)
+	require.NoError(t, err)
+	assert.Equal(t, email, user.Email)
+
+	emails, err := mr.HKeys("users")
+	require.NoError(t, err)
+	assert.Equal(t, []string{email}, emails)
+
+	var records int
+
+	for _, key := range mr.Keys() {
+		if strings.HasPrefix(key, "user:") {
+			records++
+		}
+	}
+
+	assert.Equal(t, 1, records)
+
+	matches := 0
+
+	for i := 0; i < n; i++ {
+		if ok, _ := testHasher.Verify(user.Password, fmt.Sprintf("password-%02d", i)); ok {
+			matches++
+		}
+	}
+
+	assert.Equal(t, 1, matches)
+}
@@ -0,0 +1,183 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sort"
+	"time"
+
+	"auth-rest-api/internal/models"
+	"auth-rest-api/internal/server"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// VerifyAccessToken is the server.TokenVerifier for the auth middleware, with Config.CheckAccountStatus
+// it also rejects revoked tokens and tokens of disabled or locked users
+func (s *Service) VerifyAccessToken(ctx context.Context, token string) (jwt.Claims, error) {
+	claims, err := s.Keys.ParseToken(token, "access")
+	if err != nil {
+		return nil, err
+	}
+
+	if !s.Config.CheckAccountStatus {
+		return claims, nil
+	}
+
+	revoked, err := s.Store.IsTokenRevoked(ctx, claims.ClaimUID)
+	if err != nil {
+		return nil, err
+	}
+
+	if revoked {
+		return nil, models.ErrTokenRevoked
+	}
+
+	user, err := s.currentUser(ctx, claims)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.checkStatus(ctx, user); err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+// ListSessions returns the sessions of the authenticated user, newest first
+func (s *Service) ListSessions(ctx context.Context) ([]models.Session, error) {
+	claims, err := claimsFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	families, err := s.Store.ListFamilies(ctx, claims.Email)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := make([]models.Session, 0, len(families))
+
+	for i := range families {
+		f := &families[i]
+
+		sessions = append(sessions, models.Session{
+			ID:              f.ID,
+			UserAgent:       f.Client.UserAgent,
+			IP:              f.Client.IP,
+			CreatedAt:       time.Unix(f.CreatedAt, 0).UTC(),
+			LastRefreshedAt: time.Unix(f.RefreshedAt, 0).UTC(),
+			Current:         f.ID == claims.FamilyID,
+		})
+	}
+
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].CreatedAt.After(sessions[j].CreatedAt) })
+
+	return sessions, nil
+}
+
+// RevokeSession logs out one session of the authenticated user
+func (s *Service) RevokeSession(ctx context.Context, sessionID string) error {
+	logger := ctx.Value(server.Logger).(*slog.Logger)
+
+	claims, err := claimsFromContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	family, err := s.Store.GetFamily(ctx, sessionID)
+	if err != nil {
+		return notFoundAs(err, "token family", "session")
+	}
+
+	// sessions of other users are reported as missing
+	if family.Email != claims.Email {
+		return models.ErrNotFound("session")
+	}
+
+	if err := s.Store.RevokeFamily(ctx, sessionID); err != nil {
+		return notFoundAs(err, "token family", "session")
+	}
+
+	logger.LogAttrs(ctx, slog.LevelInfo, "session revoked", slog.String("email", claims.Email), slog.String("session", sessionID))
+
+	return nil
+}
+
+// RevokeAllSessions logs the authenticated user out everywhere, including the current session
+func (s *Service) RevokeAllSessions(ctx context.Context) error {
+	claims, err := claimsFromContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	return s.revokeUserSessions(ctx, claims.Email, "")
+}
+
+// revokeUserSessions logs the user out of every session except keepFamilyID, which may be empty
+func (s *Service) revokeUserSessions(ctx context.Context, email, keepFamilyID string) error {
+	logger := ctx.Value(server.Logger).(*slog.Logger)
+
+	families, err := s.Store.ListFamilies(ctx, email)
+	if err != nil {
+		return err
+	}
+
+	revoked := 0
+
+	for i := range families {
+		if families[i].ID == keepFamilyID {
+			continue
+		}
+
+		// the session may have expired or been revoked in the meantime
+		if err := s.Store.RevokeFamily(ctx, families[i].ID); err != nil && !errors.Is(err, models.ErrNotFound("token family")) {
+			return err
+		}
+
+		revoked++
+	}
+
+	logger.LogAttrs(ctx, slog.LevelInfo, "sessions revoked", slog.String("email", email), slog.String("kept", keepFamilyID),
+		slog.Int("count", revoked))
+
+	return nil
+}
+
+// notFoundAs reports a missing store entity under the name the caller knows it by
+func notFoundAs(err error, from, to string) error {
+	if errors.Is(err, models.ErrNotFound(from)) {
+		return models.ErrNotFound(to)
+	}
+
+	return err
+}
+
+// claimsFromContext returns the access token claims stored by server.AuthMiddleware
+func claimsFromContext(ctx context.Context) (*Claims, error) {
+	claims, ok := ctx.Value(server.Claims).(*Claims)
+	if !ok || claims == nil {
+		return nil, models.ErrRequired("access token")
+	}
+
+	return claims, nil
+}
+
+// loggerFromContext returns the request logger stored by server.AddCorrelation. Code reached from
+// server.AuthMiddleware runs before AddCorrelation in Chain and falls back to the default logger.
+func loggerFromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(server.Logger).(*slog.Logger); ok && logger != nil {
+		return logger
+	}
+
+	return slog.Default()
+}
+
+// clientFromContext returns the caller details stored by server.AddCorrelation
+func clientFromContext(ctx context.Context) models.ClientInfo {
+	client, _ := ctx.Value(server.Client).(models.ClientInfo)
+
+	return client
+}
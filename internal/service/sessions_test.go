@@ -0,0 +1,88 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"auth-rest-api/internal/models"
+	"auth-rest-api/internal/server"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_ListSessions(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStore := NewMockStorer(ctrl)
+	s := New(mockStore)
+	ctx := context.WithValue(testContext(), server.Claims, &Claims{Email: email, FamilyID: "current"})
+
+	mockStore.EXPECT().ListFamilies(ctx, email).Return([]models.TokenFamily{
+		{ID: "old", Email: email, Client: models.ClientInfo{IP: "10.0.0.1", UserAgent: "firefox"}, CreatedAt: 100, RefreshedAt: 200},
+		{ID: "current", Email: email, Client: models.ClientInfo{IP: "10.0.0.2", UserAgent: "curl"}, CreatedAt: 300, RefreshedAt: 300},
+	}, nil)
+
+	got, err := s.ListSessions(ctx)
+	require.NoError(t, err)
+
+	assert.Equal(t, []models.Session{
+		{ID: "current", UserAgent: "curl", IP: "10.0.0.2", CreatedAt: time.Unix(300, 0).UTC(), LastRefreshedAt: time.Unix(300, 0).UTC(), Current: true},
+		{ID: "old", UserAgent: "firefox", IP: "10.0.0.1", CreatedAt: time.Unix(100, 0).UTC(), LastRefreshedAt: time.Unix(200, 0).UTC()},
+	}, got)
+
+	_, err = s.ListSessions(testContext())
+	assert.Equal(t, models.ErrRequired("access token"), err)
+}
+
+func TestService_RevokeSession(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStore := NewMockStorer(ctrl)
+	s := New(mockStore)
+	ctx := context.WithValue(testContext(), server.Claims, &Claims{Email: email, FamilyID: "current"})
+
+	tests := []struct {
+		name     string
+		id       string
+		mockCall func()
+		wantErr  error
+	}{
+		{
+			name: "valid case",
+			id:   "old",
+			mockCall: func() {
+				mockStore.EXPECT().GetFamily(ctx, "old").Return(&models.TokenFamily{ID: "old", Email: email}, nil)
+				mockStore.EXPECT().RevokeFamily(ctx, "old").Return(nil)
+			},
+		},
+		{
+			name: "session of another user",
+			id:   "other",
+			mockCall: func() {
+				mockStore.EXPECT().GetFamily(ctx, "other").Return(&models.TokenFamily{ID: "other", Email: "other@example.com"}, nil)
+			},
+			wantErr: models.ErrNotFound("session"),
+		},
+		{
+			name: "unknown session",
+			id:   "missing",
+			mockCall: func() {
+				mockStore.EXPECT().GetFamily(ctx, "missing").Return(nil, models.ErrNotFound("token family"))
+			},
+			wantErr: models.ErrNotFound("session"),
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockCall()
+
+			assert.Equalf(t, tt.wantErr, s.RevokeSession(ctx, tt.id), "TEST[%d] Failed - %s", i, tt.name)
+		})
+	}
+}
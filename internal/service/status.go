@@ -0,0 +1,34 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+
+	"auth-rest-api/internal/models"
+)
+
+// checkStatus tells whether the user may get tokens, accounts pending verification only sign in while
+// verified emails are not required
+func (s *Service) checkStatus(ctx context.Context, user *models.UserData) error {
+	logger := loggerFromContext(ctx)
+
+	var err error
+
+	switch user.Status {
+	case models.StatusDisabled:
+		err = models.ErrAccountDisabled
+	case models.StatusLocked:
+		err = models.ErrAccountLocked
+	case models.StatusPendingVerification:
+		if s.Config.RequireVerifiedEmail {
+			err = models.ErrEmailNotVerified
+		}
+	}
+
+	if err != nil {
+		logger.LogAttrs(ctx, slog.LevelInfo, "access blocked by account status", slog.String("user", user.ID),
+			slog.String("status", string(user.Status)))
+	}
+
+	return err
+}
@@ -0,0 +1,157 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"auth-rest-api/internal/models"
+	"auth-rest-api/internal/server"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_checkStatus(t *testing.T) {
+	s := New(nil)
+	ctx := testContext()
+
+	tests := []struct {
+		name            string
+		status          models.UserStatus
+		requireVerified bool
+		wantErr         error
+	}{
+		{name: "active", status: models.StatusActive},
+		{name: "disabled", status: models.StatusDisabled, wantErr: models.ErrAccountDisabled},
+		{name: "locked", status: models.StatusLocked, wantErr: models.ErrAccountLocked},
+		{name: "pending verification", status: models.StatusPendingVerification},
+		{name: "pending verification, verified email required", status: models.StatusPendingVerification, requireVerified: true,
+			wantErr: models.ErrEmailNotVerified},
+	}
+
+	for i, tt := range tests {
+		s.Config.RequireVerifiedEmail = tt.requireVerified
+
+		err := s.checkStatus(ctx, &models.UserData{ID: userID, Status: tt.status})
+		assert.Equalf(t, tt.wantErr, err, "TEST[%d] Failed - %s", i, tt.name)
+	}
+}
+
+func TestService_RefreshTokenDisabledUser(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStore := NewMockStorer(ctrl)
+	s := New(mockStore)
+	ctx := testContext()
+
+	td, err := s.Keys.GenerateToken(email, userID, "", nil)
+	require.NoError(t, err)
+
+	mockStore.EXPECT().GetFamily(ctx, td.FamilyID).Return(&models.TokenFamily{ID: td.FamilyID, RefreshID: td.RefreshID}, nil).Times(2)
+	mockStore.EXPECT().IsTokenRevoked(ctx, td.AccessID).Return(false, nil).Times(2)
+	mockStore.EXPECT().GetUserByID(ctx, userID).Return(&models.UserData{ID: userID, Status: models.StatusDisabled}, nil)
+	mockStore.EXPECT().GetUserByID(ctx, userID).Return(nil, models.ErrNotFound("user"))
+
+	_, err = s.RefreshToken(ctx, td.AccessToken, td.RefreshToken, "")
+	assert.Equal(t, models.ErrAccountDisabled, err)
+
+	// a deleted user has no session left
+	_, err = s.RefreshToken(ctx, td.AccessToken, td.RefreshToken, "")
+	assert.Equal(t, models.ErrTokenRevoked, err)
+}
+
+func TestService_VerifyAccessTokenStatus(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStore := NewMockStorer(ctrl)
+	s := New(mockStore)
+	ctx := testContext()
+
+	td, err := s.Keys.GenerateToken(email, userID, "", nil)
+	require.NoError(t, err)
+
+	// without the check only the signature and expiry count
+	_, err = s.VerifyAccessToken(ctx, td.AccessToken)
+	assert.NoError(t, err)
+
+	s.Config.CheckAccountStatus = true
+
+	tests := []struct {
+		name     string
+		mockCall func()
+		wantErr  error
+	}{
+		{
+			name: "active user",
+			mockCall: func() {
+				mockStore.EXPECT().IsTokenRevoked(ctx, td.AccessID).Return(false, nil)
+				mockStore.EXPECT().GetUserByID(ctx, userID).Return(&models.UserData{ID: userID, Status: models.StatusActive}, nil)
+			},
+		},
+		{
+			name:     "revoked token",
+			mockCall: func() { mockStore.EXPECT().IsTokenRevoked(ctx, td.AccessID).Return(true, nil) },
+			wantErr:  models.ErrTokenRevoked,
+		},
+		{
+			name: "locked user",
+			mockCall: func() {
+				mockStore.EXPECT().IsTokenRevoked(ctx, td.AccessID).Return(false, nil)
+				mockStore.EXPECT().GetUserByID(ctx, userID).Return(&models.UserData{ID: userID, Status: models.StatusLocked}, nil)
+			},
+			wantErr: models.ErrAccountLocked,
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockCall()
+
+			_, err := s.VerifyAccessToken(ctx, td.AccessToken)
+			assert.Equalf(t, tt.wantErr, err, "TEST[%d] Failed - %s", i, tt.name)
+		})
+	}
+}
+
+// the routes of cmd/main.go list AuthMiddleware last, it runs before AddCorrelation stored the logger
+func TestService_VerifyAccessTokenMiddleware(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStore := NewMockStorer(ctrl)
+	s := New(mockStore)
+	s.Config.CheckAccountStatus = true
+
+	td, err := s.Keys.GenerateToken(email, userID, "", nil)
+	require.NoError(t, err)
+
+	handler := server.Chain(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}, server.AddCorrelation(), server.AuthMiddleware(s.VerifyAccessToken))
+
+	tests := []struct {
+		name    string
+		status  models.UserStatus
+		expCode int
+	}{
+		{name: "active user", status: models.StatusActive, expCode: http.StatusOK},
+		{name: "disabled user", status: models.StatusDisabled, expCode: http.StatusUnauthorized},
+		{name: "locked user", status: models.StatusLocked, expCode: http.StatusUnauthorized},
+	}
+
+	for i, tt := range tests {
+		mockStore.EXPECT().IsTokenRevoked(gomock.Any(), td.AccessID).Return(false, nil)
+		mockStore.EXPECT().GetUserByID(gomock.Any(), userID).Return(&models.UserData{ID: userID, Status: tt.status}, nil)
+
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/me", http.NoBody)
+		r.Header.Set("Authorization", "Bearer "+td.AccessToken)
+
+		require.NotPanicsf(t, func() { handler(w, r) }, "TEST[%d] Failed - %s", i, tt.name)
+		assert.Equalf(t, tt.expCode, w.Code, "TEST[%d] Failed - %s", i, tt.name)
+	}
+}
@@ -0,0 +1,66 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// base32 of the RFC 6238 SHA-1 test seed "12345678901234567890"
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func Test_totpCode(t *testing.T) {
+	// RFC 6238 appendix B, truncated to 6 digits
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{unix: 59, want: "287082"},
+		{unix: 1111111109, want: "081804"},
+		{unix: 1234567890, want: "005924"},
+		{unix: 2000000000, want: "279037"},
+	}
+
+	for i, tt := range tests {
+		got, err := totpCode(rfcSecret, tt.unix/totpPeriod)
+		require.NoError(t, err)
+
+		assert.Equalf(t, tt.want, got, "TEST[%d] Failed - %d", i, tt.unix)
+	}
+}
+
+func Test_verifyTOTP(t *testing.T) {
+	now := time.Unix(1111111109, 0)
+	step := now.Unix() / totpPeriod
+
+	previous, err := totpCode(rfcSecret, step-1)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		code     string
+		lastStep int64
+		wantStep int64
+		wantOK   bool
+	}{
+		{name: "current code", code: "081804", wantStep: step, wantOK: true},
+		{name: "previous step within skew", code: previous, wantStep: step - 1, wantOK: true},
+		{name: "replayed code", code: "081804", lastStep: step},
+		{name: "wrong code", code: "000000"},
+		{name: "wrong length", code: "81804"},
+	}
+
+	for i, tt := range tests {
+		gotStep, ok := verifyTOTP(rfcSecret, tt.code, now, tt.lastStep)
+
+		assert.Equalf(t, tt.wantOK, ok, "TEST[%d] Failed - %s", i, tt.name)
+		assert.Equalf(t, tt.wantStep, gotStep, "TEST[%d] Failed - %s", i, tt.name)
+	}
+}
+
+func Test_totpURI(t *testing.T) {
+	assert.Equal(t, "otpauth://totp/auth-rest-api:sumit@kumar.com?algorithm=SHA1&digits=6&issuer=auth-rest-api&period=30&secret="+rfcSecret,
+		totpURI("auth-rest-api", "sumit@kumar.com", rfcSecret))
+}
@@ -0,0 +1,91 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+
+	"auth-rest-api/internal/models"
+	"auth-rest-api/internal/server"
+)
+
+// VerifyEmail marks the owner of a verification token as verified, every token works once
+func (s *Service) VerifyEmail(ctx context.Context, token string) error {
+	logger := ctx.Value(server.Logger).(*slog.Logger)
+
+	email, err := s.consumeOneTimeToken(ctx, purposeVerifyEmail, token)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalid("token")) {
+			return models.ErrBadRequest(models.ErrInvalid("verification token"))
+		}
+
+		return err
+	}
+
+	if err := s.Store.MarkUserVerified(ctx, email); err != nil {
+		return err
+	}
+
+	logger.LogAttrs(ctx, slog.LevelInfo, "email verified", slog.String("email", email))
+
+	return nil
+}
+
+// ResendVerification sends a new verification email. Unknown and already verified addresses are
+// silently ignored so the endpoint does not reveal which accounts exist.
+func (s *Service) ResendVerification(ctx context.Context, email string) error {
+	logger := ctx.Value(server.Logger).(*slog.Logger)
+
+	email, err := s.normalizeEmail(email)
+	if err != nil {
+		return err
+	}
+
+	user, err := s.Store.GetUserByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound("user")) {
+			logger.LogAttrs(ctx, slog.LevelInfo, "verification requested for unknown email", slog.String("email", email))
+			return nil
+		}
+
+		return err
+	}
+
+	if user.Verified {
+		return nil
+	}
+
+	return s.sendVerification(ctx, user.Email)
+}
+
+func (s *Service) sendVerification(ctx context.Context, email string) error {
+	token, err := s.issueOneTimeToken(ctx, purposeVerifyEmail, email, s.Config.VerificationTTL)
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/verify-email?token=%s", s.Config.AppURL, url.QueryEscape(token))
+
+	return s.sendMail(ctx, &models.Mail{
+		To:      email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Confirm your email address by opening the link below, it expires in %s.\n\n%s\n\nVerification token: %s\n",
+			s.Config.VerificationTTL, link, token),
+	})
+}
+
+// sendMail delivers mail through the configured mailer, without one the mail is only logged
+func (s *Service) sendMail(ctx context.Context, mail *models.Mail) error {
+	logger := ctx.Value(server.Logger).(*slog.Logger)
+
+	if s.Mailer == nil {
+		logger.LogAttrs(ctx, slog.LevelWarn, "no mailer configured, dropping mail",
+			slog.String("to", mail.To), slog.String("subject", mail.Subject))
+
+		return nil
+	}
+
+	return s.Mailer.Send(ctx, mail)
+}
@@ -0,0 +1,107 @@
+package service
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"auth-rest-api/internal/models"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var tokenRe = regexp.MustCompile(`token: (\S+)`)
+
+func TestService_VerifyEmail(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStore := NewMockStorer(ctrl)
+	mockMailer := NewMockMailer(ctrl)
+	s := New(mockStore, WithMailer(mockMailer))
+	ctx := testContext()
+
+	var (
+		storedID    string
+		storedEmail string
+		token       string
+	)
+
+	mockStore.EXPECT().CreateUser(ctx, gomock.Any()).Return(nil)
+	mockStore.EXPECT().SaveOneTimeToken(ctx, purposeVerifyEmail, gomock.Any(), email, s.Config.VerificationTTL).
+		DoAndReturn(func(_ context.Context, _, id, value string, _ time.Duration) error {
+			storedID, storedEmail = id, value
+			return nil
+		})
+	mockMailer.EXPECT().Send(ctx, gomock.Any()).DoAndReturn(func(_ context.Context, mail *models.Mail) error {
+		assert.Equal(t, email, mail.To)
+
+		token = tokenRe.FindStringSubmatch(mail.Body)[1]
+
+		return nil
+	})
+
+	require.NoError(t, s.SignUp(ctx, &models.UserReq{Email: email, Password: "sumit@kumar"}))
+
+	tests := []struct {
+		name     string
+		token    string
+		mockCall func()
+		wantErr  error
+	}{
+		{
+			name:  "valid token",
+			token: token,
+			mockCall: func() {
+				mockStore.EXPECT().ConsumeOneTimeToken(ctx, purposeVerifyEmail, storedID).Return(storedEmail, nil)
+				mockStore.EXPECT().MarkUserVerified(ctx, email).Return(nil)
+			},
+		},
+		{
+			name:  "token already used",
+			token: token,
+			mockCall: func() {
+				mockStore.EXPECT().ConsumeOneTimeToken(ctx, purposeVerifyEmail, storedID).Return("", models.ErrNotFound("token"))
+			},
+			wantErr: models.ErrBadRequest(models.ErrInvalid("verification token")),
+		},
+		{
+			name:     "tampered signature",
+			token:    storedID + ".forged",
+			mockCall: func() {},
+			wantErr:  models.ErrBadRequest(models.ErrInvalid("verification token")),
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockCall()
+
+			assert.Equalf(t, tt.wantErr, s.VerifyEmail(ctx, tt.token), "TEST[%d] Failed - %s", i, tt.name)
+		})
+	}
+}
+
+func TestService_SignIn_RequireVerifiedEmail(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStore := NewMockStorer(ctrl)
+	s := New(mockStore, WithPasswordHasher(testHasher))
+	s.Config.RequireVerifiedEmail = true
+	ctx := testContext()
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("sumit@kumar"), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	expectSignInUnlocked(ctx, mockStore)
+	mockStore.EXPECT().GetUserByEmail(ctx, email).Return(&models.UserData{Email: email, Password: hash,
+		Status: models.StatusPendingVerification}, nil)
+
+	_, err = s.SignIn(ctx, &models.UserReq{Email: email, Password: "sumit@kumar"})
+	assert.Equal(t, models.ErrEmailNotVerified, err)
+}
@@ -0,0 +1,93 @@
+package store
+
+import (
+	"context"
+	"slices"
+
+	"auth-rest-api/internal/models"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	rolesPrefix       = "roles:"
+	permissionsPrefix = "permissions:"
+)
+
+// updateAccessScript adds (ARGV[1] = 1) or removes roles and permissions only while the user exists, so a
+// grant racing a DeleteUser cannot leave sets of a deleted user. ARGV[2] counts the roles that follow,
+// the rest are permissions. It returns 0 when the user does not exist.
+var updateAccessScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return 0
+end
+
+local update = 'SREM'
+if ARGV[1] == '1' then
+	update = 'SADD'
+end
+
+local roles = tonumber(ARGV[2])
+if roles > 0 then
+	redis.call(update, KEYS[2], unpack(ARGV, 3, 2 + roles))
+end
+
+if #ARGV > 2 + roles then
+	redis.call(update, KEYS[3], unpack(ARGV, 3 + roles))
+end
+
+return 1
+`)
+
+// GetAccess returns the roles and permissions assigned to the user
+func (s *Store) GetAccess(ctx context.Context, id string) (*models.Access, error) {
+	pipe := s.DB.Pipeline()
+	roles := pipe.SMembers(ctx, rolesPrefix+id)
+	permissions := pipe.SMembers(ctx, permissionsPrefix+id)
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+
+	access := &models.Access{Roles: roles.Val(), Permissions: permissions.Val()}
+	slices.Sort(access.Roles)
+	slices.Sort(access.Permissions)
+
+	return access, nil
+}
+
+// GrantAccess adds roles and permissions to an existing user
+func (s *Store) GrantAccess(ctx context.Context, id string, access *models.Access) error {
+	return s.updateAccess(ctx, id, access, true)
+}
+
+// RevokeAccess removes roles and permissions from an existing user
+func (s *Store) RevokeAccess(ctx context.Context, id string, access *models.Access) error {
+	return s.updateAccess(ctx, id, access, false)
+}
+
+func (s *Store) updateAccess(ctx context.Context, id string, access *models.Access, grant bool) error {
+	args := make([]any, 0, 2+len(access.Roles)+len(access.Permissions))
+	args = append(args, boolToInt(grant), len(access.Roles))
+
+	for _, role := range access.Roles {
+		args = append(args, role)
+	}
+
+	for _, permission := range access.Permissions {
+		args = append(args, permission)
+	}
+
+	keys := []string{userPrefix + id, rolesPrefix + id, permissionsPrefix + id}
+
+	updated, err := updateAccessScript.Run(ctx, s.DB, keys, args...).Int()
+	if err != nil {
+		return err
+	}
+
+	if updated == 0 {
+		return models.ErrNotFound("user")
+	}
+
+	return nil
+}
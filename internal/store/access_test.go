@@ -0,0 +1,94 @@
+package store
+
+import (
+	"context"
+	"testing"
+
+	"auth-rest-api/internal/models"
+
+	"github.com/go-redis/redismock/v9"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStore_GetAccess(t *testing.T) {
+	db, mock := redismock.NewClientMock()
+	s := New(db)
+	ctx := context.Background()
+	id := uuid.NewString()
+
+	mock.ExpectSMembers("roles:" + id).SetVal([]string{"support", "admin"})
+	mock.ExpectSMembers("permissions:" + id).SetVal([]string{})
+
+	got, err := s.GetAccess(ctx, id)
+
+	assert.NoError(t, err)
+	assert.Equal(t, &models.Access{Roles: []string{"admin", "support"}, Permissions: []string{}}, got)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestStore_GrantAccess(t *testing.T) {
+	db, mock := redismock.NewClientMock()
+	s := New(db)
+	ctx := context.Background()
+	id := uuid.NewString()
+	keys := []string{userPrefix + id, "roles:" + id, "permissions:" + id}
+
+	tests := []struct {
+		name     string
+		access   *models.Access
+		mockCall func()
+		wantErr  error
+	}{
+		{
+			name:   "roles and permissions",
+			access: &models.Access{Roles: []string{"admin"}, Permissions: []string{"users:read", "users:write"}},
+			mockCall: func() {
+				mock.ExpectEvalSha(updateAccessScript.Hash(), keys, 1, 1, "admin", "users:read", "users:write").SetVal(int64(1))
+			},
+		},
+		{
+			name:     "role only",
+			access:   &models.Access{Roles: []string{"admin"}},
+			mockCall: func() { mock.ExpectEvalSha(updateAccessScript.Hash(), keys, 1, 1, "admin").SetVal(int64(1)) },
+		},
+		{
+			name:     "unknown user",
+			access:   &models.Access{Roles: []string{"admin"}},
+			mockCall: func() { mock.ExpectEvalSha(updateAccessScript.Hash(), keys, 1, 1, "admin").SetVal(int64(0)) },
+			wantErr:  models.ErrNotFound("user"),
+		},
+		{
+			name:   "db error",
+			access: &models.Access{Roles: []string{"admin"}},
+			mockCall: func() {
+				mock.ExpectEvalSha(updateAccessScript.Hash(), keys, 1, 1, "admin").SetErr(models.ErrDBNotConnected)
+			},
+			wantErr: models.ErrDBNotConnected,
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockCall()
+
+			assert.Equalf(t, tt.wantErr, s.GrantAccess(ctx, id, tt.access), "TEST[%d] Failed - %s", i, tt.name)
+		})
+	}
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestStore_RevokeAccess(t *testing.T) {
+	db, mock := redismock.NewClientMock()
+	s := New(db)
+	ctx := context.Background()
+	id := uuid.NewString()
+
+	keys := []string{userPrefix + id, "roles:" + id, "permissions:" + id}
+
+	mock.ExpectEvalSha(updateAccessScript.Hash(), keys, 0, 0, "users:write").SetVal(int64(1))
+
+	assert.NoError(t, s.RevokeAccess(ctx, id, &models.Access{Permissions: []string{"users:write"}}))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,70 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+
+	"auth-rest-api/internal/models"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// keyRingPrefix holds a key ring as a hash of its version and its keys as JSON
+const keyRingPrefix = "keyring:"
+
+// saveKeyRingScript writes the key ring when the stored version is still ARGV[1], a missing ring has
+// version 0. It returns 0 when another process saved the ring in the meantime.
+var saveKeyRingScript = redis.NewScript(`
+if tonumber(redis.call('HGET', KEYS[1], 'version') or '0') ~= tonumber(ARGV[1]) then
+	return 0
+end
+
+redis.call('HSET', KEYS[1], 'version', ARGV[1] + 1, 'keys', ARGV[2])
+
+return 1
+`)
+
+// GetKeyRing returns the stored key ring, a ring that was never saved is empty with version 0
+func (s *Store) GetKeyRing(ctx context.Context, name string) (*models.KeyRingState, error) {
+	vals, err := s.DB.HGetAll(ctx, keyRingPrefix+name).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	state := &models.KeyRingState{}
+
+	if len(vals) == 0 {
+		return state, nil
+	}
+
+	if state.Version, err = strconv.ParseInt(vals["version"], 10, 64); err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal([]byte(vals["keys"]), &state.Keys); err != nil {
+		return nil, err
+	}
+
+	return state, nil
+}
+
+// SaveKeyRing stores the keys as the next version of the ring, it returns ErrKeyRingChanged when the
+// stored version is no longer state.Version
+func (s *Store) SaveKeyRing(ctx context.Context, name string, state *models.KeyRingState) error {
+	keys, err := json.Marshal(state.Keys)
+	if err != nil {
+		return err
+	}
+
+	saved, err := saveKeyRingScript.Run(ctx, s.DB, []string{keyRingPrefix + name}, state.Version, keys).Int()
+	if err != nil {
+		return err
+	}
+
+	if saved == 0 {
+		return models.ErrKeyRingChanged
+	}
+
+	return nil
+}
@@ -0,0 +1,38 @@
+package store
+
+import (
+	"context"
+	"testing"
+
+	"auth-rest-api/internal/models"
+
+	"github.com/go-redis/redismock/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStore_KeyRing(t *testing.T) {
+	db, mock := redismock.NewClientMock()
+	s := New(db)
+	ctx := context.Background()
+	keys := []string{"keyring:access"}
+	state := &models.KeyRingState{Version: 3, Keys: []models.StoredKey{{ID: "kid", Alg: "HS256", Private: []byte("secret"),
+		ActiveFrom: 1700000000000}}}
+	stored := `[{"id":"kid","alg":"HS256","private":"c2VjcmV0","activeFrom":1700000000000}]`
+
+	mock.ExpectHGetAll("keyring:access").SetVal(map[string]string{})
+	mock.ExpectHGetAll("keyring:access").SetVal(map[string]string{"version": "3", "keys": stored})
+	mock.ExpectEvalSha(saveKeyRingScript.Hash(), keys, int64(3), []byte(stored)).SetVal(int64(1))
+	mock.ExpectEvalSha(saveKeyRingScript.Hash(), keys, int64(3), []byte(stored)).SetVal(int64(0))
+
+	got, err := s.GetKeyRing(ctx, "access")
+	assert.NoError(t, err)
+	assert.Equal(t, &models.KeyRingState{}, got)
+
+	got, err = s.GetKeyRing(ctx, "access")
+	assert.NoError(t, err)
+	assert.Equal(t, state, got)
+
+	assert.NoError(t, s.SaveKeyRing(ctx, "access", state))
+	assert.Equal(t, models.ErrKeyRingChanged, s.SaveKeyRing(ctx, "access", state))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
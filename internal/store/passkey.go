@@ -0,0 +1,163 @@
+package store
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"auth-rest-api/internal/models"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	passkeyPrefix = "passkey:"
+	// userPasskeysPrefix holds the credential IDs of a user
+	userPasskeysPrefix = "passkeys:"
+)
+
+// CreatePasskey stores a new credential, a credential ID can only be registered once
+func (s *Store) CreatePasskey(ctx context.Context, p *models.Passkey) error {
+	ok, err := s.DB.HSetNX(ctx, passkeyPrefix+p.ID, "user_id", p.UserID).Result()
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		return models.ErrPasskeyExists
+	}
+
+	if _, err := s.DB.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, passkeyPrefix+p.ID, passkeyFields(p))
+		pipe.SAdd(ctx, userPasskeysPrefix+p.UserID, p.ID)
+
+		return nil
+	}); err != nil {
+		// release the credential ID again so the registration can be retried
+		s.DB.Del(ctx, passkeyPrefix+p.ID)
+
+		return err
+	}
+
+	return nil
+}
+
+// ListPasskeys returns the credentials of the user, IDs without a stored credential are dropped
+func (s *Store) ListPasskeys(ctx context.Context, userID string) ([]models.Passkey, error) {
+	ids, err := s.DB.SMembers(ctx, userPasskeysPrefix+userID).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	passkeys := make([]models.Passkey, 0, len(ids))
+
+	if len(ids) == 0 {
+		return passkeys, nil
+	}
+
+	cmds := make([]*redis.MapStringStringCmd, len(ids))
+
+	if _, err = s.DB.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, id := range ids {
+			cmds[i] = pipe.HGetAll(ctx, passkeyPrefix+id)
+		}
+
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	var missing []any
+
+	for i, cmd := range cmds {
+		if cmd.Val()["user_id"] != userID {
+			missing = append(missing, ids[i])
+			continue
+		}
+
+		passkeys = append(passkeys, *passkeyFromHash(ids[i], cmd.Val()))
+	}
+
+	if len(missing) > 0 {
+		if err := s.DB.SRem(ctx, userPasskeysPrefix+userID, missing...).Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	return passkeys, nil
+}
+
+// UpdatePasskeyUsage records the counter and flags reported by the authenticator on sign in
+func (s *Store) UpdatePasskeyUsage(ctx context.Context, p *models.Passkey) error {
+	exists, err := s.DB.Exists(ctx, passkeyPrefix+p.ID).Result()
+	if err != nil {
+		return err
+	}
+
+	if exists == 0 {
+		return models.ErrNotFound("passkey")
+	}
+
+	values := []any{"sign_count", p.SignCount, "clone_warning", boolToInt(p.CloneWarning),
+		"backup_state", boolToInt(p.BackupState)}
+
+	if p.LastUsedAt != nil {
+		values = append(values, "last_used_at", p.LastUsedAt.Unix())
+	}
+
+	return s.DB.HSet(ctx, passkeyPrefix+p.ID, values...).Err()
+}
+
+func passkeyFields(p *models.Passkey) []any {
+	fields := []any{
+		"user_id", p.UserID,
+		"name", p.Name,
+		"public_key", p.PublicKey,
+		"attestation_type", p.AttestationType,
+		"aaguid", p.AAGUID,
+		"transports", strings.Join(p.Transports, ","),
+		"sign_count", p.SignCount,
+		"clone_warning", boolToInt(p.CloneWarning),
+		"backup_eligible", boolToInt(p.BackupEligible),
+		"backup_state", boolToInt(p.BackupState),
+		"created_at", p.CreatedAt.Unix(),
+	}
+
+	if p.LastUsedAt != nil {
+		fields = append(fields, "last_used_at", p.LastUsedAt.Unix())
+	}
+
+	return fields
+}
+
+func passkeyFromHash(id string, vals map[string]string) *models.Passkey {
+	p := &models.Passkey{
+		ID:              id,
+		UserID:          vals["user_id"],
+		Name:            vals["name"],
+		PublicKey:       []byte(vals["public_key"]),
+		AttestationType: vals["attestation_type"],
+		AAGUID:          []byte(vals["aaguid"]),
+		CloneWarning:    vals["clone_warning"] == "1",
+		BackupEligible:  vals["backup_eligible"] == "1",
+		BackupState:     vals["backup_state"] == "1",
+	}
+
+	if t := vals["transports"]; t != "" {
+		p.Transports = strings.Split(t, ",")
+	}
+
+	signCount, _ := strconv.ParseUint(vals["sign_count"], 10, 32)
+	p.SignCount = uint32(signCount)
+
+	createdAt, _ := strconv.ParseInt(vals["created_at"], 10, 64)
+	p.CreatedAt = time.Unix(createdAt, 0).UTC()
+
+	if lastUsed, err := strconv.ParseInt(vals["last_used_at"], 10, 64); err == nil {
+		t := time.Unix(lastUsed, 0).UTC()
+		p.LastUsedAt = &t
+	}
+
+	return p
+}
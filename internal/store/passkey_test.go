@@ -0,0 +1,101 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"auth-rest-api/internal/models"
+
+	"github.com/go-redis/redismock/v9"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStore_CreatePasskey(t *testing.T) {
+	db, mock := redismock.NewClientMock()
+	s := New(db)
+	ctx := context.Background()
+	p := &models.Passkey{ID: "Y3JlZGVudGlhbA", UserID: uuid.NewString(), Name: "Laptop", PublicKey: []byte("key"),
+		AttestationType: "none", Transports: []string{"internal", "hybrid"}, CreatedAt: time.Unix(100, 0)}
+
+	tests := []struct {
+		name     string
+		mockCall func()
+		wantErr  error
+	}{
+		{
+			name: "valid case",
+			mockCall: func() {
+				mock.ExpectHSetNX("passkey:"+p.ID, "user_id", p.UserID).SetVal(true)
+				mock.ExpectTxPipeline()
+				mock.ExpectHSet("passkey:"+p.ID, passkeyFields(p)).SetVal(11)
+				mock.ExpectSAdd("passkeys:"+p.UserID, p.ID).SetVal(1)
+				mock.ExpectTxPipelineExec()
+			},
+		},
+		{
+			name:     "credential registered before",
+			mockCall: func() { mock.ExpectHSetNX("passkey:"+p.ID, "user_id", p.UserID).SetVal(false) },
+			wantErr:  models.ErrPasskeyExists,
+		},
+		{
+			name:     "redis error",
+			mockCall: func() { mock.ExpectHSetNX("passkey:"+p.ID, "user_id", p.UserID).SetErr(models.ErrDBNotConnected) },
+			wantErr:  models.ErrDBNotConnected,
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockCall()
+
+			assert.Equalf(t, tt.wantErr, s.CreatePasskey(ctx, p), "TEST[%d] Failed - %s", i, tt.name)
+		})
+	}
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestStore_ListPasskeys(t *testing.T) {
+	db, mock := redismock.NewClientMock()
+	s := New(db)
+	ctx := context.Background()
+	userID := uuid.NewString()
+	lastUsed := time.Unix(200, 0).UTC()
+
+	mock.ExpectSMembers("passkeys:" + userID).SetVal([]string{"a", "gone"})
+	mock.ExpectHGetAll("passkey:a").SetVal(map[string]string{
+		"user_id": userID, "name": "Laptop", "public_key": "key", "attestation_type": "none", "transports": "internal",
+		"sign_count": "7", "clone_warning": "0", "backup_eligible": "1", "backup_state": "1", "created_at": "100",
+		"last_used_at": "200",
+	})
+	mock.ExpectHGetAll("passkey:gone").SetVal(map[string]string{})
+	mock.ExpectSRem("passkeys:"+userID, "gone").SetVal(1)
+
+	got, err := s.ListPasskeys(ctx, userID)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []models.Passkey{{
+		ID: "a", UserID: userID, Name: "Laptop", PublicKey: []byte("key"), AttestationType: "none", AAGUID: []byte{},
+		Transports: []string{"internal"}, SignCount: 7, BackupEligible: true, BackupState: true,
+		CreatedAt: time.Unix(100, 0).UTC(), LastUsedAt: &lastUsed,
+	}}, got)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestStore_UpdatePasskeyUsage(t *testing.T) {
+	db, mock := redismock.NewClientMock()
+	s := New(db)
+	ctx := context.Background()
+	at := time.Unix(300, 0)
+	p := &models.Passkey{ID: "a", SignCount: 8, CloneWarning: true, LastUsedAt: &at}
+
+	mock.ExpectExists("passkey:a").SetVal(1)
+	mock.ExpectHSet("passkey:a", "sign_count", uint32(8), "clone_warning", 1, "backup_state", 0, "last_used_at", int64(300)).SetVal(0)
+	mock.ExpectExists("passkey:a").SetVal(0)
+
+	assert.NoError(t, s.UpdatePasskeyUsage(ctx, p))
+	assert.Equal(t, models.ErrNotFound("passkey"), s.UpdatePasskeyUsage(ctx, p))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,74 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+
+	"auth-rest-api/internal/models"
+)
+
+const (
+	kindRole       = "role"
+	kindPermission = "permission"
+)
+
+// GetAccess returns the roles and permissions assigned to the user
+func (s *Store) GetAccess(ctx context.Context, id string) (*models.Access, error) {
+	rows, err := s.DB.QueryContext(ctx, `SELECT kind, name FROM user_access WHERE user_id = $1 ORDER BY kind, name`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	access := &models.Access{Roles: []string{}, Permissions: []string{}}
+
+	for rows.Next() {
+		var kind, name string
+		if err := rows.Scan(&kind, &name); err != nil {
+			return nil, err
+		}
+
+		if kind == kindRole {
+			access.Roles = append(access.Roles, name)
+		} else {
+			access.Permissions = append(access.Permissions, name)
+		}
+	}
+
+	return access, rows.Err()
+}
+
+// GrantAccess adds roles and permissions to an existing user
+func (s *Store) GrantAccess(ctx context.Context, id string, access *models.Access) error {
+	return s.updateAccess(ctx, id, access, `INSERT INTO user_access (user_id, kind, name) VALUES ($1, $2, $3)
+ON CONFLICT DO NOTHING`)
+}
+
+// RevokeAccess removes roles and permissions from an existing user
+func (s *Store) RevokeAccess(ctx context.Context, id string, access *models.Access) error {
+	return s.updateAccess(ctx, id, access, `DELETE FROM user_access WHERE user_id = $1 AND kind = $2 AND name = $3`)
+}
+
+// updateAccess runs query for every role and permission, it gets the user ID, the kind and the name
+func (s *Store) updateAccess(ctx context.Context, id string, access *models.Access, query string) error {
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		var exists bool
+		if err := tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM users WHERE id = $1)`, id).Scan(&exists); err != nil {
+			return err
+		}
+
+		if !exists {
+			return models.ErrNotFound("user")
+		}
+
+		for kind, names := range map[string][]string{kindRole: access.Roles, kindPermission: access.Permissions} {
+			for _, name := range names {
+				if _, err := tx.ExecContext(ctx, query, id, kind, name); err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,48 @@
+package sqlstore
+
+import (
+	"context"
+	"encoding/json"
+
+	"auth-rest-api/internal/models"
+)
+
+// GetKeyRing returns the stored key ring, a ring that was never saved is empty with version 0
+func (s *Store) GetKeyRing(ctx context.Context, name string) (*models.KeyRingState, error) {
+	var (
+		state = &models.KeyRingState{}
+		keys  string
+	)
+
+	err := s.DB.QueryRowContext(ctx, `SELECT version, keys FROM key_rings WHERE name = $1`, name).Scan(&state.Version, &keys)
+	if err != nil {
+		if isNoRows(err) {
+			return state, nil
+		}
+
+		return nil, err
+	}
+
+	if err := json.Unmarshal([]byte(keys), &state.Keys); err != nil {
+		return nil, err
+	}
+
+	return state, nil
+}
+
+// SaveKeyRing stores the keys as the next version of the ring, it returns ErrKeyRingChanged when the
+// stored version is no longer state.Version
+func (s *Store) SaveKeyRing(ctx context.Context, name string, state *models.KeyRingState) error {
+	keys, err := json.Marshal(state.Keys)
+	if err != nil {
+		return err
+	}
+
+	if state.Version == 0 {
+		return s.execOne(ctx, models.ErrKeyRingChanged, `INSERT INTO key_rings (name, version, keys) VALUES ($1, 1, $2)
+ON CONFLICT DO NOTHING`, name, string(keys))
+	}
+
+	return s.execOne(ctx, models.ErrKeyRingChanged, `UPDATE key_rings SET version = version + 1, keys = $3
+WHERE name = $1 AND version = $2`, name, state.Version, string(keys))
+}
@@ -0,0 +1,102 @@
+-- created_at, refreshed_at and last_*_at are unix seconds like in the Redis store, expires_at is unix
+-- milliseconds so short locks and counters keep their precision
+
+CREATE TABLE users (
+	id             TEXT PRIMARY KEY,
+	email          TEXT NOT NULL UNIQUE,
+	password       BYTEA NOT NULL,
+	verified       BOOLEAN NOT NULL DEFAULT FALSE,
+	status         TEXT NOT NULL DEFAULT 'pending_verification',
+	name           TEXT NOT NULL DEFAULT '',
+	locale         TEXT NOT NULL DEFAULT '',
+	metadata       JSONB NOT NULL DEFAULT 'null',
+	created_at     BIGINT NOT NULL,
+	last_login_at  BIGINT,
+	totp_secret    TEXT NOT NULL DEFAULT '',
+	totp_enabled   BOOLEAN NOT NULL DEFAULT FALSE,
+	totp_last_step BIGINT NOT NULL DEFAULT 0
+);
+
+CREATE TABLE password_history (
+	seq     BIGSERIAL PRIMARY KEY,
+	user_id TEXT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+	hash    BYTEA NOT NULL
+);
+
+CREATE INDEX password_history_user ON password_history (user_id, seq);
+
+CREATE TABLE recovery_codes (
+	user_id TEXT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+	hash    TEXT NOT NULL,
+	PRIMARY KEY (user_id, hash)
+);
+
+-- kind is role or permission
+CREATE TABLE user_access (
+	user_id TEXT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+	kind    TEXT NOT NULL,
+	name    TEXT NOT NULL,
+	PRIMARY KEY (user_id, kind, name)
+);
+
+CREATE TABLE passkeys (
+	id               TEXT PRIMARY KEY,
+	user_id          TEXT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+	name             TEXT NOT NULL DEFAULT '',
+	public_key       BYTEA NOT NULL,
+	attestation_type TEXT NOT NULL DEFAULT '',
+	aaguid           BYTEA,
+	transports       TEXT NOT NULL DEFAULT '',
+	sign_count       BIGINT NOT NULL DEFAULT 0,
+	clone_warning    BOOLEAN NOT NULL DEFAULT FALSE,
+	backup_eligible  BOOLEAN NOT NULL DEFAULT FALSE,
+	backup_state     BOOLEAN NOT NULL DEFAULT FALSE,
+	created_at       BIGINT NOT NULL,
+	last_used_at     BIGINT
+);
+
+CREATE INDEX passkeys_user ON passkeys (user_id);
+
+-- access and refresh token IDs, a token is revoked once its row is gone
+CREATE TABLE tokens (
+	id         TEXT PRIMARY KEY,
+	email      TEXT NOT NULL,
+	expires_at BIGINT NOT NULL
+);
+
+CREATE INDEX tokens_expires ON tokens (expires_at);
+
+-- token families, one per signed in device
+CREATE TABLE sessions (
+	family_id    TEXT PRIMARY KEY,
+	email        TEXT NOT NULL,
+	access_id    TEXT NOT NULL,
+	refresh_id   TEXT NOT NULL,
+	ip           TEXT NOT NULL DEFAULT '',
+	user_agent   TEXT NOT NULL DEFAULT '',
+	created_at   BIGINT NOT NULL,
+	refreshed_at BIGINT NOT NULL,
+	expires_at   BIGINT NOT NULL
+);
+
+CREATE INDEX sessions_email ON sessions (email);
+CREATE INDEX sessions_expires ON sessions (expires_at);
+
+CREATE TABLE one_time_tokens (
+	purpose    TEXT NOT NULL,
+	id         TEXT NOT NULL,
+	value      TEXT NOT NULL,
+	expires_at BIGINT NOT NULL,
+	PRIMARY KEY (purpose, id)
+);
+
+CREATE TABLE counters (
+	name       TEXT PRIMARY KEY,
+	value      BIGINT NOT NULL,
+	expires_at BIGINT NOT NULL
+);
+
+CREATE TABLE lockouts (
+	name       TEXT PRIMARY KEY,
+	expires_at BIGINT NOT NULL
+);
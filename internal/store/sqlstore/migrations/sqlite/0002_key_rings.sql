@@ -0,0 +1,7 @@
+-- signing key rings shared by every process, keys is the JSON list of the keys with the generated private
+-- keys encrypted by the service
+CREATE TABLE key_rings (
+	name    TEXT PRIMARY KEY,
+	version INTEGER NOT NULL,
+	keys    TEXT NOT NULL
+);
@@ -0,0 +1,82 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"auth-rest-api/internal/models"
+)
+
+const passkeyColumns = `id, user_id, name, public_key, attestation_type, aaguid, transports, sign_count, clone_warning,
+	backup_eligible, backup_state, created_at, last_used_at`
+
+// CreatePasskey stores a new credential, a credential ID can only be registered once
+func (s *Store) CreatePasskey(ctx context.Context, p *models.Passkey) error {
+	return s.execOne(ctx, models.ErrPasskeyExists, `INSERT INTO passkeys (`+passkeyColumns+`)
+VALUES (`+placeholders(1, 13)+`)
+ON CONFLICT DO NOTHING`,
+		p.ID, p.UserID, p.Name, p.PublicKey, p.AttestationType, p.AAGUID, strings.Join(p.Transports, ","), int64(p.SignCount),
+		p.CloneWarning, p.BackupEligible, p.BackupState, p.CreatedAt.Unix(), unixOrNil(p.LastUsedAt))
+}
+
+// ListPasskeys returns the credentials of the user in the order they were registered
+func (s *Store) ListPasskeys(ctx context.Context, userID string) ([]models.Passkey, error) {
+	rows, err := s.DB.QueryContext(ctx, `SELECT `+passkeyColumns+` FROM passkeys WHERE user_id = $1 ORDER BY created_at, id`,
+		userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	passkeys := []models.Passkey{}
+
+	for rows.Next() {
+		var (
+			p          models.Passkey
+			transports string
+			signCount  int64
+			createdAt  int64
+			lastUsedAt sql.NullInt64
+		)
+
+		if err := rows.Scan(&p.ID, &p.UserID, &p.Name, &p.PublicKey, &p.AttestationType, &p.AAGUID, &transports, &signCount,
+			&p.CloneWarning, &p.BackupEligible, &p.BackupState, &createdAt, &lastUsedAt); err != nil {
+			return nil, err
+		}
+
+		if transports != "" {
+			p.Transports = strings.Split(transports, ",")
+		}
+
+		p.SignCount = uint32(signCount)
+		p.CreatedAt = time.Unix(createdAt, 0).UTC()
+
+		if lastUsedAt.Valid {
+			t := time.Unix(lastUsedAt.Int64, 0).UTC()
+			p.LastUsedAt = &t
+		}
+
+		passkeys = append(passkeys, p)
+	}
+
+	return passkeys, rows.Err()
+}
+
+// UpdatePasskeyUsage records the counter and flags reported by the authenticator on sign in
+func (s *Store) UpdatePasskeyUsage(ctx context.Context, p *models.Passkey) error {
+	return s.execOne(ctx, models.ErrNotFound("passkey"), `UPDATE passkeys
+SET sign_count = $2, clone_warning = $3, backup_state = $4, last_used_at = COALESCE($5, last_used_at)
+WHERE id = $1`, p.ID, int64(p.SignCount), p.CloneWarning, p.BackupState, unixOrNil(p.LastUsedAt))
+}
+
+func unixOrNil(t *time.Time) *int64 {
+	if t == nil {
+		return nil
+	}
+
+	u := t.Unix()
+
+	return &u
+}
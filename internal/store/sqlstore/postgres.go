@@ -0,0 +1,35 @@
+package sqlstore
+
+import (
+	"embed"
+	"errors"
+	"io/fs"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+//go:embed migrations/postgres/*.sql
+var postgresMigrations embed.FS
+
+// Postgres is the dialect of PostgreSQL, connections are opened with the "pgx" driver of
+// github.com/jackc/pgx/v5/stdlib
+var Postgres = Dialect{
+	Name:       "postgres",
+	migrations: mustSub(postgresMigrations, "migrations/postgres"),
+	// any constant key works as long as every replica uses the same one
+	lockMigrations: `SELECT pg_advisory_xact_lock(72100240)`,
+	isUniqueViolation: func(err error) bool {
+		var pgErr *pgconn.PgError
+
+		return errors.As(err, &pgErr) && pgErr.Code == "23505"
+	},
+}
+
+func mustSub(fsys fs.FS, dir string) fs.FS {
+	sub, err := fs.Sub(fsys, dir)
+	if err != nil {
+		panic(err)
+	}
+
+	return sub
+}
@@ -0,0 +1,29 @@
+package sqlstore
+
+import (
+	"embed"
+	"errors"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+//go:embed migrations/sqlite/*.sql
+var sqliteMigrations embed.FS
+
+// SQLite is the dialect of SQLite, connections are opened with the "sqlite" driver of modernc.org/sqlite.
+// Deleting a user relies on foreign keys, the connections need the foreign_keys pragma.
+var SQLite = Dialect{
+	Name:       "sqlite",
+	migrations: mustSub(sqliteMigrations, "migrations/sqlite"),
+	isUniqueViolation: func(err error) bool {
+		var sqliteErr *sqlite.Error
+		if !errors.As(err, &sqliteErr) {
+			return false
+		}
+
+		code := sqliteErr.Code()
+
+		return code == sqlite3.SQLITE_CONSTRAINT_UNIQUE || code == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY
+	},
+}
@@ -0,0 +1,92 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"auth-rest-api/internal/models"
+	"auth-rest-api/internal/service"
+	"auth-rest-api/internal/store/storetest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newSQLiteStore(t *testing.T) *Store {
+	t.Helper()
+
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "auth.db")+"?_pragma=foreign_keys(1)")
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	// one connection like the service opens, concurrent writers would get SQLITE_BUSY otherwise
+	db.SetMaxOpenConns(1)
+
+	s := New(db, SQLite)
+	require.NoError(t, s.Migrate(context.Background()))
+
+	return s
+}
+
+func TestSQLite_Suite(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) service.Storer {
+		return newSQLiteStore(t)
+	})
+}
+
+func TestStore_Migrate(t *testing.T) {
+	s := newSQLiteStore(t)
+	ctx := context.Background()
+
+	// a second run finds nothing to apply
+	require.NoError(t, s.Migrate(ctx))
+
+	var versions int
+	require.NoError(t, s.DB.QueryRowContext(ctx, `SELECT COUNT(*) FROM schema_migrations`).Scan(&versions))
+	assert.Equal(t, 2, versions)
+}
+
+func TestStore_PurgeExpired(t *testing.T) {
+	s := newSQLiteStore(t)
+	ctx := context.Background()
+
+	td := &models.TokenData{FamilyID: "family", AccessID: "access", AccessExpiresAt: 1, RefreshID: "refresh",
+		RefreshExpiresAt: 2}
+	require.NoError(t, s.CreateToken(ctx, "sumit@kumar.com", td))
+	require.NoError(t, s.SaveOneTimeToken(ctx, "verify", "expired", "sumit@kumar.com", -time.Second))
+	require.NoError(t, s.SaveOneTimeToken(ctx, "verify", "live", "sumit@kumar.com", time.Hour))
+	require.NoError(t, s.Lock(ctx, "sumit@kumar.com", -time.Second))
+
+	// expired rows are invisible before they are purged
+	revoked, err := s.IsTokenRevoked(ctx, "refresh")
+	require.NoError(t, err)
+	assert.True(t, revoked)
+
+	_, err = s.GetOneTimeToken(ctx, "verify", "expired")
+	assert.Equal(t, models.ErrNotFound("token"), err)
+
+	d, err := s.LockedFor(ctx, "sumit@kumar.com")
+	require.NoError(t, err)
+	assert.Zero(t, d)
+
+	require.NoError(t, s.PurgeExpired(ctx))
+
+	tests := []struct {
+		table string
+		want  int
+	}{
+		{table: "tokens", want: 0},
+		{table: "sessions", want: 0},
+		{table: "one_time_tokens", want: 1},
+		{table: "lockouts", want: 0},
+	}
+
+	for i, tt := range tests {
+		var n int
+		require.NoError(t, s.DB.QueryRowContext(ctx, `SELECT COUNT(*) FROM `+tt.table).Scan(&n))
+		assert.Equalf(t, tt.want, n, "TEST[%d] Failed - %s", i, tt.table)
+	}
+}
@@ -0,0 +1,202 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Dialect holds what differs between the supported databases, the queries themselves are written
+// in the SQL both understand
+type Dialect struct {
+	Name string
+	// migrations holds the schema versions as <version>_<name>.sql, applied in version order
+	migrations fs.FS
+	// lockMigrations keeps concurrently starting replicas from migrating at the same time, it runs
+	// inside the migration transaction
+	lockMigrations    string
+	isUniqueViolation func(error) bool
+}
+
+// Store implements service.Storer on a SQL database
+type Store struct {
+	DB      *sql.DB
+	dialect Dialect
+}
+
+func New(db *sql.DB, dialect Dialect) *Store {
+	return &Store{DB: db, dialect: dialect}
+}
+
+// Migrate brings the schema to the latest version, every migration not applied yet runs in one
+// transaction together with its entry in schema_migrations
+func (s *Store) Migrate(ctx context.Context) error {
+	names, err := fs.Glob(s.dialect.migrations, "*.sql")
+	if err != nil {
+		return err
+	}
+
+	type migration struct {
+		version int
+		name    string
+	}
+
+	migrations := make([]migration, 0, len(names))
+
+	for _, name := range names {
+		prefix, _, _ := strings.Cut(name, "_")
+
+		version, err := strconv.Atoi(prefix)
+		if err != nil {
+			return fmt.Errorf("migration %s: the name does not start with a version", name)
+		}
+
+		migrations = append(migrations, migration{version: version, name: name})
+	}
+
+	slices.SortFunc(migrations, func(a, b migration) int { return a.version - b.version })
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() //nolint:errcheck // a committed transaction ignores the rollback
+
+	if s.dialect.lockMigrations != "" {
+		if _, err := tx.ExecContext(ctx, s.dialect.lockMigrations); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+	version    INTEGER PRIMARY KEY,
+	applied_at BIGINT NOT NULL
+)`); err != nil {
+		return err
+	}
+
+	var current int
+	if err := tx.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current); err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+
+		script, err := fs.ReadFile(s.dialect.migrations, m.name)
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, string(script)); err != nil {
+			return fmt.Errorf("migration %s: %w", m.name, err)
+		}
+
+		if _, err := tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, applied_at) VALUES ($1, $2)`,
+			m.version, time.Now().Unix()); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// PurgeExpired deletes expired tokens, sessions, counters and locks, reads skip them anyway
+func (s *Store) PurgeExpired(ctx context.Context) error {
+	now := nowMillis()
+
+	for _, table := range []string{"tokens", "sessions", "one_time_tokens", "counters", "lockouts"} {
+		if _, err := s.DB.ExecContext(ctx, `DELETE FROM `+table+` WHERE expires_at <= $1`, now); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// StartCleanup purges expired rows every interval until ctx is done
+func (s *Store) StartCleanup(ctx context.Context, interval time.Duration, onErr func(error)) {
+	if interval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := s.PurgeExpired(ctx); err != nil {
+					onErr(err)
+				}
+			}
+		}
+	}()
+}
+
+// inTx runs fn in a transaction, it is committed when fn returns nil
+func (s *Store) inTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() //nolint:errcheck // a committed transaction ignores the rollback
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// execOne runs a statement that has to hit a row, notFound is returned when it does not
+func (s *Store) execOne(ctx context.Context, notFound error, query string, args ...any) error {
+	res, err := s.DB.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return notFound
+	}
+
+	return nil
+}
+
+// placeholders returns "$from, $from+1, ..." for n arguments
+func placeholders(from, n int) string {
+	p := make([]string, n)
+	for i := range p {
+		p[i] = "$" + strconv.Itoa(from+i)
+	}
+
+	return strings.Join(p, ", ")
+}
+
+func nowMillis() int64 {
+	return time.Now().UnixMilli()
+}
+
+func expiresAt(ttl time.Duration) int64 {
+	return time.Now().Add(ttl).UnixMilli()
+}
+
+func isNoRows(err error) bool {
+	return errors.Is(err, sql.ErrNoRows)
+}
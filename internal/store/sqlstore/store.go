@@ -0,0 +1,256 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"auth-rest-api/internal/models"
+)
+
+// SaveOneTimeToken stores the value of a single use token, e.g. an email verification link
+func (s *Store) SaveOneTimeToken(ctx context.Context, purpose, id, value string, ttl time.Duration) error {
+	_, err := s.DB.ExecContext(ctx, `INSERT INTO one_time_tokens (purpose, id, value, expires_at) VALUES ($1, $2, $3, $4)
+ON CONFLICT (purpose, id) DO UPDATE SET value = excluded.value, expires_at = excluded.expires_at`,
+		purpose, id, value, expiresAt(ttl))
+
+	return err
+}
+
+// ConsumeOneTimeToken returns the value of a single use token and deletes it in the same step
+func (s *Store) ConsumeOneTimeToken(ctx context.Context, purpose, id string) (string, error) {
+	return s.oneTimeToken(ctx, `DELETE FROM one_time_tokens WHERE purpose = $1 AND id = $2 AND expires_at > $3
+RETURNING value`, purpose, id)
+}
+
+// GetOneTimeToken returns the value of a single use token without using it up
+func (s *Store) GetOneTimeToken(ctx context.Context, purpose, id string) (string, error) {
+	return s.oneTimeToken(ctx, `SELECT value FROM one_time_tokens WHERE purpose = $1 AND id = $2 AND expires_at > $3`,
+		purpose, id)
+}
+
+func (s *Store) oneTimeToken(ctx context.Context, query, purpose, id string) (string, error) {
+	var value string
+
+	if err := s.DB.QueryRowContext(ctx, query, purpose, id, nowMillis()).Scan(&value); err != nil {
+		if isNoRows(err) {
+			return "", models.ErrNotFound("token")
+		}
+
+		return "", err
+	}
+
+	return value, nil
+}
+
+// IncrCounter counts an event, the counter starts expiring with the first event after ttl
+func (s *Store) IncrCounter(ctx context.Context, name string, ttl time.Duration) (int64, error) {
+	now := nowMillis()
+
+	var value int64
+
+	// an expired counter that was not purged yet starts over
+	err := s.DB.QueryRowContext(ctx, `INSERT INTO counters (name, value, expires_at) VALUES ($1, 1, $2)
+ON CONFLICT (name) DO UPDATE SET
+	value = CASE WHEN counters.expires_at > $3 THEN counters.value + 1 ELSE 1 END,
+	expires_at = CASE WHEN counters.expires_at > $3 THEN counters.expires_at ELSE excluded.expires_at END
+RETURNING value`, name, now+ttl.Milliseconds(), now).Scan(&value)
+	if err != nil {
+		return 0, err
+	}
+
+	return value, nil
+}
+
+// ResetCounter drops counters, e.g. the failed sign ins of a user after a successful one
+func (s *Store) ResetCounter(ctx context.Context, names ...string) error {
+	if len(names) == 0 {
+		return nil
+	}
+
+	_, err := s.DB.ExecContext(ctx, `DELETE FROM counters WHERE name IN (`+placeholders(1, len(names))+`)`, toAny(names)...)
+
+	return err
+}
+
+// Lock blocks name for d, a lock that is still running is replaced
+func (s *Store) Lock(ctx context.Context, name string, d time.Duration) error {
+	_, err := s.DB.ExecContext(ctx, `INSERT INTO lockouts (name, expires_at) VALUES ($1, $2)
+ON CONFLICT (name) DO UPDATE SET expires_at = excluded.expires_at`, name, expiresAt(d))
+
+	return err
+}
+
+// LockedFor returns how long name stays locked, 0 when it is not locked
+func (s *Store) LockedFor(ctx context.Context, name string) (time.Duration, error) {
+	var until int64
+
+	if err := s.DB.QueryRowContext(ctx, `SELECT expires_at FROM lockouts WHERE name = $1`, name).Scan(&until); err != nil {
+		if isNoRows(err) {
+			return 0, nil
+		}
+
+		return 0, err
+	}
+
+	return max(time.Duration(until-nowMillis())*time.Millisecond, 0), nil
+}
+
+func (s *Store) CreateToken(ctx context.Context, email string, td *models.TokenData) error {
+	accExp := time.Unix(td.AccessExpiresAt, 0).UnixMilli()
+	refExp := time.Unix(td.RefreshExpiresAt, 0).UnixMilli()
+
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		for _, token := range []struct {
+			id        string
+			expiresAt int64
+		}{{td.AccessID, accExp}, {td.RefreshID, refExp}} {
+			if _, err := tx.ExecContext(ctx, `INSERT INTO tokens (id, email, expires_at) VALUES ($1, $2, $3)
+ON CONFLICT (id) DO UPDATE SET email = excluded.email, expires_at = excluded.expires_at`,
+				token.id, email, token.expiresAt); err != nil {
+				return err
+			}
+		}
+
+		if td.FamilyID == "" {
+			return nil
+		}
+
+		// the family lives as long as the latest refresh token
+		now := time.Now().Unix()
+
+		_, err := tx.ExecContext(ctx, `INSERT INTO sessions
+	(family_id, email, access_id, refresh_id, ip, user_agent, created_at, refreshed_at, expires_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $7, $8)
+ON CONFLICT (family_id) DO UPDATE SET email = excluded.email, access_id = excluded.access_id,
+	refresh_id = excluded.refresh_id, ip = excluded.ip, user_agent = excluded.user_agent,
+	refreshed_at = excluded.refreshed_at, expires_at = excluded.expires_at`,
+			td.FamilyID, email, td.AccessID, td.RefreshID, td.Client.IP, td.Client.UserAgent, now, refExp)
+
+		return err
+	})
+}
+
+const familyColumns = `family_id, email, access_id, refresh_id, ip, user_agent, created_at, refreshed_at`
+
+func (s *Store) GetFamily(ctx context.Context, familyID string) (*models.TokenFamily, error) {
+	family, err := scanFamily(s.DB.QueryRowContext(ctx, `SELECT `+familyColumns+` FROM sessions
+WHERE family_id = $1 AND expires_at > $2`, familyID, nowMillis()))
+	if err != nil {
+		if isNoRows(err) {
+			return nil, models.ErrNotFound("token family")
+		}
+
+		return nil, err
+	}
+
+	return family, nil
+}
+
+// RevokeFamily deletes the family together with its current token pair. The pair is read by the delete
+// itself, a refresh running at the same time waits for the row lock and can not leave a new pair behind.
+func (s *Store) RevokeFamily(ctx context.Context, familyID string) error {
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		var accessID, refreshID string
+
+		err := tx.QueryRowContext(ctx, `DELETE FROM sessions WHERE family_id = $1 AND expires_at > $2
+RETURNING access_id, refresh_id`, familyID, nowMillis()).Scan(&accessID, &refreshID)
+		if err != nil {
+			if isNoRows(err) {
+				return models.ErrNotFound("token family")
+			}
+
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `DELETE FROM tokens WHERE id IN ($1, $2)`, accessID, refreshID)
+
+		return err
+	})
+}
+
+// ListFamilies returns the live token families of a user, expired ones are deleted
+func (s *Store) ListFamilies(ctx context.Context, email string) ([]models.TokenFamily, error) {
+	now := nowMillis()
+
+	if _, err := s.DB.ExecContext(ctx, `DELETE FROM sessions WHERE email = $1 AND expires_at <= $2`, email, now); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.DB.QueryContext(ctx, `SELECT `+familyColumns+` FROM sessions
+WHERE email = $1 AND expires_at > $2
+ORDER BY created_at, family_id`, email, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	families := []models.TokenFamily{}
+
+	for rows.Next() {
+		family, err := scanFamily(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		families = append(families, *family)
+	}
+
+	return families, rows.Err()
+}
+
+func scanFamily(row scanner) (*models.TokenFamily, error) {
+	var f models.TokenFamily
+
+	if err := row.Scan(&f.ID, &f.Email, &f.AccessID, &f.RefreshID, &f.Client.IP, &f.Client.UserAgent, &f.CreatedAt,
+		&f.RefreshedAt); err != nil {
+		return nil, err
+	}
+
+	return &f, nil
+}
+
+func (s *Store) DeleteToken(ctx context.Context, tokenID ...string) error {
+	if len(tokenID) == 0 {
+		return nil
+	}
+
+	// like an expired Redis key, an expired token that was not purged yet does not count as deleted
+	query := `DELETE FROM tokens WHERE expires_at > $1 AND id IN (` + placeholders(2, len(tokenID)) + `)`
+
+	res, err := s.DB.ExecContext(ctx, query, append([]any{nowMillis()}, toAny(tokenID)...)...)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n != int64(len(tokenID)) {
+		return models.NewConstError("delete error")
+	}
+
+	return nil
+}
+
+func (s *Store) IsTokenRevoked(ctx context.Context, tokenID string) (bool, error) {
+	var live bool
+
+	if err := s.DB.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM tokens WHERE id = $1 AND expires_at > $2)`,
+		tokenID, nowMillis()).Scan(&live); err != nil {
+		return false, err
+	}
+
+	return !live, nil
+}
+
+func toAny(values []string) []any {
+	args := make([]any, len(values))
+	for i, v := range values {
+		args[i] = v
+	}
+
+	return args
+}
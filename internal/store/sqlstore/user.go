@@ -0,0 +1,316 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"auth-rest-api/internal/models"
+)
+
+const userColumns = `id, email, password, verified, status, name, locale, metadata, created_at, last_login_at,
+	totp_secret, totp_enabled, totp_last_step`
+
+// userSelect reads the user columns and whether the user registered a passkey, which enables MFA like a
+// confirmed authenticator app
+const userSelect = `SELECT ` + userColumns + `, EXISTS (SELECT 1 FROM passkeys WHERE passkeys.user_id = users.id)
+FROM users`
+
+// likeEscaper escapes the pattern characters of LIKE, the queries declare \ as the escape character
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// CreateUser inserts the user, the unique email makes a concurrent sign up for the same email fail
+// with ErrUserAlreadyExists
+func (s *Store) CreateUser(ctx context.Context, user *models.UserData) error {
+	metadata, err := json.Marshal(user.Metadata)
+	if err != nil {
+		return err
+	}
+
+	var lastLogin *int64
+
+	if user.LastLoginAt != nil {
+		t := user.LastLoginAt.Unix()
+		lastLogin = &t
+	}
+
+	totp := user.TOTP
+	if totp == nil {
+		totp = &models.TOTP{}
+	}
+
+	err = s.execOne(ctx, models.ErrUserAlreadyExists, `INSERT INTO users (`+userColumns+`)
+VALUES (`+placeholders(1, 13)+`)
+ON CONFLICT DO NOTHING`,
+		user.ID, user.Email, user.Password, user.Verified, string(user.Status), user.Name, user.Locale, string(metadata),
+		user.CreatedAt.Unix(), lastLogin, totp.Secret, totp.Enabled, totp.LastStep)
+	if err != nil && s.dialect.isUniqueViolation(err) {
+		return models.ErrUserAlreadyExists
+	}
+
+	return err
+}
+
+func (s *Store) GetUserByEmail(ctx context.Context, email string) (*models.UserData, error) {
+	return s.getUser(ctx, `email = $1`, email)
+}
+
+func (s *Store) GetUserByID(ctx context.Context, id string) (*models.UserData, error) {
+	return s.getUser(ctx, `id = $1`, id)
+}
+
+func (s *Store) getUser(ctx context.Context, where string, arg any) (*models.UserData, error) {
+	user, err := scanUser(s.DB.QueryRowContext(ctx, userSelect+` WHERE `+where, arg))
+	if err != nil {
+		if isNoRows(err) {
+			return nil, models.ErrNotFound("user")
+		}
+
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// UpdatePassword replaces the password hash of an existing user
+func (s *Store) UpdatePassword(ctx context.Context, id string, hash []byte) error {
+	return s.updateUser(ctx, `password = $2`, id, hash)
+}
+
+// UpdateProfile stores the editable profile fields of the user
+func (s *Store) UpdateProfile(ctx context.Context, user *models.UserData) error {
+	metadata, err := json.Marshal(user.Metadata)
+	if err != nil {
+		return err
+	}
+
+	return s.updateUser(ctx, `name = $2, locale = $3, metadata = $4`, user.ID, user.Name, user.Locale, string(metadata))
+}
+
+// SaveTOTP stores the authenticator app enrollment of the user
+func (s *Store) SaveTOTP(ctx context.Context, id string, totp *models.TOTP) error {
+	return s.updateUser(ctx, `totp_secret = $2, totp_enabled = $3, totp_last_step = $4`, id, totp.Secret, totp.Enabled,
+		totp.LastStep)
+}
+
+// SaveRecoveryCodes replaces the recovery code hashes of the user
+func (s *Store) SaveRecoveryCodes(ctx context.Context, id string, hashes []string) error {
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM recovery_codes WHERE user_id = $1`, id); err != nil {
+			return err
+		}
+
+		for _, hash := range hashes {
+			if _, err := tx.ExecContext(ctx, `INSERT INTO recovery_codes (user_id, hash) VALUES ($1, $2)
+ON CONFLICT DO NOTHING`, id, hash); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// ConsumeRecoveryCode removes the recovery code hash, it reports false when the code was not found
+func (s *Store) ConsumeRecoveryCode(ctx context.Context, id, hash string) (bool, error) {
+	res, err := s.DB.ExecContext(ctx, `DELETE FROM recovery_codes WHERE user_id = $1 AND hash = $2`, id, hash)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return n == 1, nil
+}
+
+// AddPasswordHistory records hash as the latest previous password of the user, only the newest keep
+// hashes are kept
+func (s *Store) AddPasswordHistory(ctx context.Context, id string, hash []byte, keep int) error {
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO password_history (user_id, hash) VALUES ($1, $2)`, id, hash); err != nil {
+			return err
+		}
+
+		_, err := tx.ExecContext(ctx, `DELETE FROM password_history WHERE user_id = $1 AND seq NOT IN (
+	SELECT seq FROM password_history WHERE user_id = $1 ORDER BY seq DESC LIMIT $2
+)`, id, keep)
+
+		return err
+	})
+}
+
+// GetPasswordHistory returns the previous password hashes of the user, newest first
+func (s *Store) GetPasswordHistory(ctx context.Context, id string) ([][]byte, error) {
+	rows, err := s.DB.QueryContext(ctx, `SELECT hash FROM password_history WHERE user_id = $1 ORDER BY seq DESC`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	hashes := [][]byte{}
+
+	for rows.Next() {
+		var hash []byte
+		if err := rows.Scan(&hash); err != nil {
+			return nil, err
+		}
+
+		hashes = append(hashes, hash)
+	}
+
+	return hashes, rows.Err()
+}
+
+func (s *Store) UpdateLastLogin(ctx context.Context, id string, at time.Time) error {
+	return s.updateUser(ctx, `last_login_at = $2`, id, at.Unix())
+}
+
+// ChangeEmail moves the user to the new email, the new address starts unverified and an active account
+// is pending verification again
+func (s *Store) ChangeEmail(ctx context.Context, id, newEmail string) error {
+	err := s.updateUser(ctx, `email = $2, verified = $3, status = CASE WHEN status = $4 THEN $5 ELSE status END`,
+		id, newEmail, false, string(models.StatusActive), string(models.StatusPendingVerification))
+	if err != nil && s.dialect.isUniqueViolation(err) {
+		return models.ErrUserAlreadyExists
+	}
+
+	return err
+}
+
+// RenameEmail moves the user to another spelling of the same address, e.g. its normalized form, the
+// verification and status are kept
+func (s *Store) RenameEmail(ctx context.Context, id, email string) error {
+	err := s.updateUser(ctx, `email = $2`, id, email)
+	if err != nil && s.dialect.isUniqueViolation(err) {
+		return models.ErrUserAlreadyExists
+	}
+
+	return err
+}
+
+func (s *Store) MarkUserVerified(ctx context.Context, email string) error {
+	user, err := s.GetUserByEmail(ctx, email)
+	if err != nil {
+		return err
+	}
+
+	return s.SetVerified(ctx, user.ID, true)
+}
+
+// SetVerified marks the email of the user as verified or unverified and moves the account between
+// active and pending verification, disabled and locked accounts keep their status
+func (s *Store) SetVerified(ctx context.Context, id string, verified bool) error {
+	from, to := models.StatusPendingVerification, models.StatusActive
+	if !verified {
+		from, to = to, from
+	}
+
+	return s.updateUser(ctx, `verified = $2, status = CASE WHEN status = $3 THEN $4 ELSE status END`,
+		id, verified, string(from), string(to))
+}
+
+// SetStatus changes the status of the user
+func (s *Store) SetStatus(ctx context.Context, id string, status models.UserStatus) error {
+	return s.updateUser(ctx, `status = $2`, id, string(status))
+}
+
+// ListUsers returns the users ordered by email, the cursor is the encoded last email of the previous page
+func (s *Store) ListUsers(ctx context.Context, query *models.UserQuery) (*models.UserPage, error) {
+	var after string
+
+	if query.Cursor != "" {
+		email, err := base64.RawURLEncoding.DecodeString(query.Cursor)
+		if err != nil {
+			return nil, models.ErrInvalid("cursor")
+		}
+
+		after = string(email)
+	}
+
+	// one more than the limit tells whether there is a next page
+	rows, err := s.DB.QueryContext(ctx, userSelect+`
+WHERE email LIKE $1 ESCAPE '\' AND email > $2
+ORDER BY email
+LIMIT $3`, likeEscaper.Replace(query.EmailPrefix)+"%", after, query.Limit+1)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	page := &models.UserPage{Users: make([]models.UserData, 0, query.Limit)}
+
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(page.Users) == query.Limit {
+			last := page.Users[len(page.Users)-1].Email
+			page.NextCursor = base64.RawURLEncoding.EncodeToString([]byte(last))
+
+			break
+		}
+
+		page.Users = append(page.Users, *user)
+	}
+
+	return page, rows.Err()
+}
+
+// DeleteUser removes the user, its recovery codes, password history, roles and passkeys go with it
+func (s *Store) DeleteUser(ctx context.Context, id string) error {
+	return s.execOne(ctx, models.ErrNotFound("user"), `DELETE FROM users WHERE id = $1`, id)
+}
+
+// updateUser sets columns of an existing user, set refers to the user ID as $1 and to args from $2 on
+func (s *Store) updateUser(ctx context.Context, set, id string, args ...any) error {
+	return s.execOne(ctx, models.ErrNotFound("user"), `UPDATE users SET `+set+` WHERE id = $1`, append([]any{id}, args...)...)
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanUser(row scanner) (*models.UserData, error) {
+	var (
+		user      models.UserData
+		status    string
+		metadata  []byte
+		createdAt int64
+		lastLogin sql.NullInt64
+		totp      models.TOTP
+		passkeys  bool
+	)
+
+	if err := row.Scan(&user.ID, &user.Email, &user.Password, &user.Verified, &status, &user.Name, &user.Locale,
+		&metadata, &createdAt, &lastLogin, &totp.Secret, &totp.Enabled, &totp.LastStep, &passkeys); err != nil {
+		return nil, err
+	}
+
+	user.Status = models.UserStatus(status)
+	user.CreatedAt = time.Unix(createdAt, 0).UTC()
+
+	if len(metadata) > 0 && string(metadata) != "null" {
+		_ = json.Unmarshal(metadata, &user.Metadata)
+	}
+
+	if lastLogin.Valid {
+		t := time.Unix(lastLogin.Int64, 0).UTC()
+		user.LastLoginAt = &t
+	}
+
+	if totp.Secret != "" {
+		user.TOTP = &totp
+	}
+
+	user.MFAEnabled = totp.Enabled || passkeys
+
+	return &user, nil
+}
@@ -3,6 +3,7 @@ package store
 import (
 	"context"
 	"errors"
+	"strconv"
 	"time"
 
 	"auth-rest-api/internal/models"
@@ -11,9 +12,28 @@ import (
 )
 
 const (
-	userTable = "users"
+	oneTimePrefix  = "otk:"
+	counterPrefix  = "counter:"
+	familyPrefix   = "family:"
+	sessionsPrefix = "sessions:"
+	lockoutPrefix  = "lockout:"
 )
 
+// revokeFamilyScript reads the current token pair of the family and deletes it with the family in one
+// step, a refresh running at the same time can not leave a new pair behind. It returns 0 when the
+// family does not exist.
+var revokeFamilyScript = redis.NewScript(`
+local family = redis.call('HMGET', KEYS[1], 'email', 'access', 'refresh')
+if not family[1] then
+	return 0
+end
+
+redis.call('DEL', KEYS[1], family[2], family[3])
+redis.call('SREM', ARGV[1] .. family[1], ARGV[2])
+
+return 1
+`)
+
 type Store struct {
 	DB *redis.Client
 }
@@ -22,55 +42,204 @@ func New(db *redis.Client) *Store {
 	return &Store{DB: db}
 }
 
-func (s *Store) CreateUser(ctx context.Context, user *models.UserData) error {
-	val, err := s.DB.HSet(ctx, userTable, user.Email, user.Password).Result()
+// SaveOneTimeToken stores the value of a single use token, e.g. an email verification link
+func (s *Store) SaveOneTimeToken(ctx context.Context, purpose, id, value string, ttl time.Duration) error {
+	return s.DB.Set(ctx, oneTimePrefix+purpose+":"+id, value, ttl).Err()
+}
+
+// ConsumeOneTimeToken returns the value of a single use token and deletes it in the same step
+func (s *Store) ConsumeOneTimeToken(ctx context.Context, purpose, id string) (string, error) {
+	val, err := s.DB.GetDel(ctx, oneTimePrefix+purpose+":"+id).Result()
 	if err != nil {
 		if errors.Is(err, redis.Nil) {
-			return models.ErrUserAlreadyExists
+			return "", models.ErrNotFound("token")
 		}
 
-		return err
-	}
-
-	if val == 0 {
-		return models.ErrUserAlreadyExists
+		return "", err
 	}
 
-	return nil
+	return val, nil
 }
 
-func (s *Store) GetUserByEmail(ctx context.Context, email string) (*models.UserData, error) {
-	passwd, err := s.DB.HGet(ctx, userTable, email).Result()
+// GetOneTimeToken returns the value of a single use token without using it up
+func (s *Store) GetOneTimeToken(ctx context.Context, purpose, id string) (string, error) {
+	val, err := s.DB.Get(ctx, oneTimePrefix+purpose+":"+id).Result()
 	if err != nil {
 		if errors.Is(err, redis.Nil) {
-			return nil, models.ErrNotFound("user")
+			return "", models.ErrNotFound("token")
 		}
 
-		return nil, err
+		return "", err
 	}
 
-	if passwd == "" {
-		return nil, models.ErrNotFound("user")
+	return val, nil
+}
+
+// IncrCounter counts an event, the counter starts expiring with the first event after ttl
+func (s *Store) IncrCounter(ctx context.Context, name string, ttl time.Duration) (int64, error) {
+	var incr *redis.IntCmd
+
+	_, err := s.DB.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		incr = pipe.Incr(ctx, counterPrefix+name)
+		pipe.ExpireNX(ctx, counterPrefix+name, ttl)
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
 	}
 
-	return &models.UserData{Email: email, Password: []byte(passwd)}, nil
+	return incr.Val(), nil
+}
+
+// ResetCounter drops counters, e.g. the failed sign ins of a user after a successful one
+func (s *Store) ResetCounter(ctx context.Context, names ...string) error {
+	keys := make([]string, 0, len(names))
+
+	for _, name := range names {
+		keys = append(keys, counterPrefix+name)
+	}
+
+	return s.DB.Del(ctx, keys...).Err()
+}
+
+// Lock blocks name for d, a lock that is still running is replaced
+func (s *Store) Lock(ctx context.Context, name string, d time.Duration) error {
+	return s.DB.Set(ctx, lockoutPrefix+name, 1, d).Err()
+}
+
+// LockedFor returns how long name stays locked, 0 when it is not locked
+func (s *Store) LockedFor(ctx context.Context, name string) (time.Duration, error) {
+	ttl, err := s.DB.PTTL(ctx, lockoutPrefix+name).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	// -2 for a missing key, -1 for a key without expiry which Lock never writes
+	if ttl < 0 {
+		return 0, nil
+	}
+
+	return ttl, nil
 }
 
 func (s *Store) CreateToken(ctx context.Context, email string, td *models.TokenData) error {
 	accExp := time.Unix(td.AccessExpiresAt, 0)
 	refExp := time.Unix(td.RefreshExpiresAt, 0)
 
-	if err := s.DB.Set(ctx, td.AccessID, email, time.Until(accExp)).Err(); err != nil {
-		return err
+	_, err := s.DB.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, td.AccessID, email, time.Until(accExp))
+		pipe.Set(ctx, td.RefreshID, email, time.Until(refExp))
+
+		if td.FamilyID == "" {
+			return nil
+		}
+
+		// the family and the user's session index live as long as the latest refresh token
+		familyKey := familyPrefix + td.FamilyID
+		sessionsKey := sessionsPrefix + email
+		now := time.Now().Unix()
+
+		pipe.HSet(ctx, familyKey, "email", email, "access", td.AccessID, "refresh", td.RefreshID,
+			"ip", td.Client.IP, "user_agent", td.Client.UserAgent, "refreshed_at", now)
+		pipe.HSetNX(ctx, familyKey, "created_at", now)
+		pipe.ExpireAt(ctx, familyKey, refExp)
+		pipe.SAdd(ctx, sessionsKey, td.FamilyID)
+		pipe.ExpireAt(ctx, sessionsKey, refExp)
+
+		return nil
+	})
+
+	return err
+}
+
+func (s *Store) GetFamily(ctx context.Context, familyID string) (*models.TokenFamily, error) {
+	vals, err := s.DB.HGetAll(ctx, familyPrefix+familyID).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(vals) == 0 {
+		return nil, models.ErrNotFound("token family")
 	}
 
-	if err := s.DB.Set(ctx, td.RefreshID, email, time.Until(refExp)).Err(); err != nil {
+	return familyFromHash(familyID, vals), nil
+}
+
+// RevokeFamily deletes the family together with its current token pair
+func (s *Store) RevokeFamily(ctx context.Context, familyID string) error {
+	revoked, err := revokeFamilyScript.Run(ctx, s.DB, []string{familyPrefix + familyID}, sessionsPrefix, familyID).Int()
+	if err != nil {
 		return err
 	}
 
+	if revoked == 0 {
+		return models.ErrNotFound("token family")
+	}
+
 	return nil
 }
 
+// ListFamilies returns the live token families of a user, expired ones are dropped from the index
+func (s *Store) ListFamilies(ctx context.Context, email string) ([]models.TokenFamily, error) {
+	ids, err := s.DB.SMembers(ctx, sessionsPrefix+email).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	families := make([]models.TokenFamily, 0, len(ids))
+
+	if len(ids) == 0 {
+		return families, nil
+	}
+
+	cmds := make([]*redis.MapStringStringCmd, len(ids))
+
+	if _, err = s.DB.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, id := range ids {
+			cmds[i] = pipe.HGetAll(ctx, familyPrefix+id)
+		}
+
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	var expired []any
+
+	for i, cmd := range cmds {
+		if len(cmd.Val()) == 0 {
+			expired = append(expired, ids[i])
+			continue
+		}
+
+		families = append(families, *familyFromHash(ids[i], cmd.Val()))
+	}
+
+	if len(expired) > 0 {
+		if err := s.DB.SRem(ctx, sessionsPrefix+email, expired...).Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	return families, nil
+}
+
+func familyFromHash(familyID string, vals map[string]string) *models.TokenFamily {
+	createdAt, _ := strconv.ParseInt(vals["created_at"], 10, 64)
+	refreshedAt, _ := strconv.ParseInt(vals["refreshed_at"], 10, 64)
+
+	return &models.TokenFamily{
+		ID:          familyID,
+		Email:       vals["email"],
+		AccessID:    vals["access"],
+		RefreshID:   vals["refresh"],
+		Client:      models.ClientInfo{IP: vals["ip"], UserAgent: vals["user_agent"]},
+		CreatedAt:   createdAt,
+		RefreshedAt: refreshedAt,
+	}
+}
+
 func (s *Store) DeleteToken(ctx context.Context, tokenID ...string) error {
 	val, err := s.DB.Del(ctx, tokenID...).Result()
 	if err != nil {
@@ -3,7 +3,9 @@ package store
 import (
 	"context"
 	"errors"
+	"fmt"
 	"testing"
+	"time"
 
 	"auth-rest-api/internal/models"
 
@@ -12,108 +14,6 @@ import (
 	"github.com/stretchr/testify/assert"
 )
 
-func TestStore_CreateUser(t *testing.T) {
-	db, mock := redismock.NewClientMock()
-	s := New(db)
-	ctx := context.Background()
-	email := "dummy@testmail.com"
-	passwd := []byte(uuid.NewString())
-
-	tests := []struct {
-		name     string
-		user     *models.UserData
-		mockCall func()
-		wantErr  error
-	}{
-		{
-			name:     "valid case",
-			user:     &models.UserData{Email: email, Password: passwd},
-			mockCall: func() { mock.ExpectHSet("users", email, passwd).SetVal(1) },
-		},
-		{
-			name:     "email entry create nil",
-			user:     &models.UserData{Email: email, Password: passwd},
-			mockCall: func() { mock.ExpectHSet("users", email, passwd).RedisNil() },
-			wantErr:  models.ErrUserAlreadyExists,
-		},
-		{
-			name:     "db error",
-			user:     &models.UserData{Email: email, Password: passwd},
-			mockCall: func() { mock.ExpectHSet("users", email, passwd).SetErr(models.ErrDBNotConnected) },
-			wantErr:  models.ErrDBNotConnected,
-		},
-		{
-			name:     "email entry found",
-			user:     &models.UserData{Email: email, Password: passwd},
-			mockCall: func() { mock.ExpectHSet("users", email, passwd).SetVal(0) },
-			wantErr:  models.ErrUserAlreadyExists,
-		},
-	}
-
-	for i, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			tt.mockCall()
-
-			assert.Equalf(t, tt.wantErr, s.CreateUser(ctx, tt.user), "TEST[%d] Failed - %s", i, tt.name)
-		})
-	}
-
-	assert.NoError(t, mock.ExpectationsWereMet())
-}
-
-func TestStore_GetUserByEmail(t *testing.T) {
-	db, mock := redismock.NewClientMock()
-	s := New(db)
-	ctx := context.Background()
-	email := "dummy@testmail.com"
-	passwd := uuid.NewString()
-
-	tests := []struct {
-		name     string
-		email    string
-		mockCall func()
-		want     *models.UserData
-		wantErr  error
-	}{
-		{
-			name:     "valid case",
-			email:    email,
-			mockCall: func() { mock.ExpectHGet("users", email).SetVal(passwd) },
-			want:     &models.UserData{Email: email, Password: []byte(passwd)},
-		},
-		{
-			name:     "empty password",
-			email:    email,
-			mockCall: func() { mock.ExpectHGet("users", email).SetVal("") },
-			wantErr:  models.ErrNotFound("user"),
-		},
-		{
-			name:     "no entry for email",
-			email:    email,
-			mockCall: func() { mock.ExpectHGet("users", email).RedisNil() },
-			wantErr:  models.ErrNotFound("user"),
-		},
-		{
-			name:     "redis error",
-			email:    email,
-			mockCall: func() { mock.ExpectHGet("users", email).SetErr(models.ErrDBNotConnected) },
-			wantErr:  models.ErrDBNotConnected,
-		},
-	}
-
-	for i, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			tt.mockCall()
-
-			got, err := s.GetUserByEmail(ctx, tt.email)
-			assert.Equalf(t, tt.wantErr, err, "TEST[%d] Failed - %s", i, tt.name)
-			assert.Equalf(t, tt.want, got, "TEST[%d] Failed - %s", i, tt.name)
-		})
-	}
-
-	assert.NoError(t, mock.ExpectationsWereMet())
-}
-
 func TestStore_DeleteToken(t *testing.T) {
 	db, mock := redismock.NewClientMock()
 	s := New(db)
@@ -242,3 +142,234 @@ func TestStore_IsTokenRevoked(t *testing.T) {
 
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
+
+// ignoreTrailing matches commands up to their last two arguments, an expiry option (e.g. "px 3599457")
+// or a timestamp field that depend on the time the test runs
+func ignoreTrailing(expected, actual []any) error {
+	if len(expected) != len(actual) {
+		return fmt.Errorf("expected %v, got %v", expected, actual)
+	}
+
+	for i := 0; i < len(expected)-2; i++ {
+		if fmt.Sprint(expected[i]) != fmt.Sprint(actual[i]) {
+			return fmt.Errorf("expected %v, got %v", expected, actual)
+		}
+	}
+
+	return nil
+}
+
+func TestStore_CreateToken(t *testing.T) {
+	db, mock := redismock.NewClientMock()
+	s := New(db)
+	ctx := context.Background()
+	email := "dummy@testmail.com"
+	exp := time.Now().Add(time.Hour)
+
+	td := &models.TokenData{
+		FamilyID: uuid.NewString(), AccessID: uuid.NewString(), RefreshID: uuid.NewString(),
+		AccessExpiresAt: exp.Unix(), RefreshExpiresAt: exp.Unix(),
+	}
+
+	td.Client = models.ClientInfo{IP: "127.0.0.1", UserAgent: "curl/8.0"}
+
+	mock.ExpectTxPipeline()
+	mock.CustomMatch(ignoreTrailing).ExpectSet(td.AccessID, email, time.Hour).SetVal("OK")
+	mock.CustomMatch(ignoreTrailing).ExpectSet(td.RefreshID, email, time.Hour).SetVal("OK")
+	mock.CustomMatch(ignoreTrailing).ExpectHSet("family:"+td.FamilyID, "email", email, "access", td.AccessID,
+		"refresh", td.RefreshID, "ip", td.Client.IP, "user_agent", td.Client.UserAgent, "refreshed_at", 0).SetVal(6)
+	mock.CustomMatch(ignoreTrailing).ExpectHSetNX("family:"+td.FamilyID, "created_at", 0).SetVal(true)
+	mock.ExpectExpireAt("family:"+td.FamilyID, time.Unix(td.RefreshExpiresAt, 0)).SetVal(true)
+	mock.ExpectSAdd("sessions:"+email, td.FamilyID).SetVal(1)
+	mock.ExpectExpireAt("sessions:"+email, time.Unix(td.RefreshExpiresAt, 0)).SetVal(true)
+	mock.ExpectTxPipelineExec()
+
+	assert.NoError(t, s.CreateToken(ctx, email, td))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestStore_GetFamily(t *testing.T) {
+	db, mock := redismock.NewClientMock()
+	s := New(db)
+	ctx := context.Background()
+	fid := uuid.NewString()
+	family := &models.TokenFamily{ID: fid, Email: "dummy@testmail.com", AccessID: uuid.NewString(), RefreshID: uuid.NewString()}
+
+	tests := []struct {
+		name     string
+		mockCall func()
+		want     *models.TokenFamily
+		wantErr  error
+	}{
+		{
+			name: "valid case",
+			mockCall: func() {
+				mock.ExpectHGetAll("family:" + fid).SetVal(map[string]string{
+					"email": family.Email, "access": family.AccessID, "refresh": family.RefreshID,
+				})
+			},
+			want: family,
+		},
+		{
+			name:     "family not found",
+			mockCall: func() { mock.ExpectHGetAll("family:" + fid).SetVal(map[string]string{}) },
+			wantErr:  models.ErrNotFound("token family"),
+		},
+		{
+			name:     "redis error",
+			mockCall: func() { mock.ExpectHGetAll("family:" + fid).SetErr(models.ErrDBNotConnected) },
+			wantErr:  models.ErrDBNotConnected,
+		},
+	}
+
+	for i, tt := range tests {
+		tt.mockCall()
+
+		got, err := s.GetFamily(ctx, fid)
+
+		assert.Equalf(t, tt.wantErr, err, "TEST[%d] Failed - %s", i, tt.name)
+		assert.Equalf(t, tt.want, got, "TEST[%d] Failed - %s", i, tt.name)
+	}
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestStore_RevokeFamily(t *testing.T) {
+	db, mock := redismock.NewClientMock()
+	s := New(db)
+	ctx := context.Background()
+	fid := uuid.NewString()
+	keys := []string{"family:" + fid}
+
+	tests := []struct {
+		name     string
+		mockCall func()
+		wantErr  error
+	}{
+		{
+			name:     "success case",
+			mockCall: func() { mock.ExpectEvalSha(revokeFamilyScript.Hash(), keys, "sessions:", fid).SetVal(int64(1)) },
+		},
+		{
+			name:     "family not found",
+			mockCall: func() { mock.ExpectEvalSha(revokeFamilyScript.Hash(), keys, "sessions:", fid).SetVal(int64(0)) },
+			wantErr:  models.ErrNotFound("token family"),
+		},
+		{
+			name: "db error",
+			mockCall: func() {
+				mock.ExpectEvalSha(revokeFamilyScript.Hash(), keys, "sessions:", fid).SetErr(models.ErrDBNotConnected)
+			},
+			wantErr: models.ErrDBNotConnected,
+		},
+	}
+
+	for i, tt := range tests {
+		tt.mockCall()
+
+		err := s.RevokeFamily(ctx, fid)
+
+		assert.Equalf(t, tt.wantErr, err, "TEST[%d] Failed - %s", i, tt.name)
+	}
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestStore_ListFamilies(t *testing.T) {
+	db, mock := redismock.NewClientMock()
+	s := New(db)
+	ctx := context.Background()
+	email := "dummy@testmail.com"
+	live := uuid.NewString()
+	expired := uuid.NewString()
+
+	mock.ExpectSMembers("sessions:" + email).SetVal([]string{live, expired})
+	mock.ExpectHGetAll("family:" + live).SetVal(map[string]string{
+		"email": email, "access": "acc", "refresh": "ref", "ip": "127.0.0.1", "user_agent": "curl/8.0",
+		"created_at": "1700000000", "refreshed_at": "1700000600",
+	})
+	mock.ExpectHGetAll("family:" + expired).SetVal(map[string]string{})
+	mock.ExpectSRem("sessions:"+email, expired).SetVal(1)
+
+	got, err := s.ListFamilies(ctx, email)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []models.TokenFamily{{
+		ID: live, Email: email, AccessID: "acc", RefreshID: "ref",
+		Client:    models.ClientInfo{IP: "127.0.0.1", UserAgent: "curl/8.0"},
+		CreatedAt: 1700000000, RefreshedAt: 1700000600,
+	}}, got)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestStore_OneTimeToken(t *testing.T) {
+	db, mock := redismock.NewClientMock()
+	s := New(db)
+	ctx := context.Background()
+	id := uuid.NewString()
+	key := "otk:verify-email:" + id
+
+	mock.ExpectSet(key, "dummy@testmail.com", time.Hour).SetVal("OK")
+	mock.ExpectGet(key).SetVal("dummy@testmail.com")
+	mock.ExpectGetDel(key).SetVal("dummy@testmail.com")
+	mock.ExpectGetDel(key).RedisNil()
+	mock.ExpectGetDel(key).SetErr(models.ErrDBNotConnected)
+
+	assert.NoError(t, s.SaveOneTimeToken(ctx, "verify-email", id, "dummy@testmail.com", time.Hour))
+
+	got, err := s.GetOneTimeToken(ctx, "verify-email", id)
+	assert.NoError(t, err)
+	assert.Equal(t, "dummy@testmail.com", got)
+
+	got, err = s.ConsumeOneTimeToken(ctx, "verify-email", id)
+	assert.NoError(t, err)
+	assert.Equal(t, "dummy@testmail.com", got)
+
+	_, err = s.ConsumeOneTimeToken(ctx, "verify-email", id)
+	assert.Equal(t, models.ErrNotFound("token"), err)
+
+	_, err = s.ConsumeOneTimeToken(ctx, "verify-email", id)
+	assert.Equal(t, models.ErrDBNotConnected, err)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestStore_IncrCounter(t *testing.T) {
+	db, mock := redismock.NewClientMock()
+	s := New(db)
+	ctx := context.Background()
+
+	mock.ExpectTxPipeline()
+	mock.ExpectIncr("counter:mfa-challenge:abc").SetVal(3)
+	mock.ExpectExpireNX("counter:mfa-challenge:abc", 5*time.Minute).SetVal(false)
+	mock.ExpectTxPipelineExec()
+
+	got, err := s.IncrCounter(ctx, "mfa-challenge:abc", 5*time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), got)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestStore_Lockout(t *testing.T) {
+	db, mock := redismock.NewClientMock()
+	s := New(db)
+	ctx := context.Background()
+
+	mock.ExpectSet("lockout:signin:email:dummy@testmail.com", 1, 2*time.Minute).SetVal("OK")
+	mock.ExpectPTTL("lockout:signin:email:dummy@testmail.com").SetVal(90 * time.Second)
+	mock.ExpectPTTL("lockout:signin:ip:10.0.0.1").SetVal(-2)
+	mock.ExpectDel("counter:signin:email:dummy@testmail.com").SetVal(1)
+
+	assert.NoError(t, s.Lock(ctx, "signin:email:dummy@testmail.com", 2*time.Minute))
+
+	got, err := s.LockedFor(ctx, "signin:email:dummy@testmail.com")
+	assert.NoError(t, err)
+	assert.Equal(t, 90*time.Second, got)
+
+	got, err = s.LockedFor(ctx, "signin:ip:10.0.0.1")
+	assert.NoError(t, err)
+	assert.Zero(t, got)
+
+	assert.NoError(t, s.ResetCounter(ctx, "signin:email:dummy@testmail.com"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
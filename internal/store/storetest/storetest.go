@@ -0,0 +1,707 @@
+// Package storetest holds the behaviour every service.Storer implementation shares, each backend runs
+// it against a real database in its own tests
+package storetest
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"auth-rest-api/internal/models"
+	"auth-rest-api/internal/service"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Run runs the suite, newStore returns an empty store for every test
+func Run(t *testing.T, newStore func(t *testing.T) service.Storer) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, s service.Storer)
+	}{
+		{name: "users", fn: testUsers},
+		{name: "user status", fn: testUserStatus},
+		{name: "change email", fn: testChangeEmail},
+		{name: "list users", fn: testListUsers},
+		{name: "delete user", fn: testDeleteUser},
+		{name: "update deleted user", fn: testUpdateDeletedUser},
+		{name: "missing user", fn: testMissingUser},
+		{name: "password history", fn: testPasswordHistory},
+		{name: "recovery codes", fn: testRecoveryCodes},
+		{name: "access", fn: testAccess},
+		{name: "passkeys", fn: testPasskeys},
+		{name: "one time tokens", fn: testOneTimeTokens},
+		{name: "counters and locks", fn: testCountersAndLocks},
+		{name: "tokens", fn: testTokens},
+		{name: "token families", fn: testTokenFamilies},
+		{name: "key rings", fn: testKeyRings},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, newStore(t))
+		})
+	}
+}
+
+func newUser(email string) *models.UserData {
+	return &models.UserData{
+		ID:        uuid.NewString(),
+		Email:     email,
+		Password:  []byte("$argon2id$v=19$m=65536,t=3,p=2$c2FsdA$aGFzaA"),
+		Status:    models.StatusPendingVerification,
+		CreatedAt: time.Unix(1700000000, 0).UTC(),
+	}
+}
+
+func createUser(t *testing.T, s service.Storer, email string) *models.UserData {
+	t.Helper()
+
+	user := newUser(email)
+	require.NoError(t, s.CreateUser(context.Background(), user))
+
+	return user
+}
+
+func testUsers(t *testing.T, s service.Storer) {
+	ctx := context.Background()
+	lastLogin := time.Unix(1700000500, 0).UTC()
+
+	user := newUser("sumit@kumar.com")
+	user.Name = "Sumit"
+	user.Locale = "en-IN"
+	user.Metadata = map[string]string{"plan": "pro"}
+	user.LastLoginAt = &lastLogin
+
+	require.NoError(t, s.CreateUser(ctx, user))
+
+	got, err := s.GetUserByEmail(ctx, user.Email)
+	require.NoError(t, err)
+	assert.Equal(t, user, got)
+
+	got, err = s.GetUserByID(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, user, got)
+
+	dup := newUser(user.Email)
+	assert.ErrorIs(t, s.CreateUser(ctx, dup), models.ErrUserAlreadyExists)
+
+	_, err = s.GetUserByID(ctx, dup.ID)
+	assert.Equal(t, models.ErrNotFound("user"), err)
+
+	require.NoError(t, s.UpdatePassword(ctx, user.ID, []byte("new hash")))
+
+	user.Name, user.Locale, user.Metadata = "Sumit Kumar", "de-DE", nil
+	require.NoError(t, s.UpdateProfile(ctx, user))
+
+	login := time.Unix(1700000900, 0)
+	require.NoError(t, s.UpdateLastLogin(ctx, user.ID, login))
+
+	require.NoError(t, s.SaveTOTP(ctx, user.ID, &models.TOTP{Secret: "JBSWY3DPEHPK3PXP", Enabled: true, LastStep: 42}))
+
+	got, err = s.GetUserByID(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("new hash"), got.Password)
+	assert.Equal(t, "Sumit Kumar", got.Name)
+	assert.Equal(t, "de-DE", got.Locale)
+	assert.Empty(t, got.Metadata)
+	assert.Equal(t, login.Unix(), got.LastLoginAt.Unix())
+	assert.Equal(t, &models.TOTP{Secret: "JBSWY3DPEHPK3PXP", Enabled: true, LastStep: 42}, got.TOTP)
+	assert.True(t, got.MFAEnabled)
+}
+
+func testUserStatus(t *testing.T, s service.Storer) {
+	ctx := context.Background()
+	user := createUser(t, s, "sumit@kumar.com")
+
+	status := func() (bool, models.UserStatus) {
+		got, err := s.GetUserByID(ctx, user.ID)
+		require.NoError(t, err)
+
+		return got.Verified, got.Status
+	}
+
+	require.NoError(t, s.MarkUserVerified(ctx, user.Email))
+	verified, st := status()
+	assert.True(t, verified)
+	assert.Equal(t, models.StatusActive, st)
+
+	require.NoError(t, s.SetVerified(ctx, user.ID, false))
+	verified, st = status()
+	assert.False(t, verified)
+	assert.Equal(t, models.StatusPendingVerification, st)
+
+	// a disabled account stays disabled
+	require.NoError(t, s.SetStatus(ctx, user.ID, models.StatusDisabled))
+	require.NoError(t, s.SetVerified(ctx, user.ID, true))
+	verified, st = status()
+	assert.True(t, verified)
+	assert.Equal(t, models.StatusDisabled, st)
+
+	assert.Equal(t, models.ErrNotFound("user"), s.MarkUserVerified(ctx, "nobody@kumar.com"))
+}
+
+func testChangeEmail(t *testing.T, s service.Storer) {
+	ctx := context.Background()
+	user := createUser(t, s, "sumit@kumar.com")
+	other := createUser(t, s, "other@kumar.com")
+
+	require.NoError(t, s.MarkUserVerified(ctx, user.Email))
+
+	assert.ErrorIs(t, s.ChangeEmail(ctx, user.ID, other.Email), models.ErrUserAlreadyExists)
+
+	require.NoError(t, s.ChangeEmail(ctx, user.ID, "new@kumar.com"))
+
+	got, err := s.GetUserByEmail(ctx, "new@kumar.com")
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, got.ID)
+	assert.False(t, got.Verified)
+	assert.Equal(t, models.StatusPendingVerification, got.Status)
+
+	_, err = s.GetUserByEmail(ctx, user.Email)
+	assert.Equal(t, models.ErrNotFound("user"), err)
+
+	// the old email is free again
+	createUser(t, s, user.Email)
+
+	// a rename keeps the verification
+	legacy := createUser(t, s, "Legacy@Kumar.com")
+	require.NoError(t, s.MarkUserVerified(ctx, legacy.Email))
+	assert.ErrorIs(t, s.RenameEmail(ctx, legacy.ID, other.Email), models.ErrUserAlreadyExists)
+	require.NoError(t, s.RenameEmail(ctx, legacy.ID, "legacy@kumar.com"))
+
+	got, err = s.GetUserByEmail(ctx, "legacy@kumar.com")
+	require.NoError(t, err)
+	assert.Equal(t, legacy.ID, got.ID)
+	assert.True(t, got.Verified)
+	assert.Equal(t, models.StatusActive, got.Status)
+
+	_, err = s.GetUserByEmail(ctx, legacy.Email)
+	assert.Equal(t, models.ErrNotFound("user"), err)
+	assert.Equal(t, models.ErrNotFound("user"), s.RenameEmail(ctx, "missing", "missing@kumar.com"))
+}
+
+func testListUsers(t *testing.T, s service.Storer) {
+	ctx := context.Background()
+	emails := []string{"a_b@kumar.com", "axb@kumar.com", "abc@kumar.com", "abd@kumar.com", "abe@kumar.com", "zed@kumar.com"}
+
+	for _, email := range emails {
+		createUser(t, s, email)
+	}
+
+	// a page may hold fewer or more users than the limit, every user shows up once
+	list := func(prefix string) []string {
+		var (
+			got    []string
+			cursor string
+		)
+
+		for range len(emails) + 1 {
+			page, err := s.ListUsers(ctx, &models.UserQuery{Cursor: cursor, EmailPrefix: prefix, Limit: 2})
+			require.NoError(t, err)
+
+			for _, u := range page.Users {
+				got = append(got, u.Email)
+			}
+
+			if cursor = page.NextCursor; cursor == "" {
+				break
+			}
+		}
+
+		slices.Sort(got)
+
+		return got
+	}
+
+	all := slices.Clone(emails)
+	slices.Sort(all)
+
+	assert.Equal(t, all, list(""))
+	assert.Equal(t, []string{"abc@kumar.com", "abd@kumar.com", "abe@kumar.com"}, list("ab"))
+	assert.Equal(t, []string{"a_b@kumar.com"}, list("a_"))
+	assert.Empty(t, list("nobody"))
+}
+
+func testDeleteUser(t *testing.T, s service.Storer) {
+	ctx := context.Background()
+	user := createUser(t, s, "sumit@kumar.com")
+
+	require.NoError(t, s.SaveRecoveryCodes(ctx, user.ID, []string{"code"}))
+	require.NoError(t, s.AddPasswordHistory(ctx, user.ID, []byte("old"), 3))
+	require.NoError(t, s.GrantAccess(ctx, user.ID, &models.Access{Roles: []string{"admin"}}))
+	require.NoError(t, s.CreatePasskey(ctx, &models.Passkey{ID: "cred", UserID: user.ID, PublicKey: []byte("key"),
+		CreatedAt: time.Unix(1700000000, 0).UTC()}))
+
+	require.NoError(t, s.DeleteUser(ctx, user.ID))
+	assert.Equal(t, models.ErrNotFound("user"), s.DeleteUser(ctx, user.ID))
+
+	_, err := s.GetUserByEmail(ctx, user.Email)
+	assert.Equal(t, models.ErrNotFound("user"), err)
+
+	// a new account with the same email starts without the data of the deleted one
+	again := createUser(t, s, user.Email)
+
+	ok, err := s.ConsumeRecoveryCode(ctx, user.ID, "code")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	history, err := s.GetPasswordHistory(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Empty(t, history)
+
+	access, err := s.GetAccess(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Empty(t, access.Roles)
+
+	passkeys, err := s.ListPasskeys(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Empty(t, passkeys)
+
+	// the credential can be registered again
+	require.NoError(t, s.CreatePasskey(ctx, &models.Passkey{ID: "cred", UserID: again.ID, PublicKey: []byte("key"),
+		CreatedAt: time.Unix(1700000000, 0).UTC()}))
+}
+
+// UserUpdates returns every update of a user record and its access, none may bring back data of a
+// deleted user
+func UserUpdates(s service.Storer, id string) []func(ctx context.Context) error {
+	return []func(ctx context.Context) error{
+		func(ctx context.Context) error { return s.UpdatePassword(ctx, id, []byte("hash")) },
+		func(ctx context.Context) error { return s.UpdateProfile(ctx, &models.UserData{ID: id, Name: "Sumit"}) },
+		func(ctx context.Context) error { return s.SaveTOTP(ctx, id, &models.TOTP{Secret: "secret"}) },
+		func(ctx context.Context) error { return s.SetStatus(ctx, id, models.StatusDisabled) },
+		func(ctx context.Context) error { return s.UpdateLastLogin(ctx, id, time.Now()) },
+		func(ctx context.Context) error {
+			return s.GrantAccess(ctx, id, &models.Access{Roles: []string{"admin"}, Permissions: []string{"users:write"}})
+		},
+	}
+}
+
+// RaceDeleteUser runs every update of the user while it is deleted and returns the error of DeleteUser
+func RaceDeleteUser(t *testing.T, s service.Storer, id string) error {
+	t.Helper()
+
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+
+	for _, update := range UserUpdates(s, id) {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			if err := update(ctx); err != nil && !errors.Is(err, models.ErrNotFound("user")) {
+				t.Error(err)
+			}
+		}()
+	}
+
+	err := s.DeleteUser(ctx, id)
+	wg.Wait()
+
+	return err
+}
+
+func testUpdateDeletedUser(t *testing.T, s service.Storer) {
+	ctx := context.Background()
+	user := createUser(t, s, "sumit@kumar.com")
+
+	require.NoError(t, s.DeleteUser(ctx, user.ID))
+
+	for i, update := range UserUpdates(s, user.ID) {
+		assert.Equalf(t, models.ErrNotFound("user"), update(ctx), "TEST[%d] Failed - update after delete", i)
+	}
+
+	// updates racing the delete either land before it or find the user gone
+	for range 20 {
+		user = createUser(t, s, "sumit@kumar.com")
+		require.NoError(t, RaceDeleteUser(t, s, user.ID))
+
+		_, err := s.GetUserByID(ctx, user.ID)
+		require.Equal(t, models.ErrNotFound("user"), err)
+
+		_, err = s.GetUserByEmail(ctx, user.Email)
+		require.Equal(t, models.ErrNotFound("user"), err)
+
+		access, err := s.GetAccess(ctx, user.ID)
+		require.NoError(t, err)
+		require.Empty(t, access.Roles)
+		require.Empty(t, access.Permissions)
+	}
+}
+
+func testMissingUser(t *testing.T, s service.Storer) {
+	ctx := context.Background()
+	id := uuid.NewString()
+	notFound := models.ErrNotFound("user")
+
+	_, err := s.GetUserByID(ctx, id)
+	assert.Equal(t, notFound, err)
+
+	_, err = s.GetUserByEmail(ctx, "nobody@kumar.com")
+	assert.Equal(t, notFound, err)
+
+	assert.Equal(t, notFound, s.UpdatePassword(ctx, id, []byte("hash")))
+	assert.Equal(t, notFound, s.UpdateProfile(ctx, &models.UserData{ID: id}))
+	assert.Equal(t, notFound, s.UpdateLastLogin(ctx, id, time.Now()))
+	assert.Equal(t, notFound, s.SaveTOTP(ctx, id, &models.TOTP{Secret: "secret"}))
+	assert.Equal(t, notFound, s.ChangeEmail(ctx, id, "new@kumar.com"))
+	assert.Equal(t, notFound, s.SetVerified(ctx, id, true))
+	assert.Equal(t, notFound, s.SetStatus(ctx, id, models.StatusDisabled))
+	assert.Equal(t, notFound, s.GrantAccess(ctx, id, &models.Access{Roles: []string{"admin"}}))
+	assert.Equal(t, notFound, s.RevokeAccess(ctx, id, &models.Access{Roles: []string{"admin"}}))
+
+	// the failed updates did not create the user
+	_, err = s.GetUserByID(ctx, id)
+	assert.Equal(t, notFound, err)
+}
+
+func testPasswordHistory(t *testing.T, s service.Storer) {
+	ctx := context.Background()
+	user := createUser(t, s, "sumit@kumar.com")
+
+	history, err := s.GetPasswordHistory(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Empty(t, history)
+
+	for _, hash := range []string{"first", "second", "third"} {
+		require.NoError(t, s.AddPasswordHistory(ctx, user.ID, []byte(hash), 2))
+	}
+
+	history, err = s.GetPasswordHistory(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("third"), []byte("second")}, history)
+}
+
+func testRecoveryCodes(t *testing.T, s service.Storer) {
+	ctx := context.Background()
+	user := createUser(t, s, "sumit@kumar.com")
+
+	consume := func(hash string) bool {
+		ok, err := s.ConsumeRecoveryCode(ctx, user.ID, hash)
+		require.NoError(t, err)
+
+		return ok
+	}
+
+	require.NoError(t, s.SaveRecoveryCodes(ctx, user.ID, []string{"a", "b", "c"}))
+	assert.True(t, consume("b"))
+	assert.False(t, consume("b"))
+	assert.False(t, consume("d"))
+
+	// new codes replace the old ones
+	require.NoError(t, s.SaveRecoveryCodes(ctx, user.ID, []string{"d", "e"}))
+	assert.False(t, consume("a"))
+	assert.True(t, consume("d"))
+}
+
+func testAccess(t *testing.T, s service.Storer) {
+	ctx := context.Background()
+	user := createUser(t, s, "sumit@kumar.com")
+
+	access, err := s.GetAccess(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Empty(t, access.Roles)
+	assert.Empty(t, access.Permissions)
+
+	require.NoError(t, s.GrantAccess(ctx, user.ID, &models.Access{Roles: []string{"support", "admin"},
+		Permissions: []string{"users:read"}}))
+	require.NoError(t, s.GrantAccess(ctx, user.ID, &models.Access{Roles: []string{"admin"}, Permissions: []string{"billing:read"}}))
+
+	access, err = s.GetAccess(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"admin", "support"}, access.Roles)
+	assert.Equal(t, []string{"billing:read", "users:read"}, access.Permissions)
+
+	require.NoError(t, s.RevokeAccess(ctx, user.ID, &models.Access{Roles: []string{"support", "unknown"},
+		Permissions: []string{"users:read"}}))
+
+	access, err = s.GetAccess(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"admin"}, access.Roles)
+	assert.Equal(t, []string{"billing:read"}, access.Permissions)
+}
+
+func testPasskeys(t *testing.T, s service.Storer) {
+	ctx := context.Background()
+	user := createUser(t, s, "sumit@kumar.com")
+
+	passkeys, err := s.ListPasskeys(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Empty(t, passkeys)
+
+	got, err := s.GetUserByID(ctx, user.ID)
+	require.NoError(t, err)
+	assert.False(t, got.MFAEnabled)
+
+	p := &models.Passkey{
+		ID:              "cred-1",
+		UserID:          user.ID,
+		Name:            "Laptop",
+		PublicKey:       []byte("public key"),
+		AttestationType: "none",
+		AAGUID:          []byte("0123456789abcdef"),
+		Transports:      []string{"internal", "hybrid"},
+		SignCount:       7,
+		BackupEligible:  true,
+		CreatedAt:       time.Unix(1700000000, 0).UTC(),
+	}
+
+	require.NoError(t, s.CreatePasskey(ctx, p))
+	assert.ErrorIs(t, s.CreatePasskey(ctx, p), models.ErrPasskeyExists)
+
+	passkeys, err = s.ListPasskeys(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []models.Passkey{*p}, passkeys)
+
+	// a passkey enables MFA without an authenticator app
+	got, err = s.GetUserByID(ctx, user.ID)
+	require.NoError(t, err)
+	assert.True(t, got.MFAEnabled)
+	assert.Nil(t, got.TOTP)
+
+	page, err := s.ListUsers(ctx, &models.UserQuery{Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, page.Users, 1)
+	assert.True(t, page.Users[0].MFAEnabled)
+
+	usedAt := time.Unix(1700000600, 0).UTC()
+	p.SignCount, p.CloneWarning, p.BackupState, p.LastUsedAt = 8, true, true, &usedAt
+	require.NoError(t, s.UpdatePasskeyUsage(ctx, p))
+
+	passkeys, err = s.ListPasskeys(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []models.Passkey{*p}, passkeys)
+
+	// an update without a time keeps the last use
+	p.SignCount, p.LastUsedAt = 9, nil
+	require.NoError(t, s.UpdatePasskeyUsage(ctx, p))
+
+	passkeys, err = s.ListPasskeys(ctx, user.ID)
+	require.NoError(t, err)
+	require.Len(t, passkeys, 1)
+	assert.Equal(t, uint32(9), passkeys[0].SignCount)
+	assert.Equal(t, &usedAt, passkeys[0].LastUsedAt)
+
+	assert.Equal(t, models.ErrNotFound("passkey"), s.UpdatePasskeyUsage(ctx, &models.Passkey{ID: "missing"}))
+}
+
+func testOneTimeTokens(t *testing.T, s service.Storer) {
+	ctx := context.Background()
+	notFound := models.ErrNotFound("token")
+
+	require.NoError(t, s.SaveOneTimeToken(ctx, "verify", "abc", "sumit@kumar.com", time.Hour))
+	require.NoError(t, s.SaveOneTimeToken(ctx, "reset", "abc", "other@kumar.com", time.Hour))
+
+	value, err := s.GetOneTimeToken(ctx, "verify", "abc")
+	require.NoError(t, err)
+	assert.Equal(t, "sumit@kumar.com", value)
+
+	// saving again replaces the value
+	require.NoError(t, s.SaveOneTimeToken(ctx, "verify", "abc", "new@kumar.com", time.Hour))
+
+	value, err = s.ConsumeOneTimeToken(ctx, "verify", "abc")
+	require.NoError(t, err)
+	assert.Equal(t, "new@kumar.com", value)
+
+	_, err = s.ConsumeOneTimeToken(ctx, "verify", "abc")
+	assert.Equal(t, notFound, err)
+
+	_, err = s.GetOneTimeToken(ctx, "verify", "abc")
+	assert.Equal(t, notFound, err)
+
+	// tokens of other purposes are separate
+	value, err = s.GetOneTimeToken(ctx, "reset", "abc")
+	require.NoError(t, err)
+	assert.Equal(t, "other@kumar.com", value)
+}
+
+func testCountersAndLocks(t *testing.T, s service.Storer) {
+	ctx := context.Background()
+
+	for want := int64(1); want <= 3; want++ {
+		n, err := s.IncrCounter(ctx, "signin:sumit@kumar.com", time.Hour)
+		require.NoError(t, err)
+		assert.Equal(t, want, n)
+	}
+
+	n, err := s.IncrCounter(ctx, "signin:other@kumar.com", time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+
+	require.NoError(t, s.ResetCounter(ctx, "signin:sumit@kumar.com", "signin:missing"))
+
+	n, err = s.IncrCounter(ctx, "signin:sumit@kumar.com", time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+
+	d, err := s.LockedFor(ctx, "sumit@kumar.com")
+	require.NoError(t, err)
+	assert.Zero(t, d)
+
+	require.NoError(t, s.Lock(ctx, "sumit@kumar.com", time.Minute))
+
+	d, err = s.LockedFor(ctx, "sumit@kumar.com")
+	require.NoError(t, err)
+	assert.Greater(t, d, 50*time.Second)
+	assert.LessOrEqual(t, d, time.Minute)
+
+	// a new lock replaces the running one
+	require.NoError(t, s.Lock(ctx, "sumit@kumar.com", time.Hour))
+
+	d, err = s.LockedFor(ctx, "sumit@kumar.com")
+	require.NoError(t, err)
+	assert.Greater(t, d, 59*time.Minute)
+}
+
+func newTokenData(familyID string) *models.TokenData {
+	now := time.Now()
+
+	return &models.TokenData{
+		FamilyID:         familyID,
+		Client:           models.ClientInfo{IP: "192.0.2.1", UserAgent: "curl/8.0"},
+		AccessID:         uuid.NewString(),
+		AccessExpiresAt:  now.Add(15 * time.Minute).Unix(),
+		RefreshID:        uuid.NewString(),
+		RefreshExpiresAt: now.Add(24 * time.Hour).Unix(),
+	}
+}
+
+func testTokens(t *testing.T, s service.Storer) {
+	ctx := context.Background()
+	td := newTokenData("")
+
+	revoked := func(id string) bool {
+		r, err := s.IsTokenRevoked(ctx, id)
+		require.NoError(t, err)
+
+		return r
+	}
+
+	assert.True(t, revoked(td.AccessID))
+
+	require.NoError(t, s.CreateToken(ctx, "sumit@kumar.com", td))
+	assert.False(t, revoked(td.AccessID))
+	assert.False(t, revoked(td.RefreshID))
+
+	// a token without family has no session
+	families, err := s.ListFamilies(ctx, "sumit@kumar.com")
+	require.NoError(t, err)
+	assert.Empty(t, families)
+
+	require.NoError(t, s.DeleteToken(ctx, td.AccessID))
+	assert.True(t, revoked(td.AccessID))
+	assert.False(t, revoked(td.RefreshID))
+
+	assert.Error(t, s.DeleteToken(ctx, td.AccessID, td.RefreshID))
+	assert.True(t, revoked(td.RefreshID))
+}
+
+func testTokenFamilies(t *testing.T, s service.Storer) {
+	ctx := context.Background()
+	email := "sumit@kumar.com"
+
+	first := newTokenData(uuid.NewString())
+	second := newTokenData(uuid.NewString())
+	other := newTokenData(uuid.NewString())
+
+	require.NoError(t, s.CreateToken(ctx, email, first))
+	require.NoError(t, s.CreateToken(ctx, email, second))
+	require.NoError(t, s.CreateToken(ctx, "other@kumar.com", other))
+
+	family, err := s.GetFamily(ctx, first.FamilyID)
+	require.NoError(t, err)
+	assert.Equal(t, first.FamilyID, family.ID)
+	assert.Equal(t, email, family.Email)
+	assert.Equal(t, first.AccessID, family.AccessID)
+	assert.Equal(t, first.RefreshID, family.RefreshID)
+	assert.Equal(t, first.Client, family.Client)
+	assert.NotZero(t, family.CreatedAt)
+	assert.GreaterOrEqual(t, family.RefreshedAt, family.CreatedAt)
+
+	// a rotation moves the family to the new pair and keeps its creation time
+	rotated := newTokenData(first.FamilyID)
+	rotated.Client.IP = "192.0.2.2"
+	require.NoError(t, s.CreateToken(ctx, email, rotated))
+
+	family, err = s.GetFamily(ctx, first.FamilyID)
+	require.NoError(t, err)
+	createdAt := family.CreatedAt
+	assert.Equal(t, rotated.AccessID, family.AccessID)
+	assert.Equal(t, rotated.RefreshID, family.RefreshID)
+	assert.Equal(t, "192.0.2.2", family.Client.IP)
+	assert.Equal(t, createdAt, family.CreatedAt)
+
+	families, err := s.ListFamilies(ctx, email)
+	require.NoError(t, err)
+
+	ids := make([]string, len(families))
+	for i, f := range families {
+		ids[i] = f.ID
+	}
+
+	assert.ElementsMatch(t, []string{first.FamilyID, second.FamilyID}, ids)
+
+	require.NoError(t, s.RevokeFamily(ctx, first.FamilyID))
+
+	_, err = s.GetFamily(ctx, first.FamilyID)
+	assert.Equal(t, models.ErrNotFound("token family"), err)
+	assert.Equal(t, models.ErrNotFound("token family"), s.RevokeFamily(ctx, first.FamilyID))
+
+	for _, id := range []string{rotated.AccessID, rotated.RefreshID} {
+		r, err := s.IsTokenRevoked(ctx, id)
+		require.NoError(t, err)
+		assert.True(t, r)
+	}
+
+	families, err = s.ListFamilies(ctx, email)
+	require.NoError(t, err)
+	require.Len(t, families, 1)
+	assert.Equal(t, second.FamilyID, families[0].ID)
+
+	families, err = s.ListFamilies(ctx, "nobody@kumar.com")
+	require.NoError(t, err)
+	assert.NotNil(t, families)
+	assert.Empty(t, families)
+}
+
+func testKeyRings(t *testing.T, s service.Storer) {
+	ctx := context.Background()
+
+	empty, err := s.GetKeyRing(ctx, "access")
+	require.NoError(t, err)
+	assert.Equal(t, &models.KeyRingState{}, empty)
+
+	first := &models.KeyRingState{Keys: []models.StoredKey{
+		{ID: "configured", Alg: "HS256", ActiveFrom: 1700000000000, RetireAt: 1700000900000},
+		{ID: "rotated", Alg: "ES256", Private: []byte("private key"), ActiveFrom: 1700000060000},
+	}}
+	require.NoError(t, s.SaveKeyRing(ctx, "access", first))
+
+	// a save based on an outdated version is refused
+	assert.Equal(t, models.ErrKeyRingChanged, s.SaveKeyRing(ctx, "access", first))
+
+	got, err := s.GetKeyRing(ctx, "access")
+	require.NoError(t, err)
+	assert.Equal(t, &models.KeyRingState{Version: 1, Keys: first.Keys}, got)
+
+	second := &models.KeyRingState{Version: 1, Keys: first.Keys[1:]}
+	require.NoError(t, s.SaveKeyRing(ctx, "access", second))
+	assert.Equal(t, models.ErrKeyRingChanged, s.SaveKeyRing(ctx, "access", second))
+
+	got, err = s.GetKeyRing(ctx, "access")
+	require.NoError(t, err)
+	assert.Equal(t, &models.KeyRingState{Version: 2, Keys: second.Keys}, got)
+
+	// rings are kept apart
+	refresh, err := s.GetKeyRing(ctx, "refresh")
+	require.NoError(t, err)
+	assert.Zero(t, refresh.Version)
+}
@@ -0,0 +1,84 @@
+package store
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"auth-rest-api/internal/models"
+	"auth-rest-api/internal/service"
+	"auth-rest-api/internal/store/storetest"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore_Suite(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) service.Storer {
+		mr := miniredis.RunT(t)
+
+		return New(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	})
+}
+
+// deleteAfterFirst deletes the user once the first command of an update returned, which is between the
+// check and the write of an update that is not atomic
+type deleteAfterFirst struct {
+	once sync.Once
+	del  func()
+}
+
+func (h *deleteAfterFirst) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (h *deleteAfterFirst) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		err := next(ctx, cmd)
+
+		// connection set up is not part of the update
+		if name := cmd.Name(); name != "hello" && name != "client" {
+			h.once.Do(h.del)
+		}
+
+		return err
+	}
+}
+
+func (h *deleteAfterFirst) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return next
+}
+
+func TestStore_UpdateDeletedUser(t *testing.T) {
+	mr := miniredis.RunT(t)
+	s := New(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	ctx := context.Background()
+
+	for i := range storetest.UserUpdates(s, "") {
+		user := &models.UserData{ID: uuid.NewString(), Email: "sumit@kumar.com", Password: []byte("hash"),
+			Status: models.StatusActive, CreatedAt: time.Unix(1700000000, 0)}
+		require.NoError(t, s.CreateUser(ctx, user))
+
+		client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+		client.AddHook(&deleteAfterFirst{del: func() { require.NoError(t, s.DeleteUser(ctx, user.ID)) }})
+
+		err := storetest.UserUpdates(New(client), user.ID)[i](ctx)
+		if err != nil {
+			assert.Equalf(t, models.ErrNotFound("user"), err, "TEST[%d] Failed", i)
+		}
+
+		// a write after the check would recreate a partial record or the access sets of the deleted user
+		for _, key := range mr.Keys() {
+			for _, prefix := range []string{userPrefix, rolesPrefix, permissionsPrefix} {
+				assert.Falsef(t, strings.HasPrefix(key, prefix), "TEST[%d] Failed - left behind %s", i, key)
+			}
+		}
+
+		require.NoError(t, client.Close())
+	}
+}
@@ -0,0 +1,548 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"auth-rest-api/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// emailIndex maps the email of every user to the user ID
+	emailIndex = "users"
+	userPrefix = "user:"
+	// verifiedTable holds the verified emails of users created before user records existed
+	verifiedTable  = "users:verified"
+	recoveryPrefix = "recovery:"
+	historyPrefix  = "password-history:"
+)
+
+// migrateUserScript turns a legacy email -> password hash entry into a user record. It returns the
+// user ID the email points to afterwards, which is the one of a concurrent migration if that won.
+var migrateUserScript = redis.NewScript(`
+local current = redis.call('HGET', KEYS[1], ARGV[1])
+if current ~= ARGV[2] then
+	return current
+end
+
+local verified = redis.call('SISMEMBER', KEYS[2], ARGV[1])
+redis.call('HSET', KEYS[3], 'id', ARGV[3], 'email', ARGV[1], 'password', ARGV[2], 'verified', verified, 'created_at', ARGV[4])
+redis.call('HSET', KEYS[1], ARGV[1], ARGV[3])
+redis.call('SREM', KEYS[2], ARGV[1])
+
+return ARGV[3]
+`)
+
+// createUserScript claims the email in the index and writes the user record in one step, so a
+// concurrent sign up for the same email can neither overwrite the record nor leave a half created
+// user. It returns 0 when the email is taken.
+var createUserScript = redis.NewScript(`
+if redis.call('HSETNX', KEYS[1], ARGV[1], ARGV[2]) == 0 then
+	return 0
+end
+
+redis.call('HSET', KEYS[2], unpack(ARGV, 3))
+
+return 1
+`)
+
+// changeEmailScript moves the email index entry of the user to the new email in one step. With ARGV[3]
+// set the new address starts unverified and an active account is pending verification again. It returns
+// -1 when the new email is taken and 0 when the user does not exist.
+var changeEmailScript = redis.NewScript(`
+if redis.call('HEXISTS', KEYS[1], ARGV[1]) == 1 then
+	return -1
+end
+
+local old = redis.call('HGET', KEYS[2], 'email')
+if not old then
+	return 0
+end
+
+redis.call('HSET', KEYS[1], ARGV[1], ARGV[2])
+redis.call('HDEL', KEYS[1], old)
+redis.call('HSET', KEYS[2], 'email', ARGV[1])
+if ARGV[3] == '1' then
+	redis.call('HSET', KEYS[2], 'verified', 0)
+	if redis.call('HGET', KEYS[2], 'status') == 'active' then
+		redis.call('HSET', KEYS[2], 'status', 'pending_verification')
+	end
+end
+
+return 1
+`)
+
+// setVerifiedScript sets the verified flag and moves the account between active and pending
+// verification, disabled and locked accounts keep their status. It returns 0 when the user does not exist.
+var setVerifiedScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return 0
+end
+
+local status = redis.call('HGET', KEYS[1], 'status')
+redis.call('HSET', KEYS[1], 'verified', ARGV[1])
+
+if ARGV[1] == '1' and status == 'pending_verification' then
+	redis.call('HSET', KEYS[1], 'status', 'active')
+elseif ARGV[1] == '0' and status == 'active' then
+	redis.call('HSET', KEYS[1], 'status', 'pending_verification')
+end
+
+return 1
+`)
+
+// deleteUserScript drops the user record and its email index entry in one step, it returns 0 when the
+// user does not exist
+var deleteUserScript = redis.NewScript(`
+local email = redis.call('HGET', KEYS[2], 'email')
+if not email then
+	return 0
+end
+
+if redis.call('HGET', KEYS[1], email) == ARGV[1] then
+	redis.call('HDEL', KEYS[1], email)
+end
+
+redis.call('DEL', KEYS[2])
+
+return 1
+`)
+
+// updateUserScript sets fields of the user record only while it exists, so an update racing a
+// DeleteUser cannot recreate a partial record. It returns 0 when the user does not exist.
+var updateUserScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return 0
+end
+
+redis.call('HSET', KEYS[1], unpack(ARGV))
+
+return 1
+`)
+
+// globEscaper escapes the pattern characters of HSCAN MATCH
+var globEscaper = strings.NewReplacer(`\`, `\\`, "*", `\*`, "?", `\?`, "[", `\[`, "]", `\]`)
+
+// CreateUser claims the email in the index and stores the user record under the user ID atomically,
+// it returns ErrUserAlreadyExists when the email is taken
+func (s *Store) CreateUser(ctx context.Context, user *models.UserData) error {
+	args := append([]any{user.Email, user.ID}, userFields(user)...)
+
+	created, err := createUserScript.Run(ctx, s.DB, []string{emailIndex, userPrefix + user.ID}, args...).Int()
+	if err != nil {
+		return err
+	}
+
+	if created == 0 {
+		return models.ErrUserAlreadyExists
+	}
+
+	return nil
+}
+
+func (s *Store) GetUserByEmail(ctx context.Context, email string) (*models.UserData, error) {
+	id, err := s.DB.HGet(ctx, emailIndex, email).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, models.ErrNotFound("user")
+		}
+
+		return nil, err
+	}
+
+	if id == "" {
+		return nil, models.ErrNotFound("user")
+	}
+
+	// users created before user records existed map their email to the password hash
+	if uuid.Validate(id) != nil {
+		if id, err = s.migrateLegacyUser(ctx, email, id); err != nil {
+			return nil, err
+		}
+	}
+
+	return s.GetUserByID(ctx, id)
+}
+
+func (s *Store) GetUserByID(ctx context.Context, id string) (*models.UserData, error) {
+	var (
+		vals     *redis.MapStringStringCmd
+		passkeys *redis.IntCmd
+	)
+
+	if _, err := s.DB.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		vals = pipe.HGetAll(ctx, userPrefix+id)
+		passkeys = pipe.SCard(ctx, userPasskeysPrefix+id)
+
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	if len(vals.Val()) == 0 {
+		return nil, models.ErrNotFound("user")
+	}
+
+	return userFromHash(vals.Val(), passkeys.Val()), nil
+}
+
+func (s *Store) migrateLegacyUser(ctx context.Context, email, hash string) (string, error) {
+	id := uuid.NewString()
+	keys := []string{emailIndex, verifiedTable, userPrefix + id}
+
+	id, err := migrateUserScript.Run(ctx, s.DB, keys, email, hash, id, time.Now().Unix()).Text()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return "", models.ErrNotFound("user")
+		}
+
+		return "", err
+	}
+
+	return id, nil
+}
+
+// UpdatePassword replaces the password hash of an existing user
+func (s *Store) UpdatePassword(ctx context.Context, id string, hash []byte) error {
+	return s.updateUser(ctx, id, "password", hash)
+}
+
+// UpdateProfile stores the editable profile fields of the user
+func (s *Store) UpdateProfile(ctx context.Context, user *models.UserData) error {
+	metadata, err := json.Marshal(user.Metadata)
+	if err != nil {
+		return err
+	}
+
+	return s.updateUser(ctx, user.ID, "name", user.Name, "locale", user.Locale, "metadata", metadata)
+}
+
+// SaveTOTP stores the authenticator app enrollment of the user
+func (s *Store) SaveTOTP(ctx context.Context, id string, totp *models.TOTP) error {
+	return s.updateUser(ctx, id, "totp_secret", totp.Secret, "totp_enabled", boolToInt(totp.Enabled),
+		"totp_last_step", totp.LastStep)
+}
+
+// SaveRecoveryCodes replaces the recovery code hashes of the user
+func (s *Store) SaveRecoveryCodes(ctx context.Context, id string, hashes []string) error {
+	members := make([]any, len(hashes))
+	for i, h := range hashes {
+		members[i] = h
+	}
+
+	_, err := s.DB.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, recoveryPrefix+id)
+		pipe.SAdd(ctx, recoveryPrefix+id, members...)
+
+		return nil
+	})
+
+	return err
+}
+
+// ConsumeRecoveryCode removes the recovery code hash, it reports false when the code was not found
+func (s *Store) ConsumeRecoveryCode(ctx context.Context, id, hash string) (bool, error) {
+	n, err := s.DB.SRem(ctx, recoveryPrefix+id, hash).Result()
+	if err != nil {
+		return false, err
+	}
+
+	return n == 1, nil
+}
+
+// AddPasswordHistory records hash as the latest previous password of the user, only the newest keep
+// hashes are kept
+func (s *Store) AddPasswordHistory(ctx context.Context, id string, hash []byte, keep int) error {
+	_, err := s.DB.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.LPush(ctx, historyPrefix+id, hash)
+		pipe.LTrim(ctx, historyPrefix+id, 0, int64(keep-1))
+
+		return nil
+	})
+
+	return err
+}
+
+// GetPasswordHistory returns the previous password hashes of the user, newest first
+func (s *Store) GetPasswordHistory(ctx context.Context, id string) ([][]byte, error) {
+	vals, err := s.DB.LRange(ctx, historyPrefix+id, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	hashes := make([][]byte, len(vals))
+	for i, v := range vals {
+		hashes[i] = []byte(v)
+	}
+
+	return hashes, nil
+}
+
+func (s *Store) UpdateLastLogin(ctx context.Context, id string, at time.Time) error {
+	return s.updateUser(ctx, id, "last_login_at", at.Unix())
+}
+
+// ChangeEmail points the new email to the user and drops the old one from the index, the new address
+// has to be verified again
+func (s *Store) ChangeEmail(ctx context.Context, id, newEmail string) error {
+	return s.moveEmail(ctx, id, newEmail, true)
+}
+
+// RenameEmail moves the user to another spelling of the same address, e.g. its normalized form, the
+// verification and status are kept
+func (s *Store) RenameEmail(ctx context.Context, id, email string) error {
+	return s.moveEmail(ctx, id, email, false)
+}
+
+func (s *Store) moveEmail(ctx context.Context, id, email string, unverify bool) error {
+	res, err := changeEmailScript.Run(ctx, s.DB, []string{emailIndex, userPrefix + id}, email, id, boolToInt(unverify)).Int()
+	if err != nil {
+		return err
+	}
+
+	switch res {
+	case -1:
+		return models.ErrUserAlreadyExists
+	case 0:
+		return models.ErrNotFound("user")
+	}
+
+	return nil
+}
+
+func (s *Store) MarkUserVerified(ctx context.Context, email string) error {
+	user, err := s.GetUserByEmail(ctx, email)
+	if err != nil {
+		return err
+	}
+
+	return s.SetVerified(ctx, user.ID, true)
+}
+
+// SetVerified marks the email of the user as verified or unverified
+func (s *Store) SetVerified(ctx context.Context, id string, verified bool) error {
+	res, err := setVerifiedScript.Run(ctx, s.DB, []string{userPrefix + id}, boolToInt(verified)).Int()
+	if err != nil {
+		return err
+	}
+
+	if res == 0 {
+		return models.ErrNotFound("user")
+	}
+
+	return nil
+}
+
+// SetStatus changes the status of the user
+func (s *Store) SetStatus(ctx context.Context, id string, status models.UserStatus) error {
+	return s.updateUser(ctx, id, "status", string(status))
+}
+
+// ListUsers walks the email index with HSCAN, a page holds about query.Limit users or less when the
+// prefix matches few emails. The cursor is the HSCAN cursor.
+func (s *Store) ListUsers(ctx context.Context, query *models.UserQuery) (*models.UserPage, error) {
+	var cursor uint64
+
+	if query.Cursor != "" {
+		c, err := strconv.ParseUint(query.Cursor, 10, 64)
+		if err != nil {
+			return nil, models.ErrInvalid("cursor")
+		}
+
+		cursor = c
+	}
+
+	match := globEscaper.Replace(query.EmailPrefix) + "*"
+
+	var ids []string
+
+	for {
+		entries, next, err := s.DB.HScan(ctx, emailIndex, cursor, match, int64(query.Limit)).Result()
+		if err != nil {
+			return nil, err
+		}
+
+		for i := 0; i+1 < len(entries); i += 2 {
+			email, id := entries[i], entries[i+1]
+
+			// users created before user records existed map their email to the password hash
+			if uuid.Validate(id) != nil {
+				if id, err = s.migrateLegacyUser(ctx, email, id); err != nil {
+					return nil, err
+				}
+			}
+
+			ids = append(ids, id)
+		}
+
+		cursor = next
+		if cursor == 0 || len(ids) >= query.Limit {
+			break
+		}
+	}
+
+	page := &models.UserPage{Users: make([]models.UserData, 0, len(ids))}
+
+	if cursor != 0 {
+		page.NextCursor = strconv.FormatUint(cursor, 10)
+	}
+
+	if len(ids) == 0 {
+		return page, nil
+	}
+
+	cmds := make([]*redis.MapStringStringCmd, len(ids))
+	passkeys := make([]*redis.IntCmd, len(ids))
+
+	if _, err := s.DB.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, id := range ids {
+			cmds[i] = pipe.HGetAll(ctx, userPrefix+id)
+			passkeys[i] = pipe.SCard(ctx, userPasskeysPrefix+id)
+		}
+
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	for i, cmd := range cmds {
+		// the user was deleted while the index was read
+		if len(cmd.Val()) == 0 {
+			continue
+		}
+
+		page.Users = append(page.Users, *userFromHash(cmd.Val(), passkeys[i].Val()))
+	}
+
+	return page, nil
+}
+
+// DeleteUser removes the user record with its email, recovery codes, password history, roles and passkeys
+func (s *Store) DeleteUser(ctx context.Context, id string) error {
+	passkeys, err := s.DB.SMembers(ctx, userPasskeysPrefix+id).Result()
+	if err != nil {
+		return err
+	}
+
+	deleted, err := deleteUserScript.Run(ctx, s.DB, []string{emailIndex, userPrefix + id}, id).Int()
+	if err != nil {
+		return err
+	}
+
+	if deleted == 0 {
+		return models.ErrNotFound("user")
+	}
+
+	keys := []string{recoveryPrefix + id, historyPrefix + id, rolesPrefix + id, permissionsPrefix + id, userPasskeysPrefix + id}
+	for _, p := range passkeys {
+		keys = append(keys, passkeyPrefix+p)
+	}
+
+	return s.DB.Del(ctx, keys...).Err()
+}
+
+// updateUser sets fields of an existing user record, a deleted user is not recreated
+func (s *Store) updateUser(ctx context.Context, id string, values ...any) error {
+	updated, err := updateUserScript.Run(ctx, s.DB, []string{userPrefix + id}, values...).Int()
+	if err != nil {
+		return err
+	}
+
+	if updated == 0 {
+		return models.ErrNotFound("user")
+	}
+
+	return nil
+}
+
+func userFields(user *models.UserData) []any {
+	metadata, _ := json.Marshal(user.Metadata)
+
+	fields := []any{
+		"id", user.ID,
+		"email", user.Email,
+		"password", user.Password,
+		"verified", boolToInt(user.Verified),
+		"status", string(user.Status),
+		"name", user.Name,
+		"locale", user.Locale,
+		"metadata", metadata,
+		"created_at", user.CreatedAt.Unix(),
+	}
+
+	if user.LastLoginAt != nil {
+		fields = append(fields, "last_login_at", user.LastLoginAt.Unix())
+	}
+
+	if user.TOTP != nil {
+		fields = append(fields, "totp_secret", user.TOTP.Secret, "totp_enabled", boolToInt(user.TOTP.Enabled),
+			"totp_last_step", user.TOTP.LastStep)
+	}
+
+	return fields
+}
+
+// userFromHash reads a user record, a user with passkeys has MFA enabled like one with a confirmed
+// authenticator app
+func userFromHash(vals map[string]string, passkeys int64) *models.UserData {
+	user := &models.UserData{
+		ID:       vals["id"],
+		Email:    vals["email"],
+		Password: []byte(vals["password"]),
+		Verified: vals["verified"] == "1",
+		Status:   userStatus(vals),
+		Name:     vals["name"],
+		Locale:   vals["locale"],
+	}
+
+	if m := vals["metadata"]; m != "" && m != "null" {
+		_ = json.Unmarshal([]byte(m), &user.Metadata)
+	}
+
+	createdAt, _ := strconv.ParseInt(vals["created_at"], 10, 64)
+	user.CreatedAt = time.Unix(createdAt, 0).UTC()
+
+	if lastLogin, err := strconv.ParseInt(vals["last_login_at"], 10, 64); err == nil {
+		t := time.Unix(lastLogin, 0).UTC()
+		user.LastLoginAt = &t
+	}
+
+	if secret := vals["totp_secret"]; secret != "" {
+		lastStep, _ := strconv.ParseInt(vals["totp_last_step"], 10, 64)
+		user.TOTP = &models.TOTP{Secret: secret, Enabled: vals["totp_enabled"] == "1", LastStep: lastStep}
+	}
+
+	user.MFAEnabled = vals["totp_enabled"] == "1" || passkeys > 0
+
+	return user
+}
+
+// userStatus reads the status of the user, records written before statuses existed are derived from
+// their disabled and verified flags
+func userStatus(vals map[string]string) models.UserStatus {
+	switch {
+	case vals["status"] != "":
+		return models.UserStatus(vals["status"])
+	case vals["disabled"] == "1":
+		return models.StatusDisabled
+	case vals["verified"] == "1":
+		return models.StatusActive
+	default:
+		return models.StatusPendingVerification
+	}
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+
+	return 0
+}
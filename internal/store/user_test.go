@@ -0,0 +1,456 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"testing"
+	"time"
+
+	"auth-rest-api/internal/models"
+
+	"github.com/go-redis/redismock/v9"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+var uuidRe = regexp.MustCompile(`[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}`)
+
+// ignoreGenerated matches commands with generated user IDs, the last argument (a timestamp) is skipped
+func ignoreGenerated(expected, actual []any) error {
+	if len(expected) != len(actual) {
+		return fmt.Errorf("expected %v, got %v", expected, actual)
+	}
+
+	for i := 0; i < len(expected)-1; i++ {
+		if uuidRe.ReplaceAllString(fmt.Sprint(expected[i]), "<id>") != uuidRe.ReplaceAllString(fmt.Sprint(actual[i]), "<id>") {
+			return fmt.Errorf("expected %v, got %v", expected, actual)
+		}
+	}
+
+	return nil
+}
+
+func TestStore_CreateUser(t *testing.T) {
+	db, mock := redismock.NewClientMock()
+	s := New(db)
+	ctx := context.Background()
+	user := &models.UserData{ID: uuid.NewString(), Email: "dummy@testmail.com", Password: []byte(uuid.NewString()),
+		CreatedAt: time.Unix(100, 0)}
+
+	keys := []string{"users", "user:" + user.ID}
+	args := append([]any{user.Email, user.ID}, userFields(user)...)
+
+	tests := []struct {
+		name     string
+		mockCall func()
+		wantErr  error
+	}{
+		{
+			name:     "valid case",
+			mockCall: func() { mock.ExpectEvalSha(createUserScript.Hash(), keys, args...).SetVal(int64(1)) },
+		},
+		{
+			name:     "email entry found",
+			mockCall: func() { mock.ExpectEvalSha(createUserScript.Hash(), keys, args...).SetVal(int64(0)) },
+			wantErr:  models.ErrUserAlreadyExists,
+		},
+		{
+			name:     "db error",
+			mockCall: func() { mock.ExpectEvalSha(createUserScript.Hash(), keys, args...).SetErr(models.ErrDBNotConnected) },
+			wantErr:  models.ErrDBNotConnected,
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockCall()
+
+			assert.Equalf(t, tt.wantErr, s.CreateUser(ctx, user), "TEST[%d] Failed - %s", i, tt.name)
+		})
+	}
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestStore_GetUserByEmail(t *testing.T) {
+	db, mock := redismock.NewClientMock()
+	s := New(db)
+	ctx := context.Background()
+	email := "dummy@testmail.com"
+	id := uuid.NewString()
+	passwd := "$2a$10$" + uuid.NewString()
+	lastLogin := time.Unix(200, 0).UTC()
+
+	record := map[string]string{"id": id, "email": email, "password": passwd, "verified": "1", "name": "Sumit",
+		"metadata": `{"team":"auth"}`, "created_at": "100", "last_login_at": "200"}
+
+	tests := []struct {
+		name     string
+		mockCall func()
+		want     *models.UserData
+		wantErr  error
+	}{
+		{
+			name: "valid case",
+			mockCall: func() {
+				mock.ExpectHGet("users", email).SetVal(id)
+				mock.ExpectHGetAll("user:" + id).SetVal(record)
+				mock.ExpectSCard("passkeys:" + id).SetVal(0)
+			},
+			want: &models.UserData{ID: id, Email: email, Password: []byte(passwd), Verified: true, Name: "Sumit",
+				Metadata: map[string]string{"team": "auth"}, CreatedAt: time.Unix(100, 0).UTC(), LastLoginAt: &lastLogin,
+				Status: models.StatusActive},
+		},
+		{
+			name: "legacy entry is migrated",
+			mockCall: func() {
+				mock.ExpectHGet("users", email).SetVal(passwd)
+				mock.CustomMatch(ignoreGenerated).ExpectEvalSha(migrateUserScript.Hash(),
+					[]string{"users", "users:verified", "user:" + id}, email, passwd, id, time.Now().Unix()).SetVal(id)
+				mock.ExpectHGetAll("user:" + id).SetVal(map[string]string{"id": id, "email": email, "password": passwd,
+					"verified": "0", "created_at": "100"})
+				mock.ExpectSCard("passkeys:" + id).SetVal(0)
+			},
+			want: &models.UserData{ID: id, Email: email, Password: []byte(passwd), CreatedAt: time.Unix(100, 0).UTC(),
+				Status: models.StatusPendingVerification},
+		},
+		{
+			name:     "empty id",
+			mockCall: func() { mock.ExpectHGet("users", email).SetVal("") },
+			wantErr:  models.ErrNotFound("user"),
+		},
+		{
+			name:     "no entry for email",
+			mockCall: func() { mock.ExpectHGet("users", email).RedisNil() },
+			wantErr:  models.ErrNotFound("user"),
+		},
+		{
+			name: "record missing",
+			mockCall: func() {
+				mock.ExpectHGet("users", email).SetVal(id)
+				mock.ExpectHGetAll("user:" + id).SetVal(map[string]string{})
+				mock.ExpectSCard("passkeys:" + id).SetVal(0)
+			},
+			wantErr: models.ErrNotFound("user"),
+		},
+		{
+			name:     "redis error",
+			mockCall: func() { mock.ExpectHGet("users", email).SetErr(models.ErrDBNotConnected) },
+			wantErr:  models.ErrDBNotConnected,
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockCall()
+
+			got, err := s.GetUserByEmail(ctx, email)
+			assert.Equalf(t, tt.wantErr, err, "TEST[%d] Failed - %s", i, tt.name)
+			assert.Equalf(t, tt.want, got, "TEST[%d] Failed - %s", i, tt.name)
+		})
+	}
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestStore_UpdatePassword(t *testing.T) {
+	db, mock := redismock.NewClientMock()
+	s := New(db)
+	ctx := context.Background()
+	id := uuid.NewString()
+	hash := []byte(uuid.NewString())
+
+	tests := []struct {
+		name     string
+		mockCall func()
+		wantErr  error
+	}{
+		{
+			name: "valid case",
+			mockCall: func() {
+				mock.ExpectEvalSha(updateUserScript.Hash(), []string{"user:" + id}, "password", hash).SetVal(int64(1))
+			},
+		},
+		{
+			name: "unknown user",
+			mockCall: func() {
+				mock.ExpectEvalSha(updateUserScript.Hash(), []string{"user:" + id}, "password", hash).SetVal(int64(0))
+			},
+			wantErr: models.ErrNotFound("user"),
+		},
+		{
+			name: "redis error",
+			mockCall: func() {
+				mock.ExpectEvalSha(updateUserScript.Hash(), []string{"user:" + id}, "password", hash).SetErr(models.ErrDBNotConnected)
+			},
+			wantErr: models.ErrDBNotConnected,
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockCall()
+
+			assert.Equalf(t, tt.wantErr, s.UpdatePassword(ctx, id, hash), "TEST[%d] Failed - %s", i, tt.name)
+		})
+	}
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestStore_UpdateProfile(t *testing.T) {
+	db, mock := redismock.NewClientMock()
+	s := New(db)
+	ctx := context.Background()
+	user := &models.UserData{ID: uuid.NewString(), Name: "Sumit", Locale: "en", Metadata: map[string]string{"team": "auth"}}
+	at := time.Now()
+
+	mock.ExpectEvalSha(updateUserScript.Hash(), []string{"user:" + user.ID}, "name", "Sumit", "locale", "en", "metadata",
+		[]byte(`{"team":"auth"}`)).SetVal(int64(1))
+	mock.ExpectEvalSha(updateUserScript.Hash(), []string{"user:" + user.ID}, "last_login_at", at.Unix()).SetVal(int64(1))
+
+	assert.NoError(t, s.UpdateProfile(ctx, user))
+	assert.NoError(t, s.UpdateLastLogin(ctx, user.ID, at))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestStore_ChangeEmail(t *testing.T) {
+	db, mock := redismock.NewClientMock()
+	s := New(db)
+	ctx := context.Background()
+	id := uuid.NewString()
+	newEmail := "new@testmail.com"
+	keys := []string{"users", "user:" + id}
+
+	tests := []struct {
+		name     string
+		rename   bool
+		mockCall func()
+		wantErr  error
+	}{
+		{
+			name:     "valid case",
+			mockCall: func() { mock.ExpectEvalSha(changeEmailScript.Hash(), keys, newEmail, id, 1).SetVal(int64(1)) },
+		},
+		{
+			name:     "rename keeps the verification",
+			rename:   true,
+			mockCall: func() { mock.ExpectEvalSha(changeEmailScript.Hash(), keys, newEmail, id, 0).SetVal(int64(1)) },
+		},
+		{
+			name:     "new email taken",
+			mockCall: func() { mock.ExpectEvalSha(changeEmailScript.Hash(), keys, newEmail, id, 1).SetVal(int64(-1)) },
+			wantErr:  models.ErrUserAlreadyExists,
+		},
+		{
+			name:     "unknown user",
+			mockCall: func() { mock.ExpectEvalSha(changeEmailScript.Hash(), keys, newEmail, id, 1).SetVal(int64(0)) },
+			wantErr:  models.ErrNotFound("user"),
+		},
+		{
+			name: "redis error",
+			mockCall: func() {
+				mock.ExpectEvalSha(changeEmailScript.Hash(), keys, newEmail, id, 1).SetErr(models.ErrDBNotConnected)
+			},
+			wantErr: models.ErrDBNotConnected,
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockCall()
+
+			change := s.ChangeEmail
+			if tt.rename {
+				change = s.RenameEmail
+			}
+
+			assert.Equalf(t, tt.wantErr, change(ctx, id, newEmail), "TEST[%d] Failed - %s", i, tt.name)
+		})
+	}
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestStore_MarkUserVerified(t *testing.T) {
+	db, mock := redismock.NewClientMock()
+	s := New(db)
+	ctx := context.Background()
+	email := "dummy@testmail.com"
+	id := uuid.NewString()
+
+	mock.ExpectHGet("users", email).SetVal(id)
+	mock.ExpectHGetAll("user:" + id).SetVal(map[string]string{"id": id, "email": email})
+	mock.ExpectSCard("passkeys:" + id).SetVal(0)
+	mock.ExpectEvalSha(setVerifiedScript.Hash(), []string{"user:" + id}, 1).SetVal(int64(1))
+
+	assert.NoError(t, s.MarkUserVerified(ctx, email))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestStore_MFA(t *testing.T) {
+	db, mock := redismock.NewClientMock()
+	s := New(db)
+	ctx := context.Background()
+	id := uuid.NewString()
+
+	mock.ExpectEvalSha(updateUserScript.Hash(), []string{"user:" + id}, "totp_secret", "SECRET", "totp_enabled", 1, "totp_last_step",
+		int64(42)).SetVal(int64(1))
+	mock.ExpectTxPipeline()
+	mock.ExpectDel("recovery:" + id).SetVal(1)
+	mock.ExpectSAdd("recovery:"+id, "h1", "h2").SetVal(2)
+	mock.ExpectTxPipelineExec()
+	mock.ExpectSRem("recovery:"+id, "h1").SetVal(1)
+	mock.ExpectSRem("recovery:"+id, "h1").SetVal(0)
+
+	assert.NoError(t, s.SaveTOTP(ctx, id, &models.TOTP{Secret: "SECRET", Enabled: true, LastStep: 42}))
+	assert.NoError(t, s.SaveRecoveryCodes(ctx, id, []string{"h1", "h2"}))
+
+	ok, err := s.ConsumeRecoveryCode(ctx, id, "h1")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	ok, err = s.ConsumeRecoveryCode(ctx, id, "h1")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestStore_ListUsers(t *testing.T) {
+	db, mock := redismock.NewClientMock()
+	s := New(db)
+	ctx := context.Background()
+	first, second, gone := uuid.NewString(), uuid.NewString(), uuid.NewString()
+
+	tests := []struct {
+		name     string
+		query    *models.UserQuery
+		mockCall func()
+		want     *models.UserPage
+		wantErr  error
+	}{
+		{
+			name:  "scans until the page is full",
+			query: &models.UserQuery{EmailPrefix: "dummy*", Limit: 2},
+			mockCall: func() {
+				mock.ExpectHScan("users", 0, `dummy\**`, 2).SetVal([]string{"dummy*1@testmail.com", first}, 12)
+				mock.ExpectHScan("users", 12, `dummy\**`, 2).SetVal([]string{"dummy*2@testmail.com", second,
+					"dummy*3@testmail.com", gone}, 7)
+				mock.ExpectHGetAll("user:" + first).SetVal(map[string]string{"id": first, "email": "dummy*1@testmail.com",
+					"status": "active", "created_at": "100"})
+				mock.ExpectSCard("passkeys:" + first).SetVal(1)
+				mock.ExpectHGetAll("user:" + second).SetVal(map[string]string{"id": second, "email": "dummy*2@testmail.com",
+					"status": "disabled", "created_at": "100"})
+				mock.ExpectSCard("passkeys:" + second).SetVal(0)
+				mock.ExpectHGetAll("user:" + gone).SetVal(map[string]string{})
+				mock.ExpectSCard("passkeys:" + gone).SetVal(0)
+			},
+			want: &models.UserPage{Users: []models.UserData{
+				{ID: first, Email: "dummy*1@testmail.com", Password: []byte{}, Status: models.StatusActive, CreatedAt: time.Unix(100, 0).UTC(),
+					MFAEnabled: true},
+				{ID: second, Email: "dummy*2@testmail.com", Password: []byte{}, Status: models.StatusDisabled, CreatedAt: time.Unix(100, 0).UTC()},
+			}, NextCursor: "7"},
+		},
+		{
+			name:  "last page",
+			query: &models.UserQuery{Cursor: "7", Limit: 2},
+			mockCall: func() {
+				mock.ExpectHScan("users", 7, "*", 2).SetVal([]string{}, 0)
+			},
+			want: &models.UserPage{Users: []models.UserData{}},
+		},
+		{
+			name:     "invalid cursor",
+			query:    &models.UserQuery{Cursor: "abc", Limit: 2},
+			mockCall: func() {},
+			wantErr:  models.ErrInvalid("cursor"),
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockCall()
+
+			got, err := s.ListUsers(ctx, tt.query)
+
+			assert.Equalf(t, tt.wantErr, err, "TEST[%d] Failed - %s", i, tt.name)
+			assert.Equalf(t, tt.want, got, "TEST[%d] Failed - %s", i, tt.name)
+		})
+	}
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestStore_DeleteUser(t *testing.T) {
+	db, mock := redismock.NewClientMock()
+	s := New(db)
+	ctx := context.Background()
+	id := uuid.NewString()
+	keys := []string{"users", "user:" + id}
+
+	mock.ExpectSMembers("passkeys:" + id).SetVal([]string{"a"})
+	mock.ExpectEvalSha(deleteUserScript.Hash(), keys, id).SetVal(int64(1))
+	mock.ExpectDel("recovery:"+id, "password-history:"+id, "roles:"+id, "permissions:"+id, "passkeys:"+id, "passkey:a").SetVal(3)
+
+	mock.ExpectSMembers("passkeys:" + id).SetVal([]string{})
+	mock.ExpectEvalSha(deleteUserScript.Hash(), keys, id).SetVal(int64(0))
+
+	assert.NoError(t, s.DeleteUser(ctx, id))
+	assert.Equal(t, models.ErrNotFound("user"), s.DeleteUser(ctx, id))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestStore_SetStatus(t *testing.T) {
+	db, mock := redismock.NewClientMock()
+	s := New(db)
+	ctx := context.Background()
+	id := uuid.NewString()
+
+	mock.ExpectEvalSha(updateUserScript.Hash(), []string{"user:" + id}, "status", "disabled").SetVal(int64(1))
+	mock.ExpectEvalSha(updateUserScript.Hash(), []string{"user:" + id}, "status", "active").SetVal(int64(0))
+	mock.ExpectEvalSha(setVerifiedScript.Hash(), []string{"user:" + id}, 0).SetVal(int64(0))
+
+	assert.NoError(t, s.SetStatus(ctx, id, models.StatusDisabled))
+	assert.Equal(t, models.ErrNotFound("user"), s.SetStatus(ctx, id, models.StatusActive))
+	assert.Equal(t, models.ErrNotFound("user"), s.SetVerified(ctx, id, false))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func Test_userStatus(t *testing.T) {
+	tests := []struct {
+		name string
+		vals map[string]string
+		want models.UserStatus
+	}{
+		{name: "stored status", vals: map[string]string{"status": "locked", "verified": "1"}, want: models.StatusLocked},
+		{name: "disabled flag", vals: map[string]string{"disabled": "1", "verified": "1"}, want: models.StatusDisabled},
+		{name: "verified record", vals: map[string]string{"verified": "1"}, want: models.StatusActive},
+		{name: "unverified record", vals: map[string]string{"verified": "0"}, want: models.StatusPendingVerification},
+	}
+
+	for i, tt := range tests {
+		assert.Equalf(t, tt.want, userStatus(tt.vals), "TEST[%d] Failed - %s", i, tt.name)
+	}
+}
+
+func TestStore_PasswordHistory(t *testing.T) {
+	db, mock := redismock.NewClientMock()
+	s := New(db)
+	ctx := context.Background()
+	id := uuid.NewString()
+
+	mock.ExpectTxPipeline()
+	mock.ExpectLPush("password-history:"+id, []byte("hash-2")).SetVal(2)
+	mock.ExpectLTrim("password-history:"+id, 0, 4).SetVal("OK")
+	mock.ExpectTxPipelineExec()
+	mock.ExpectLRange("password-history:"+id, 0, -1).SetVal([]string{"hash-2", "hash-1"})
+
+	assert.NoError(t, s.AddPasswordHistory(ctx, id, []byte("hash-2"), 5))
+
+	got, err := s.GetPasswordHistory(ctx, id)
+	assert.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("hash-2"), []byte("hash-1")}, got)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}